@@ -0,0 +1,370 @@
+package main
+
+import mathbits "math/bits" // bits is the field extractor of compressed.go
+
+// BitManipulationInstructions holds the Zba, Zbb and Zbs instructions, they are merged into Instructions. ZEXT.H
+// is PACK rd, rs1, x0 in RV32 and PACKW rd, rs1, x0 in RV64 (see CryptoInstructions), ZEXT.W is ADD.UW rd, rs1, x0.
+var BitManipulationInstructions = map[[4]uint32]Instruction{
+	// Zba : address generation
+	// SH1ADD : Shift Left by 1 and Add
+	{0b0110011, 0b010, 0b0010000, 0}: {
+		"SH1ADD",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs2)+readRegister(cpu, rs1)<<1)
+		},
+	},
+	// SH2ADD : Shift Left by 2 and Add
+	{0b0110011, 0b100, 0b0010000, 0}: {
+		"SH2ADD",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs2)+readRegister(cpu, rs1)<<2)
+		},
+	},
+	// SH3ADD : Shift Left by 3 and Add
+	{0b0110011, 0b110, 0b0010000, 0}: {
+		"SH3ADD",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs2)+readRegister(cpu, rs1)<<3)
+		},
+	},
+	// ADD.UW : Add Unsigned Word
+	{0b0111011, 0b000, 0b0000100, 0}: rv64Instruction(Instruction{
+		"ADD.UW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs2)+uint64(uint32(readRegister(cpu, rs1))))
+		},
+	}),
+	// SH1ADD.UW : Shift Unsigned Word Left by 1 and Add
+	{0b0111011, 0b010, 0b0010000, 0}: rv64Instruction(Instruction{
+		"SH1ADD.UW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs2)+uint64(uint32(readRegister(cpu, rs1)))<<1)
+		},
+	}),
+	// SH2ADD.UW : Shift Unsigned Word Left by 2 and Add
+	{0b0111011, 0b100, 0b0010000, 0}: rv64Instruction(Instruction{
+		"SH2ADD.UW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs2)+uint64(uint32(readRegister(cpu, rs1)))<<2)
+		},
+	}),
+	// SH3ADD.UW : Shift Unsigned Word Left by 3 and Add
+	{0b0111011, 0b110, 0b0010000, 0}: rv64Instruction(Instruction{
+		"SH3ADD.UW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs2)+uint64(uint32(readRegister(cpu, rs1)))<<3)
+		},
+	}),
+	// SLLI.UW : Shift Left Unsigned Word Immediate (6-bit shamt, funct6 000010)
+	{0b0011011, 0b001, 0b0000100, 0}: rv64Instruction(Instruction{
+		"SLLI.UW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, shamt := args[0], args[1], args[2]
+			writeRegister(cpu, rd, uint64(uint32(readRegister(cpu, rs1)))<<shamt)
+		},
+	}),
+
+	// Zbb : basic bit manipulation
+	// ANDN : AND with inverted operand
+	{0b0110011, 0b111, 0b0100000, 0}: {
+		"ANDN",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs1)&^readRegister(cpu, rs2))
+		},
+	},
+	// ORN : OR with inverted operand
+	{0b0110011, 0b110, 0b0100000, 0}: {
+		"ORN",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs1)|^readRegister(cpu, rs2))
+		},
+	},
+	// XNOR : Exclusive NOR
+	{0b0110011, 0b100, 0b0100000, 0}: {
+		"XNOR",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, ^(readRegister(cpu, rs1) ^ readRegister(cpu, rs2)))
+		},
+	},
+	// CLZ : Count Leading Zeros
+	{0b0010011, 0b001, 0b0110000, 0b00000}: {
+		"CLZ",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			value := readUnsignedRegister(cpu, rs1)
+			writeRegister(cpu, rd, uint64(mathbits.LeadingZeros64(value)-(64-int(cpu.xlen))))
+		},
+	},
+	// CTZ : Count Trailing Zeros
+	{0b0010011, 0b001, 0b0110000, 0b00001}: {
+		"CTZ",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			value := readUnsignedRegister(cpu, rs1)
+			writeRegister(cpu, rd, uint64(min(mathbits.TrailingZeros64(value), int(cpu.xlen))))
+		},
+	},
+	// CPOP : Count Set Bits
+	{0b0010011, 0b001, 0b0110000, 0b00010}: {
+		"CPOP",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			writeRegister(cpu, rd, uint64(mathbits.OnesCount64(readUnsignedRegister(cpu, rs1))))
+		},
+	},
+	// CLZW : Count Leading Zeros in Word
+	{0b0011011, 0b001, 0b0110000, 0b00000}: rv64Instruction(Instruction{
+		"CLZW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			writeRegister(cpu, rd, uint64(mathbits.LeadingZeros32(uint32(readRegister(cpu, rs1)))))
+		},
+	}),
+	// CTZW : Count Trailing Zeros in Word
+	{0b0011011, 0b001, 0b0110000, 0b00001}: rv64Instruction(Instruction{
+		"CTZW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			writeRegister(cpu, rd, uint64(mathbits.TrailingZeros32(uint32(readRegister(cpu, rs1)))))
+		},
+	}),
+	// CPOPW : Count Set Bits in Word
+	{0b0011011, 0b001, 0b0110000, 0b00010}: rv64Instruction(Instruction{
+		"CPOPW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			writeRegister(cpu, rd, uint64(mathbits.OnesCount32(uint32(readRegister(cpu, rs1)))))
+		},
+	}),
+	// SEXT.B : Sign-Extend Byte
+	{0b0010011, 0b001, 0b0110000, 0b00100}: {
+		"SEXT.B",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			writeRegister(cpu, rd, uint64(int8(readRegister(cpu, rs1))))
+		},
+	},
+	// SEXT.H : Sign-Extend Halfword
+	{0b0010011, 0b001, 0b0110000, 0b00101}: {
+		"SEXT.H",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			writeRegister(cpu, rd, uint64(int16(readRegister(cpu, rs1))))
+		},
+	},
+	// MAX : Maximum
+	{0b0110011, 0b110, 0b0000101, 0}: {
+		"MAX",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			a, b := readRegister(cpu, rs1), readRegister(cpu, rs2)
+			if int64(a) < int64(b) {
+				a = b
+			}
+			writeRegister(cpu, rd, a)
+		},
+	},
+	// MAXU : Maximum Unsigned
+	{0b0110011, 0b111, 0b0000101, 0}: {
+		"MAXU",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			a, b := readRegister(cpu, rs1), readRegister(cpu, rs2)
+			if a < b {
+				a = b
+			}
+			writeRegister(cpu, rd, a)
+		},
+	},
+	// MIN : Minimum
+	{0b0110011, 0b100, 0b0000101, 0}: {
+		"MIN",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			a, b := readRegister(cpu, rs1), readRegister(cpu, rs2)
+			if int64(b) < int64(a) {
+				a = b
+			}
+			writeRegister(cpu, rd, a)
+		},
+	},
+	// MINU : Minimum Unsigned
+	{0b0110011, 0b101, 0b0000101, 0}: {
+		"MINU",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			a, b := readRegister(cpu, rs1), readRegister(cpu, rs2)
+			if b < a {
+				a = b
+			}
+			writeRegister(cpu, rd, a)
+		},
+	},
+	// ORC.B : Bitwise OR-Combine, Byte Granule (each byte becomes 0x00 or 0xFF)
+	{0b0010011, 0b101, 0b0010100, 0b00111}: {
+		"ORC.B",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			value := readRegister(cpu, rs1)
+			result := uint64(0)
+			for shift := 0; shift < int(cpu.xlen); shift += 8 {
+				if (value>>shift)&0xFF != 0 {
+					result |= 0xFF << shift
+				}
+			}
+			writeRegister(cpu, rd, result)
+		},
+	},
+	// REV8 : Byte-Reverse Register
+	{0b0010011, 0b101, 0b0110100, 0b11000}: {
+		"REV8",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			if cpu.xlen != 32 {
+				raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction)) // RV64 encodes REV8 with rs2 = 56
+				return
+			}
+			writeRegister(cpu, rd, uint64(mathbits.ReverseBytes32(uint32(readRegister(cpu, rs1)))))
+		},
+	},
+	// ROL : Rotate Left
+	{0b0110011, 0b001, 0b0110000, 0}: {
+		"ROL",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, rotateLeft(cpu, readRegister(cpu, rs1), int(shiftAmount(cpu, readRegister(cpu, rs2)))))
+		},
+	},
+	// ROR : Rotate Right
+	{0b0110011, 0b101, 0b0110000, 0}: {
+		"ROR",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, rotateLeft(cpu, readRegister(cpu, rs1), -int(shiftAmount(cpu, readRegister(cpu, rs2)))))
+		},
+	},
+	// RORI : Rotate Right Immediate
+	{0b0010011, 0b101, 0b0110000, 0}: {
+		"RORI",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, shamt := args[0], args[1], args[2]
+			writeRegister(cpu, rd, rotateLeft(cpu, readRegister(cpu, rs1), -int(shamt)))
+		},
+	},
+	// ROLW : Rotate Left Word
+	{0b0111011, 0b001, 0b0110000, 0}: rv64Instruction(Instruction{
+		"ROLW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			amount := int(readRegister(cpu, rs2) & 0x1F)
+			writeRegister(cpu, rd, signExtendWord(uint64(mathbits.RotateLeft32(uint32(readRegister(cpu, rs1)), amount))))
+		},
+	}),
+	// RORW : Rotate Right Word
+	{0b0111011, 0b101, 0b0110000, 0}: rv64Instruction(Instruction{
+		"RORW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			amount := int(readRegister(cpu, rs2) & 0x1F)
+			writeRegister(cpu, rd, signExtendWord(uint64(mathbits.RotateLeft32(uint32(readRegister(cpu, rs1)), -amount))))
+		},
+	}),
+	// RORIW : Rotate Right Word Immediate
+	{0b0011011, 0b101, 0b0110000, 0}: rv64Instruction(Instruction{
+		"RORIW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, shamt := args[0], args[1], args[2]
+			writeRegister(cpu, rd, signExtendWord(uint64(mathbits.RotateLeft32(uint32(readRegister(cpu, rs1)), -int(shamt)))))
+		},
+	}),
+
+	// Zbs : single-bit instructions
+	// BCLR : Single-Bit Clear
+	{0b0110011, 0b001, 0b0100100, 0}: {
+		"BCLR",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs1)&^(1<<shiftAmount(cpu, readRegister(cpu, rs2))))
+		},
+	},
+	// BCLRI : Single-Bit Clear Immediate
+	{0b0010011, 0b001, 0b0100100, 0}: {
+		"BCLRI",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, shamt := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs1)&^(1<<shamt))
+		},
+	},
+	// BEXT : Single-Bit Extract
+	{0b0110011, 0b101, 0b0100100, 0}: {
+		"BEXT",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, (readRegister(cpu, rs1)>>shiftAmount(cpu, readRegister(cpu, rs2)))&1)
+		},
+	},
+	// BEXTI : Single-Bit Extract Immediate
+	{0b0010011, 0b101, 0b0100100, 0}: {
+		"BEXTI",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, shamt := args[0], args[1], args[2]
+			writeRegister(cpu, rd, (readRegister(cpu, rs1)>>shamt)&1)
+		},
+	},
+	// BINV : Single-Bit Invert
+	{0b0110011, 0b001, 0b0110100, 0}: {
+		"BINV",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs1)^(1<<shiftAmount(cpu, readRegister(cpu, rs2))))
+		},
+	},
+	// BINVI : Single-Bit Invert Immediate
+	{0b0010011, 0b001, 0b0110100, 0}: {
+		"BINVI",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, shamt := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs1)^(1<<shamt))
+		},
+	},
+	// BSET : Single-Bit Set
+	{0b0110011, 0b001, 0b0010100, 0}: {
+		"BSET",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs1)|(1<<shiftAmount(cpu, readRegister(cpu, rs2))))
+		},
+	},
+	// BSETI : Single-Bit Set Immediate
+	{0b0010011, 0b001, 0b0010100, 0}: {
+		"BSETI",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, shamt := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs1)|(1<<shamt))
+		},
+	},
+}
+
+// rotateLeft rotates value left by amount bits (right when negative) within XLEN.
+func rotateLeft(cpu *CPUState, value uint64, amount int) uint64 {
+	if cpu.xlen == 32 {
+		return uint64(mathbits.RotateLeft32(uint32(value), amount))
+	}
+	return mathbits.RotateLeft64(value, amount)
+}
+
+func init() {
+	for key, instruction := range BitManipulationInstructions {
+		Instructions[key] = instruction
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBitManipulationInstructions(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	op := func(funct7, funct3 uint32) uint32 { // OP x3, x1, x2
+		return assembleR(0b0110011, 3, funct3, 1, 2, funct7)
+	}
+	opImm := func(funct3, imm uint32) uint32 { // OP-IMM x3, x1, imm
+		return assembleI(0b0010011, 3, funct3, 1, imm)
+	}
+
+	tests := []struct {
+		name         string
+		instruction  uint32
+		rs1, rs2     uint32
+		expected     uint32
+		expectedTrap bool
+	}{
+		// Zba
+		{"SH1ADD", op(0b0010000, 0b010), 0x10, 0x100, 0x120, false},
+		{"SH2ADD", op(0b0010000, 0b100), 0x10, 0x100, 0x140, false},
+		{"SH3ADD", op(0b0010000, 0b110), 0x10, 0x100, 0x180, false},
+		// Zbb
+		{"ANDN", op(0b0100000, 0b111), 0xFF, 0x0F, 0xF0, false},
+		{"ORN", op(0b0100000, 0b110), 0, 0xFFFFFFF0, 0xF, false},
+		{"XNOR", op(0b0100000, 0b100), 0xFF, 0x0F, 0xFFFFFF0F, false},
+		{"CLZ", opImm(0b001, 0x600), 0x00010000, 0, 15, false},
+		{"CLZ of 0", opImm(0b001, 0x600), 0, 0, 32, false},
+		{"CTZ", opImm(0b001, 0x601), 0x00010000, 0, 16, false},
+		{"CPOP", opImm(0b001, 0x602), 0xF0F0F0F0, 0, 16, false},
+		{"SEXT.B", opImm(0b001, 0x604), 0x1234FF80, 0, 0xFFFFFF80, false},
+		{"SEXT.H", opImm(0b001, 0x605), 0x12348000, 0, 0xFFFF8000, false},
+		{"ZEXT.H", assembleR(0b0110011, 3, 0b100, 1, 0, 0b0000100), 0xFFFF8000, 0, 0x8000, false},
+		{"MAX", op(0b0000101, 0b110), 0xFFFFFFFF, 1, 1, false},
+		{"MAXU", op(0b0000101, 0b111), 0xFFFFFFFF, 1, 0xFFFFFFFF, false},
+		{"MIN", op(0b0000101, 0b100), 0xFFFFFFFF, 1, 0xFFFFFFFF, false},
+		{"MINU", op(0b0000101, 0b101), 0xFFFFFFFF, 1, 1, false},
+		{"ORC.B", opImm(0b101, 0x287), 0x00100001, 0, 0x00FF00FF, false},
+		{"REV8", opImm(0b101, 0x698), 0x12345678, 0, 0x78563412, false},
+		{"ROL", op(0b0110000, 0b001), 0x80000001, 33, 0x00000003, false},
+		{"ROR", op(0b0110000, 0b101), 0x00000003, 1, 0x80000001, false},
+		{"RORI", opImm(0b101, 0x600|8), 0x12345678, 0, 0x78123456, false},
+		// Zbs
+		{"BSET", op(0b0010100, 0b001), 0, 31, 0x80000000, false},
+		{"BSETI", opImm(0b001, 0x280|4), 0x1, 0, 0x11, false},
+		{"BCLR", op(0b0100100, 0b001), 0xFF, 32, 0xFE, false},
+		{"BCLRI", opImm(0b001, 0x480|7), 0xFF, 0, 0x7F, false},
+		{"BINV", op(0b0110100, 0b001), 0x1, 0, 0, false},
+		{"BINVI", opImm(0b001, 0x680|1), 0x1, 0, 0x3, false},
+		{"BEXT", op(0b0100100, 0b101), 0x8, 35, 1, false},
+		{"BEXTI", opImm(0b101, 0x480|2), 0x8, 0, 0, false},
+		// The base shifts share the OP-IMM key space
+		{"SLLI", opImm(0b001, 4), 0x1, 0, 0x10, false},
+		{"SRAI", opImm(0b101, 0x400|4), 0x80000000, 0, 0xF8000000, false},
+		// Unallocated rs2 values of the unary operations
+		{"CLZ group with rs2 = 3", opImm(0b001, 0x603), 0x1, 0, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initMemory(&memory, 64, 0)
+			initCPUState(&cpu, 0, 0)
+			cpu.csr[csrMtvec] = 0x20
+
+			memory.Store32(0, test.instruction)
+			writeRegister(&cpu, 1, uint64(test.rs1))
+			writeRegister(&cpu, 2, uint64(test.rs2))
+
+			executeInstruction(&cpu, &memory)
+
+			if test.expectedTrap {
+				if cpu.pc != 0x20 || cpu.csr[csrMcause] != causeIllegalInstruction {
+					t.Errorf("expected an illegal instruction trap, got pc=0x%x mcause=%d", cpu.pc, cpu.csr[csrMcause])
+				}
+				return
+			}
+			if cpu.pc != 4 {
+				t.Errorf("expected pc=0x4, got pc=0x%x mcause=%d", cpu.pc, cpu.csr[csrMcause])
+			}
+			if uint32(cpu.x[3]) != test.expected {
+				t.Errorf("expected x3=0x%x, got x3=0x%x", test.expected, cpu.x[3])
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+// Memory map of the CLINT (core-local interruptor), at the address used by most RISC-V platforms
+const (
+	clintBase     = 0x02000000
+	clintSize     = 0x10000
+	clintMsip     = 0x0000 // Machine software interrupt pending, only bit 0 is implemented
+	clintMtimecmp = 0x4000 // 64-bit, a machine timer interrupt is pending while mtime >= mtimecmp
+	clintMtime    = 0xBFF8 // 64-bit, the same counter as the time CSR
+)
+
+// CLINT holds the memory-mapped timer and software interrupt registers of the hart. mtime is not stored: it is
+// the time counter of the hart (see readTime), so it advances with the executed instructions.
+type CLINT struct {
+	cpu      *CPUState
+	msip     uint32
+	mtimecmp uint64
+}
+
+// newCLINT returns the CLINT of a hart, no timer interrupt is pending until the guest programs mtimecmp.
+func newCLINT(cpu *CPUState) *CLINT {
+	return &CLINT{cpu: cpu, mtimecmp: ^uint64(0)}
+}
+
+// attachCLINT maps the registers of a CLINT at clintBase and lets handleInterrupts sample it.
+func attachCLINT(memory *Memory, clint *CLINT) error {
+	memory.clint = clint
+	return memory.Map(Region{name: "clint", base: clintBase, size: clintSize, device: clint})
+}
+
+// Read returns the size bytes of the CLINT registers at a byte offset.
+func (clint *CLINT) Read(offset uint32, size uint32) uint32 {
+	return readCLINT(clint, offset) >> ((offset % 4) * 8)
+}
+
+// Write writes the size bytes of the CLINT registers at a byte offset, leaving the rest of the register untouched.
+func (clint *CLINT) Write(offset uint32, size uint32, value uint32) {
+	shift := (offset % 4) * 8
+	writeCLINT(clint, offset, value<<shift, uint32(1<<(8*size)-1)<<shift)
+}
+
+// readCLINT returns the word of the CLINT registers at a byte offset, unimplemented words read as zero.
+func readCLINT(clint *CLINT, offset uint32) uint32 {
+	switch offset &^ 3 {
+	case clintMsip:
+		return clint.msip
+	case clintMtimecmp:
+		return uint32(clint.mtimecmp)
+	case clintMtimecmp + 4:
+		return uint32(clint.mtimecmp >> 32)
+	case clintMtime:
+		return uint32(readTime(clint.cpu))
+	case clintMtime + 4:
+		return uint32(readTime(clint.cpu) >> 32)
+	}
+	return 0
+}
+
+// writeCLINT writes the bits of mask in the word of the CLINT registers at a byte offset, so that byte and
+// halfword stores only modify their part of the register.
+func writeCLINT(clint *CLINT, offset uint32, value uint32, mask uint32) {
+	word := readCLINT(clint, offset)&^mask | value&mask
+	switch offset &^ 3 {
+	case clintMsip:
+		clint.msip = word & 1
+	case clintMtimecmp:
+		clint.mtimecmp = clint.mtimecmp&^0xFFFFFFFF | uint64(word)
+	case clintMtimecmp + 4:
+		clint.mtimecmp = clint.mtimecmp&0xFFFFFFFF | uint64(word)<<32
+	case clintMtime:
+		setTime(clint.cpu, readTime(clint.cpu)&^0xFFFFFFFF|uint64(word))
+	case clintMtime + 4:
+		setTime(clint.cpu, readTime(clint.cpu)&0xFFFFFFFF|uint64(word)<<32)
+	}
+}
+
+// updateCLINTInterrupts drives mip.MSIP and mip.MTIP from the CLINT registers.
+func updateCLINTInterrupts(cpu *CPUState, clint *CLINT) {
+	mip := cpu.csr[csrMip] &^ (mipMSIP | mipMTIP)
+	if clint.msip&1 != 0 {
+		mip |= mipMSIP
+	}
+	if readTime(cpu) >= clint.mtimecmp {
+		mip |= mipMTIP
+	}
+	cpu.csr[csrMip] = mip
+}
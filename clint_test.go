@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCLINTRegisters(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initMemory(&memory, 256, 0)
+	initCPUState(&cpu, 0, 0)
+	attachCLINT(&memory, newCLINT(&cpu))
+	cpu.ticks, cpu.csr[csrMcycle] = 1000, 1000
+
+	memory.Store32(clintBase+clintMtimecmp, 0x89ABCDEF)
+	memory.Store32(clintBase+clintMtimecmp+4, 0x01234567)
+	memory.Store16(clintBase+clintMtimecmp+2, 0x1111)
+	if memory.clint.mtimecmp != 0x012345671111CDEF { // Stores only write their part of the register
+		t.Errorf("expected mtimecmp=0x012345671111cdef, got 0x%x", memory.clint.mtimecmp)
+	}
+
+	memory.Store8(clintBase+clintMsip, 0xFF)
+	if memory.Load32(clintBase+clintMsip) != 1 {
+		t.Errorf("expected msip=1, got 0x%x", memory.Load32(clintBase+clintMsip))
+	}
+
+	if mtime := memory.Load32(clintBase + clintMtime); mtime != 100 {
+		t.Errorf("expected mtime to follow the cycle counter (100), got %d", mtime)
+	}
+	memory.Store32(clintBase+clintMtime+4, 0x2)
+	if value := CSRs[csrTime].Read(&cpu); value != 0x200000064 {
+		t.Errorf("expected writing mtime to change the time CSR to 0x200000064, got 0x%x", value)
+	}
+	if cpu.csr[csrMcycle] != 1000 {
+		t.Errorf("expected writing mtime to leave mcycle untouched, got %d", cpu.csr[csrMcycle])
+	}
+
+	if !isPhysicalAccessValid(&memory, clintBase+clintMtime, 8, accessLoad) || isPhysicalAccessValid(&memory, clintBase+clintSize, 4, accessLoad) {
+		t.Errorf("expected only the CLINT range to be accessible")
+	}
+}
+
+func TestInterrupts(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	tests := []struct {
+		name          string
+		privilege     uint64
+		mstatus       uint64
+		mie           uint64
+		mip           uint64
+		mideleg       uint64
+		msip          uint32
+		mtimecmp      uint64
+		expectedCause uint64 // 0 when no interrupt is taken
+		expectedMode  uint64
+	}{
+		{"Timer interrupt", privilegeMachine, mstatusMIE, mipMTIP, 0, 0, 0, 10, 7, privilegeMachine},
+		{"Timer not expired", privilegeMachine, mstatusMIE, mipMTIP, 0, 0, 0, 1000, 0, privilegeMachine},
+		{"Timer disabled in mie", privilegeMachine, mstatusMIE, 0, 0, 0, 0, 10, 0, privilegeMachine},
+		{"Software interrupt masked by MIE", privilegeMachine, 0, mipMSIP, 0, 0, 1, ^uint64(0), 0, privilegeMachine},
+		{"Software interrupt from U-mode ignores MIE", privilegeUser, 0, mipMSIP, 0, 0, 1, ^uint64(0), 3,
+			privilegeMachine},
+		{"Software before timer", privilegeMachine, mstatusMIE, mipMSIP | mipMTIP, 0, 0, 1, 10, 3, privilegeMachine},
+		{"Delegated interrupt to S-mode", privilegeSupervisor, mstatusSIE, mipSTIP, mipSTIP, mipSTIP, 0, ^uint64(0), 5,
+			privilegeSupervisor},
+		{"Delegated interrupt masked by SIE", privilegeSupervisor, 0, mipSTIP, mipSTIP, mipSTIP, 0, ^uint64(0), 0,
+			privilegeSupervisor},
+		{"Delegated interrupt is not taken in M-mode", privilegeMachine, mstatusMIE | mstatusSIE, mipSTIP, mipSTIP,
+			mipSTIP, 0, ^uint64(0), 0, privilegeMachine},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initMemory(&memory, 256, 0)
+			initCPUState(&cpu, 0x10, 0)
+			attachCLINT(&memory, newCLINT(&cpu))
+			memory.clint.msip = test.msip
+			memory.clint.mtimecmp = test.mtimecmp
+			cpu.ticks = 100 * cpuFrequency / timeFrequency // time = 100
+			cpu.privilege = test.privilege
+			cpu.csr[csrMstatus] = test.mstatus
+			cpu.csr[csrMie] = test.mie
+			cpu.csr[csrMip] = test.mip
+			cpu.csr[csrMideleg] = test.mideleg
+			cpu.csr[csrMtvec] = 0x80
+			cpu.csr[csrStvec] = 0xC0
+
+			handleInterrupts(&cpu, &memory)
+
+			if test.expectedCause == 0 {
+				if cpu.pc != 0x10 {
+					t.Errorf("expected no interrupt, got pc=0x%x mcause=0x%x", cpu.pc, cpu.csr[csrMcause])
+				}
+				return
+			}
+			cause, epc := cpu.csr[csrMcause], cpu.csr[csrMepc]
+			if test.expectedMode == privilegeSupervisor {
+				cause, epc = cpu.csr[csrScause], cpu.csr[csrSepc]
+			}
+			if cause != 1<<31|test.expectedCause || epc != 0x10 || cpu.privilege != test.expectedMode {
+				t.Errorf("expected interrupt %d in mode %d, got cause=0x%x epc=0x%x in mode %d", test.expectedCause,
+					test.expectedMode, cause, epc, cpu.privilege)
+			}
+		})
+	}
+}
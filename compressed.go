@@ -0,0 +1,255 @@
+package main
+
+import "fmt"
+
+// isCompressed reports whether the low parcel of an instruction is a 16-bit RVC instruction.
+// Standard 32-bit instructions always have their two lowest bits set to 0b11.
+func isCompressed(parcel uint32) bool {
+	return parcel&0b11 != 0b11
+}
+
+func assembleR(opcode, rd, funct3, rs1, rs2, funct7 uint32) uint32 {
+	return funct7<<25 | rs2<<20 | rs1<<15 | funct3<<12 | rd<<7 | opcode
+}
+
+func assembleI(opcode, rd, funct3, rs1, imm uint32) uint32 {
+	return (imm&0xFFF)<<20 | rs1<<15 | funct3<<12 | rd<<7 | opcode
+}
+
+func assembleS(opcode, funct3, rs1, rs2, imm uint32) uint32 {
+	return ((imm>>5)&0x7F)<<25 | rs2<<20 | rs1<<15 | funct3<<12 | (imm&0x1F)<<7 | opcode
+}
+
+func assembleB(funct3, rs1, rs2, imm uint32) uint32 {
+	return ((imm>>12)&0x1)<<31 | ((imm>>5)&0x3F)<<25 | rs2<<20 | rs1<<15 | funct3<<12 |
+		((imm>>1)&0xF)<<8 | ((imm>>11)&0x1)<<7 | 0b1100011
+}
+
+func assembleU(opcode, rd, imm uint32) uint32 {
+	return (imm&0xFFFFF)<<12 | rd<<7 | opcode
+}
+
+func assembleJ(rd, imm uint32) uint32 {
+	return ((imm>>20)&0x1)<<31 | ((imm>>1)&0x3FF)<<21 | ((imm>>11)&0x1)<<20 | ((imm>>12)&0xFF)<<12 | rd<<7 | 0b1101111
+}
+
+// signExtend sign-extends the lowest `bits` bits of value.
+func signExtend(value uint32, bits uint32) uint32 {
+	shift := 32 - bits
+	return uint32(int32(value<<shift) >> shift)
+}
+
+// bit extracts instruction[pos] and places it at position `to`.
+func bit(instruction uint32, pos uint32, to uint32) uint32 {
+	return ((instruction >> pos) & 0x1) << to
+}
+
+// bits extracts instruction[hi:lo] and places it starting at position `to`.
+func bits(instruction uint32, hi uint32, lo uint32, to uint32) uint32 {
+	return ((instruction >> lo) & (1<<(hi-lo+1) - 1)) << to
+}
+
+// expandCompressed translates a 16-bit RVC instruction into its 32-bit equivalent. A few encodings depend on XLEN:
+// RV64C replaces C.FLW/C.FSW/C.FLWSP/C.FSWSP with their doubleword integer counterparts and C.JAL with C.ADDIW.
+func expandCompressed(instruction uint32, xlen uint32) (uint32, error) {
+	instruction &= 0xFFFF
+	quadrant := instruction & 0b11
+	funct3 := (instruction >> 13) & 0x7
+
+	// Full register fields [11:7] and [6:2], and the x8-x15 register fields [9:7] and [4:2]
+	rd := (instruction >> 7) & 0x1F
+	rs2 := (instruction >> 2) & 0x1F
+	rdPrime := 8 + (instruction>>7)&0x7
+	rs2Prime := 8 + (instruction>>2)&0x7
+
+	// CI-format 6-bit immediate imm[5] = [12], imm[4:0] = [6:2]
+	ciImm := signExtend(bit(instruction, 12, 5)|bits(instruction, 6, 2, 0), 6)
+
+	// Shift amount shamt[5] = [12], shamt[4:0] = [6:2], shamt[5] must be zero on RV32C
+	shamt := ciImm & 0x3F
+	shamtValid := xlen == 64 || shamt < 32
+
+	illegal := fmt.Errorf("illegal compressed instruction %04x", instruction)
+
+	switch quadrant {
+	case 0b00:
+		// C.LW / C.SW offset : uimm[5:3] = [12:10], uimm[2] = [6], uimm[6] = [5]
+		wordOffset := bits(instruction, 12, 10, 3) | bit(instruction, 6, 2) | bit(instruction, 5, 6)
+		// C.FLD / C.FSD offset : uimm[5:3] = [12:10], uimm[7:6] = [6:5]
+		doubleOffset := bits(instruction, 12, 10, 3) | bits(instruction, 6, 5, 6)
+
+		switch funct3 {
+		case 0b000: // C.ADDI4SPN : addi rd', x2, nzuimm
+			nzuimm := bits(instruction, 12, 11, 4) | bits(instruction, 10, 7, 6) | bit(instruction, 6, 2) | bit(instruction, 5, 3)
+			if nzuimm == 0 {
+				return 0, illegal
+			}
+			return assembleI(0b0010011, rs2Prime, 0b000, 2, nzuimm), nil
+		case 0b001: // C.FLD : fld rd', offset(rs1')
+			return assembleI(0b0000111, rs2Prime, 0b011, rdPrime, doubleOffset), nil
+		case 0b010: // C.LW : lw rd', offset(rs1')
+			return assembleI(0b0000011, rs2Prime, 0b010, rdPrime, wordOffset), nil
+		case 0b011:
+			if xlen == 64 { // C.LD : ld rd', offset(rs1')
+				return assembleI(0b0000011, rs2Prime, 0b011, rdPrime, doubleOffset), nil
+			}
+			// C.FLW : flw rd', offset(rs1')
+			return assembleI(0b0000111, rs2Prime, 0b010, rdPrime, wordOffset), nil
+		case 0b101: // C.FSD : fsd rs2', offset(rs1')
+			return assembleS(0b0100111, 0b011, rdPrime, rs2Prime, doubleOffset), nil
+		case 0b110: // C.SW : sw rs2', offset(rs1')
+			return assembleS(0b0100011, 0b010, rdPrime, rs2Prime, wordOffset), nil
+		case 0b111:
+			if xlen == 64 { // C.SD : sd rs2', offset(rs1')
+				return assembleS(0b0100011, 0b011, rdPrime, rs2Prime, doubleOffset), nil
+			}
+			// C.FSW : fsw rs2', offset(rs1')
+			return assembleS(0b0100111, 0b010, rdPrime, rs2Prime, wordOffset), nil
+		}
+	case 0b01:
+		// CJ-format offset[11|4|9:8|10|6|7|3:1|5] = [12:2]
+		jumpOffset := signExtend(bit(instruction, 12, 11)|bit(instruction, 11, 4)|bits(instruction, 10, 9, 8)|
+			bit(instruction, 8, 10)|bit(instruction, 7, 6)|bit(instruction, 6, 7)|bits(instruction, 5, 3, 1)|
+			bit(instruction, 2, 5), 12)
+		// CB-format offset[8|4:3] = [12:10], offset[7:6|2:1|5] = [6:2]
+		branchOffset := signExtend(bit(instruction, 12, 8)|bits(instruction, 11, 10, 3)|bits(instruction, 6, 5, 6)|
+			bits(instruction, 4, 3, 1)|bit(instruction, 2, 5), 9)
+
+		switch funct3 {
+		case 0b000: // C.ADDI (C.NOP when rd = x0) : addi rd, rd, imm
+			return assembleI(0b0010011, rd, 0b000, rd, ciImm), nil
+		case 0b001:
+			if xlen == 64 { // C.ADDIW : addiw rd, rd, imm
+				if rd == 0 {
+					return 0, illegal
+				}
+				return assembleI(0b0011011, rd, 0b000, rd, ciImm), nil
+			}
+			// C.JAL : jal x1, offset
+			return assembleJ(1, jumpOffset), nil
+		case 0b010: // C.LI : addi rd, x0, imm
+			return assembleI(0b0010011, rd, 0b000, 0, ciImm), nil
+		case 0b011:
+			if rd == 2 { // C.ADDI16SP : addi x2, x2, nzimm
+				nzimm := signExtend(bit(instruction, 12, 9)|bit(instruction, 6, 4)|bit(instruction, 5, 6)|
+					bits(instruction, 4, 3, 7)|bit(instruction, 2, 5), 10)
+				if nzimm == 0 {
+					return 0, illegal
+				}
+				return assembleI(0b0010011, 2, 0b000, 2, nzimm), nil
+			}
+			// C.LUI : lui rd, nzimm
+			if ciImm == 0 {
+				return 0, illegal
+			}
+			return assembleU(0b0110111, rd, ciImm), nil
+		case 0b100:
+			switch (instruction >> 10) & 0b11 {
+			case 0b00: // C.SRLI : srli rd', rd', shamt
+				if !shamtValid {
+					return 0, illegal
+				}
+				return assembleI(0b0010011, rdPrime, 0b101, rdPrime, shamt), nil
+			case 0b01: // C.SRAI : srai rd', rd', shamt
+				if !shamtValid {
+					return 0, illegal
+				}
+				return assembleI(0b0010011, rdPrime, 0b101, rdPrime, 0b0100000<<5|shamt), nil
+			case 0b10: // C.ANDI : andi rd', rd', imm
+				return assembleI(0b0010011, rdPrime, 0b111, rdPrime, ciImm), nil
+			case 0b11:
+				if bit(instruction, 12, 0) != 0 {
+					if xlen != 64 {
+						return 0, illegal // C.SUBW / C.ADDW are RV64C only
+					}
+					switch (instruction >> 5) & 0b11 {
+					case 0b00: // C.SUBW
+						return assembleR(0b0111011, rdPrime, 0b000, rdPrime, rs2Prime, 0b0100000), nil
+					case 0b01: // C.ADDW
+						return assembleR(0b0111011, rdPrime, 0b000, rdPrime, rs2Prime, 0), nil
+					}
+					return 0, illegal
+				}
+				switch (instruction >> 5) & 0b11 {
+				case 0b00: // C.SUB
+					return assembleR(0b0110011, rdPrime, 0b000, rdPrime, rs2Prime, 0b0100000), nil
+				case 0b01: // C.XOR
+					return assembleR(0b0110011, rdPrime, 0b100, rdPrime, rs2Prime, 0), nil
+				case 0b10: // C.OR
+					return assembleR(0b0110011, rdPrime, 0b110, rdPrime, rs2Prime, 0), nil
+				case 0b11: // C.AND
+					return assembleR(0b0110011, rdPrime, 0b111, rdPrime, rs2Prime, 0), nil
+				}
+			}
+		case 0b101: // C.J : jal x0, offset
+			return assembleJ(0, jumpOffset), nil
+		case 0b110: // C.BEQZ : beq rs1', x0, offset
+			return assembleB(0b000, rdPrime, 0, branchOffset), nil
+		case 0b111: // C.BNEZ : bne rs1', x0, offset
+			return assembleB(0b001, rdPrime, 0, branchOffset), nil
+		}
+	case 0b10:
+		// C.LWSP offset : uimm[5] = [12], uimm[4:2|7:6] = [6:2]
+		lwspOffset := bit(instruction, 12, 5) | bits(instruction, 6, 4, 2) | bits(instruction, 3, 2, 6)
+		// C.FLDSP offset : uimm[5] = [12], uimm[4:3|8:6] = [6:2]
+		fldspOffset := bit(instruction, 12, 5) | bits(instruction, 6, 5, 3) | bits(instruction, 4, 2, 6)
+		// C.SWSP offset : uimm[5:2|7:6] = [12:7]
+		swspOffset := bits(instruction, 12, 9, 2) | bits(instruction, 8, 7, 6)
+		// C.FSDSP offset : uimm[5:3|8:6] = [12:7]
+		fsdspOffset := bits(instruction, 12, 10, 3) | bits(instruction, 9, 7, 6)
+
+		switch funct3 {
+		case 0b000: // C.SLLI : slli rd, rd, shamt
+			if !shamtValid {
+				return 0, illegal
+			}
+			return assembleI(0b0010011, rd, 0b001, rd, shamt), nil
+		case 0b001: // C.FLDSP : fld rd, offset(x2)
+			return assembleI(0b0000111, rd, 0b011, 2, fldspOffset), nil
+		case 0b010: // C.LWSP : lw rd, offset(x2)
+			if rd == 0 {
+				return 0, illegal
+			}
+			return assembleI(0b0000011, rd, 0b010, 2, lwspOffset), nil
+		case 0b011:
+			if xlen == 64 { // C.LDSP : ld rd, offset(x2)
+				if rd == 0 {
+					return 0, illegal
+				}
+				return assembleI(0b0000011, rd, 0b011, 2, fldspOffset), nil
+			}
+			// C.FLWSP : flw rd, offset(x2)
+			return assembleI(0b0000111, rd, 0b010, 2, lwspOffset), nil
+		case 0b100:
+			if bit(instruction, 12, 0) == 0 {
+				if rs2 == 0 { // C.JR : jalr x0, 0(rs1)
+					if rd == 0 {
+						return 0, illegal
+					}
+					return assembleI(0b1100111, 0, 0b000, rd, 0), nil
+				}
+				// C.MV : add rd, x0, rs2
+				return assembleR(0b0110011, rd, 0b000, 0, rs2, 0), nil
+			}
+			if rd == 0 && rs2 == 0 { // C.EBREAK
+				return assembleI(0b1110011, 0, 0b000, 0, 1), nil
+			}
+			if rs2 == 0 { // C.JALR : jalr x1, 0(rs1)
+				return assembleI(0b1100111, 1, 0b000, rd, 0), nil
+			}
+			// C.ADD : add rd, rd, rs2
+			return assembleR(0b0110011, rd, 0b000, rd, rs2, 0), nil
+		case 0b101: // C.FSDSP : fsd rs2, offset(x2)
+			return assembleS(0b0100111, 0b011, 2, rs2, fsdspOffset), nil
+		case 0b110: // C.SWSP : sw rs2, offset(x2)
+			return assembleS(0b0100011, 0b010, 2, rs2, swspOffset), nil
+		case 0b111:
+			if xlen == 64 { // C.SDSP : sd rs2, offset(x2)
+				return assembleS(0b0100011, 0b011, 2, rs2, fsdspOffset), nil
+			}
+			// C.FSWSP : fsw rs2, offset(x2)
+			return assembleS(0b0100111, 0b010, 2, rs2, swspOffset), nil
+		}
+	}
+	return 0, illegal
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestExpandCompressed(t *testing.T) {
+	tests := []struct {
+		name       string
+		compressed uint32
+		expected   uint32
+		shouldFail bool
+	}{
+		{"C.ADDI4SPN", 0x0808, 0x01010513, false}, // c.addi4spn a0, sp, 16 => addi a0, sp, 16
+		{"C.LW", 0x411c, 0x00052783, false},       // c.lw a5, 0(a0) => lw a5, 0(a0)
+		{"C.SW", 0xc15c, 0x00f52223, false},       // c.sw a5, 4(a0) => sw a5, 4(a0)
+		{"C.ADDI", 0x1141, 0xff010113, false},     // c.addi sp, -16 => addi sp, sp, -16
+		{"C.JAL", 0x2001, 0x000000ef, false},      // c.jal 0 => jal ra, 0
+		{"C.LI", 0x4515, 0x00500513, false},       // c.li a0, 5 => addi a0, x0, 5
+		{"C.ADDI16SP", 0x713d, 0xfe010113, false}, // c.addi16sp sp, -32 => addi sp, sp, -32
+		{"C.LUI", 0x6505, 0x00001537, false},      // c.lui a0, 1 => lui a0, 1
+		{"C.SRAI", 0x8505, 0x40155513, false},     // c.srai a0, 1 => srai a0, a0, 1
+		{"C.SUB", 0x8d0d, 0x40b50533, false},      // c.sub a0, a1 => sub a0, a0, a1
+		{"C.J", 0xa001, 0x0000006f, false},        // c.j 0 => jal x0, 0
+		{"C.BEQZ", 0xc501, 0x00050463, false},     // c.beqz a0, 8 => beq a0, x0, 8
+		{"C.SLLI", 0x050a, 0x00251513, false},     // c.slli a0, 2 => slli a0, a0, 2
+		{"C.LWSP", 0x40b2, 0x00c12083, false},     // c.lwsp ra, 12(sp) => lw ra, 12(sp)
+		{"C.JR", 0x8082, 0x00008067, false},       // c.jr ra => jalr x0, 0(ra)
+		{"C.MV", 0x852e, 0x00b00533, false},       // c.mv a0, a1 => add a0, x0, a1
+		{"C.EBREAK", 0x9002, 0x00100073, false},   // c.ebreak => ebreak
+		{"C.ADD", 0x952e, 0x00b50533, false},      // c.add a0, a1 => add a0, a0, a1
+		{"C.SWSP", 0xc606, 0x00112623, false},     // c.swsp ra, 12(sp) => sw ra, 12(sp)
+		{"Illegal all zeros", 0x0000, 0, true},    // The all-zero parcel is defined as illegal
+		{"Illegal C.LWSP x0", 0x4002, 0, true},    // c.lwsp with rd = x0 is reserved
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expanded, err := expandCompressed(test.compressed, 32)
+
+			if test.shouldFail {
+				if err == nil {
+					t.Errorf("expected failure for instruction '%04x', but got %08x", test.compressed, expanded)
+				}
+			} else if err != nil {
+				t.Errorf("expected success for instruction '%04x', but got error: %v", test.compressed, err)
+			} else if expanded != test.expected {
+				t.Errorf("expected %08x, got %08x", test.expected, expanded)
+			}
+		})
+	}
+}
+
+func TestExpandCompressedRV64(t *testing.T) {
+	tests := []struct {
+		name       string
+		xlen       uint32
+		compressed uint32
+		expected   uint32
+		shouldFail bool
+	}{
+		{"C.LD", 64, 0x651c, 0x00853783, false},            // c.ld a5, 8(a0) => ld a5, 8(a0)
+		{"C.SD", 64, 0xe51c, 0x00f53423, false},            // c.sd a5, 8(a0) => sd a5, 8(a0)
+		{"C.ADDIW", 64, 0x2505, 0x0015051b, false},         // c.addiw a0, 1 => addiw a0, a0, 1
+		{"C.SUBW", 64, 0x9d0d, 0x40b5053b, false},          // c.subw a0, a1 => subw a0, a0, a1
+		{"C.ADDW", 64, 0x9d2d, 0x00b5053b, false},          // c.addw a0, a1 => addw a0, a0, a1
+		{"C.SLLI shamt 32", 64, 0x1502, 0x02051513, false}, // c.slli a0, 32 => slli a0, a0, 32
+		{"C.LDSP", 64, 0x60a2, 0x00813083, false},          // c.ldsp ra, 8(sp) => ld ra, 8(sp)
+		{"C.SDSP", 64, 0xe406, 0x00113423, false},          // c.sdsp ra, 8(sp) => sd ra, 8(sp)
+		{"C.ADDIW x0", 64, 0x2001, 0, true},                // c.addiw with rd = x0 is reserved
+		{"C.SLLI shamt 32 on RV32", 32, 0x1502, 0, true},   // shamt[5] must be zero on RV32C
+		{"C.SUBW on RV32", 32, 0x9d0d, 0, true},            // C.SUBW / C.ADDW are RV64C only
+		{"C.FLW on RV32", 32, 0x651c, 0x00852787, false},   // the C.LD encoding is c.flw fa5, 8(a0) on RV32
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expanded, err := expandCompressed(test.compressed, test.xlen)
+
+			if test.shouldFail {
+				if err == nil {
+					t.Errorf("expected failure for instruction '%04x', but got %08x", test.compressed, expanded)
+				}
+			} else if err != nil {
+				t.Errorf("expected success for instruction '%04x', but got error: %v", test.compressed, err)
+			} else if expanded != test.expected {
+				t.Errorf("expected %08x, got %08x", test.expected, expanded)
+			}
+		})
+	}
+}
+
+func TestExecuteMixedLengthInstructions(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initMemory(&memory, 64, 0)
+	initCPUState(&cpu, 0, 0)
+
+	// 0x0: c.li a0, 5
+	// 0x2: c.jal 4         => ra = 0x4, pc = 0x6
+	// 0x4: c.li a0, 1      (skipped)
+	// 0x6: addi a1, a0, 1  (32-bit instruction spanning two words)
+	memory.Store32(0, 0x2011<<16|0x4515)
+	memory.Store32(4, 0x0593<<16|0x4505)
+	memory.Store32(8, 0x0015)
+
+	expectedPCs := []uint64{0x2, 0x6, 0xA}
+	for i, expectedPC := range expectedPCs {
+		if _, err := executeInstruction(&cpu, &memory); err != nil {
+			t.Fatalf("step %d: unexpected error: %v", i, err)
+		}
+		if cpu.pc != expectedPC {
+			t.Errorf("step %d: expected pc=0x%x, got pc=0x%x", i, expectedPC, cpu.pc)
+		}
+	}
+
+	if cpu.x[10] != 5 {
+		t.Errorf("expected a0=5, got a0=%d", cpu.x[10])
+	}
+	if cpu.x[1] != 4 {
+		t.Errorf("expected ra=4 (link address after a 2-byte c.jal), got ra=%d", cpu.x[1])
+	}
+	if cpu.x[11] != 6 {
+		t.Errorf("expected a1=6, got a1=%d", cpu.x[11])
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import mathbits "math/bits" // bits is the field extractor of compressed.go
+
+// Virtual clocks of the hart: every instruction takes one cycle of cpuFrequency, and the time CSR counts at
+// timeFrequency. time is derived from the cycles elapsed so that it advances deterministically, even in step mode.
+// It uses its own count of cycles: writing mcycle must not move time or mtime backwards.
+var (
+	cpuFrequency  uint64 = 100_000_000 // Hz
+	timeFrequency uint64 = 10_000_000  // Hz, selected at launch with -t
+)
+
+// elapsedTime converts the cycles elapsed since reset into ticks of timeFrequency.
+func elapsedTime(cpu *CPUState) uint64 {
+	// cycles * timeFrequency on 128 bits, the quotient wraps around like the counter
+	high, low := mathbits.Mul64(cpu.ticks, timeFrequency)
+	quotient, _ := mathbits.Div64(high%cpuFrequency, low, cpuFrequency)
+	return quotient
+}
+
+// readTime returns the current value of the time counter, which is also mtime in the CLINT.
+func readTime(cpu *CPUState) uint64 {
+	return elapsedTime(cpu) + cpu.timeOffset
+}
+
+// setTime writes the time counter, as a store to mtime does. The cycle count is left untouched.
+func setTime(cpu *CPUState, value uint64) {
+	cpu.timeOffset = value - elapsedTime(cpu)
+}
+
+// countInstruction advances the counters after an instruction: a cycle always elapses, the instruction only
+// retires when it did not raise an exception. A counter written by the instruction keeps the written value.
+func countInstruction(cpu *CPUState) {
+	cpu.ticks++
+	if cpu.writtenCounters&counterBit(csrMcycle) == 0 {
+		cpu.csr[csrMcycle]++
+	}
+	if !cpu.trapped && cpu.writtenCounters&counterBit(csrMinstret) == 0 {
+		cpu.csr[csrMinstret]++
+	}
+	cpu.writtenCounters = 0
+}
+
+// counterBit returns the bit of a counter in mcounteren and in cpu.writtenCounters.
+func counterBit(counter uint32) uint64 {
+	return 1 << (counter & 0x1F)
+}
+
+// isHighCounterCSR reports whether the CSR address is the upper half of a 64-bit counter (RV32 only).
+func isHighCounterCSR(address uint32) bool {
+	return address == csrMcycleh || address == csrMinstreth || (address >= csrCycleh && address <= csrInstreth)
+}
+
+// counterCSR returns a view on a 64-bit counter stored in cpu.csr[counter]: the whole counter, or only its
+// upper 32 bits when high is set. In RV32 the low view reads and writes the lower 32 bits.
+func counterCSR(name string, counter uint32, high bool) CSR {
+	return CSR{
+		name,
+		func(cpu *CPUState) uint64 {
+			if high {
+				return cpu.csr[counter] >> 32
+			}
+			return cpu.csr[counter]
+		},
+		func(cpu *CPUState, value uint64) {
+			switch {
+			case high:
+				cpu.csr[counter] = cpu.csr[counter]&0xFFFFFFFF | value<<32
+			case cpu.xlen == 32:
+				cpu.csr[counter] = cpu.csr[counter]&^0xFFFFFFFF | value&0xFFFFFFFF
+			default:
+				cpu.csr[counter] = value
+			}
+			cpu.writtenCounters |= counterBit(counter)
+		},
+	}
+}
+
+// timeCSR returns the read-only time counter, or its upper 32 bits when high is set.
+func timeCSR(name string, high bool) CSR {
+	return CSR{
+		name,
+		func(cpu *CPUState) uint64 {
+			if high {
+				return readTime(cpu) >> 32
+			}
+			return readTime(cpu)
+		},
+		func(cpu *CPUState, value uint64) {},
+	}
+}
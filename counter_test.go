@@ -0,0 +1,151 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCounters(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initMemory(&memory, 256, 0)
+	initCPUState(&cpu, 0, 0)
+	cpu.csr[csrMtvec] = 0x80
+
+	memory.Store32(0, 0x00000013)    // NOP
+	memory.Store32(4, 0x00000013)    // NOP
+	memory.Store32(8, 0xFFFFFFFF)    // Illegal instruction, does not retire
+	memory.Store32(0x80, 0xC0202573) // rdinstret a0
+	memory.Store32(0x84, 0xC00025F3) // rdcycle a1
+
+	for i := 0; i < 5; i++ {
+		executeInstruction(&cpu, &memory)
+	}
+
+	if cpu.x[10] != 2 {
+		t.Errorf("expected instret=2 before rdinstret, got %d", cpu.x[10])
+	}
+	if cpu.x[11] != 4 {
+		t.Errorf("expected cycle=4 before rdcycle, got %d", cpu.x[11])
+	}
+	if cpu.csr[csrMinstret] != 4 || cpu.csr[csrMcycle] != 5 {
+		t.Errorf("expected minstret=4 and mcycle=5, got minstret=%d and mcycle=%d", cpu.csr[csrMinstret], cpu.csr[csrMcycle])
+	}
+}
+
+func TestCounterWrites(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initMemory(&memory, 256, 0)
+	initCPUState(&cpu, 0, 0)
+	cpu.csr[csrMcycle], cpu.csr[csrMinstret] = 100, 100
+
+	memory.Store32(0, 0xB0001073)  // csrw mcycle, zero
+	memory.Store32(4, 0xB0201073)  // csrw minstret, zero
+	memory.Store32(8, 0xB0202573)  // csrr a0, minstret
+	memory.Store32(12, 0xB00025F3) // csrr a1, mcycle
+
+	for i := 0; i < 4; i++ {
+		executeInstruction(&cpu, &memory)
+	}
+
+	if cpu.x[10] != 0 {
+		t.Errorf("expected minstret=0 after the write, got %d", cpu.x[10])
+	}
+	if cpu.x[11] != 2 {
+		t.Errorf("expected mcycle=2 two instructions after the write, got %d", cpu.x[11])
+	}
+	if cpu.ticks != 4 {
+		t.Errorf("expected the writes to leave the elapsed cycles alone, got %d", cpu.ticks)
+	}
+}
+
+func TestCounterCSRs(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+	csrrs := Instructions[[4]uint32{0b1110011, 0b010, 0, 0}]
+	csrrw := Instructions[[4]uint32{0b1110011, 0b001, 0, 0}]
+
+	tests := []struct {
+		name         string
+		xlen         uint32
+		exec         func()
+		expected     uint64
+		expectedTrap bool
+	}{
+		{"cycle RV32", 32, func() { csrrs.Exec(&cpu, &memory, 2, 0, csrCycle) }, 0x89ABCDEF, false},
+		{"cycleh RV32", 32, func() { csrrs.Exec(&cpu, &memory, 2, 0, csrCycleh) }, 0x01234567, false},
+		{"instreth RV32", 32, func() { csrrs.Exec(&cpu, &memory, 2, 0, csrInstreth) }, 0x2, false},
+		{"cycle RV64", 64, func() { csrrs.Exec(&cpu, &memory, 2, 0, csrCycle) }, 0x0123456789ABCDEF, false},
+		{"cycleh RV64", 64, func() { csrrs.Exec(&cpu, &memory, 2, 0, csrCycleh) }, 0, true},
+		{"time", 64, func() { csrrs.Exec(&cpu, &memory, 2, 0, csrTime) }, 0x0123456789ABCDEF / 10, false},
+		{"write cycle", 32, func() { csrrw.Exec(&cpu, &memory, 2, 1, csrCycle) }, 0, true},
+		{"write mcycle RV32 keeps the high half", 32, func() {
+			csrrw.Exec(&cpu, &memory, 0, 1, csrMcycle)
+			csrrs.Exec(&cpu, &memory, 2, 0, csrMcycleh)
+		}, 0x01234567, false},
+		{"write mcycleh", 32, func() {
+			csrrw.Exec(&cpu, &memory, 0, 1, csrMcycleh)
+			csrrs.Exec(&cpu, &memory, 2, 0, csrMcycle)
+		}, 0x89ABCDEF, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initCPUState(&cpu, 0x100, 0)
+			cpu.xlen = test.xlen
+			cpu.csr[csrMtvec] = 0x200
+			cpu.ticks, cpu.csr[csrMcycle] = 0x0123456789ABCDEF, 0x0123456789ABCDEF
+			cpu.csr[csrMinstret] = 0x0000000200000000
+			writeRegister(&cpu, 1, 0x5)
+
+			test.exec()
+
+			if test.expectedTrap {
+				if cpu.pc != 0x200 || cpu.csr[csrMcause] != causeIllegalInstruction {
+					t.Errorf("expected an illegal instruction trap, got pc=0x%x mcause=%d", cpu.pc, cpu.csr[csrMcause])
+				}
+				return
+			}
+			if value := readUnsignedRegister(&cpu, 2); value != test.expected {
+				t.Errorf("expected x2=0x%x, got x2=0x%x", test.expected, value)
+			}
+		})
+	}
+}
+
+func TestTimeCounter(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+	csrrw := Instructions[[4]uint32{0b1110011, 0b001, 0, 0}]
+	defer func(frequency uint64) { timeFrequency = frequency }(timeFrequency)
+
+	tests := []struct {
+		name      string
+		frequency uint64
+		ticks     uint64
+		expected  uint64
+	}{
+		{"10 MHz", 10_000_000, 1000, 100},
+		{"Same as the cpu", cpuFrequency, 1000, 1000},
+		{"Faster than 1.8e11 Hz", 1_000_000_000_000, 1<<40 + 99_999_999, (1<<40 + 99_999_999) * 10_000},
+		{"Large counter", 10_000_000, 1 << 63, 1 << 63 / 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timeFrequency = test.frequency
+			initCPUState(&cpu, 0, 0)
+			cpu.ticks, cpu.csr[csrMcycle] = test.ticks, test.ticks
+
+			if value := readTime(&cpu); value != test.expected {
+				t.Errorf("expected time=%d, got %d", test.expected, value)
+			}
+			csrrw.Exec(&cpu, &memory, 0, 0, csrMcycle) // Writing mcycle does not move time
+			if value := readTime(&cpu); value != test.expected {
+				t.Errorf("expected time=%d after writing mcycle, got %d", test.expected, value)
+			}
+		})
+	}
+}
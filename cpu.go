@@ -1,27 +1,292 @@
 package main
 
+import "fmt"
+
 type CPUState struct {
-	x  [32]uint32
-	pc uint32
+	x    [32]uint64 // Integer registers, RV32 values are kept sign-extended from bit 31
+	f    [32]uint64 // Floating-point registers, narrower values are NaN-boxed
+	v    []byte     // Vector registers, VLEN/8 bytes each: v0 is v[0:VLEN/8], register groups are contiguous
+	pc   uint64
+	xlen uint32 // Width of the integer registers and of the address space (32 or 64), see --isa
+	vlen uint32 // Width of the vector registers in bits, see --vlen
+
+	embedded   bool            // RV32E: only x0-x15 exist, referencing x16-x31 is an illegal instruction
+	extensions map[string]bool // Extensions enabled by the ISA string, the others raise illegal instruction exceptions
+
+	privilege uint64 // Current privilege mode: privilegeUser, privilegeSupervisor or privilegeMachine
+
+	ticks      uint64 // Cycles elapsed since reset, the base of the time counter: unlike mcycle, software cannot write it
+	timeOffset uint64 // Difference between mtime and the time elapsed since reset, changed by writing mtime
+
+	writtenCounters uint64 // Counters written by the instruction being executed, as mcounteren bits: it does not count
+
+	instruction       uint32 // Raw bits of the instruction being executed
+	instructionLength uint32 // Length in bytes of the instruction being executed (2 or 4)
+	jumped            bool   // Set when the instruction being executed wrote the pc
+	trapped           bool   // Set when the instruction being executed raised an exception, it does not retire
+	decodeOnly        bool   // Set while disassembling: the decoders format the instruction without executing it
+
+	tlb    [tlbSize]tlbEntry       // Cached Sv32 translations, see mmu.go
+	icache [icacheSize]icacheEntry // Cached instructions, see icache.go
+
+	// LR/SC reservation set (a single word)
+	reservation      uint32
+	reservationValid bool
+
+	// Control and status registers, see CSRs for the implemented ones
+	csr [4096]uint64
+}
+
+// xlenMask returns the mask of the XLEN bits of an integer register.
+func xlenMask(state *CPUState) uint64 {
+	if state.xlen == 64 {
+		return 0xFFFFFFFFFFFFFFFF
+	}
+	return 0xFFFFFFFF
+}
+
+// signExtendWord sign-extends the low 32 bits of value, as the *W instructions and RV32 registers do.
+func signExtendWord(value uint64) uint64 {
+	return uint64(int64(int32(value)))
+}
+
+// immediate sign-extends an immediate produced by the decoders (they sign-extend it to 32 bits).
+func immediate(imm uint32) uint64 {
+	return signExtendWord(uint64(imm))
+}
+
+// registerCount returns the number of integer registers: 16 in RV32E, 32 otherwise.
+func registerCount(state *CPUState) int {
+	if state.embedded {
+		return 16
+	}
+	return 32
 }
 
-func readRegister(state *CPUState, reg uint32) uint32 {
+// readRegister returns the value of an integer register, sign-extended to 64 bits in RV32. Signed comparisons
+// and arithmetic right shifts can use it directly.
+func readRegister(state *CPUState, reg uint32) uint64 {
 	if reg == 0 {
 		return 0
 	}
 	return state.x[reg]
 }
 
-func writeRegister(state *CPUState, reg uint32, value uint32) {
+// readUnsignedRegister returns the value of an integer register zero-extended from XLEN bits.
+func readUnsignedRegister(state *CPUState, reg uint32) uint64 {
+	return readRegister(state, reg) & xlenMask(state)
+}
+
+// writeRegister writes an integer register, in RV32 only the low 32 bits of value are kept.
+func writeRegister(state *CPUState, reg uint32, value uint64) {
 	if reg != 0 {
+		if state.xlen == 32 {
+			value = signExtendWord(value)
+		}
 		state.x[reg] = value
 	}
 }
 
+// shiftAmount keeps the log2(XLEN) low bits of a shift amount held in a register.
+func shiftAmount(state *CPUState, value uint64) uint64 {
+	return value & uint64(state.xlen-1)
+}
+
+// effectiveAddress returns rs1 + imm wrapped to XLEN bits.
+func effectiveAddress(state *CPUState, rs1 uint32, imm uint32) uint64 {
+	return (readRegister(state, rs1) + immediate(imm)) & xlenMask(state)
+}
+
+// readFloatRegister32 returns the single-precision value of a float register, or the canonical NaN when the register
+// does not hold a properly NaN-boxed value.
+func readFloatRegister32(state *CPUState, reg uint32) uint32 {
+	value := state.f[reg]
+	if value>>32 != 0xFFFFFFFF {
+		return uint32(canonicalNaN(float32Format))
+	}
+	return uint32(value)
+}
+
+// writeFloatRegister32 NaN-boxes a single-precision value into a float register.
+func writeFloatRegister32(state *CPUState, reg uint32, value uint32) {
+	state.f[reg] = 0xFFFFFFFF<<32 | uint64(value)
+	markFloatStateDirty(state)
+}
+
+// readFloatRegister64 returns the double-precision value of a float register.
+func readFloatRegister64(state *CPUState, reg uint32) uint64 {
+	return state.f[reg]
+}
+
+// writeFloatRegister64 writes a double-precision value into a float register.
+func writeFloatRegister64(state *CPUState, reg uint32, value uint64) {
+	state.f[reg] = value
+	markFloatStateDirty(state)
+}
+
+// readFloatRegister returns the value of a float register in the given format.
+func readFloatRegister(state *CPUState, format floatFormat, reg uint32) uint64 {
+	if format == float64Format {
+		return readFloatRegister64(state, reg)
+	}
+	return uint64(readFloatRegister32(state, reg))
+}
+
+// writeFloatRegister writes a value of the given format into a float register.
+func writeFloatRegister(state *CPUState, format floatFormat, reg uint32, value uint64) {
+	if format == float64Format {
+		writeFloatRegister64(state, reg, value)
+	} else {
+		writeFloatRegister32(state, reg, uint32(value))
+	}
+}
+
+// setFloatFlags accumulates exception flags into fflags.
+func setFloatFlags(state *CPUState, flags uint32) {
+	if flags != 0 {
+		state.csr[csrFcsr] |= uint64(flags)
+		markFloatStateDirty(state)
+	}
+}
+
+func markFloatStateDirty(state *CPUState) {
+	state.csr[csrMstatus] |= mstatusFSDirty
+}
+
+// jumpTo redirects execution to address instead of the next sequential instruction.
+func jumpTo(state *CPUState, address uint64) {
+	state.pc = address & xlenMask(state)
+	state.jumped = true
+}
+
+func reserveAddress(state *CPUState, address uint32) {
+	state.reservation = address &^ 3
+	state.reservationValid = true
+}
+
+// invalidateReservation drops the LR/SC reservation when a store hits the reserved word.
+func invalidateReservation(state *CPUState, address uint32) {
+	if state.reservationValid && state.reservation == address&^3 {
+		state.reservationValid = false
+	}
+}
+
 func initCPUState(state *CPUState, firstInstruction uint32, defaultMemoryValue uint32) {
-	for i := 0; i < 32; i++ {
-		writeRegister(state, uint32(i), defaultMemoryValue)
+	state.xlen = xlen
+	state.embedded = embedded
+	state.extensions = extensions
+	for i := 0; i < registerCount(state); i++ {
+		writeRegister(state, uint32(i), uint64(defaultMemoryValue))
+	}
+	state.pc = uint64(firstInstruction)
+	state.instructionLength = 4
+	state.reservationValid = false
+	flushTLB(state)
+	flushICache(state)
+	state.ticks = 0
+	state.timeOffset = 0
+	state.writtenCounters = 0
+	state.csr = [4096]uint64{}
+	// The FPU and the vector unit, when present, are usable right away by bare-metal programs, and MRET stays in
+	// M-mode until MPP is changed
+	state.csr[csrMstatus] = privilegeMachine << mstatusMPPShift
+	if state.extensions["f"] {
+		state.csr[csrMstatus] |= mstatusFSInitial
 	}
-	state.pc = firstInstruction
+	if state.extensions["v"] {
+		state.csr[csrMstatus] |= mstatusVSInitial
+	}
+	state.vlen = vlen
+	state.v = make([]byte, 32*vlen/8)
+	state.csr[csrVtype] = 1 << (state.xlen - 1) // vill until the first vset{i}vl{i}
+	state.privilege = privilegeMachine
+	state.f = [32]uint64{}
 	logDebug("INIT", "CPU state initialized with default memory value %d\n", defaultMemoryValue)
 }
+
+// decodeInstruction fetches the instruction at pc, expands it if it is compressed, then decodes and executes it
+// without advancing the pc.
+func decodeInstruction(cpu *CPUState, memory *Memory) (string, error) {
+	cpu.jumped = false
+	cpu.trapped = false
+	pc := cpu.pc
+	instruction, length, ok := fetchInstruction(cpu, memory, pc)
+	if !ok {
+		return "", fmt.Errorf("instruction fetch fault at %s", formatAddress(pc))
+	}
+	cpu.instruction = instruction
+	cpu.instructionLength = length
+
+	if length == 2 {
+		if !cpu.extensions["c"] {
+			raiseException(cpu, causeIllegalInstruction, uint64(instruction))
+			return "", fmt.Errorf("compressed instruction %04x without the C extension", instruction)
+		}
+		expanded, err := expandCompressed(instruction, cpu.xlen)
+		if err != nil {
+			raiseException(cpu, causeIllegalInstruction, uint64(instruction))
+			return "", err
+		}
+		instruction = expanded
+	}
+
+	opcode, err := GetOpcodeFromInstruction(instruction)
+	if err != nil {
+		raiseException(cpu, causeIllegalInstruction, uint64(instruction))
+		return "", err
+	}
+	if cpu.embedded && referencesUpperRegister(opcode, instruction) {
+		raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+		return "", fmt.Errorf("instruction %08x references a register above x15 in RV32E", instruction)
+	}
+	return opcode.Encoding.Decode(opcode, instruction, cpu, memory), nil
+}
+
+// disassembleInstruction formats the instruction at pc without executing it: the hart, its caches and memory are
+// left untouched, so that the step by step debugger can show the next instruction. When translation is enabled,
+// the instruction is only read through the translations already cached in the TLB.
+func disassembleInstruction(cpu *CPUState, memory *Memory) (string, error) {
+	instruction := uint32(0)
+	for half := uint64(0); half < 2; half++ {
+		physical, ok := peekTranslation(cpu, cpu.pc+2*half)
+		if !ok || !isPhysicalAccessValid(memory, physical, 2, accessFetch) {
+			return "", fmt.Errorf("instruction at %s cannot be fetched", formatAddress(cpu.pc))
+		}
+		instruction |= uint32(memory.Load16(uint32(physical))) << (16 * half)
+		if half == 0 && isCompressed(instruction) {
+			break
+		}
+	}
+
+	if isCompressed(instruction) {
+		if !cpu.extensions["c"] {
+			return "", fmt.Errorf("compressed instruction %04x without the C extension", instruction)
+		}
+		expanded, err := expandCompressed(instruction, cpu.xlen)
+		if err != nil {
+			return "", err
+		}
+		instruction = expanded
+	}
+	opcode, err := GetOpcodeFromInstruction(instruction)
+	if err != nil {
+		return "", err
+	}
+	if cpu.embedded && referencesUpperRegister(opcode, instruction) {
+		return "", fmt.Errorf("instruction %08x references a register above x15 in RV32E", instruction)
+	}
+
+	cpu.decodeOnly = true
+	defer func() { cpu.decodeOnly = false }()
+	return opcode.Encoding.Decode(opcode, instruction, cpu, memory), nil
+}
+
+// executeInstruction runs the instruction at pc and moves to the next one unless the instruction jumped.
+func executeInstruction(cpu *CPUState, memory *Memory) (string, error) {
+	rtnString, err := decodeInstruction(cpu, memory)
+	if !cpu.jumped {
+		cpu.pc = (cpu.pc + uint64(cpu.instructionLength)) & xlenMask(cpu)
+	}
+	countInstruction(cpu)
+	return rtnString, err
+}
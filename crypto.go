@@ -0,0 +1,229 @@
+package main
+
+import mathbits "math/bits" // bits is the field extractor of compressed.go
+
+// AES substitution box and its inverse, computed in init()
+var aesSbox, aesInverseSbox [256]byte
+
+// CryptoInstructions holds the scalar cryptography instructions Zbkb, Zbkx, Zknh, Zkne and Zknd, they are merged
+// into Instructions. The AES and SHA-256 instructions are the RV32 ones, Zbkb shares ROL, ROR, RORI, ANDN, ORN,
+// XNOR and REV8 with Zbb.
+var CryptoInstructions = map[[4]uint32]Instruction{
+	// Zbkb : bit manipulation for cryptography
+	// PACK : Pack the low halves of rs1 and rs2 (ZEXT.H is PACK rd, rs1, x0 in RV32)
+	{0b0110011, 0b100, 0b0000100, 0}: {
+		"PACK",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			half := cpu.xlen / 2
+			low := readRegister(cpu, rs1) & (1<<half - 1)
+			writeRegister(cpu, rd, readRegister(cpu, rs2)<<half|low)
+		},
+	},
+	// PACKH : Pack the low bytes of rs1 and rs2
+	{0b0110011, 0b111, 0b0000100, 0}: {
+		"PACKH",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, (readRegister(cpu, rs2)&0xFF)<<8|readRegister(cpu, rs1)&0xFF)
+		},
+	},
+	// PACKW : Pack the low 16 bits of rs1 and rs2, sign-extended (ZEXT.H is PACKW rd, rs1, x0 in RV64)
+	{0b0111011, 0b100, 0b0000100, 0}: rv64Instruction(Instruction{
+		"PACKW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, signExtendWord((readRegister(cpu, rs2)&0xFFFF)<<16|readRegister(cpu, rs1)&0xFFFF))
+		},
+	}),
+	// BREV8 : Reverse the bits of each byte
+	{0b0010011, 0b101, 0b0110100, 0b00111}: {
+		"BREV8",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			value := readRegister(cpu, rs1)
+			writeRegister(cpu, rd, mathbits.ReverseBytes64(mathbits.Reverse64(value)))
+		},
+	},
+	// ZIP : Interleave the bits of the low and high halves (RV32 only)
+	{0b0010011, 0b001, 0b0000100, 0b01111}: {
+		"ZIP",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			if cpu.xlen != 32 {
+				raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+				return
+			}
+			value, result := uint32(readRegister(cpu, rs1)), uint32(0)
+			for i := 0; i < 16; i++ {
+				result |= (value>>i&1)<<(2*i) | (value>>(i+16)&1)<<(2*i+1)
+			}
+			writeRegister(cpu, rd, uint64(result))
+		},
+	},
+	// UNZIP : Deinterleave the even and odd bits into the low and high halves (RV32 only)
+	{0b0010011, 0b101, 0b0000100, 0b01111}: {
+		"UNZIP",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			if cpu.xlen != 32 {
+				raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+				return
+			}
+			value, result := uint32(readRegister(cpu, rs1)), uint32(0)
+			for i := 0; i < 16; i++ {
+				result |= (value>>(2*i)&1)<<i | (value>>(2*i+1)&1)<<(i+16)
+			}
+			writeRegister(cpu, rd, uint64(result))
+		},
+	},
+
+	// Zbkx : crossbar permutations
+	// XPERM4 : rd[nibble i] = rs1[nibble rs2[nibble i]], 0 when out of range
+	{0b0110011, 0b010, 0b0010100, 0}: {
+		"XPERM4",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, crossbarPermutation(cpu, readRegister(cpu, rs1), readRegister(cpu, rs2), 4))
+		},
+	},
+	// XPERM8 : rd[byte i] = rs1[byte rs2[byte i]], 0 when out of range
+	{0b0110011, 0b100, 0b0010100, 0}: {
+		"XPERM8",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, crossbarPermutation(cpu, readRegister(cpu, rs1), readRegister(cpu, rs2), 8))
+		},
+	},
+
+	// Zknh : SHA-256 functions, on the low word of rs1, the result is sign-extended
+	// SHA256SUM0 : ror(x, 2) ^ ror(x, 13) ^ ror(x, 22)
+	{0b0010011, 0b001, 0b0001000, 0b00000}: {
+		"SHA256SUM0",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			writeRegister(cpu, rd, sha256Function(readRegister(cpu, rs1), 2, 13, 22, false))
+		},
+	},
+	// SHA256SUM1 : ror(x, 6) ^ ror(x, 11) ^ ror(x, 25)
+	{0b0010011, 0b001, 0b0001000, 0b00001}: {
+		"SHA256SUM1",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			writeRegister(cpu, rd, sha256Function(readRegister(cpu, rs1), 6, 11, 25, false))
+		},
+	},
+	// SHA256SIG0 : ror(x, 7) ^ ror(x, 18) ^ (x >> 3)
+	{0b0010011, 0b001, 0b0001000, 0b00010}: {
+		"SHA256SIG0",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			writeRegister(cpu, rd, sha256Function(readRegister(cpu, rs1), 7, 18, 3, true))
+		},
+	},
+	// SHA256SIG1 : ror(x, 17) ^ ror(x, 19) ^ (x >> 10)
+	{0b0010011, 0b001, 0b0001000, 0b00011}: {
+		"SHA256SIG1",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			writeRegister(cpu, rd, sha256Function(readRegister(cpu, rs1), 17, 19, 10, true))
+		},
+	},
+}
+
+// crossbarPermutation implements XPERM4 and XPERM8: each element of width bits of indexes selects an element of
+// values, the elements past XLEN read as 0.
+func crossbarPermutation(cpu *CPUState, values uint64, indexes uint64, width uint32) uint64 {
+	mask := uint64(1)<<width - 1
+	result := uint64(0)
+	for i := uint32(0); i < cpu.xlen; i += width {
+		index := (indexes >> i) & mask
+		if index < uint64(cpu.xlen/width) {
+			result |= ((values >> (index * uint64(width))) & mask) << i
+		}
+	}
+	return result
+}
+
+// sha256Function returns ror(x, a) ^ ror(x, b) ^ ror(x, c), or x >> c for the last term of the sigma functions.
+func sha256Function(value uint64, a int, b int, c int, shift bool) uint64 {
+	x := uint32(value)
+	last := mathbits.RotateLeft32(x, -c)
+	if shift {
+		last = x >> c
+	}
+	return signExtendWord(uint64(mathbits.RotateLeft32(x, -a) ^ mathbits.RotateLeft32(x, -b) ^ last))
+}
+
+// aesMultiply multiplies two elements of GF(2^8) modulo the AES polynomial x^8 + x^4 + x^3 + x + 1.
+func aesMultiply(a byte, b byte) byte {
+	result := byte(0)
+	for ; b != 0; b >>= 1 {
+		if b&1 != 0 {
+			result ^= a
+		}
+		a = a<<1 ^ byte(int8(a)>>7)&0x1B
+	}
+	return result
+}
+
+// aes32Instruction returns AES32ESI, AES32ESMI, AES32DSI or AES32DSMI for the byte select bs (funct7[6:5]):
+// byte bs of rs2 goes through the forward or inverse S-box, then MixColumns for a middle round, and the column
+// rotated back to byte bs is XORed with rs1.
+func aes32Instruction(name string, bs uint32, decrypt bool, middle bool) Instruction {
+	return Instruction{
+		name,
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			if cpu.xlen != 32 {
+				raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction)) // RV64 has the AES64 instructions
+				return
+			}
+			input := byte(readRegister(cpu, rs2) >> (8 * bs))
+			var column uint32
+			switch {
+			case !decrypt && !middle:
+				column = uint32(aesSbox[input])
+			case !decrypt:
+				s := aesSbox[input]
+				column = uint32(aesMultiply(s, 3))<<24 | uint32(s)<<16 | uint32(s)<<8 | uint32(aesMultiply(s, 2))
+			case !middle:
+				column = uint32(aesInverseSbox[input])
+			default:
+				s := aesInverseSbox[input]
+				column = uint32(aesMultiply(s, 0xB))<<24 | uint32(aesMultiply(s, 0xD))<<16 |
+					uint32(aesMultiply(s, 0x9))<<8 | uint32(aesMultiply(s, 0xE))
+			}
+			writeRegister(cpu, rd, readRegister(cpu, rs1)^uint64(mathbits.RotateLeft32(column, int(8*bs))))
+		},
+	}
+}
+
+func init() {
+	// S-box: multiplicative inverse in GF(2^8) followed by the affine transformation
+	for i := 0; i < 256; i++ {
+		inverse := byte(0)
+		for j := 1; j < 256 && i != 0; j++ {
+			if aesMultiply(byte(i), byte(j)) == 1 {
+				inverse = byte(j)
+				break
+			}
+		}
+		s := inverse ^ mathbits.RotateLeft8(inverse, 1) ^ mathbits.RotateLeft8(inverse, 2) ^
+			mathbits.RotateLeft8(inverse, 3) ^ mathbits.RotateLeft8(inverse, 4) ^ 0x63
+		aesSbox[i] = s
+		aesInverseSbox[s] = byte(i)
+	}
+
+	// Zkne and Zknd : funct7 holds bs in [6:5]
+	for bs := uint32(0); bs < 4; bs++ {
+		CryptoInstructions[[4]uint32{0b0110011, 0b000, bs<<5 | 0b10001, 0}] = aes32Instruction("AES32ESI", bs, false, false)
+		CryptoInstructions[[4]uint32{0b0110011, 0b000, bs<<5 | 0b10011, 0}] = aes32Instruction("AES32ESMI", bs, false, true)
+		CryptoInstructions[[4]uint32{0b0110011, 0b000, bs<<5 | 0b10101, 0}] = aes32Instruction("AES32DSI", bs, true, false)
+		CryptoInstructions[[4]uint32{0b0110011, 0b000, bs<<5 | 0b10111, 0}] = aes32Instruction("AES32DSMI", bs, true, true)
+	}
+
+	for key, instruction := range CryptoInstructions {
+		Instructions[key] = instruction
+	}
+}
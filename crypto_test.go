@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCryptoInstructions(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	op := func(funct7, funct3 uint32) uint32 { // OP x3, x1, x2
+		return assembleR(0b0110011, 3, funct3, 1, 2, funct7)
+	}
+	opImm := func(funct3, imm uint32) uint32 { // OP-IMM x3, x1, imm
+		return assembleI(0b0010011, 3, funct3, 1, imm)
+	}
+
+	tests := []struct {
+		name         string
+		instruction  uint32
+		xlen         uint32
+		rs1, rs2     uint64
+		expected     uint64
+		expectedTrap bool
+	}{
+		// Zbkb
+		{"PACK", op(0b0000100, 0b100), 32, 0x12345678, 0xABCD, 0xFFFFFFFFABCD5678, false},
+		{"PACK RV64", op(0b0000100, 0b100), 64, 0xFFFFFFFF12345678, 0xABCD, 0x0000ABCD12345678, false},
+		{"PACKH", op(0b0000100, 0b111), 32, 0x1234, 0x56AB, 0xAB34, false},
+		{"PACKW", assembleR(0b0111011, 3, 0b100, 1, 2, 0b0000100), 64, 0x1234, 0x8000, 0xFFFFFFFF80001234, false},
+		{"PACKW RV32", assembleR(0b0111011, 3, 0b100, 1, 2, 0b0000100), 32, 0x1234, 0x8000, 0, true},
+		{"BREV8", opImm(0b101, 0x687), 32, 0x01020380, 0, 0xFFFFFFFF8040C001, false},
+		{"ZIP", opImm(0b001, 0x08F), 32, 0x12345678, 0, 0x131C1F60, false},
+		{"UNZIP", opImm(0b101, 0x08F), 32, 0x131C1F60, 0, 0x12345678, false},
+		{"ZIP RV64", opImm(0b001, 0x08F), 64, 0x12345678, 0, 0, true},
+		// Zbkx
+		{"XPERM8", op(0b0010100, 0b100), 32, 0x44332211, 0x00010203, 0x11223344, false},
+		{"XPERM8 out of range", op(0b0010100, 0b100), 32, 0x44332211, 0x04000000, 0x00111111, false},
+		{"XPERM4", op(0b0010100, 0b010), 32, 0xFEDCBA98, 0x00000008, 0xFFFFFFFF88888880, false},
+		{"XPERM4 RV64", op(0b0010100, 0b010), 64, 0xFEDCBA9876543210, 0x0123456789ABCDEF, 0x0123456789ABCDEF, false},
+		// Zknh: the initial hash values and the first message word of SHA-256("abc")
+		{"SHA256SUM0", opImm(0b001, 0x100), 32, 0x6A09E667, 0, 0xFFFFFFFFCE20B47E, false},
+		{"SHA256SUM1", opImm(0b001, 0x101), 32, 0x510E527F, 0, 0x3587272B, false},
+		{"SHA256SIG0", opImm(0b001, 0x102), 32, 0x61626380, 0, 0xFFFFFFFF940E90EF, false},
+		{"SHA256SIG1", opImm(0b001, 0x103), 32, 0x00000018, 0, 0x000F0000, false},
+		{"SHA256SUM0 RV64", opImm(0b001, 0x100), 64, 0xFFFFFFFF6A09E667, 0, 0xFFFFFFFFCE20B47E, false},
+		// Zkne and Zknd: S-box values of FIPS-197
+		{"AES32ESI", op(0b0010001, 0), 32, 0, 0x53, 0xED, false},
+		{"AES32ESI byte 2", op(0b1010001, 0), 32, 0, 0x00530000, 0x00ED0000, false},
+		{"AES32ESI XOR rs1", op(0b0010001, 0), 32, 0xFFFFFFFF, 0, 0xFFFFFFFFFFFFFF9C, false},
+		{"AES32DSI byte 1", op(0b0110101, 0), 32, 0, 0xED00, 0x5300, false},
+		{"AES32DSI of 0x63", op(0b0010101, 0), 32, 0x1234, 0x63, 0x1234, false},
+		{"AES32ESMI RV64", op(0b0010011, 0), 64, 0, 0, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initMemory(&memory, 64, 0)
+			initCPUState(&cpu, 0, 0)
+			cpu.xlen = test.xlen
+			cpu.csr[csrMtvec] = 0x20
+
+			memory.Store32(0, test.instruction)
+			writeRegister(&cpu, 1, test.rs1)
+			writeRegister(&cpu, 2, test.rs2)
+
+			executeInstruction(&cpu, &memory)
+
+			if test.expectedTrap {
+				if cpu.pc != 0x20 || cpu.csr[csrMcause] != causeIllegalInstruction {
+					t.Errorf("expected an illegal instruction trap, got pc=0x%x mcause=%d", cpu.pc, cpu.csr[csrMcause])
+				}
+				return
+			}
+			if cpu.pc != 4 {
+				t.Errorf("expected pc=0x4, got pc=0x%x mcause=%d", cpu.pc, cpu.csr[csrMcause])
+			}
+			if cpu.x[3] != test.expected {
+				t.Errorf("expected x3=0x%x, got x3=0x%x", test.expected, cpu.x[3])
+			}
+		})
+	}
+}
+
+func TestAES32MixColumns(t *testing.T) {
+	// MixColumns example of FIPS-197: db 13 53 45 -> 8e 4d a1 bc, the inputs go through the S-box first
+	tests := []struct {
+		name     string
+		funct7   uint32
+		input    uint64
+		expected uint64
+	}{
+		{"AES32ESMI", 0b10011, 0x6850829F, 0xFFFFFFFFBCA14D8E},
+		{"AES32DSMI", 0b10111, 0x6532E319, 0x455313DB},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cpu CPUState
+			var memory Memory
+
+			initMemory(&memory, 64, 0)
+			initCPUState(&cpu, 0, 0)
+			for bs := uint32(0); bs < 4; bs++ {
+				memory.Store32(bs*4, assembleR(0b0110011, 1, 0, 1, 2, bs<<5|test.funct7)) // x1 = x1 ^ column(x2, bs)
+			}
+			writeRegister(&cpu, 2, test.input)
+
+			for i := 0; i < 4; i++ {
+				executeInstruction(&cpu, &memory)
+			}
+			if cpu.x[1] != test.expected {
+				t.Errorf("expected x1=0x%x, got x1=0x%x", test.expected, cpu.x[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import "fmt"
+
+// CSR addresses
+const (
+	// Floating-point CSRs
+	csrFflags = 0x001
+	csrFrm    = 0x002
+	csrFcsr   = 0x003
+
+	// Vector CSRs
+	csrVstart = 0x008
+	csrVxsat  = 0x009
+	csrVxrm   = 0x00A
+	csrVcsr   = 0x00F
+	csrVl     = 0xC20
+	csrVtype  = 0xC21
+	csrVlenb  = 0xC22
+
+	// Supervisor-mode CSRs
+	csrSstatus    = 0x100
+	csrSie        = 0x104
+	csrStvec      = 0x105
+	csrScounteren = 0x106
+	csrSscratch   = 0x140
+	csrSepc       = 0x141
+	csrScause     = 0x142
+	csrStval      = 0x143
+	csrSip        = 0x144
+	csrSatp       = 0x180
+
+	// Machine-mode CSRs
+	csrMstatus    = 0x300
+	csrMisa       = 0x301
+	csrMedeleg    = 0x302
+	csrMideleg    = 0x303
+	csrMie        = 0x304
+	csrMtvec      = 0x305
+	csrMcounteren = 0x306
+	csrPmpcfg0    = 0x3A0 // pmpcfg0-3, see pmp.go
+	csrPmpcfg3    = 0x3A3
+	csrPmpaddr0   = 0x3B0 // pmpaddr0-15
+	csrMscratch   = 0x340
+	csrMepc       = 0x341
+	csrMcause     = 0x342
+	csrMtval      = 0x343
+	csrMip        = 0x344
+	csrMvendorid  = 0xF11
+	csrMarchid    = 0xF12
+	csrMimpid     = 0xF13
+	csrMhartid    = 0xF14
+	csrMconfigptr = 0xF15
+
+	// Machine counters, the high halves only exist in RV32
+	csrMcycle    = 0xB00
+	csrMinstret  = 0xB02
+	csrMcycleh   = 0xB80
+	csrMinstreth = 0xB82
+
+	// Unprivileged counters (Zicntr), read-only shadows of the machine counters
+	csrCycle    = 0xC00
+	csrTime     = 0xC01
+	csrInstret  = 0xC02
+	csrCycleh   = 0xC80
+	csrTimeh    = 0xC81
+	csrInstreth = 0xC82
+)
+
+// mstatus fields
+const (
+	mstatusSIE  = 1 << 1
+	mstatusMIE  = 1 << 3
+	mstatusSPIE = 1 << 5
+	mstatusMPIE = 1 << 7
+	mstatusSPP  = 1 << 8
+	mstatusVS   = 0b11 << 9 // Vector unit state, encoded as FS
+	mstatusMPP  = 0b11 << mstatusMPPShift
+	mstatusFS   = 0b11 << 13 // Floating-point unit state: Off, Initial, Clean or Dirty
+	mstatusMPRV = 1 << 17    // Modify PRiVilege: loads and stores are translated and checked as in MPP
+	mstatusSUM  = 1 << 18    // permit Supervisor User Memory access
+	mstatusMXR  = 1 << 19    // Make eXecutable Readable
+	mstatusTVM  = 1 << 20    // Trap Virtual Memory: satp and SFENCE.VMA are illegal in S-mode
+	mstatusTW   = 1 << 21    // Timeout Wait: WFI is illegal in S-mode
+	mstatusTSR  = 1 << 22    // Trap SRET: SRET is illegal in S-mode
+	mstatusUXL  = 0b11 << 32 // RV64 only, XLEN of U-mode (read-only 2)
+	mstatusSXL  = 0b11 << 34 // RV64 only, XLEN of S-mode (read-only 2)
+
+	mstatusMPPShift  = 11
+	mstatusFSInitial = 0b01 << 13
+	mstatusFSDirty   = 0b11 << 13
+	mstatusVSInitial = 0b01 << 9
+	mstatusVSDirty   = 0b11 << 9
+
+	mstatusWriteMask = mstatusSIE | mstatusMIE | mstatusSPIE | mstatusMPIE | mstatusSPP | mstatusVS | mstatusMPP |
+		mstatusFS | mstatusMPRV | mstatusSUM | mstatusMXR | mstatusTVM | mstatusTW | mstatusTSR
+	sstatusWriteMask = mstatusSIE | mstatusSPIE | mstatusSPP | mstatusVS | mstatusFS | mstatusSUM | mstatusMXR
+)
+
+// Interrupt enable / pending bits shared by mie and mip (sie and sip are views on their delegated bits)
+const (
+	mipSSIP = 1 << 1
+	mipMSIP = 1 << 3
+	mipSTIP = 1 << 5
+	mipMTIP = 1 << 7
+	mipSEIP = 1 << 9
+	mipMEIP = 1 << 11
+
+	supervisorInterrupts = mipSSIP | mipSTIP | mipSEIP
+)
+
+// Exceptions that can be delegated to S-mode, an ECALL from M-mode always stays in M-mode
+const medelegWriteMask = 0b1011_0011_1111_1111
+
+// Counters that can be made available to lower privilege modes by mcounteren and scounteren: CY, TM and IR
+const counterenWriteMask = 0b111
+
+// misa extensions: one bit per supported extension letter
+const misaExtensions = 1<<('I'-'A') | 1<<('M'-'A') | 1<<('A'-'A') | 1<<('B'-'A') | 1<<('C'-'A') | 1<<('F'-'A') |
+	1<<('D'-'A') | 1<<('S'-'A') | 1<<('U'-'A') | 1<<('V'-'A')
+
+// misa letters of the extensions selected by the ISA string, B stands for Zba, Zbb and Zbs together
+var misaLetters = map[byte][]string{
+	'M': {"m"}, 'A': {"a"}, 'B': {"zba", "zbb", "zbs"}, 'C': {"c"}, 'F': {"f"}, 'D': {"d"}, 'V': {"v"},
+}
+
+// misaValue returns misa: MXL (1 for RV32, 2 for RV64) in the two most significant bits and the extensions.
+func misaValue(cpu *CPUState) uint64 {
+	extensions := uint64(misaExtensions)
+	for letter, names := range misaLetters {
+		for _, name := range names {
+			if !cpu.extensions[name] {
+				extensions &^= 1 << (letter - 'A')
+			}
+		}
+	}
+	if cpu.embedded {
+		extensions = extensions&^(1<<('I'-'A')) | 1<<('E'-'A') // RV32E replaces the I base
+	}
+	if cpu.xlen == 64 {
+		return 2<<62 | extensions
+	}
+	return 1<<30 | extensions
+}
+
+// mstatusSDBit returns mstatus.SD, the read-only summary of FS = Dirty or VS = Dirty held in the most significant bit.
+func mstatusSDBit(cpu *CPUState) uint64 {
+	return 1 << (cpu.xlen - 1)
+}
+
+// readMstatus returns mstatus with its read-only fields: SD, and UXL/SXL in RV64.
+func readMstatus(cpu *CPUState) uint64 {
+	mstatus := cpu.csr[csrMstatus]
+	if mstatus&mstatusFS == mstatusFSDirty || mstatus&mstatusVS == mstatusVSDirty {
+		mstatus |= mstatusSDBit(cpu)
+	}
+	if cpu.xlen == 64 {
+		mstatus |= 2<<32 | 2<<34
+	}
+	return mstatus
+}
+
+// delegatedCSR returns a view on the bits of the M-mode CSR at address that are delegated to S-mode by mideleg,
+// as sie and sip are. Only the delegated bits of writeMask can be modified.
+func delegatedCSR(name string, address uint32, writeMask uint64) CSR {
+	return CSR{
+		name,
+		func(cpu *CPUState) uint64 {
+			return cpu.csr[address] & cpu.csr[csrMideleg]
+		},
+		func(cpu *CPUState, value uint64) {
+			mask := writeMask & cpu.csr[csrMideleg]
+			cpu.csr[address] = (cpu.csr[address] &^ mask) | (value & mask)
+		},
+	}
+}
+
+type CSR struct {
+	Name  string
+	Read  func(cpu *CPUState) uint64
+	Write func(cpu *CPUState, value uint64)
+}
+
+// storedCSR returns a CSR backed by cpu.csr[address] in which only the bits of writeMask can be modified.
+func storedCSR(name string, address uint32, writeMask uint64) CSR {
+	return CSR{
+		name,
+		func(cpu *CPUState) uint64 {
+			return cpu.csr[address]
+		},
+		func(cpu *CPUState, value uint64) {
+			cpu.csr[address] = (cpu.csr[address] &^ writeMask) | (value & writeMask)
+		},
+	}
+}
+
+// IALIGN = 32.
+// IALIGN = 32. The bit is still stored so that it reappears when C is enabled again.
+func exceptionPCCSR(name string, address uint32) CSR {
+	return CSR{
+		name,
+		func(cpu *CPUState) uint64 {
+			return exceptionPC(cpu, address)
+		},
+		storedCSR(name, address, ^uint64(1)).Write,
+	}
+}
+
+// constantCSR returns a CSR that always reads as value and ignores writes.
+func constantCSR(name string, value uint64) CSR {
+	return CSR{
+		name,
+		func(cpu *CPUState) uint64 {
+			return value
+		},
+		func(cpu *CPUState, value uint64) {},
+	}
+}
+
+// floatCSR returns a view on the bits [offset+width-1:offset] of fcsr, writing it marks the FPU state dirty.
+func floatCSR(name string, offset uint32, width uint32) CSR {
+	mask := uint64(1<<width-1) << offset
+	return CSR{
+		name,
+		func(cpu *CPUState) uint64 {
+			return (cpu.csr[csrFcsr] & mask) >> offset
+		},
+		func(cpu *CPUState, value uint64) {
+			cpu.csr[csrFcsr] = (cpu.csr[csrFcsr] &^ mask) | ((value << offset) & mask)
+			markFloatStateDirty(cpu)
+		},
+	}
+}
+
+var CSRs = map[uint32]CSR{
+	// Floating-point control and status
+	csrFflags: floatCSR("fflags", 0, 5),
+	csrFrm:    floatCSR("frm", 5, 3),
+	csrFcsr:   floatCSR("fcsr", 0, 8),
+	// Machine trap setup
+	csrMstatus: {
+		"mstatus",
+		func(cpu *CPUState) uint64 {
+			return readMstatus(cpu)
+		},
+		func(cpu *CPUState, value uint64) {
+			if (value&mstatusMPP)>>mstatusMPPShift == 2 {
+				value = value&^mstatusMPP | cpu.csr[csrMstatus]&mstatusMPP // 2 is reserved, MPP keeps its value
+			}
+			cpu.csr[csrMstatus] = value & mstatusWriteMask
+		},
+	},
+	csrMisa: {
+		"misa",
+		func(cpu *CPUState) uint64 {
+			return misaValue(cpu)
+		},
+		func(cpu *CPUState, value uint64) {},
+	},
+	csrMedeleg:    storedCSR("medeleg", csrMedeleg, medelegWriteMask),
+	csrMideleg:    storedCSR("mideleg", csrMideleg, supervisorInterrupts),
+	csrMie:        storedCSR("mie", csrMie, mipMSIP|mipMTIP|mipMEIP|supervisorInterrupts),
+	csrMtvec:      storedCSR("mtvec", csrMtvec, ^uint64(0b10)), // MODE is either direct (0) or vectored (1)
+	csrMcounteren: storedCSR("mcounteren", csrMcounteren, counterenWriteMask),
+	// Machine trap handling
+	csrMscratch: storedCSR("mscratch", csrMscratch, ^uint64(0)),
+	csrMepc:     exceptionPCCSR("mepc", csrMepc),
+	csrMcause:   storedCSR("mcause", csrMcause, ^uint64(0)),
+	csrMtval:    storedCSR("mtval", csrMtval, ^uint64(0)),
+	csrMip:      storedCSR("mip", csrMip, supervisorInterrupts), // The M-mode bits are driven by the interrupt sources
+	// Supervisor trap setup, sstatus is a restricted view on mstatus
+	csrSstatus: {
+		"sstatus",
+		func(cpu *CPUState) uint64 {
+			return readMstatus(cpu) & (sstatusWriteMask | mstatusUXL | mstatusSDBit(cpu))
+		},
+		func(cpu *CPUState, value uint64) {
+			cpu.csr[csrMstatus] = (cpu.csr[csrMstatus] &^ sstatusWriteMask) | (value & sstatusWriteMask)
+		},
+	},
+	csrSie:        delegatedCSR("sie", csrMie, supervisorInterrupts),
+	csrStvec:      storedCSR("stvec", csrStvec, ^uint64(0b10)),
+	csrScounteren: storedCSR("scounteren", csrScounteren, counterenWriteMask),
+	// Supervisor trap handling
+	csrSscratch: storedCSR("sscratch", csrSscratch, ^uint64(0)),
+	csrSepc:     exceptionPCCSR("sepc", csrSepc),
+	csrScause:   storedCSR("scause", csrScause, ^uint64(0)),
+	csrStval:    storedCSR("stval", csrStval, ^uint64(0)),
+	csrSip:      delegatedCSR("sip", csrMip, mipSSIP), // Only the software interrupt can be cleared by S-mode
+	// Supervisor protection and translation
+	csrSatp: {
+		"satp",
+		func(cpu *CPUState) uint64 {
+			return cpu.csr[csrSatp]
+		},
+		func(cpu *CPUState, value uint64) {
+			if cpu.xlen == 64 {
+				if value>>60 != 0 {
+					return // Only Bare is supported in RV64, writing another mode leaves satp unchanged
+				}
+				cpu.csr[csrSatp] = value
+				return
+			}
+			cpu.csr[csrSatp] = value & (satpModeSv32 | satpASID | satpPPN)
+		},
+	},
+	// Machine information registers
+	csrMvendorid:  constantCSR("mvendorid", 0),
+	csrMarchid:    constantCSR("marchid", 0),
+	csrMimpid:     constantCSR("mimpid", 0),
+	csrMhartid:    constantCSR("mhartid", 0),
+	csrMconfigptr: constantCSR("mconfigptr", 0),
+	// Machine counters
+	csrMcycle:    counterCSR("mcycle", csrMcycle, false),
+	csrMinstret:  counterCSR("minstret", csrMinstret, false),
+	csrMcycleh:   counterCSR("mcycleh", csrMcycle, true),
+	csrMinstreth: counterCSR("minstreth", csrMinstret, true),
+	// Unprivileged counters
+	csrCycle:    counterCSR("cycle", csrMcycle, false),
+	csrTime:     timeCSR("time", false),
+	csrInstret:  counterCSR("instret", csrMinstret, false),
+	csrCycleh:   counterCSR("cycleh", csrMcycle, true),
+	csrTimeh:    timeCSR("timeh", true),
+	csrInstreth: counterCSR("instreth", csrMinstret, true),
+}
+
+// isReadOnlyCSR reports whether the CSR address is in a read-only range (address[11:10] = 0b11).
+func isReadOnlyCSR(address uint32) bool {
+	return (address>>10)&0b11 == 0b11
+}
+
+// isCounterEnabled reports whether an unprivileged counter CSR can be read from the current mode: S-mode needs
+// its bit in mcounteren, U-mode in both mcounteren and scounteren.
+func isCounterEnabled(cpu *CPUState, address uint32) bool {
+	bit := counterBit(address)
+	if cpu.privilege < privilegeMachine && cpu.csr[csrMcounteren]&bit == 0 {
+		return false
+	}
+	return cpu.privilege != privilegeUser || cpu.csr[csrScounteren]&bit != 0
+}
+
+// isCSRAccessible reports whether an implemented CSR can currently be accessed.
+func isCSRAccessible(cpu *CPUState, address uint32) bool {
+	if uint64(address>>8)&0b11 > cpu.privilege {
+		return false // address[9:8] is the lowest privilege mode allowed to access the CSR
+	}
+	if (address >= csrCycle && address <= csrInstret) || (address >= csrCycleh && address <= csrInstreth) {
+		if !cpu.extensions["zicntr"] || !isCounterEnabled(cpu, address) {
+			return false
+		}
+	}
+	if address >= csrFflags && address <= csrFcsr {
+		return cpu.csr[csrMstatus]&mstatusFS != 0 // The floating-point CSRs are illegal while the FPU is off
+	}
+	if (address >= csrVstart && address <= csrVcsr) || (address >= csrVl && address <= csrVlenb) {
+		return cpu.csr[csrMstatus]&mstatusVS != 0 // Same for the vector CSRs and the vector unit
+	}
+	if address == csrSatp && cpu.privilege == privilegeSupervisor && cpu.csr[csrMstatus]&mstatusTVM != 0 {
+		return false
+	}
+	if isHighCounterCSR(address) {
+		return cpu.xlen == 32 // RV64 reads the whole counter through the low CSR
+	}
+	if isOddPmpcfgCSR(address) {
+		return cpu.xlen == 32
+	}
+	return true
+}
+
+func csrName(address uint32) string {
+	if csr, found := CSRs[address]; found {
+		return csr.Name
+	}
+	return fmt.Sprintf("0x%03x", address)
+}
+
+// accessCSR implements the atomic read-modify-write of the Zicsr instructions.
+// The CSR is only read when read is set and only written when write is set, so that side effects are skipped
+// as required by the specification (CSRRW with rd = x0, CSRRS/CSRRC with rs1 = x0). CSRs are XLEN bits wide.
+func accessCSR(cpu *CPUState, rd uint32, address uint32, read bool, write bool, modify func(old uint64) uint64) {
+	csr, found := CSRs[address]
+	if !found || !isCSRAccessible(cpu, address) || (write && isReadOnlyCSR(address)) {
+		raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+		return
+	}
+
+	var old uint64
+	if read {
+		old = csr.Read(cpu) & xlenMask(cpu)
+	}
+	if write {
+		csr.Write(cpu, modify(old)&xlenMask(cpu))
+	}
+	writeRegister(cpu, rd, old)
+}
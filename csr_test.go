@@ -0,0 +1,173 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCSRInstructions(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	tests := []struct {
+		name         string
+		funct3       uint32
+		args         []uint32 // rd, rs1 (or uimm), csr
+		defaultRegs  map[uint32]uint64
+		defaultCSRs  map[uint32]uint64
+		expectedRegs map[uint32]uint64
+		expectedCSRs map[uint32]uint64
+		expectedTrap bool
+	}{
+		{
+			name:         "CSRRW mscratch",
+			funct3:       0b001,
+			args:         []uint32{2, 1, csrMscratch}, // CSRRW x2, mscratch, x1
+			defaultRegs:  map[uint32]uint64{1: 0x1234},
+			defaultCSRs:  map[uint32]uint64{csrMscratch: 0x5678},
+			expectedRegs: map[uint32]uint64{2: 0x5678},
+			expectedCSRs: map[uint32]uint64{csrMscratch: 0x1234},
+		},
+		{
+			name:         "CSRRS mstatus.MIE",
+			funct3:       0b010,
+			args:         []uint32{2, 1, csrMstatus}, // CSRRS x2, mstatus, x1
+			defaultRegs:  map[uint32]uint64{1: mstatusMIE},
+			expectedRegs: map[uint32]uint64{2: mstatusMPP | mstatusFSInitial | mstatusVSInitial},
+			expectedCSRs: map[uint32]uint64{csrMstatus: mstatusMPP | mstatusFSInitial | mstatusVSInitial | mstatusMIE},
+		},
+		{
+			name:         "CSRRC mie",
+			funct3:       0b011,
+			args:         []uint32{2, 1, csrMie}, // CSRRC x2, mie, x1
+			defaultRegs:  map[uint32]uint64{1: mipMTIP},
+			defaultCSRs:  map[uint32]uint64{csrMie: mipMTIP | mipMEIP},
+			expectedRegs: map[uint32]uint64{2: mipMTIP | mipMEIP},
+			expectedCSRs: map[uint32]uint64{csrMie: mipMEIP},
+		},
+		{
+			name:         "CSRRWI mtvec keeps a valid mode",
+			funct3:       0b101,
+			args:         []uint32{0, 0b11, csrMtvec}, // CSRRWI x0, mtvec, 3
+			expectedCSRs: map[uint32]uint64{csrMtvec: 0b01},
+		},
+		{
+			name:         "CSRRSI mscratch",
+			funct3:       0b110,
+			args:         []uint32{2, 0b101, csrMscratch}, // CSRRSI x2, mscratch, 5
+			defaultCSRs:  map[uint32]uint64{csrMscratch: 0b010},
+			expectedRegs: map[uint32]uint64{2: 0b010},
+			expectedCSRs: map[uint32]uint64{csrMscratch: 0b111},
+		},
+		{
+			name:         "CSRRCI mscratch",
+			funct3:       0b111,
+			args:         []uint32{2, 0b101, csrMscratch}, // CSRRCI x2, mscratch, 5
+			defaultCSRs:  map[uint32]uint64{csrMscratch: 0b111},
+			expectedRegs: map[uint32]uint64{2: 0b111},
+			expectedCSRs: map[uint32]uint64{csrMscratch: 0b010},
+		},
+		{
+			name:         "CSRRS read misa",
+			funct3:       0b010,
+			args:         []uint32{2, 0, csrMisa}, // CSRRS x2, misa, x0
+			expectedRegs: map[uint32]uint64{2: 1<<30 | misaExtensions},
+		},
+		{
+			name:         "CSRRS read-only mhartid with rs1 = x0",
+			funct3:       0b010,
+			args:         []uint32{2, 0, csrMhartid}, // CSRRS x2, mhartid, x0
+			defaultRegs:  map[uint32]uint64{2: 0xFF},
+			expectedRegs: map[uint32]uint64{2: 0},
+		},
+		{
+			name:         "CSRRW read-only mhartid",
+			funct3:       0b001,
+			args:         []uint32{2, 1, csrMhartid}, // CSRRW x2, mhartid, x1
+			defaultRegs:  map[uint32]uint64{1: 1, 2: 0xFF},
+			expectedRegs: map[uint32]uint64{2: 0xFF},
+			expectedTrap: true,
+		},
+		{
+			name:         "CSRRS unimplemented CSR",
+			funct3:       0b010,
+			args:         []uint32{2, 0, 0x7C0}, // CSRRS x2, 0x7c0, x0
+			defaultRegs:  map[uint32]uint64{2: 0xFF},
+			expectedRegs: map[uint32]uint64{2: 0xFF},
+			expectedTrap: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initCPUState(&cpu, 0x100, 0)
+			cpu.csr[csrMtvec] = 0x200
+
+			for reg, value := range test.defaultRegs {
+				writeRegister(&cpu, reg, value)
+			}
+			for address, value := range test.defaultCSRs {
+				cpu.csr[address] = value
+			}
+
+			Instructions[[4]uint32{0b1110011, test.funct3, 0, 0}].Exec(&cpu, &memory, test.args...)
+
+			for reg, expected := range test.expectedRegs {
+				if cpu.x[reg] != expected {
+					t.Errorf("expected x%d=0x%x, got x%d=0x%x", reg, expected, reg, cpu.x[reg])
+				}
+			}
+			for address, expected := range test.expectedCSRs {
+				if value := CSRs[address].Read(&cpu); value != expected {
+					t.Errorf("expected %s=0x%x, got %s=0x%x", csrName(address), expected, csrName(address), value)
+				}
+			}
+
+			if test.expectedTrap {
+				if cpu.pc != 0x200 || cpu.csr[csrMcause] != causeIllegalInstruction || cpu.csr[csrMepc] != 0x100 {
+					t.Errorf("expected an illegal instruction trap, got pc=0x%x mcause=%d mepc=0x%x",
+						cpu.pc, cpu.csr[csrMcause], cpu.csr[csrMepc])
+				}
+			} else if cpu.pc != 0x100 {
+				t.Errorf("expected no trap, got pc=0x%x mcause=%d", cpu.pc, cpu.csr[csrMcause])
+			}
+		})
+	}
+}
+
+func TestMisaRV64(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initCPUState(&cpu, 0, 0)
+	cpu.xlen = 64
+
+	Instructions[[4]uint32{0b1110011, 0b010, 0, 0}].Exec(&cpu, &memory, 2, 0, csrMisa) // CSRRS x2, misa, x0
+
+	if expected := uint64(2<<62 | misaExtensions); cpu.x[2] != expected {
+		t.Errorf("expected misa=0x%x, got misa=0x%x", expected, cpu.x[2])
+	}
+}
+
+func TestSupervisorCSRViews(t *testing.T) {
+	var cpu CPUState
+
+	initCPUState(&cpu, 0, 0)
+	cpu.csr[csrMideleg] = mipSSIP | mipSTIP
+	cpu.csr[csrMie] = mipMTIP | mipSTIP | mipSEIP
+
+	CSRs[csrSstatus].Write(&cpu, ^uint64(0))
+	if expected := uint64(privilegeMachine<<mstatusMPPShift | sstatusWriteMask); cpu.csr[csrMstatus] != expected {
+		t.Errorf("expected sstatus to only write its fields, got mstatus=0x%x", cpu.csr[csrMstatus])
+	}
+	if value := CSRs[csrSie].Read(&cpu); value != mipSTIP {
+		t.Errorf("expected sie=0x%x, got sie=0x%x", mipSTIP, value)
+	}
+	CSRs[csrSie].Write(&cpu, mipSSIP)
+	if expected := uint64(mipMTIP | mipSSIP | mipSEIP); cpu.csr[csrMie] != expected {
+		t.Errorf("expected mie=0x%x, got mie=0x%x", expected, cpu.csr[csrMie])
+	}
+	CSRs[csrMstatus].Write(&cpu, 2<<mstatusMPPShift)
+	if cpu.csr[csrMstatus]&mstatusMPP != mstatusMPP {
+		t.Errorf("expected the reserved MPP value to be ignored, got mstatus=0x%x", cpu.csr[csrMstatus])
+	}
+}
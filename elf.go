@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Symbol is a function or a label of the loaded programs, used to show addresses as function+offset.
+type Symbol struct {
+	name    string
+	address uint32
+	size    uint32 // 0 for the labels of assembly programs, they extend to the next symbol
+}
+
+// Symbols of the loaded ELF programs, sorted by address
+var symbols []Symbol
+
+// isELF reports whether a file starts with the ELF magic number.
+func isELF(filename string) bool {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, len(elf.ELFMAG))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, []byte(elf.ELFMAG))
+}
+
+// loadELF copies the PT_LOAD segments of an ELF32 RISC-V program to their physical addresses, the bytes of a
+// segment past its content in the file (.bss) are zeroed. It returns the entry point of the program and adds its
+// functions and labels to symbols.
+func loadELF(memory *Memory, filename string) (uint32, error) {
+	file, err := elf.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if file.Class != elf.ELFCLASS32 || file.Machine != elf.EM_RISCV {
+		return 0, fmt.Errorf("%s is not an ELF32 RISC-V program", filename)
+	}
+
+	for _, segment := range file.Progs {
+		if segment.Type != elf.PT_LOAD || segment.Memsz == 0 {
+			continue
+		}
+		// Checked before any allocation: Memsz comes straight from the file
+		if segment.Filesz > segment.Memsz || segment.Memsz >= 1<<32 || segment.Paddr+segment.Memsz > 1<<32 ||
+			!isPhysicalAccessValid(memory, segment.Paddr, uint32(segment.Memsz), accessStore) {
+			return 0, fmt.Errorf("%s: segment of %d bytes does not fit in memory at 0x%08x", filename, segment.Memsz, segment.Paddr)
+		}
+		data := make([]byte, segment.Memsz)
+		if _, err := io.ReadFull(segment.Open(), data[:segment.Filesz]); err != nil {
+			return 0, fmt.Errorf("%s: %v", filename, err)
+		}
+		for i, value := range data {
+			memory.Store8(uint32(segment.Paddr)+uint32(i), value)
+		}
+	}
+
+	// A stripped program still runs, its addresses are shown raw
+	programSymbols, err := file.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return 0, fmt.Errorf("%s: %v", filename, err)
+	}
+	for _, symbol := range programSymbols {
+		kind := elf.ST_TYPE(symbol.Info)
+		if (kind != elf.STT_FUNC && kind != elf.STT_NOTYPE) || symbol.Section == elf.SHN_UNDEF ||
+			symbol.Name == "" || strings.HasPrefix(symbol.Name, "$") || strings.HasPrefix(symbol.Name, ".L") {
+			continue
+		}
+		symbols = append(symbols, Symbol{symbol.Name, uint32(symbol.Value), uint32(symbol.Size)})
+	}
+	sort.SliceStable(symbols, func(i, j int) bool { return symbols[i].address < symbols[j].address })
+	return uint32(file.Entry), nil
+}
+
+// symbolize returns an address as function+offset, or "" when no symbol holds it.
+func symbolize(address uint64) string {
+	next := sort.Search(len(symbols), func(i int) bool { return uint64(symbols[i].address) > address })
+	if next == 0 {
+		return ""
+	}
+	symbol := symbols[next-1]
+	offset := address - uint64(symbol.address)
+	if symbol.size != 0 && offset >= uint64(symbol.size) {
+		return ""
+	}
+	if offset == 0 {
+		return symbol.name
+	}
+	return fmt.Sprintf("%s+0x%x", symbol.name, offset)
+}
+
+// formatAddress returns an address as function+offset when a symbol holds it, in hexadecimal otherwise.
+func formatAddress(address uint64) string {
+	if name := symbolize(address); name != "" {
+		return name
+	}
+	return fmt.Sprintf("0x%08x", address)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testSegment is a PT_LOAD segment of the ELF files built by writeTestELF
+type testSegment struct {
+	virtual, physical uint32
+	data              []byte
+	size              uint32 // Size in memory, the bytes past data are .bss
+}
+
+// writeTestELF writes an ELF32 RISC-V executable made of segments and of a symbol table holding symbols.
+func writeTestELF(t *testing.T, path string, machine elf.Machine, entry uint32, segments []testSegment, symbols []elf.Sym32, names string) {
+	const headerSize, programHeaderSize, sectionHeaderSize, symbolSize = 52, 32, 40, 16
+	shstrtab := "\x00.symtab\x00.strtab\x00.shstrtab\x00"
+
+	var content bytes.Buffer
+	offset := uint32(headerSize + programHeaderSize*len(segments))
+	var programs []elf.Prog32
+	for _, segment := range segments {
+		programs = append(programs, elf.Prog32{Type: uint32(elf.PT_LOAD), Off: offset, Vaddr: segment.virtual, Paddr: segment.physical,
+			Filesz: uint32(len(segment.data)), Memsz: segment.size, Flags: uint32(elf.PF_R | elf.PF_W | elf.PF_X), Align: 4})
+		content.Write(segment.data)
+		offset += uint32(len(segment.data))
+	}
+	symtab := offset
+	binary.Write(&content, binary.LittleEndian, append([]elf.Sym32{{}}, symbols...))
+	strtab := symtab + uint32(symbolSize*(len(symbols)+1))
+	content.WriteString(names)
+	shstrtabOffset := strtab + uint32(len(names))
+	content.WriteString(shstrtab)
+	sections := []elf.Section32{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_SYMTAB), Off: symtab, Size: uint32(symbolSize * (len(symbols) + 1)), Link: 2, Info: 1, Entsize: symbolSize},
+		{Name: 9, Type: uint32(elf.SHT_STRTAB), Off: strtab, Size: uint32(len(names))},
+		{Name: 17, Type: uint32(elf.SHT_STRTAB), Off: shstrtabOffset, Size: uint32(len(shstrtab))},
+	}
+
+	header := elf.Header32{Type: uint16(elf.ET_EXEC), Machine: uint16(machine), Version: uint32(elf.EV_CURRENT), Entry: entry,
+		Phoff: headerSize, Shoff: shstrtabOffset + uint32(len(shstrtab)), Ehsize: headerSize, Phentsize: programHeaderSize,
+		Phnum: uint16(len(segments)), Shentsize: sectionHeaderSize, Shnum: uint16(len(sections)), Shstrndx: 3}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS], header.Ident[elf.EI_DATA], header.Ident[elf.EI_VERSION] = byte(elf.ELFCLASS32), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)
+
+	var file bytes.Buffer
+	binary.Write(&file, binary.LittleEndian, header)
+	binary.Write(&file, binary.LittleEndian, programs)
+	file.Write(content.Bytes())
+	binary.Write(&file, binary.LittleEndian, sections)
+	if err := os.WriteFile(path, file.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadELF(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+	defer func() { symbols = nil }()
+
+	// _start: LUI a0, 0x80001 ; loop: LW a1, 4(a0) ; J loop
+	text := []byte{0x37, 0x15, 0x00, 0x80, 0x83, 0x25, 0x45, 0x00, 0xEF, 0xF0, 0xDF, 0xFF}
+	segments := []testSegment{
+		{0x80000000, 0x80000000, text, uint32(len(text))},
+		{0x00001000, 0x80001000, []byte{0x44, 0x33, 0x22, 0x11}, 16}, // .data then .bss, linked at another address
+	}
+	names := "\x00_start\x00loop\x00$x\x00buffer\x00"
+	programSymbols := []elf.Sym32{
+		{Name: 1, Value: 0x80000000, Size: 4, Info: elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC), Shndx: 1},
+		{Name: 8, Value: 0x80000004, Info: elf.ST_INFO(elf.STB_LOCAL, elf.STT_NOTYPE), Shndx: 1},
+		{Name: 13, Value: 0x80000000, Info: elf.ST_INFO(elf.STB_LOCAL, elf.STT_NOTYPE), Shndx: 1},
+		{Name: 16, Value: 0x80001000, Size: 16, Info: elf.ST_INFO(elf.STB_GLOBAL, elf.STT_OBJECT), Shndx: 1},
+	}
+	path := filepath.Join(t.TempDir(), "program.elf")
+	writeTestELF(t, path, elf.EM_RISCV, 0x80000000, segments, programSymbols, names)
+
+	initPagedMemory(&memory, 1024*1024, 0xFFFFFFFF)
+	entry, err := loadImage(&memory, Image{path, 0, false})
+	if err != nil {
+		t.Fatalf("unexpected error loading the ELF file: %v", err)
+	}
+	if entry != 0x80000000 {
+		t.Errorf("expected the entry point 0x80000000, got 0x%x", entry)
+	}
+
+	tests := []struct {
+		name     string
+		address  uint32
+		expected uint32
+	}{
+		{"text", 0x80000004, 0x00452583},
+		{"data at its physical address", 0x80001000, 0x11223344},
+		{"bss is zeroed", 0x80001004, 0},
+		{"end of bss", 0x8000100C, 0},
+		{"past the segment", 0x80001010, 0xFFFFFFFF},
+		{"nothing at the virtual address", 0x00001000, 0xFFFFFFFF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if value := memory.Load32(test.address); value != test.expected {
+				t.Errorf("expected 0x%x at 0x%x, got 0x%x", test.expected, test.address, value)
+			}
+		})
+	}
+
+	resetCPU(&cpu, entry, 0)
+	for i := 0; i < 3; i++ {
+		executeInstruction(&cpu, &memory)
+	}
+	if cpu.pc != 0x80000004 || cpu.x[11] != 0 {
+		t.Errorf("expected the program to loop with a1=0, got pc=0x%x a1=0x%x", cpu.pc, cpu.x[11])
+	}
+}
+
+func TestSymbolize(t *testing.T) {
+	defer func() { symbols = nil }()
+	symbols = []Symbol{{"_start", 0x80000000, 4}, {"loop", 0x80000004, 0}, {"handler", 0x80000100, 8}}
+
+	tests := []struct {
+		address  uint64
+		expected string
+	}{
+		{0x80000000, "_start"},
+		{0x80000002, "_start+0x2"},
+		{0x80000004, "loop"},
+		{0x80000010, "loop+0xc"},
+		{0x80000104, "handler+0x4"},
+		{0x80000108, "0x80000108"}, // Past the size of handler
+		{0x7FFFFFFC, "0x7ffffffc"},
+	}
+
+	for _, test := range tests {
+		if name := formatAddress(test.address); name != test.expected {
+			t.Errorf("expected 0x%x to be shown as %s, got %s", test.address, test.expected, name)
+		}
+	}
+}
+
+func TestLoadELFErrors(t *testing.T) {
+	var memory Memory
+	defer func() { symbols = nil }()
+	directory := t.TempDir()
+
+	tests := []struct {
+		name     string
+		machine  elf.Machine
+		segments []testSegment
+	}{
+		{"Not RISC-V", elf.EM_X86_64, []testSegment{{0x80000000, 0x80000000, []byte{0x13, 0, 0, 0}, 4}}},
+		{"Segment over the RAM limit", elf.EM_RISCV, []testSegment{{0x80000000, 0x80000000, []byte{0x13, 0, 0, 0}, 2 * pageSize}}},
+		{"Segment outside of the address space", elf.EM_RISCV, []testSegment{{0xFFFFFFFC, 0xFFFFFFFC, []byte{0x13, 0, 0, 0}, 8}}},
+		{"Largest segment size", elf.EM_RISCV, []testSegment{{0x80000000, 0x80000000, []byte{0x13, 0, 0, 0}, 0xFFFFFFFF}}},
+		{"Largest segment size at 0", elf.EM_RISCV, []testSegment{{0, 0, []byte{0x13, 0, 0, 0}, 0xFFFFFFFF}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(directory, "program.elf")
+			writeTestELF(t, path, test.machine, 0x80000000, test.segments, nil, "\x00")
+			initPagedMemory(&memory, pageSize, 0)
+			if _, err := loadImage(&memory, Image{path, 0, false}); err == nil {
+				t.Errorf("expected an error loading the ELF file")
+			}
+		})
+	}
+}
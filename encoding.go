@@ -4,7 +4,7 @@ import "fmt"
 
 func decodeI(opcode Opcode, instruction uint32, cpu *CPUState, memory *Memory) string {
 	// [31:20] imm[11:0] [19:15] rs1 [14:12] funct3 [11:7] rd [6:0] opcode
-	imm := uint32(instruction) >> 20
+	imm := signExtend(instruction>>20, 12)
 	rd := (instruction >> 7) & 0x1F
 	rs1 := (instruction >> 15) & 0x1F
 
@@ -12,24 +12,60 @@ func decodeI(opcode Opcode, instruction uint32, cpu *CPUState, memory *Memory) s
 	funct7 := uint32(0)
 	funct12 := uint32(0)
 
-	if opcode.Type == "OP-IMM" && funct3 == 0b101 {
-		funct7 = instruction >> 25
+	if (opcode.Type == "OP-IMM" || opcode.Type == "OP-IMM-32") && (funct3 == 0b001 || funct3 == 0b101) {
+		funct7 = instruction >> 25 // Selects between the shifts and the Zbb/Zbs operations
+		imm &= 0x1F                // shamt
+		wideShift := opcode.Type == "OP-IMM" && cpu.xlen == 64 || opcode.Type == "OP-IMM-32" && funct7>>1 == 0b000010
+		if wideShift && !isSelectedByRs2(instruction&0x7F, funct3, funct7) {
+			// RV64 shifts and SLLI.UW have a 6-bit shamt [25:20] and a funct6 [31:26]
+			funct7 = (instruction >> 26) << 1
+			imm = (instruction >> 20) & 0x3F
+		}
 	}
 	if opcode.Type == "SYSTEM" {
-		funct12 = instruction >> 20
+		imm = instruction >> 20 // funct12 or CSR address, not sign-extended
+		if funct3 == 0 {
+			funct12 = instruction >> 20
+			if funct12>>5 == 0b0001001 {
+				funct12 &^= 0x1F // SFENCE.VMA: [24:20] holds rs2
+			}
+		}
+	}
+	vector := opcode.Type == "LOAD-FP" && isVectorWidth(funct3)
+	if vector {
+		// [31:29] nf [28] mew [27:26] mop [25] vm [24:20] lumop or rs2 : imm holds vm and lumop or rs2
+		funct7 = instruction >> 26
+		imm = (instruction >> 20) & 0x3F
+		if funct7 == vectorUnitStride {
+			funct12 = imm & 0x1F
+		}
 	}
 
-	inst, err := FindInstruction(instruction, funct3, funct7, funct12)
+	inst, err := FindInstruction(cpu, instruction, funct3, funct7, funct12)
+	if err == nil && opcode.Type == "SYSTEM" && funct3 == 0 && (rd != 0 || rs1 != 0 && funct12 != 0b000100100000) {
+		// ECALL, EBREAK, xRET and WFI have no operands and SFENCE.VMA only rs1 and rs2: the other encodings are reserved
+		err = fmt.Errorf("instruction %s with rd = x%d and rs1 = x%d is reserved", inst.Name, rd, rs1)
+	}
 	if err == nil {
-		inst.Exec(cpu, memory, rd, rs1, imm)
-		if opcode.Type == "OP-IMM" {
+		execute(inst, cpu, memory, rd, rs1, imm)
+		if isSelectedByRs2(instruction&0x7F, funct3, funct7) {
+			return fmt.Sprintf("%s x%d, x%d\n", inst.Name, rd, rs1)
+		} else if opcode.Type == "OP-IMM" || opcode.Type == "OP-IMM-32" {
 			return fmt.Sprintf("%s x%d, x%d, %d\n", inst.Name, rd, rs1, imm)
-		} else if opcode.Type == "SYSTEM" {
+		} else if opcode.Type == "SYSTEM" && funct3 == 0 && funct12 == 0b000100100000 {
+			return fmt.Sprintf("%s x%d, x%d\n", inst.Name, rs1, imm&0x1F)
+		} else if opcode.Type == "SYSTEM" && funct3 == 0 {
 			return fmt.Sprintf("%s x%d, %d\n", inst.Name, rd, imm)
+		} else if opcode.Type == "SYSTEM" && funct3&0b100 == 0 {
+			return fmt.Sprintf("%s x%d, %s, x%d\n", inst.Name, rd, csrName(imm), rs1)
+		} else if opcode.Type == "SYSTEM" {
+			return fmt.Sprintf("%s x%d, %s, %d\n", inst.Name, rd, csrName(imm), rs1)
+		} else if vector {
+			return fmt.Sprintf("%s v%d, (x%d)%s\n", inst.Name, rd, rs1, vectorAccessOperands(funct7, imm&0x1F, imm>>5))
 		}
 		return fmt.Sprintf("%s x%d, x%d, %d\n", inst.Name, rd, rs1, imm)
 	} else {
-		return fmt.Sprintf("%s\n", err.Error())
+		return illegalInstruction(cpu, err)
 	}
 }
 
@@ -42,30 +78,271 @@ func decodeR(opcode Opcode, instruction uint32, cpu *CPUState, memory *Memory) s
 	funct3 := (instruction >> 12) & 0x7
 	funct7 := instruction >> 25
 
-	inst, err := FindInstruction(instruction, funct3, funct7, 0)
+	funct12 := uint32(0)
+	rm := funct3
+
+	if opcode.Type == "AMO" {
+		// [31:27] funct5 [26] aq [25] rl : the ordering bits are accepted and ignored
+		funct7 = instruction >> 27
+	}
+	if opcode.Type == "OP-FP" {
+		// [31:27] funct5 [26:25] fmt : funct3 is either the rounding mode or selects the operation
+		if floatRoundedOperations[funct7>>2] {
+			funct3 = 0
+		}
+		if floatOperationsSelectedByRs2[funct7>>2] {
+			funct12 = rs2
+		}
+	}
+
+	inst, err := FindInstruction(cpu, instruction, funct3, funct7, funct12)
 	if err == nil {
-		inst.Exec(cpu, memory, rd, rs1, rs2)
+		execute(inst, cpu, memory, rd, rs1, rs2, rm)
+		if opcode.Type == "OP-FP" {
+			return fmt.Sprintf("%s f%d, f%d, f%d\n", inst.Name, rd, rs1, rs2)
+		} else if isSelectedByRs2(instruction&0x7F, funct3, funct7) {
+			return fmt.Sprintf("%s x%d, x%d\n", inst.Name, rd, rs1)
+		}
 		return fmt.Sprintf("%s x%d, x%d, x%d\n", inst.Name, rd, rs1, rs2)
 	} else {
-		return fmt.Sprintf("%s\n", err.Error())
+		return illegalInstruction(cpu, err)
+	}
+}
+
+// OP-FP operations (funct7[6:2]) whose funct3 field holds a rounding mode
+var floatRoundedOperations = map[uint32]bool{
+	0b00000: true, // FADD
+	0b00001: true, // FSUB
+	0b00010: true, // FMUL
+	0b00011: true, // FDIV
+	0b01011: true, // FSQRT
+	0b01000: true, // FCVT between float formats
+	0b11000: true, // FCVT float to integer
+	0b11010: true, // FCVT integer to float
+}
+
+// OP-FP operations (funct7[6:2]) that are also selected by their rs2 field
+var floatOperationsSelectedByRs2 = map[uint32]bool{
+	0b01011: true, // FSQRT
+	0b01000: true, // FCVT between float formats
+	0b11000: true, // FCVT float to integer
+	0b11010: true, // FCVT integer to float
+	0b11100: true, // FMV to integer, FCLASS
+	0b11110: true, // FMV from integer
+}
+
+// OP-FP operations (funct7[6:2]) with an integer destination or source register
+var (
+	floatOperationsWithIntegerRd = map[uint32]bool{
+		0b10100: true, // FEQ, FLT, FLE
+		0b11000: true, // FCVT float to integer
+		0b11100: true, // FMV to integer, FCLASS
+	}
+	floatOperationsWithIntegerRs1 = map[uint32]bool{
+		0b11010: true, // FCVT integer to float
+		0b11110: true, // FMV from integer
+	}
+)
+
+// referencesUpperRegister reports whether an instruction names one of the integer registers x16-x31 that RV32E
+// does not have. Only the fields holding integer registers are checked: float registers, immediates and the
+// rs2 field of the operations it selects are not.
+func referencesUpperRegister(opcode Opcode, instruction uint32) bool {
+	rd := (instruction >> 7) & 0x1F
+	rs1 := (instruction >> 15) & 0x1F
+	rs2 := (instruction >> 20) & 0x1F
+	funct3 := (instruction >> 12) & 0x7
+
+	var registers []uint32
+	switch opcode.Type {
+	case "OP", "OP-32", "AMO":
+		registers = []uint32{rd, rs1, rs2}
+	case "LOAD", "OP-IMM", "OP-IMM-32", "JALR":
+		registers = []uint32{rd, rs1}
+	case "STORE", "BRANCH":
+		registers = []uint32{rs1, rs2}
+	case "LOAD-FP", "STORE-FP":
+		registers = []uint32{rs1}
+		if isVectorWidth(funct3) && (instruction>>26)&0b11 == vectorStrided {
+			registers = append(registers, rs2) // The stride
+		}
+	case "OP-V":
+		if funct3 == vectorOPIVX || funct3 == vectorOPMVX {
+			registers = []uint32{rs1}
+		} else if funct3 == vectorOPMVV && instruction>>26 == 0b010000 {
+			registers = []uint32{rd} // VMV.X.S, VCPOP.M, VFIRST.M
+		} else if funct3 == vectorOPCFG {
+			registers = []uint32{rd}
+			if instruction>>30 != 0b11 {
+				registers = append(registers, rs1) // vsetivli holds a uimm in the rs1 field
+			}
+			if instruction>>25 == 0b1000000 {
+				registers = append(registers, rs2) // vsetvl
+			}
+		}
+	case "LUI", "AUIPC", "JAL":
+		registers = []uint32{rd}
+	case "SYSTEM":
+		registers = []uint32{rd}
+		if funct3&0b100 == 0 {
+			registers = append(registers, rs1) // The immediate forms hold a uimm in the rs1 field
+		}
+		if funct3 == 0 && instruction>>25 == 0b0001001 {
+			registers = append(registers, rs2) // SFENCE.VMA
+		}
+	case "OP-FP":
+		if floatOperationsWithIntegerRd[instruction>>27] {
+			registers = []uint32{rd}
+		} else if floatOperationsWithIntegerRs1[instruction>>27] {
+			registers = []uint32{rs1}
+		}
+	}
+
+	for _, register := range registers {
+		if register >= 16 {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeR4(opcode Opcode, instruction uint32, cpu *CPUState, memory *Memory) string {
+	// [31:27] rs3 [26:25] fmt [24:20] rs2 [19:15] rs1 [14:12] rm [11:7] rd [6:0] opcode
+	rd := (instruction >> 7) & 0x1F
+	rs1 := (instruction >> 15) & 0x1F
+	rs2 := (instruction >> 20) & 0x1F
+	rs3 := instruction >> 27
+
+	rm := (instruction >> 12) & 0x7
+	format := (instruction >> 25) & 0x3
+
+	inst, err := FindInstruction(cpu, instruction, 0, format, 0)
+	if err == nil {
+		execute(inst, cpu, memory, rd, rs1, rs2, rs3, rm)
+		return fmt.Sprintf("%s f%d, f%d, f%d, f%d\n", inst.Name, rd, rs1, rs2, rs3)
+	} else {
+		return illegalInstruction(cpu, err)
 	}
 }
 
 func decodeS(opcode Opcode, instruction uint32, cpu *CPUState, memory *Memory) string {
 	// [31:25] imm[11:5] [24:20] rs2 [19:15] rs1 [14:12] funct3 [11:7] imm[4:0] [6:0] opcode
-	imm := ((instruction >> 25) << 5) | ((instruction >> 7) & 0x1F)
+	imm := signExtend(((instruction>>25)<<5)|((instruction>>7)&0x1F), 12)
 	rs1 := (instruction >> 15) & 0x1F
 	rs2 := (instruction >> 20) & 0x1F
 
 	funct3 := (instruction >> 12) & 0x7
+	funct7 := uint32(0)
+	funct12 := uint32(0)
 
-	inst, err := FindInstruction(instruction, funct3, 0, 0)
+	vector := opcode.Type == "STORE-FP" && isVectorWidth(funct3)
+	if vector {
+		// [31:29] nf [28] mew [27:26] mop [25] vm [24:20] sumop or rs2 [11:7] vs3 : imm holds vm and vs3
+		funct7 = instruction >> 26
+		imm = ((instruction>>25)&1)<<5 | (instruction>>7)&0x1F
+		if funct7 == vectorUnitStride {
+			funct12 = rs2
+		}
+	}
+
+	inst, err := FindInstruction(cpu, instruction, funct3, funct7, funct12)
 	if err == nil {
-		inst.Exec(cpu, memory, rs1, rs2, imm)
+		execute(inst, cpu, memory, rs1, rs2, imm)
+		if vector {
+			return fmt.Sprintf("%s v%d, (x%d)%s\n", inst.Name, imm&0x1F, rs1, vectorAccessOperands(funct7, rs2, imm>>5))
+		}
 		return fmt.Sprintf("%s x%d, x%d, %d\n", inst.Name, rs1, rs2, imm)
 	} else {
-		return fmt.Sprintf("%s\n", err.Error())
+		return illegalInstruction(cpu, err)
+	}
+}
+
+// vectorAccessOperands returns the operands following the base address of a vector load or store: the stride
+// register of the strided accesses and the mask.
+func vectorAccessOperands(mop uint32, rs2 uint32, vm uint32) string {
+	operands := ""
+	if mop == vectorStrided {
+		operands = fmt.Sprintf(", x%d", rs2)
 	}
+	if vm == 0 {
+		operands += ", v0.t"
+	}
+	return operands
+}
+
+func decodeV(opcode Opcode, instruction uint32, cpu *CPUState, memory *Memory) string {
+	// [31:26] funct6 [25] vm [24:20] vs2 [19:15] vs1/rs1/imm [14:12] funct3 [11:7] vd/rd [6:0] opcode
+	vd := (instruction >> 7) & 0x1F
+	vs1 := (instruction >> 15) & 0x1F
+	vs2 := (instruction >> 20) & 0x1F
+	vm := (instruction >> 25) & 1
+
+	funct3 := (instruction >> 12) & 0x7
+	funct6 := instruction >> 26
+	funct12 := uint32(0)
+
+	if funct3 == vectorOPCFG {
+		// vsetvli [31] = 0, vsetivli [31:30] = 11, vsetvl [31:25] = 1000000 : the rest holds vtype or rs2
+		funct6 = 0
+		if instruction>>30 == 0b11 {
+			funct6 = 0b11
+		} else if instruction>>31 == 1 {
+			funct6 = instruction >> 25
+		}
+		inst, err := FindInstruction(cpu, instruction, funct3, funct6, 0)
+		if err != nil {
+			return illegalInstruction(cpu, err)
+		}
+		execute(inst, cpu, memory, vd, vs1, instruction>>20)
+		if funct6 == 0b1000000 {
+			return fmt.Sprintf("%s x%d, x%d, x%d\n", inst.Name, vd, vs1, vs2)
+		} else if funct6 == 0b11 {
+			return fmt.Sprintf("%s x%d, %d, %#x\n", inst.Name, vd, vs1, (instruction>>20)&0x3FF)
+		}
+		return fmt.Sprintf("%s x%d, x%d, %#x\n", inst.Name, vd, vs1, (instruction>>20)&0x7FF)
+	}
+	if vectorOperationsSelectedByVs1[[2]uint32{funct3, funct6}] {
+		funct12 = vs1
+	}
+
+	inst, err := FindInstruction(cpu, instruction, funct3, funct6, funct12)
+	if err != nil {
+		return illegalInstruction(cpu, err)
+	}
+	execute(inst, cpu, memory, vd, vs1, vs2, vm)
+	name, mask := inst.Name, ""
+	if vm == 0 {
+		mask = ", v0.t"
+	}
+	if funct3 != vectorOPMVV && funct3 != vectorOPMVX && (funct6 == 0b010111 || funct6>>2 == 0b0100) && vm == 0 {
+		// VMERGE and the carry operations read v0 as an operand rather than as a mask
+		mask = ", v0"
+		if funct6 == 0b010001 || funct6 == 0b010011 {
+			name += "M" // VMADC and VMSBC with a carry in
+		}
+	}
+	switch {
+	case funct6 == 0b010111 && vm == 1 && funct3 != vectorOPMVV && funct3 != vectorOPMVX:
+		// VMV.V.V, VMV.V.X and VMV.V.I are the unmasked encodings of VMERGE, with vs2 = v0
+		switch funct3 {
+		case vectorOPIVX:
+			return fmt.Sprintf("VMV.V.X v%d, x%d\n", vd, vs1)
+		case vectorOPIVI:
+			return fmt.Sprintf("VMV.V.I v%d, %d\n", vd, int32(signExtend(vs1, 5)))
+		}
+		return fmt.Sprintf("VMV.V.V v%d, v%d\n", vd, vs1)
+	case funct3 == vectorOPMVV && funct6 == 0b010000:
+		return fmt.Sprintf("%s x%d, v%d%s\n", name, vd, vs2, mask)
+	case funct3 == vectorOPMVX && funct6 == 0b010000:
+		return fmt.Sprintf("%s v%d, x%d\n", name, vd, vs1)
+	case vectorOperationsSelectedByVs1[[2]uint32{funct3, funct6}]:
+		return fmt.Sprintf("%s v%d, v%d%s\n", name, vd, vs2, mask)
+	case funct3 == vectorOPIVX || funct3 == vectorOPMVX:
+		return fmt.Sprintf("%s v%d, v%d, x%d%s\n", name, vd, vs2, vs1, mask)
+	case funct3 == vectorOPIVI:
+		return fmt.Sprintf("%s v%d, v%d, %d%s\n", name, vd, vs2, int32(signExtend(vs1, 5)), mask)
+	}
+	return fmt.Sprintf("%s v%d, v%d, v%d%s\n", name, vd, vs2, vs1, mask)
 }
 
 func decodeU(opcode Opcode, instruction uint32, cpu *CPUState, memory *Memory) string {
@@ -73,43 +350,58 @@ func decodeU(opcode Opcode, instruction uint32, cpu *CPUState, memory *Memory) s
 	imm := instruction >> 12
 	rd := (instruction >> 7) & 0x1F
 
-	inst, err := FindInstruction(instruction, 0, 0, 0)
+	inst, err := FindInstruction(cpu, instruction, 0, 0, 0)
 	if err == nil {
-		inst.Exec(cpu, memory, rd, imm)
+		execute(inst, cpu, memory, rd, imm)
 		return fmt.Sprintf("%s x%d, %d\n", inst.Name, rd, imm)
 	} else {
-		return fmt.Sprintf("%s\n", err.Error())
+		return illegalInstruction(cpu, err)
 	}
 }
 
 func decodeSB(opcode Opcode, instruction uint32, cpu *CPUState, memory *Memory) string {
-	// [31] imm[12] [30:25] imm[10:5] [24:21] funct3 [20:20] imm[11] [19:12] imm[4:1] [11:8] rs2 [7:7] rs1 [6:0] opcode
-	imm := ((instruction >> 31) << 12) | ((instruction >> 25) & 0x3F) | ((instruction >> 8) & 0xF) | ((instruction>>7)&0x1)<<11
+	// [31] imm[12] [30:25] imm[10:5] [24:20] rs2 [19:15] rs1 [14:12] funct3 [11:8] imm[4:1] [7] imm[11] [6:0] opcode
+	imm := signExtend(((instruction>>31)<<12)|((instruction>>25)&0x3F)<<5|((instruction>>8)&0xF)<<1|((instruction>>7)&0x1)<<11, 13)
 	rs1 := (instruction >> 15) & 0x1F
 	rs2 := (instruction >> 20) & 0x1F
 
 	funct3 := (instruction >> 12) & 0x7
 
-	inst, err := FindInstruction(instruction, funct3, 0, 0)
+	inst, err := FindInstruction(cpu, instruction, funct3, 0, 0)
 	if err == nil {
-		inst.Exec(cpu, memory, rs1, rs2, imm)
+		execute(inst, cpu, memory, rs1, rs2, imm)
 		return fmt.Sprintf("%s x%d, x%d, %d\n", inst.Name, rs1, rs2, imm)
 	} else {
-		return fmt.Sprintf("%s\n", err.Error())
+		return illegalInstruction(cpu, err)
 	}
 }
 
 func decodeUJ(opcode Opcode, instruction uint32, cpu *CPUState, memory *Memory) string {
-	// [31] imm[20] [30:21] imm[10:1] [20:20] imm[11] [19:12] rd [11:8] imm[19:12] [7:7] imm[10] [6:0] opcode
-	imm := ((instruction >> 31) << 20) | ((instruction >> 21) & 0x3FF) | ((instruction>>20)&0x1)<<11 | ((instruction>>12)&0xFF)<<12
+	// [31] imm[20] [30:21] imm[10:1] [20] imm[11] [19:12] imm[19:12] [11:7] rd [6:0] opcode
+	imm := signExtend(((instruction>>31)<<20)|((instruction>>21)&0x3FF)<<1|((instruction>>20)&0x1)<<11|((instruction>>12)&0xFF)<<12, 21)
 	rd := (instruction >> 7) & 0x1F
 
-	inst, err := FindInstruction(instruction, 0, 0, 0)
+	inst, err := FindInstruction(cpu, instruction, 0, 0, 0)
 	if err == nil {
-		inst.Exec(cpu, memory, rd, imm)
+		execute(inst, cpu, memory, rd, imm)
 		return fmt.Sprintf("%s x%d, %d\n", inst.Name, rd, imm)
 	} else {
-		return fmt.Sprintf("%s\n", err.Error())
+		return illegalInstruction(cpu, err)
+	}
+}
+
+// illegalInstruction raises an illegal instruction exception for an encoding missing from Instructions.
+func illegalInstruction(cpu *CPUState, err error) string {
+	if !cpu.decodeOnly {
+		raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+	}
+	return fmt.Sprintf("%s\n", err.Error())
+}
+
+// execute runs a decoded instruction, unless the hart is only disassembling it (see disassembleInstruction).
+func execute(instruction Instruction, cpu *CPUState, memory *Memory, args ...uint32) {
+	if !cpu.decodeOnly {
+		instruction.Exec(cpu, memory, args...)
 	}
 }
 
@@ -121,8 +413,10 @@ type Encoding struct {
 var Encodings = map[string]Encoding{
 	"I":  {"I", decodeI},   // Integer-Register-Immediate instructions
 	"R":  {"R", decodeR},   // Register-register operations
+	"R4": {"R4", decodeR4}, // Fused multiply-add operations
 	"S":  {"S", decodeS},   // Store instructions
 	"U":  {"U", decodeU},   // Upper immediate instructions
 	"SB": {"SB", decodeSB}, // Branch instructions
 	"UJ": {"UJ", decodeUJ}, // Jump instructions
+	"V":  {"V", decodeV},   // Vector operations
 }
@@ -18,6 +18,11 @@ func encodeRType(rd, rs1, rs2, funct3, funct7 uint32) uint32 {
 	return funct7<<25 | rs2<<20 | rs1<<15 | funct3<<12 | rd<<7 | 0b0110011
 }
 
+func encodeAMOType(rd, rs1, rs2, funct5, aq, rl uint32) uint32 {
+	// [31:27] funct5 [26] aq [25] rl [24:20] rs2 [19:15] rs1 [14:12] funct3 [11:7] rd [6:0] opcode
+	return funct5<<27 | aq<<26 | rl<<25 | rs2<<20 | rs1<<15 | 0b010<<12 | rd<<7 | 0b0101111
+}
+
 func encodeSType(rs1, rs2, imm, funct3 uint32) uint32 {
 	// [31:25] imm[11:5] [24:20] rs2 [19:15] rs1 [14:12] funct3 [11:7] imm[4:0] [6:0] opcode
 	return imm<<25 | rs2<<20 | rs1<<15 | funct3<<12 | 0b0100011
@@ -91,6 +96,38 @@ func TestEncodings(t *testing.T) {
 			instruction: encodeRType(2, 1, 2, 0b100, 0), // XOR x2, x1, x2
 			expected:    "XOR x2, x1, x2\n",
 		},
+		// OP RV32M (MUL, DIV, ...)
+		{
+			name:        "R-type MUL",
+			encoding:    "R",
+			instruction: encodeRType(2, 1, 2, 0b000, 0b0000001), // MUL x2, x1, x2
+			expected:    "MUL x2, x1, x2\n",
+		},
+		{
+			name:        "R-type DIVU",
+			encoding:    "R",
+			instruction: encodeRType(2, 1, 2, 0b101, 0b0000001), // DIVU x2, x1, x2
+			expected:    "DIVU x2, x1, x2\n",
+		},
+		{
+			name:        "R-type REM",
+			encoding:    "R",
+			instruction: encodeRType(2, 1, 2, 0b110, 0b0000001), // REM x2, x1, x2
+			expected:    "REM x2, x1, x2\n",
+		},
+		// AMO (LR.W, SC.W, AMOADD.W, ...)
+		{
+			name:        "R-type AMOADD.W",
+			encoding:    "R",
+			instruction: encodeAMOType(2, 1, 3, 0b00000, 0, 0), // AMOADD.W x2, x3, (x1)
+			expected:    "AMOADD.W x2, x1, x3\n",
+		},
+		{
+			name:        "R-type AMOSWAP.W.aqrl",
+			encoding:    "R",
+			instruction: encodeAMOType(2, 1, 3, 0b00001, 1, 1), // AMOSWAP.W.aqrl x2, x3, (x1)
+			expected:    "AMOSWAP.W x2, x1, x3\n",
+		},
 		// OP-IMM (ADDI, SLTI, ...)
 		{
 			name:        "I-type ADDI",
@@ -134,6 +171,76 @@ func TestEncodings(t *testing.T) {
 			instruction: encodeIType(2, 1, 5, 0b101, 0b0100000), // SRAI x2, x1, 5
 			expected:    "SRAI x2, x1, 5\n",
 		},
+		// BRANCH / JAL (sign-extended immediates)
+		{
+			name:        "SB-type BEQ",
+			encoding:    "SB",
+			instruction: 0x00208463, // BEQ x1, x2, 8
+			expected:    "BEQ x1, x2, 8\n",
+		},
+		{
+			name:        "SB-type BNE backwards",
+			encoding:    "SB",
+			instruction: 0xfe209ee3, // BNE x1, x2, -4
+			expected:    "BNE x1, x2, 4294967292\n",
+		},
+		{
+			name:        "UJ-type JAL",
+			encoding:    "UJ",
+			instruction: 0x010000ef, // JAL x1, 16
+			expected:    "JAL x1, 16\n",
+		},
+		{
+			name:        "I-type ADDI negative",
+			encoding:    "I",
+			instruction: 0xfff08113, // ADDI x2, x1, -1
+			expected:    "ADDI x2, x1, 4294967295\n",
+		},
+		// SYSTEM (Zicsr)
+		{
+			name:        "I-type CSRRW",
+			encoding:    "I",
+			instruction: 0x34011173, // CSRRW x2, mscratch, x2
+			expected:    "CSRRW x2, mscratch, x2\n",
+		},
+		{
+			name:        "I-type CSRRSI",
+			encoding:    "I",
+			instruction: 0x3002e173, // CSRRSI x2, mstatus, 5
+			expected:    "CSRRSI x2, mstatus, 5\n",
+		},
+		// Zbb
+		{
+			name:        "R-type ANDN",
+			encoding:    "R",
+			instruction: 0x4020f1b3, // ANDN x3, x1, x2
+			expected:    "ANDN x3, x1, x2\n",
+		},
+		{
+			name:        "I-type CLZ selected by rs2",
+			encoding:    "I",
+			instruction: 0x60011093, // CLZ x1, x2
+			expected:    "CLZ x1, x2\n",
+		},
+		// OP-FP
+		{
+			name:        "R-type FADD.S",
+			encoding:    "R",
+			instruction: 0x003170d3, // FADD.S f1, f2, f3
+			expected:    "FADD.S f1, f2, f3\n",
+		},
+		{
+			name:        "R-type FADD.D",
+			encoding:    "R",
+			instruction: 0x023170d3, // FADD.D f1, f2, f3
+			expected:    "FADD.D f1, f2, f3\n",
+		},
+		{
+			name:        "R4-type FMADD.S",
+			encoding:    "R4",
+			instruction: 0x203100c3, // FMADD.S f1, f2, f3, f4, rne
+			expected:    "FMADD.S f1, f2, f3, f4\n",
+		},
 	}
 
 	for _, test := range tests {
@@ -155,3 +262,62 @@ func TestEncodings(t *testing.T) {
 		})
 	}
 }
+
+func TestDisassembleInstruction(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	tests := []struct {
+		name          string
+		instruction   uint32
+		expected      string
+		expectedError bool
+	}{
+		{"ADDI", assembleI(0b0010011, 1, 0, 1, 5), "ADDI x1, x1, 5\n", false},
+		{"SW", assembleS(0b0100011, 0b010, 0, 1, 0x20), "SW x0, x1, 32\n", false},
+		{"JAL", assembleJ(1, 0x40), "", false},
+		{"ECALL", 0x00000073, "ECALL x0, 0\n", false},
+		{"Compressed C.LI", 0x4515, "", false}, // C.LI a0, 5
+		{"VMERGE.VVM", encodeVType(0b010111, 0, 3, 2, vectorOPIVV, 4), "VMERGE.VVM v4, v3, v2, v0\n", false},
+		{"VMV.V.V", encodeVType(0b010111, 1, 0, 2, vectorOPIVV, 4), "VMV.V.V v4, v2\n", false},
+		{"VMV.V.X", encodeVType(0b010111, 1, 0, 1, vectorOPIVX, 4), "VMV.V.X v4, x1\n", false},
+		{"VMV.V.I", encodeVType(0b010111, 1, 0, 0b11111, vectorOPIVI, 4), "VMV.V.I v4, -1\n", false},
+		{"Illegal instruction", 0xFFFFFFFF, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initMemory(&memory, 256, 0)
+			initCPUState(&cpu, 0x10, 0)
+			cpu.csr[csrMtvec] = 0x80
+			memory.Store32(0x10, test.instruction)
+			writeRegister(&cpu, 1, 0x1234)
+			before := cpu
+
+			text, err := disassembleInstruction(&cpu, &memory)
+
+			if (err != nil) != test.expectedError {
+				t.Fatalf("expected error=%v, got %v", test.expectedError, err)
+			}
+			if test.expected != "" && text != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, text)
+			}
+			if !test.expectedError && text == "" {
+				t.Errorf("expected the instruction to be formatted")
+			}
+			if cpu.pc != before.pc || cpu.x != before.x || cpu.csr != before.csr || cpu.trapped || cpu.decodeOnly {
+				t.Errorf("expected the hart to be left untouched, got pc=0x%x x1=0x%x mcause=%d", cpu.pc, cpu.x[1], cpu.csr[csrMcause])
+			}
+			if value := memory.Load32(0x1254); value != 0 {
+				t.Errorf("expected memory to be left untouched, got 0x%x", value)
+			}
+		})
+	}
+
+	// Nothing to fetch in a page of paged RAM never written
+	initPagedMemory(&memory, pageSize, 0)
+	initCPUState(&cpu, 0x80000000, 0)
+	if _, err := disassembleInstruction(&cpu, &memory); err == nil {
+		t.Errorf("expected an error disassembling a page never written")
+	}
+}
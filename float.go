@@ -0,0 +1,514 @@
+package main
+
+import (
+	"math"
+	"math/big"
+)
+
+// Floating-point exception flags (fflags)
+const (
+	flagInexact   = 1 << 0 // NX
+	flagUnderflow = 1 << 1 // UF
+	flagOverflow  = 1 << 2 // OF
+	flagDivByZero = 1 << 3 // DZ
+	flagInvalid   = 1 << 4 // NV
+)
+
+// Rounding modes, from the rm field of an instruction or from frm
+const (
+	roundNearestEven = 0b000 // RNE
+	roundTowardZero  = 0b001 // RTZ
+	roundDown        = 0b010 // RDN
+	roundUp          = 0b011 // RUP
+	roundNearestMax  = 0b100 // RMM
+	roundDynamic     = 0b111 // DYN, use frm
+)
+
+// exactPrecision is large enough for big.Float to hold the exact sum of any two products of IEEE 754 doubles,
+// so that every result is rounded only once, by roundFloat.
+const exactPrecision = 4600
+
+// floatFormat describes an IEEE 754 binary interchange format, values are handled as raw bits in an uint64.
+type floatFormat struct {
+	exponentBits uint
+	fractionBits uint
+}
+
+var float32Format = floatFormat{8, 23}
+var float64Format = floatFormat{11, 52}
+
+func floatBias(format floatFormat) int {
+	return 1<<(format.exponentBits-1) - 1
+}
+
+func floatSignBit(format floatFormat) uint64 {
+	return 1 << (format.exponentBits + format.fractionBits)
+}
+
+func floatExponent(format floatFormat, bits uint64) uint64 {
+	return (bits >> format.fractionBits) & (1<<format.exponentBits - 1)
+}
+
+func floatFraction(format floatFormat, bits uint64) uint64 {
+	return bits & (1<<format.fractionBits - 1)
+}
+
+func isFloatNegative(format floatFormat, bits uint64) bool {
+	return bits&floatSignBit(format) != 0
+}
+
+func isFloatNaN(format floatFormat, bits uint64) bool {
+	return floatExponent(format, bits) == 1<<format.exponentBits-1 && floatFraction(format, bits) != 0
+}
+
+func isFloatSignalingNaN(format floatFormat, bits uint64) bool {
+	return isFloatNaN(format, bits) && bits&(1<<(format.fractionBits-1)) == 0
+}
+
+func isFloatInf(format floatFormat, bits uint64) bool {
+	return floatExponent(format, bits) == 1<<format.exponentBits-1 && floatFraction(format, bits) == 0
+}
+
+func isFloatZero(format floatFormat, bits uint64) bool {
+	return bits&^floatSignBit(format) == 0
+}
+
+func canonicalNaN(format floatFormat) uint64 {
+	return (1<<format.exponentBits-1)<<format.fractionBits | 1<<(format.fractionBits-1)
+}
+
+func floatInfinity(format floatFormat, negative bool) uint64 {
+	return floatSign(format, negative) | (1<<format.exponentBits-1)<<format.fractionBits
+}
+
+func floatMaxFinite(format floatFormat, negative bool) uint64 {
+	return floatSign(format, negative) | (1<<format.exponentBits-2)<<format.fractionBits | (1<<format.fractionBits - 1)
+}
+
+func floatZero(format floatFormat, negative bool) uint64 {
+	return floatSign(format, negative)
+}
+
+func floatSign(format floatFormat, negative bool) uint64 {
+	if negative {
+		return floatSignBit(format)
+	}
+	return 0
+}
+
+// nanResult returns the canonical NaN of an operation that received NaN operands, with NV raised for signaling ones.
+func nanResult(format floatFormat, operands ...uint64) (uint64, uint32) {
+	var flags uint32
+	for _, operand := range operands {
+		if isFloatSignalingNaN(format, operand) {
+			flags |= flagInvalid
+		}
+	}
+	return canonicalNaN(format), flags
+}
+
+func hasFloatNaN(format floatFormat, operands ...uint64) bool {
+	for _, operand := range operands {
+		if isFloatNaN(format, operand) {
+			return true
+		}
+	}
+	return false
+}
+
+// floatToBig returns the exact value of a finite float.
+func floatToBig(format floatFormat, bits uint64) *big.Float {
+	exponent := int(floatExponent(format, bits))
+	mantissa := floatFraction(format, bits)
+	if exponent == 0 {
+		exponent = 1 // Subnormal
+	} else {
+		mantissa |= 1 << format.fractionBits
+	}
+	value := new(big.Float).SetPrec(exactPrecision).SetUint64(mantissa)
+	value.SetMantExp(value, exponent-floatBias(format)-int(format.fractionBits))
+	if isFloatNegative(format, bits) {
+		value.Neg(value)
+	}
+	return value
+}
+
+// roundToQuantum rounds magnitude to an integer multiple of 2^quantum and returns that integer. sticky tells that
+// the exact value is slightly above magnitude (magnitude was truncated), negative gives the sign for directed modes.
+func roundToQuantum(magnitude *big.Float, quantum int, sticky bool, negative bool, rm uint32) (uint64, bool) {
+	scaled := new(big.Float).SetMantExp(magnitude, -quantum)
+	integer, _ := scaled.Uint64() // Truncated toward zero
+	fraction := new(big.Float).Sub(scaled, new(big.Float).SetUint64(integer))
+	half := fraction.Cmp(big.NewFloat(0.5))
+	inexact := fraction.Sign() != 0 || sticky
+
+	var increment bool
+	switch rm {
+	case roundNearestEven:
+		increment = half > 0 || (half == 0 && (sticky || integer&1 == 1))
+	case roundTowardZero:
+		increment = false
+	case roundDown:
+		increment = negative && inexact
+	case roundUp:
+		increment = !negative && inexact
+	case roundNearestMax:
+		increment = half >= 0
+	}
+	if increment {
+		integer++
+	}
+	return integer, inexact
+}
+
+// roundFloat rounds an exact (or truncated, when sticky is set) value to format. Tininess is detected after
+// rounding, as required by RISC-V.
+func roundFloat(format floatFormat, value *big.Float, sticky bool, rm uint32) (uint64, uint32) {
+	negative := value.Signbit()
+	if value.Sign() == 0 {
+		return floatZero(format, negative), 0
+	}
+
+	fractionBits := int(format.fractionBits)
+	minExponent := 1 - floatBias(format)
+	magnitude := new(big.Float).Abs(value)
+	exponent := magnitude.MantExp(nil) - 1 // magnitude is in [2^exponent, 2^(exponent+1))
+
+	quantum := max(exponent, minExponent) - fractionBits
+	mantissa, inexact := roundToQuantum(magnitude, quantum, sticky, negative, rm)
+	if mantissa == 1<<(fractionBits+1) {
+		mantissa >>= 1
+		quantum++
+	}
+
+	var flags uint32
+	if inexact {
+		flags |= flagInexact
+		tiny := exponent < minExponent-1
+		if exponent == minExponent-1 {
+			unbounded, _ := roundToQuantum(magnitude, exponent-fractionBits, sticky, negative, rm)
+			tiny = unbounded < 1<<(fractionBits+1)
+		}
+		if tiny {
+			flags |= flagUnderflow
+		}
+	}
+
+	if mantissa < 1<<fractionBits {
+		return floatSign(format, negative) | mantissa, flags // Subnormal or zero
+	}
+
+	biasedExponent := uint64(quantum + fractionBits + floatBias(format))
+	if biasedExponent >= 1<<format.exponentBits-1 {
+		flags |= flagOverflow | flagInexact
+		switch {
+		case rm == roundTowardZero, rm == roundDown && !negative, rm == roundUp && negative:
+			return floatMaxFinite(format, negative), flags
+		default:
+			return floatInfinity(format, negative), flags
+		}
+	}
+	return floatSign(format, negative) | biasedExponent<<format.fractionBits | (mantissa - 1<<fractionBits), flags
+}
+
+// exactZeroSign returns the sign of an exact zero sum: x + (-x) is +0 except when rounding down.
+func exactZeroSign(rm uint32) bool {
+	return rm == roundDown
+}
+
+func floatAdd(format floatFormat, a uint64, b uint64, rm uint32) (uint64, uint32) {
+	if hasFloatNaN(format, a, b) {
+		return nanResult(format, a, b)
+	}
+	aNegative, bNegative := isFloatNegative(format, a), isFloatNegative(format, b)
+	if isFloatInf(format, a) || isFloatInf(format, b) {
+		if isFloatInf(format, a) && isFloatInf(format, b) && aNegative != bNegative {
+			return canonicalNaN(format), flagInvalid // inf - inf
+		}
+		if isFloatInf(format, a) {
+			return a, 0
+		}
+		return b, 0
+	}
+
+	sum := new(big.Float).SetPrec(exactPrecision).Add(floatToBig(format, a), floatToBig(format, b))
+	if sum.Sign() == 0 {
+		if isFloatZero(format, a) && isFloatZero(format, b) && aNegative == bNegative {
+			return a, 0
+		}
+		return floatZero(format, exactZeroSign(rm)), 0
+	}
+	return roundFloat(format, sum, false, rm)
+}
+
+func floatSub(format floatFormat, a uint64, b uint64, rm uint32) (uint64, uint32) {
+	return floatAdd(format, a, b^floatSignBit(format), rm)
+}
+
+func floatMul(format floatFormat, a uint64, b uint64, rm uint32) (uint64, uint32) {
+	if hasFloatNaN(format, a, b) {
+		return nanResult(format, a, b)
+	}
+	negative := isFloatNegative(format, a) != isFloatNegative(format, b)
+	if isFloatInf(format, a) || isFloatInf(format, b) {
+		if isFloatZero(format, a) || isFloatZero(format, b) {
+			return canonicalNaN(format), flagInvalid // inf * 0
+		}
+		return floatInfinity(format, negative), 0
+	}
+	if isFloatZero(format, a) || isFloatZero(format, b) {
+		return floatZero(format, negative), 0
+	}
+
+	product := new(big.Float).SetPrec(exactPrecision).Mul(floatToBig(format, a), floatToBig(format, b))
+	return roundFloat(format, product, false, rm)
+}
+
+func floatDiv(format floatFormat, a uint64, b uint64, rm uint32) (uint64, uint32) {
+	if hasFloatNaN(format, a, b) {
+		return nanResult(format, a, b)
+	}
+	negative := isFloatNegative(format, a) != isFloatNegative(format, b)
+	switch {
+	case isFloatInf(format, a) && isFloatInf(format, b), isFloatZero(format, a) && isFloatZero(format, b):
+		return canonicalNaN(format), flagInvalid // inf / inf, 0 / 0
+	case isFloatInf(format, a):
+		return floatInfinity(format, negative), 0
+	case isFloatZero(format, b):
+		return floatInfinity(format, negative), flagDivByZero
+	case isFloatZero(format, a), isFloatInf(format, b):
+		return floatZero(format, negative), 0
+	}
+
+	// The quotient is truncated with a few guard bits, the remaining bits only matter as a sticky bit
+	quotient := new(big.Float).SetPrec(2*format.fractionBits + 8).SetMode(big.ToZero)
+	quotient.Quo(floatToBig(format, a), floatToBig(format, b))
+	return roundFloat(format, quotient, quotient.Acc() != big.Exact, rm)
+}
+
+func floatSqrt(format floatFormat, a uint64, rm uint32) (uint64, uint32) {
+	if hasFloatNaN(format, a) {
+		return nanResult(format, a)
+	}
+	if isFloatZero(format, a) {
+		return a, 0 // sqrt(-0) = -0
+	}
+	if isFloatNegative(format, a) {
+		return canonicalNaN(format), flagInvalid
+	}
+	if isFloatInf(format, a) {
+		return a, 0
+	}
+
+	// big.Float.Sqrt does not report its accuracy: truncate the root by comparing its square with the operand
+	value := floatToBig(format, a)
+	precision := 2*format.fractionBits + 8
+	root := new(big.Float).SetPrec(precision).Sqrt(value)
+	square := new(big.Float).SetPrec(exactPrecision)
+	ulp := func() *big.Float {
+		return new(big.Float).SetMantExp(big.NewFloat(1), root.MantExp(nil)-int(precision))
+	}
+	for square.Mul(root, root).Cmp(value) > 0 {
+		root.Sub(root, ulp())
+	}
+	for {
+		next := new(big.Float).SetPrec(precision).Add(root, ulp())
+		if square.Mul(next, next).Cmp(value) > 0 {
+			break
+		}
+		root = next
+	}
+	return roundFloat(format, root, square.Mul(root, root).Cmp(value) != 0, rm)
+}
+
+// floatFusedMulAdd returns (a * b) + c with a single rounding, the signs of the product and of the addend are
+// flipped by negateProduct and negateAddend (FMSUB, FNMSUB, FNMADD).
+func floatFusedMulAdd(format floatFormat, a uint64, b uint64, c uint64, negateProduct bool, negateAddend bool, rm uint32) (uint64, uint32) {
+	infTimesZero := (isFloatInf(format, a) && isFloatZero(format, b)) || (isFloatZero(format, a) && isFloatInf(format, b))
+	if hasFloatNaN(format, a, b, c) {
+		result, flags := nanResult(format, a, b, c)
+		if infTimesZero {
+			flags |= flagInvalid // Raised even when the addend is a quiet NaN
+		}
+		return result, flags
+	}
+	if infTimesZero {
+		return canonicalNaN(format), flagInvalid
+	}
+
+	productNegative := (isFloatNegative(format, a) != isFloatNegative(format, b)) != negateProduct
+	if negateAddend {
+		c ^= floatSignBit(format)
+	}
+	addendNegative := isFloatNegative(format, c)
+
+	if isFloatInf(format, a) || isFloatInf(format, b) {
+		if isFloatInf(format, c) && addendNegative != productNegative {
+			return canonicalNaN(format), flagInvalid // inf - inf
+		}
+		return floatInfinity(format, productNegative), 0
+	}
+	if isFloatInf(format, c) {
+		return c, 0
+	}
+
+	product := new(big.Float).SetPrec(exactPrecision).Mul(floatToBig(format, a), floatToBig(format, b))
+	if productNegative != product.Signbit() {
+		product.Neg(product)
+	}
+	sum := new(big.Float).SetPrec(exactPrecision).Add(product, floatToBig(format, c))
+	if sum.Sign() == 0 {
+		if product.Sign() == 0 && isFloatZero(format, c) && productNegative == addendNegative {
+			return floatZero(format, productNegative), 0
+		}
+		return floatZero(format, exactZeroSign(rm)), 0
+	}
+	return roundFloat(format, sum, false, rm)
+}
+
+// floatToFloat64 returns the value of a float as a Go float64, which is exact for single and double precision.
+func floatToFloat64(format floatFormat, bits uint64) float64 {
+	if format == float32Format {
+		return float64(math.Float32frombits(uint32(bits)))
+	}
+	return math.Float64frombits(bits)
+}
+
+// floatCompare compares a and b, signaling makes quiet NaNs raise NV as well (FLT, FLE).
+func floatCompare(format floatFormat, a uint64, b uint64, signaling bool) (less bool, equal bool, flags uint32) {
+	if hasFloatNaN(format, a, b) {
+		if signaling {
+			return false, false, flagInvalid
+		}
+		_, flags = nanResult(format, a, b)
+		return false, false, flags
+	}
+	x, y := floatToFloat64(format, a), floatToFloat64(format, b)
+	return x < y, x == y, 0
+}
+
+// floatMinMax implements FMIN/FMAX: a NaN operand is ignored, and -0 is considered smaller than +0.
+func floatMinMax(format floatFormat, a uint64, b uint64, maximum bool) (uint64, uint32) {
+	_, flags := nanResult(format, a, b)
+	switch {
+	case isFloatNaN(format, a) && isFloatNaN(format, b):
+		return canonicalNaN(format), flags
+	case isFloatNaN(format, a):
+		return b, flags
+	case isFloatNaN(format, b):
+		return a, flags
+	}
+
+	x, y := floatToFloat64(format, a), floatToFloat64(format, b)
+	aSmaller := x < y || (x == y && isFloatNegative(format, a))
+	if aSmaller != maximum {
+		return a, 0
+	}
+	return b, 0
+}
+
+// floatClass implements FCLASS, one bit is set in the result depending on the kind of value.
+func floatClass(format floatFormat, a uint64) uint32 {
+	negative := isFloatNegative(format, a)
+	switch {
+	case isFloatInf(format, a) && negative:
+		return 1 << 0
+	case isFloatInf(format, a):
+		return 1 << 7
+	case isFloatSignalingNaN(format, a):
+		return 1 << 8
+	case isFloatNaN(format, a):
+		return 1 << 9
+	case isFloatZero(format, a) && negative:
+		return 1 << 3
+	case isFloatZero(format, a):
+		return 1 << 4
+	case floatExponent(format, a) == 0 && negative:
+		return 1 << 2 // Negative subnormal
+	case floatExponent(format, a) == 0:
+		return 1 << 5 // Positive subnormal
+	case negative:
+		return 1 << 1
+	default:
+		return 1 << 6
+	}
+}
+
+// floatToInt converts a float to a signed or unsigned integer of the given width, out-of-range values and NaNs
+// saturate and raise NV.
+func floatToInt(format floatFormat, a uint64, signed bool, width uint, rm uint32) (uint64, uint32) {
+	minimum, maximum := int64(0), int64(1<<width-1)
+	if signed {
+		minimum, maximum = -1<<(width-1), 1<<(width-1)-1
+	}
+	if width == 64 && !signed {
+		maximum = -1 // 2^64 - 1 is handled as a special case below
+	}
+	saturate := func(negative bool) (uint64, uint32) {
+		if negative {
+			return uint64(minimum), flagInvalid
+		}
+		return uint64(maximum), flagInvalid
+	}
+
+	if isFloatNaN(format, a) {
+		return saturate(false)
+	}
+	negative := isFloatNegative(format, a)
+	if isFloatInf(format, a) {
+		return saturate(negative)
+	}
+	if isFloatZero(format, a) {
+		return 0, 0
+	}
+
+	magnitude := new(big.Float).Abs(floatToBig(format, a))
+	if magnitude.MantExp(nil) > 64 {
+		return saturate(negative)
+	}
+	integer, inexact := roundToQuantum(magnitude, 0, false, negative, rm)
+
+	var flags uint32
+	if inexact {
+		flags = flagInexact
+	}
+	if negative {
+		if integer == 0 {
+			return 0, flags
+		}
+		if !signed || integer > uint64(-minimum) {
+			return saturate(true)
+		}
+		return uint64(-int64(integer)), flags
+	}
+	if (width < 64 || signed) && integer > uint64(maximum) {
+		return saturate(false)
+	}
+	return integer, flags
+}
+
+// intToFloat converts the low width bits of value, as a signed or unsigned integer, to a float.
+func intToFloat(format floatFormat, value uint64, signed bool, width uint, rm uint32) (uint64, uint32) {
+	result := new(big.Float).SetPrec(exactPrecision)
+	if signed {
+		result.SetInt64(int64(value<<(64-width)) >> (64 - width))
+	} else {
+		result.SetUint64(value << (64 - width) >> (64 - width))
+	}
+	return roundFloat(format, result, false, rm)
+}
+
+// floatConvert converts a float between two formats (FCVT.S.D, FCVT.D.S).
+func floatConvert(from floatFormat, to floatFormat, a uint64, rm uint32) (uint64, uint32) {
+	negative := isFloatNegative(from, a)
+	switch {
+	case isFloatNaN(from, a):
+		_, flags := nanResult(from, a)
+		return canonicalNaN(to), flags
+	case isFloatInf(from, a):
+		return floatInfinity(to, negative), 0
+	case isFloatZero(from, a):
+		return floatZero(to, negative), 0
+	}
+	return roundFloat(to, floatToBig(from, a), false, rm)
+}
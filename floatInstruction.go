@@ -0,0 +1,332 @@
+package main
+
+// floatInstruction wraps the implementation of an F/D instruction: they are illegal while mstatus.FS is Off.
+func floatInstruction(name string, exec func(cpu *CPUState, memory *Memory, args ...uint32)) Instruction {
+	return Instruction{
+		name,
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			if cpu.csr[csrMstatus]&mstatusFS == 0 {
+				raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+				return
+			}
+			exec(cpu, memory, args...)
+		},
+	}
+}
+
+// roundingMode resolves the rm field of an instruction, DYN selects frm. It raises an illegal instruction
+// exception and returns false for the reserved encodings.
+func roundingMode(cpu *CPUState, rm uint32) (uint32, bool) {
+	if rm == roundDynamic {
+		rm = uint32(cpu.csr[csrFcsr]>>5) & 0b111
+	}
+	if rm > roundNearestMax {
+		raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+		return 0, false
+	}
+	return rm, true
+}
+
+// binaryFloat executes a rounded operation rd = op(rs1, rs2) (args: rd, rs1, rs2, rm).
+func binaryFloat(cpu *CPUState, format floatFormat, args []uint32, op func(format floatFormat, a uint64, b uint64, rm uint32) (uint64, uint32)) {
+	rd, rs1, rs2 := args[0], args[1], args[2]
+	if rm, ok := roundingMode(cpu, args[3]); ok {
+		result, flags := op(format, readFloatRegister(cpu, format, rs1), readFloatRegister(cpu, format, rs2), rm)
+		setFloatFlags(cpu, flags)
+		writeFloatRegister(cpu, format, rd, result)
+	}
+}
+
+// fusedFloat executes a fused multiply-add (args: rd, rs1, rs2, rs3, rm).
+func fusedFloat(cpu *CPUState, format floatFormat, args []uint32, negateProduct bool, negateAddend bool) {
+	rd, rs1, rs2, rs3 := args[0], args[1], args[2], args[3]
+	if rm, ok := roundingMode(cpu, args[4]); ok {
+		a, b, c := readFloatRegister(cpu, format, rs1), readFloatRegister(cpu, format, rs2), readFloatRegister(cpu, format, rs3)
+		result, flags := floatFusedMulAdd(format, a, b, c, negateProduct, negateAddend, rm)
+		setFloatFlags(cpu, flags)
+		writeFloatRegister(cpu, format, rd, result)
+	}
+}
+
+// compareFloat executes FEQ/FLT/FLE: rd = 1 when the comparison holds.
+func compareFloat(cpu *CPUState, format floatFormat, args []uint32, signaling bool, holds func(less bool, equal bool) bool) {
+	rd, rs1, rs2 := args[0], args[1], args[2]
+	less, equal, flags := floatCompare(format, readFloatRegister(cpu, format, rs1), readFloatRegister(cpu, format, rs2), signaling)
+	setFloatFlags(cpu, flags)
+	if holds(less, equal) {
+		writeRegister(cpu, rd, 1)
+	} else {
+		writeRegister(cpu, rd, 0)
+	}
+}
+
+// FloatInstructions holds the F and D instructions that depend on the width of the format, they are merged
+// into Instructions along with the arithmetic of each format (see floatOperations).
+var FloatInstructions = map[[4]uint32]Instruction{
+	// LOAD-FP
+	// FLW : Load Floating-Point Word
+	{0b0000111, 0b010, 0, 0}: floatInstruction("FLW", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rd, rs1, imm := args[0], args[1], args[2]
+		address := effectiveAddress(cpu, rs1, imm)
+		physical, ok := checkAccess(cpu, memory, address, 4, accessLoad)
+		if !ok {
+			return
+		}
+		writeFloatRegister32(cpu, rd, memory.Load32(physical))
+	}),
+	// FLD : Load Floating-Point Double
+	{0b0000111, 0b011, 0, 0}: floatInstruction("FLD", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rd, rs1, imm := args[0], args[1], args[2]
+		address := effectiveAddress(cpu, rs1, imm)
+		physical, ok := checkAccess(cpu, memory, address, 8, accessLoad)
+		if !ok {
+			return
+		}
+		writeFloatRegister64(cpu, rd, readDoubleword(memory, physical))
+	}),
+	// STORE-FP
+	// FSW : Store Floating-Point Word
+	{0b0100111, 0b010, 0, 0}: floatInstruction("FSW", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rs1, rs2, imm := args[0], args[1], args[2]
+		address := effectiveAddress(cpu, rs1, imm)
+		physical, ok := checkAccess(cpu, memory, address, 4, accessStore)
+		if !ok {
+			return
+		}
+		memory.Store32(physical, uint32(cpu.f[rs2])) // The raw low bits, FSW does not check NaN-boxing
+		invalidateReservation(cpu, physical)
+	}),
+	// FSD : Store Floating-Point Double
+	{0b0100111, 0b011, 0, 0}: floatInstruction("FSD", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rs1, rs2, imm := args[0], args[1], args[2]
+		address := effectiveAddress(cpu, rs1, imm)
+		physical, ok := checkAccess(cpu, memory, address, 8, accessStore)
+		if !ok {
+			return
+		}
+		writeDoubleword(cpu, memory, physical, readFloatRegister64(cpu, rs2))
+	}),
+	// OP-FP
+	// FMV.X.W : Move Floating-Point Word to Integer Register
+	{0b1010011, 0b000, 0b1110000, 0}: floatInstruction("FMV.X.W", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rd, rs1 := args[0], args[1]
+		writeRegister(cpu, rd, signExtendWord(cpu.f[rs1])) // The raw low bits, FMV.X.W does not check NaN-boxing
+	}),
+	// FMV.W.X : Move Integer Register to Floating-Point Word
+	{0b1010011, 0b000, 0b1111000, 0}: floatInstruction("FMV.W.X", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rd, rs1 := args[0], args[1]
+		writeFloatRegister32(cpu, rd, uint32(readRegister(cpu, rs1)))
+	}),
+	// FCVT.S.D : Convert Double to Single
+	{0b1010011, 0, 0b0100000, 0b00001}: floatInstruction("FCVT.S.D", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rd, rs1 := args[0], args[1]
+		if rm, ok := roundingMode(cpu, args[3]); ok {
+			result, flags := floatConvert(float64Format, float32Format, readFloatRegister64(cpu, rs1), rm)
+			setFloatFlags(cpu, flags)
+			writeFloatRegister32(cpu, rd, uint32(result))
+		}
+	}),
+	// FCVT.D.S : Convert Single to Double (always exact)
+	{0b1010011, 0, 0b0100001, 0b00000}: floatInstruction("FCVT.D.S", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rd, rs1 := args[0], args[1]
+		if rm, ok := roundingMode(cpu, args[3]); ok {
+			result, flags := floatConvert(float32Format, float64Format, uint64(readFloatRegister32(cpu, rs1)), rm)
+			setFloatFlags(cpu, flags)
+			writeFloatRegister64(cpu, rd, result)
+		}
+	}),
+	// FMV.X.D : Move Floating-Point Double to Integer Register (RV64)
+	{0b1010011, 0b000, 0b1110001, 0}: rv64Instruction(floatInstruction("FMV.X.D", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rd, rs1 := args[0], args[1]
+		writeRegister(cpu, rd, cpu.f[rs1])
+	})),
+	// FMV.D.X : Move Integer Register to Floating-Point Double (RV64)
+	{0b1010011, 0b000, 0b1111001, 0}: rv64Instruction(floatInstruction("FMV.D.X", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rd, rs1 := args[0], args[1]
+		writeFloatRegister64(cpu, rd, readRegister(cpu, rs1))
+	})),
+}
+
+// floatOperations returns the arithmetic, comparison and integer conversion instructions of a format. formatField is
+// the fmt field of the encoding (funct7[1:0], 0b00 for single and 0b01 for double precision) and suffix the letter
+// appended to the mnemonics.
+func floatOperations(format floatFormat, formatField uint32, suffix string) map[[4]uint32]Instruction {
+	signBit := floatSignBit(format)
+
+	return map[[4]uint32]Instruction{
+		// MADD / MSUB / NMSUB / NMADD
+		// FMADD : Fused Multiply-Add (rs1 * rs2 + rs3)
+		{0b1000011, 0, formatField, 0}: floatInstruction("FMADD."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			fusedFloat(cpu, format, args, false, false)
+		}),
+		// FMSUB : Fused Multiply-Subtract (rs1 * rs2 - rs3)
+		{0b1000111, 0, formatField, 0}: floatInstruction("FMSUB."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			fusedFloat(cpu, format, args, false, true)
+		}),
+		// FNMSUB : Fused Negated Multiply-Subtract (-(rs1 * rs2) + rs3)
+		{0b1001011, 0, formatField, 0}: floatInstruction("FNMSUB."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			fusedFloat(cpu, format, args, true, false)
+		}),
+		// FNMADD : Fused Negated Multiply-Add (-(rs1 * rs2) - rs3)
+		{0b1001111, 0, formatField, 0}: floatInstruction("FNMADD."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			fusedFloat(cpu, format, args, true, true)
+		}),
+		// OP-FP
+		// FADD : Floating-Point Add
+		{0b1010011, 0, 0b0000000 | formatField, 0}: floatInstruction("FADD."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			binaryFloat(cpu, format, args, floatAdd)
+		}),
+		// FSUB : Floating-Point Subtract
+		{0b1010011, 0, 0b0000100 | formatField, 0}: floatInstruction("FSUB."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			binaryFloat(cpu, format, args, floatSub)
+		}),
+		// FMUL : Floating-Point Multiply
+		{0b1010011, 0, 0b0001000 | formatField, 0}: floatInstruction("FMUL."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			binaryFloat(cpu, format, args, floatMul)
+		}),
+		// FDIV : Floating-Point Divide
+		{0b1010011, 0, 0b0001100 | formatField, 0}: floatInstruction("FDIV."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			binaryFloat(cpu, format, args, floatDiv)
+		}),
+		// FSQRT : Floating-Point Square Root
+		{0b1010011, 0, 0b0101100 | formatField, 0}: floatInstruction("FSQRT."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			if rm, ok := roundingMode(cpu, args[3]); ok {
+				result, flags := floatSqrt(format, readFloatRegister(cpu, format, rs1), rm)
+				setFloatFlags(cpu, flags)
+				writeFloatRegister(cpu, format, rd, result)
+			}
+		}),
+		// FSGNJ : Floating-Point Sign Inject
+		{0b1010011, 0b000, 0b0010000 | formatField, 0}: floatInstruction("FSGNJ."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeFloatRegister(cpu, format, rd, readFloatRegister(cpu, format, rs1)&^signBit|readFloatRegister(cpu, format, rs2)&signBit)
+		}),
+		// FSGNJN : Floating-Point Sign Inject Negated
+		{0b1010011, 0b001, 0b0010000 | formatField, 0}: floatInstruction("FSGNJN."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeFloatRegister(cpu, format, rd, readFloatRegister(cpu, format, rs1)&^signBit|^readFloatRegister(cpu, format, rs2)&signBit)
+		}),
+		// FSGNJX : Floating-Point Sign Inject XOR
+		{0b1010011, 0b010, 0b0010000 | formatField, 0}: floatInstruction("FSGNJX."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeFloatRegister(cpu, format, rd, readFloatRegister(cpu, format, rs1)^readFloatRegister(cpu, format, rs2)&signBit)
+		}),
+		// FMIN : Floating-Point Minimum
+		{0b1010011, 0b000, 0b0010100 | formatField, 0}: floatInstruction("FMIN."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			result, flags := floatMinMax(format, readFloatRegister(cpu, format, rs1), readFloatRegister(cpu, format, rs2), false)
+			setFloatFlags(cpu, flags)
+			writeFloatRegister(cpu, format, rd, result)
+		}),
+		// FMAX : Floating-Point Maximum
+		{0b1010011, 0b001, 0b0010100 | formatField, 0}: floatInstruction("FMAX."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			result, flags := floatMinMax(format, readFloatRegister(cpu, format, rs1), readFloatRegister(cpu, format, rs2), true)
+			setFloatFlags(cpu, flags)
+			writeFloatRegister(cpu, format, rd, result)
+		}),
+		// FCVT.W : Floating-Point Convert to Word
+		{0b1010011, 0, 0b1100000 | formatField, 0b00000}: floatInstruction("FCVT.W."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			if rm, ok := roundingMode(cpu, args[3]); ok {
+				result, flags := floatToInt(format, readFloatRegister(cpu, format, rs1), true, 32, rm)
+				setFloatFlags(cpu, flags)
+				writeRegister(cpu, rd, signExtendWord(result))
+			}
+		}),
+		// FCVT.WU : Floating-Point Convert to Unsigned Word
+		{0b1010011, 0, 0b1100000 | formatField, 0b00001}: floatInstruction("FCVT.WU."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			if rm, ok := roundingMode(cpu, args[3]); ok {
+				result, flags := floatToInt(format, readFloatRegister(cpu, format, rs1), false, 32, rm)
+				setFloatFlags(cpu, flags)
+				writeRegister(cpu, rd, signExtendWord(result)) // Sign-extended in RV64, even for WU
+			}
+		}),
+		// FEQ : Floating-Point Equal
+		{0b1010011, 0b010, 0b1010000 | formatField, 0}: floatInstruction("FEQ."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			compareFloat(cpu, format, args, false, func(less bool, equal bool) bool { return equal })
+		}),
+		// FLT : Floating-Point Less Than
+		{0b1010011, 0b001, 0b1010000 | formatField, 0}: floatInstruction("FLT."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			compareFloat(cpu, format, args, true, func(less bool, equal bool) bool { return less })
+		}),
+		// FLE : Floating-Point Less or Equal
+		{0b1010011, 0b000, 0b1010000 | formatField, 0}: floatInstruction("FLE."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			compareFloat(cpu, format, args, true, func(less bool, equal bool) bool { return less || equal })
+		}),
+		// FCLASS : Floating-Point Classify
+		{0b1010011, 0b001, 0b1110000 | formatField, 0}: floatInstruction("FCLASS."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			writeRegister(cpu, rd, uint64(floatClass(format, readFloatRegister(cpu, format, rs1))))
+		}),
+		// FCVT.*.W : Floating-Point Convert from Word
+		{0b1010011, 0, 0b1101000 | formatField, 0b00000}: floatInstruction("FCVT."+suffix+".W", func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			if rm, ok := roundingMode(cpu, args[3]); ok {
+				result, flags := intToFloat(format, readRegister(cpu, rs1), true, 32, rm)
+				setFloatFlags(cpu, flags)
+				writeFloatRegister(cpu, format, rd, result)
+			}
+		}),
+		// FCVT.*.WU : Floating-Point Convert from Unsigned Word
+		{0b1010011, 0, 0b1101000 | formatField, 0b00001}: floatInstruction("FCVT."+suffix+".WU", func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			if rm, ok := roundingMode(cpu, args[3]); ok {
+				result, flags := intToFloat(format, readRegister(cpu, rs1), false, 32, rm)
+				setFloatFlags(cpu, flags)
+				writeFloatRegister(cpu, format, rd, result)
+			}
+		}),
+		// FCVT.L : Floating-Point Convert to Long (RV64)
+		{0b1010011, 0, 0b1100000 | formatField, 0b00010}: rv64Instruction(floatInstruction("FCVT.L."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			if rm, ok := roundingMode(cpu, args[3]); ok {
+				result, flags := floatToInt(format, readFloatRegister(cpu, format, rs1), true, 64, rm)
+				setFloatFlags(cpu, flags)
+				writeRegister(cpu, rd, result)
+			}
+		})),
+		// FCVT.LU : Floating-Point Convert to Unsigned Long (RV64)
+		{0b1010011, 0, 0b1100000 | formatField, 0b00011}: rv64Instruction(floatInstruction("FCVT.LU."+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			if rm, ok := roundingMode(cpu, args[3]); ok {
+				result, flags := floatToInt(format, readFloatRegister(cpu, format, rs1), false, 64, rm)
+				setFloatFlags(cpu, flags)
+				writeRegister(cpu, rd, result)
+			}
+		})),
+		// FCVT.*.L : Floating-Point Convert from Long (RV64)
+		{0b1010011, 0, 0b1101000 | formatField, 0b00010}: rv64Instruction(floatInstruction("FCVT."+suffix+".L", func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			if rm, ok := roundingMode(cpu, args[3]); ok {
+				result, flags := intToFloat(format, readRegister(cpu, rs1), true, 64, rm)
+				setFloatFlags(cpu, flags)
+				writeFloatRegister(cpu, format, rd, result)
+			}
+		})),
+		// FCVT.*.LU : Floating-Point Convert from Unsigned Long (RV64)
+		{0b1010011, 0, 0b1101000 | formatField, 0b00011}: rv64Instruction(floatInstruction("FCVT."+suffix+".LU", func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			if rm, ok := roundingMode(cpu, args[3]); ok {
+				result, flags := intToFloat(format, readRegister(cpu, rs1), false, 64, rm)
+				setFloatFlags(cpu, flags)
+				writeFloatRegister(cpu, format, rd, result)
+			}
+		})),
+	}
+}
+
+func init() {
+	tables := []map[[4]uint32]Instruction{
+		FloatInstructions,
+		floatOperations(float32Format, 0b00, "S"),
+		floatOperations(float64Format, 0b01, "D"),
+	}
+	for _, table := range tables {
+		for key, instruction := range table {
+			Instructions[key] = instruction
+		}
+	}
+}
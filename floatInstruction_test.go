@@ -0,0 +1,304 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFloatInstructions(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+	var memorySize uint32 = 256 // bytes
+	var trapVector uint64 = 0x80
+
+	boxed := func(value uint32) uint64 {
+		return 0xFFFFFFFF<<32 | uint64(value)
+	}
+
+	tests := []struct {
+		name           string
+		instruction    uint32
+		fpuOff         bool
+		frm            uint32
+		defaultFloats  map[uint32]uint64
+		defaultRegs    map[uint32]uint32
+		defaultMem     map[uint32]uint32
+		expectedFloats map[uint32]uint64
+		expectedRegs   map[uint32]uint32
+		expectedMem    map[uint32]uint32
+		expectedFlags  uint32
+		expectedTrap   bool
+	}{
+		{
+			name:           "FADD.S with the dynamic rounding mode",
+			instruction:    assembleR(0b1010011, 1, roundDynamic, 2, 3, 0b0000000), // FADD.S f1, f2, f3, dyn
+			frm:            roundTowardZero,
+			defaultFloats:  map[uint32]uint64{2: boxed(0x3dcccccd), 3: boxed(0x3e4ccccd)}, // 0.1 + 0.2
+			expectedFloats: map[uint32]uint64{1: boxed(0x3e999999)},
+			expectedFlags:  flagInexact,
+		},
+		{
+			name:           "FADD.S with an improperly NaN-boxed operand",
+			instruction:    assembleR(0b1010011, 1, roundNearestEven, 2, 3, 0b0000000), // FADD.S f1, f2, f3
+			defaultFloats:  map[uint32]uint64{2: 0x000000003f800000, 3: boxed(0x3f800000)},
+			expectedFloats: map[uint32]uint64{1: boxed(0x7fc00000)},
+		},
+		{
+			name:           "FDIV.S by zero",
+			instruction:    assembleR(0b1010011, 1, roundNearestEven, 2, 3, 0b0001100), // FDIV.S f1, f2, f3
+			defaultFloats:  map[uint32]uint64{2: boxed(0x3f800000), 3: boxed(0x00000000)},
+			expectedFloats: map[uint32]uint64{1: boxed(0x7f800000)},
+			expectedFlags:  flagDivByZero,
+		},
+		{
+			name:           "FMADD.S",
+			instruction:    assembleR(0b1000011, 1, roundNearestEven, 2, 3, 4<<2), // FMADD.S f1, f2, f3, f4
+			defaultFloats:  map[uint32]uint64{2: boxed(0x40000000), 3: boxed(0x40400000), 4: boxed(0x3f800000)},
+			expectedFloats: map[uint32]uint64{1: boxed(0x40e00000)}, // 2 * 3 + 1 = 7
+		},
+		{
+			name:           "FMIN.S of -0 and +0",
+			instruction:    assembleR(0b1010011, 1, 0b000, 2, 3, 0b0010100), // FMIN.S f1, f2, f3
+			defaultFloats:  map[uint32]uint64{2: boxed(0x00000000), 3: boxed(0x80000000)},
+			expectedFloats: map[uint32]uint64{1: boxed(0x80000000)},
+		},
+		{
+			name:          "FCVT.W.S rounds toward zero",
+			instruction:   assembleR(0b1010011, 5, roundTowardZero, 2, 0b00000, 0b1100000), // FCVT.W.S x5, f2, rtz
+			defaultFloats: map[uint32]uint64{2: boxed(0xbfc00000)},                         // -1.5
+			expectedRegs:  map[uint32]uint32{5: 0xFFFFFFFF},
+			expectedFlags: flagInexact,
+		},
+		{
+			name:          "FCVT.WU.S of a negative value",
+			instruction:   assembleR(0b1010011, 5, roundNearestEven, 2, 0b00001, 0b1100000), // FCVT.WU.S x5, f2
+			defaultFloats: map[uint32]uint64{2: boxed(0xbf800000)},
+			expectedRegs:  map[uint32]uint32{5: 0},
+			expectedFlags: flagInvalid,
+		},
+		{
+			name:           "FCVT.S.W",
+			instruction:    assembleR(0b1010011, 1, roundNearestEven, 5, 0b00000, 0b1101000), // FCVT.S.W f1, x5
+			defaultRegs:    map[uint32]uint32{5: 0xFFFFFFFD},
+			expectedFloats: map[uint32]uint64{1: boxed(0xc0400000)}, // -3.0
+		},
+		{
+			name:          "FLT.S with a quiet NaN",
+			instruction:   assembleR(0b1010011, 5, 0b001, 2, 3, 0b1010000), // FLT.S x5, f2, f3
+			defaultFloats: map[uint32]uint64{2: boxed(0x7fc00000), 3: boxed(0x3f800000)},
+			defaultRegs:   map[uint32]uint32{5: 0xFF},
+			expectedRegs:  map[uint32]uint32{5: 0},
+			expectedFlags: flagInvalid,
+		},
+		{
+			name:          "FCLASS.S",
+			instruction:   assembleR(0b1010011, 5, 0b001, 2, 0, 0b1110000), // FCLASS.S x5, f2
+			defaultFloats: map[uint32]uint64{2: boxed(0xff800000)},
+			expectedRegs:  map[uint32]uint32{5: 1},
+		},
+		{
+			name:           "FSGNJN.S",
+			instruction:    assembleR(0b1010011, 1, 0b001, 2, 3, 0b0010000), // FSGNJN.S f1, f2, f3
+			defaultFloats:  map[uint32]uint64{2: boxed(0x3f800000), 3: boxed(0x3f800000)},
+			expectedFloats: map[uint32]uint64{1: boxed(0xbf800000)},
+		},
+		{
+			name:          "FMV.X.W keeps the raw bits",
+			instruction:   assembleR(0b1010011, 5, 0b000, 2, 0, 0b1110000), // FMV.X.W x5, f2
+			defaultFloats: map[uint32]uint64{2: boxed(0x7f800001)},
+			expectedRegs:  map[uint32]uint32{5: 0x7f800001},
+		},
+		{
+			name:           "FMV.W.X NaN-boxes",
+			instruction:    assembleR(0b1010011, 1, 0b000, 5, 0, 0b1111000), // FMV.W.X f1, x5
+			defaultRegs:    map[uint32]uint32{5: 0x12345678},
+			expectedFloats: map[uint32]uint64{1: boxed(0x12345678)},
+		},
+		{
+			name:           "FLW",
+			instruction:    assembleI(0b0000111, 1, 0b010, 5, 4), // FLW f1, 4(x5)
+			defaultRegs:    map[uint32]uint32{5: 0x20},
+			defaultMem:     map[uint32]uint32{0x24: 0x40490fdb},
+			expectedFloats: map[uint32]uint64{1: boxed(0x40490fdb)},
+		},
+		{
+			name:          "FSW",
+			instruction:   assembleS(0b0100111, 0b010, 5, 2, 4), // FSW f2, 4(x5)
+			defaultRegs:   map[uint32]uint32{5: 0x20},
+			defaultFloats: map[uint32]uint64{2: boxed(0x40490fdb)},
+			expectedMem:   map[uint32]uint32{0x24: 0x40490fdb},
+		},
+		{
+			name:           "FADD.D",
+			instruction:    assembleR(0b1010011, 1, roundNearestEven, 2, 3, 0b0000001),      // FADD.D f1, f2, f3
+			defaultFloats:  map[uint32]uint64{2: 0x3fb999999999999a, 3: 0x3fc999999999999a}, // 0.1 + 0.2
+			expectedFloats: map[uint32]uint64{1: 0x3fd3333333333334},
+			expectedFlags:  flagInexact,
+		},
+		{
+			name:           "FMADD.D",
+			instruction:    assembleR(0b1000011, 1, roundNearestEven, 2, 3, 4<<2|0b01), // FMADD.D f1, f2, f3, f4
+			defaultFloats:  map[uint32]uint64{2: 0x4000000000000000, 3: 0x4008000000000000, 4: 0x3ff0000000000000},
+			expectedFloats: map[uint32]uint64{1: 0x401c000000000000}, // 2 * 3 + 1 = 7
+		},
+		{
+			name:          "FLT.D",
+			instruction:   assembleR(0b1010011, 5, 0b001, 2, 3, 0b1010001), // FLT.D x5, f2, f3
+			defaultFloats: map[uint32]uint64{2: 0xbff0000000000000, 3: 0x3ff0000000000000},
+			expectedRegs:  map[uint32]uint32{5: 1},
+		},
+		{
+			name:           "FCVT.S.D",
+			instruction:    assembleR(0b1010011, 1, roundNearestEven, 2, 0b00001, 0b0100000), // FCVT.S.D f1, f2
+			defaultFloats:  map[uint32]uint64{2: 0x3fb999999999999a},
+			expectedFloats: map[uint32]uint64{1: boxed(0x3dcccccd)},
+			expectedFlags:  flagInexact,
+		},
+		{
+			name:           "FCVT.D.S",
+			instruction:    assembleR(0b1010011, 1, roundNearestEven, 2, 0b00000, 0b0100001), // FCVT.D.S f1, f2
+			defaultFloats:  map[uint32]uint64{2: boxed(0x3dcccccd)},
+			expectedFloats: map[uint32]uint64{1: 0x3fb99999a0000000},
+		},
+		{
+			name:          "FCVT.W.D",
+			instruction:   assembleR(0b1010011, 5, roundTowardZero, 2, 0b00000, 0b1100001), // FCVT.W.D x5, f2, rtz
+			defaultFloats: map[uint32]uint64{2: 0xc00c000000000000},                        // -3.5
+			expectedRegs:  map[uint32]uint32{5: 0xFFFFFFFD},
+			expectedFlags: flagInexact,
+		},
+		{
+			name:           "FCVT.D.WU",
+			instruction:    assembleR(0b1010011, 1, roundNearestEven, 5, 0b00001, 0b1101001), // FCVT.D.WU f1, x5
+			defaultRegs:    map[uint32]uint32{5: 0xFFFFFFFF},
+			expectedFloats: map[uint32]uint64{1: 0x41efffffffe00000},
+		},
+		{
+			name:           "FSGNJX.D",
+			instruction:    assembleR(0b1010011, 1, 0b010, 2, 3, 0b0010001), // FSGNJX.D f1, f2, f3
+			defaultFloats:  map[uint32]uint64{2: 0xbff0000000000000, 3: 0x8000000000000000},
+			expectedFloats: map[uint32]uint64{1: 0x3ff0000000000000},
+		},
+		{
+			name:           "FLD",
+			instruction:    assembleI(0b0000111, 1, 0b011, 5, 8), // FLD f1, 8(x5)
+			defaultRegs:    map[uint32]uint32{5: 0x20},
+			defaultMem:     map[uint32]uint32{0x28: 0x54442d18, 0x2C: 0x400921fb},
+			expectedFloats: map[uint32]uint64{1: 0x400921fb54442d18},
+		},
+		{
+			name:          "FSD",
+			instruction:   assembleS(0b0100111, 0b011, 5, 2, 8), // FSD f2, 8(x5)
+			defaultRegs:   map[uint32]uint32{5: 0x20},
+			defaultFloats: map[uint32]uint64{2: 0x400921fb54442d18},
+			expectedMem:   map[uint32]uint32{0x28: 0x54442d18, 0x2C: 0x400921fb},
+		},
+		{
+			name:           "FLD misaligned",
+			instruction:    assembleI(0b0000111, 1, 0b011, 5, 4), // FLD f1, 4(x5)
+			defaultRegs:    map[uint32]uint32{5: 0x20},
+			defaultFloats:  map[uint32]uint64{1: 0x3ff0000000000000},
+			expectedFloats: map[uint32]uint64{1: 0x3ff0000000000000},
+			expectedTrap:   true,
+		},
+		{
+			name:          "FLW misaligned",
+			instruction:   assembleI(0b0000111, 1, 0b010, 5, 2), // FLW f1, 2(x5)
+			defaultRegs:   map[uint32]uint32{5: 0x20},
+			defaultFloats: map[uint32]uint64{1: boxed(0x3f800000)},
+			// The trap handler runs instead, f1 is left unchanged
+			expectedFloats: map[uint32]uint64{1: boxed(0x3f800000)},
+			expectedTrap:   true,
+		},
+		{
+			name:           "Reserved rounding mode",
+			instruction:    assembleR(0b1010011, 1, 0b101, 2, 3, 0b0000000), // FADD.S f1, f2, f3, rm = 5
+			defaultFloats:  map[uint32]uint64{1: boxed(0x3f800000), 2: boxed(0x3f800000), 3: boxed(0x3f800000)},
+			expectedFloats: map[uint32]uint64{1: boxed(0x3f800000)},
+			expectedTrap:   true,
+		},
+		{
+			name:           "Invalid dynamic rounding mode",
+			instruction:    assembleR(0b1010011, 1, roundDynamic, 2, 3, 0b0000000), // FADD.S f1, f2, f3, dyn
+			frm:            0b110,
+			defaultFloats:  map[uint32]uint64{1: boxed(0x3f800000), 2: boxed(0x3f800000), 3: boxed(0x3f800000)},
+			expectedFloats: map[uint32]uint64{1: boxed(0x3f800000)},
+			expectedTrap:   true,
+		},
+		{
+			name:           "FPU off",
+			instruction:    assembleR(0b1010011, 1, roundNearestEven, 2, 3, 0b0000000), // FADD.S f1, f2, f3
+			fpuOff:         true,
+			defaultFloats:  map[uint32]uint64{1: boxed(0x3f800000), 2: boxed(0x3f800000), 3: boxed(0x3f800000)},
+			expectedFloats: map[uint32]uint64{1: boxed(0x3f800000)},
+			expectedTrap:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initMemory(&memory, memorySize, 0)
+			initCPUState(&cpu, 0, 0)
+			cpu.csr[csrMtvec] = trapVector
+			cpu.csr[csrFcsr] = uint64(test.frm) << 5
+			if test.fpuOff {
+				cpu.csr[csrMstatus] &^= mstatusFS
+			}
+
+			memory.Store32(0, test.instruction)
+			for address, value := range test.defaultMem {
+				memory.Store32(address, value)
+			}
+			for reg, value := range test.defaultRegs {
+				writeRegister(&cpu, reg, uint64(value))
+			}
+			for reg, value := range test.defaultFloats {
+				cpu.f[reg] = value
+			}
+
+			executeInstruction(&cpu, &memory)
+
+			for reg, expected := range test.expectedFloats {
+				if cpu.f[reg] != expected {
+					t.Errorf("expected f%d=0x%016x, got f%d=0x%016x", reg, expected, reg, cpu.f[reg])
+				}
+			}
+			for reg, expected := range test.expectedRegs {
+				if uint32(cpu.x[reg]) != expected {
+					t.Errorf("expected x%d=0x%x, got x%d=0x%x", reg, expected, reg, cpu.x[reg])
+				}
+			}
+			for address, expected := range test.expectedMem {
+				if value := memory.Load32(address); value != expected {
+					t.Errorf("expected memory[0x%x]=0x%x, got 0x%x", address, expected, value)
+				}
+			}
+			if flags := uint32(cpu.csr[csrFcsr]) & 0b11111; flags != test.expectedFlags {
+				t.Errorf("expected fflags 0b%05b, got 0b%05b", test.expectedFlags, flags)
+			}
+
+			if test.expectedTrap {
+				if cpu.pc != trapVector || cpu.csr[csrMepc] != 0 {
+					t.Errorf("expected a trap, got pc=0x%x mepc=0x%x", cpu.pc, cpu.csr[csrMepc])
+				}
+			} else if cpu.pc != 4 {
+				t.Errorf("expected pc=0x4, got pc=0x%x mcause=%d", cpu.pc, cpu.csr[csrMcause])
+			}
+		})
+	}
+}
+
+func TestFloatStateDirty(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initMemory(&memory, 64, 0)
+	initCPUState(&cpu, 0, 0)
+
+	memory.Store32(0, assembleR(0b1010011, 1, 0b000, 5, 0, 0b1111000)) // FMV.W.X f1, x5
+	executeInstruction(&cpu, &memory)
+
+	mstatus := CSRs[csrMstatus].Read(&cpu)
+	if mstatus&mstatusFS != mstatusFSDirty || mstatus&mstatusSDBit(&cpu) == 0 {
+		t.Errorf("expected FS=Dirty and SD set after writing a float register, got mstatus=0x%x", mstatus)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFloat32Arithmetic(t *testing.T) {
+	add, sub, mul, div := floatAdd, floatSub, floatMul, floatDiv
+	sqrt := func(format floatFormat, a uint64, b uint64, rm uint32) (uint64, uint32) {
+		return floatSqrt(format, a, rm)
+	}
+
+	tests := []struct {
+		name          string
+		op            func(format floatFormat, a uint64, b uint64, rm uint32) (uint64, uint32)
+		a, b          uint64
+		rm            uint32
+		expected      uint64
+		expectedFlags uint32
+	}{
+		{"1 + 2", add, 0x3f800000, 0x40000000, roundNearestEven, 0x40400000, 0},
+		{"0.1 + 0.2 RNE", add, 0x3dcccccd, 0x3e4ccccd, roundNearestEven, 0x3e99999a, flagInexact},
+		{"0.1 + 0.2 RTZ", add, 0x3dcccccd, 0x3e4ccccd, roundTowardZero, 0x3e999999, flagInexact},
+		{"0.1 + 0.2 RDN", add, 0x3dcccccd, 0x3e4ccccd, roundDown, 0x3e999999, flagInexact},
+		{"0.1 + 0.2 RUP", add, 0x3dcccccd, 0x3e4ccccd, roundUp, 0x3e99999a, flagInexact},
+		{"1 - 1 RNE is +0", sub, 0x3f800000, 0x3f800000, roundNearestEven, 0x00000000, 0},
+		{"1 - 1 RDN is -0", sub, 0x3f800000, 0x3f800000, roundDown, 0x80000000, 0},
+		{"-0 + -0", add, 0x80000000, 0x80000000, roundNearestEven, 0x80000000, 0},
+		{"inf - inf", sub, 0x7f800000, 0x7f800000, roundNearestEven, 0x7fc00000, flagInvalid},
+		{"qNaN + 1", add, 0x7fc00001, 0x3f800000, roundNearestEven, 0x7fc00000, 0},
+		{"sNaN + 1", add, 0x7f800001, 0x3f800000, roundNearestEven, 0x7fc00000, flagInvalid},
+		{"max * 2 RNE", mul, 0x7f7fffff, 0x40000000, roundNearestEven, 0x7f800000, flagOverflow | flagInexact},
+		{"max * 2 RTZ", mul, 0x7f7fffff, 0x40000000, roundTowardZero, 0x7f7fffff, flagOverflow | flagInexact},
+		{"-max * 2 RUP", mul, 0xff7fffff, 0x40000000, roundUp, 0xff7fffff, flagOverflow | flagInexact},
+		{"min normal * 0.5", mul, 0x00800000, 0x3f000000, roundNearestEven, 0x00400000, 0},
+		{"min subnormal * 0.5 RNE", mul, 0x00000001, 0x3f000000, roundNearestEven, 0x00000000, flagUnderflow | flagInexact},
+		{"min subnormal * 0.5 RUP", mul, 0x00000001, 0x3f000000, roundUp, 0x00000001, flagUnderflow | flagInexact},
+		// (2^-126 - 2^-149) * (1 + 2^-23) rounds to 2^-126: tiny before rounding but not after
+		{"tininess after rounding", mul, 0x007fffff, 0x3f800001, roundNearestEven, 0x00800000, flagInexact},
+		{"0 * inf", mul, 0x00000000, 0x7f800000, roundNearestEven, 0x7fc00000, flagInvalid},
+		{"-2 * 0", mul, 0xc0000000, 0x00000000, roundNearestEven, 0x80000000, 0},
+		{"1 / 3 RNE", div, 0x3f800000, 0x40400000, roundNearestEven, 0x3eaaaaab, flagInexact},
+		{"1 / 3 RTZ", div, 0x3f800000, 0x40400000, roundTowardZero, 0x3eaaaaaa, flagInexact},
+		{"6 / 3", div, 0x40c00000, 0x40400000, roundNearestEven, 0x40000000, 0},
+		{"1 / 0", div, 0x3f800000, 0x00000000, roundNearestEven, 0x7f800000, flagDivByZero},
+		{"-1 / 0", div, 0xbf800000, 0x00000000, roundNearestEven, 0xff800000, flagDivByZero},
+		{"0 / 0", div, 0x00000000, 0x00000000, roundNearestEven, 0x7fc00000, flagInvalid},
+		{"sqrt(4)", sqrt, 0x40800000, 0, roundNearestEven, 0x40000000, 0},
+		{"sqrt(2) RNE", sqrt, 0x40000000, 0, roundNearestEven, 0x3fb504f3, flagInexact},
+		{"sqrt(2) RUP", sqrt, 0x40000000, 0, roundUp, 0x3fb504f4, flagInexact},
+		{"sqrt(-0)", sqrt, 0x80000000, 0, roundNearestEven, 0x80000000, 0},
+		{"sqrt(-1)", sqrt, 0xbf800000, 0, roundNearestEven, 0x7fc00000, flagInvalid},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, flags := test.op(float32Format, test.a, test.b, test.rm)
+
+			if result != test.expected {
+				t.Errorf("expected 0x%08x, got 0x%08x", test.expected, result)
+			}
+			if flags != test.expectedFlags {
+				t.Errorf("expected flags 0b%05b, got 0b%05b", test.expectedFlags, flags)
+			}
+		})
+	}
+}
+
+func TestFloat32FusedMulAdd(t *testing.T) {
+	tests := []struct {
+		name          string
+		a, b, c       uint64
+		negateProduct bool
+		negateAddend  bool
+		rm            uint32
+		expected      uint64
+		expectedFlags uint32
+	}{
+		{"1 * 2 + 3", 0x3f800000, 0x40000000, 0x40400000, false, false, roundNearestEven, 0x40a00000, 0},
+		{"1 * 2 - 3", 0x3f800000, 0x40000000, 0x40400000, false, true, roundNearestEven, 0xbf800000, 0},
+		{"-(1 * 2) + 3", 0x3f800000, 0x40000000, 0x40400000, true, false, roundNearestEven, 0x3f800000, 0},
+		{"-(1 * 2) - 3", 0x3f800000, 0x40000000, 0x40400000, true, true, roundNearestEven, 0xc0a00000, 0},
+		// (1 + 2^-23) * (1 - 2^-24) - 1 is exact only without an intermediate rounding
+		{"single rounding", 0x3f800001, 0x3f7fffff, 0x3f800000, false, true, roundNearestEven, 0x337ffffe, 0},
+		{"1 * 1 - 1 RDN", 0x3f800000, 0x3f800000, 0x3f800000, false, true, roundDown, 0x80000000, 0},
+		{"inf * 0 + qNaN", 0x7f800000, 0x00000000, 0x7fc00000, false, false, roundNearestEven, 0x7fc00000, flagInvalid},
+		{"inf * 1 - inf", 0x7f800000, 0x3f800000, 0x7f800000, false, true, roundNearestEven, 0x7fc00000, flagInvalid},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, flags := floatFusedMulAdd(float32Format, test.a, test.b, test.c, test.negateProduct, test.negateAddend, test.rm)
+
+			if result != test.expected {
+				t.Errorf("expected 0x%08x, got 0x%08x", test.expected, result)
+			}
+			if flags != test.expectedFlags {
+				t.Errorf("expected flags 0b%05b, got 0b%05b", test.expectedFlags, flags)
+			}
+		})
+	}
+}
+
+func TestFloat32Conversions(t *testing.T) {
+	tests := []struct {
+		name          string
+		toInt         bool
+		signed        bool
+		value         uint64
+		rm            uint32
+		expected      uint64
+		expectedFlags uint32
+	}{
+		{"FCVT.W.S -1.5 RNE", true, true, 0xbfc00000, roundNearestEven, 0xfffffffe, flagInexact},
+		{"FCVT.W.S -1.5 RTZ", true, true, 0xbfc00000, roundTowardZero, 0xffffffff, flagInexact},
+		{"FCVT.W.S 2.5 RNE", true, true, 0x40200000, roundNearestEven, 2, flagInexact},
+		{"FCVT.W.S 2.5 RMM", true, true, 0x40200000, roundNearestMax, 3, flagInexact},
+		{"FCVT.W.S 3e9 saturates", true, true, 0x4f32d05e, roundNearestEven, 0x7fffffff, flagInvalid},
+		{"FCVT.W.S -inf saturates", true, true, 0xff800000, roundNearestEven, 0x80000000, flagInvalid},
+		{"FCVT.W.S NaN", true, true, 0x7fc00000, roundNearestEven, 0x7fffffff, flagInvalid},
+		{"FCVT.WU.S 3e9", true, false, 0x4f32d05e, roundNearestEven, 3000000000, 0},
+		{"FCVT.WU.S -1", true, false, 0xbf800000, roundNearestEven, 0, flagInvalid},
+		{"FCVT.WU.S -0.25 RNE", true, false, 0xbe800000, roundNearestEven, 0, flagInexact},
+		{"FCVT.S.W -1", false, true, 0xffffffff, roundNearestEven, 0xbf800000, 0},
+		{"FCVT.S.W 2^24 + 1 RNE", false, true, 16777217, roundNearestEven, 0x4b800000, flagInexact},
+		{"FCVT.S.W 2^24 + 1 RUP", false, true, 16777217, roundUp, 0x4b800001, flagInexact},
+		{"FCVT.S.WU 2^32 - 1", false, false, 0xffffffff, roundNearestEven, 0x4f800000, flagInexact},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result uint64
+			var flags uint32
+			if test.toInt {
+				result, flags = floatToInt(float32Format, test.value, test.signed, 32, test.rm)
+				result &= 0xFFFFFFFF
+			} else {
+				result, flags = intToFloat(float32Format, test.value, test.signed, 32, test.rm)
+			}
+
+			if result != test.expected {
+				t.Errorf("expected 0x%08x, got 0x%08x", test.expected, result)
+			}
+			if flags != test.expectedFlags {
+				t.Errorf("expected flags 0b%05b, got 0b%05b", test.expectedFlags, flags)
+			}
+		})
+	}
+}
+
+func TestFloat32CompareMinMaxClass(t *testing.T) {
+	if _, _, flags := floatCompare(float32Format, 0x7fc00000, 0x3f800000, false); flags != 0 {
+		t.Errorf("FEQ with a quiet NaN should not raise flags, got 0b%05b", flags)
+	}
+	if _, _, flags := floatCompare(float32Format, 0x7f800001, 0x3f800000, false); flags != flagInvalid {
+		t.Errorf("FEQ with a signaling NaN should raise NV, got 0b%05b", flags)
+	}
+	if less, _, flags := floatCompare(float32Format, 0x7fc00000, 0x3f800000, true); less || flags != flagInvalid {
+		t.Errorf("FLT with a quiet NaN should be false and raise NV, got %v 0b%05b", less, flags)
+	}
+	if _, equal, _ := floatCompare(float32Format, 0x80000000, 0x00000000, false); !equal {
+		t.Errorf("-0 and +0 should compare equal")
+	}
+	if result, _ := floatMinMax(float32Format, 0x00000000, 0x80000000, false); result != 0x80000000 {
+		t.Errorf("FMIN(+0, -0) should be -0, got 0x%08x", result)
+	}
+	if result, flags := floatMinMax(float32Format, 0x7f800001, 0x3f800000, true); result != 0x3f800000 || flags != flagInvalid {
+		t.Errorf("FMAX(sNaN, 1) should be 1 with NV, got 0x%08x 0b%05b", result, flags)
+	}
+	if result, _ := floatMinMax(float32Format, 0x7fc00000, 0x7f800001, true); result != 0x7fc00000 {
+		t.Errorf("FMAX(NaN, NaN) should be the canonical NaN, got 0x%08x", result)
+	}
+
+	classes := map[uint64]uint32{
+		0xff800000: 1 << 0, // -inf
+		0xbf800000: 1 << 1, // negative normal
+		0x80000001: 1 << 2, // negative subnormal
+		0x80000000: 1 << 3, // -0
+		0x00000000: 1 << 4, // +0
+		0x00000001: 1 << 5, // positive subnormal
+		0x3f800000: 1 << 6, // positive normal
+		0x7f800000: 1 << 7, // +inf
+		0x7f800001: 1 << 8, // signaling NaN
+		0x7fc00000: 1 << 9, // quiet NaN
+	}
+	for value, expected := range classes {
+		if class := floatClass(float32Format, value); class != expected {
+			t.Errorf("FCLASS(0x%08x): expected 0b%010b, got 0b%010b", value, expected, class)
+		}
+	}
+}
+
+func TestFloat64Arithmetic(t *testing.T) {
+	add, mul, div := floatAdd, floatMul, floatDiv
+	sqrt := func(format floatFormat, a uint64, b uint64, rm uint32) (uint64, uint32) {
+		return floatSqrt(format, a, rm)
+	}
+	fusedSub := func(format floatFormat, a uint64, b uint64, rm uint32) (uint64, uint32) {
+		return floatFusedMulAdd(format, a, b, 0x3ff0000000000000, false, true, rm) // a * b - 1
+	}
+
+	tests := []struct {
+		name          string
+		op            func(format floatFormat, a uint64, b uint64, rm uint32) (uint64, uint32)
+		a, b          uint64
+		rm            uint32
+		expected      uint64
+		expectedFlags uint32
+	}{
+		{"0.1 + 0.2 RNE", add, 0x3fb999999999999a, 0x3fc999999999999a, roundNearestEven, 0x3fd3333333333334, flagInexact},
+		{"0.1 + 0.2 RTZ", add, 0x3fb999999999999a, 0x3fc999999999999a, roundTowardZero, 0x3fd3333333333333, flagInexact},
+		{"1 / 3 RNE", div, 0x3ff0000000000000, 0x4008000000000000, roundNearestEven, 0x3fd5555555555555, flagInexact},
+		{"1 / 3 RUP", div, 0x3ff0000000000000, 0x4008000000000000, roundUp, 0x3fd5555555555556, flagInexact},
+		{"1 / -0", div, 0x3ff0000000000000, 0x8000000000000000, roundNearestEven, 0xfff0000000000000, flagDivByZero},
+		{"sqrt(2)", sqrt, 0x4000000000000000, 0, roundNearestEven, 0x3ff6a09e667f3bcd, flagInexact},
+		{"max * 2", mul, 0x7fefffffffffffff, 0x4000000000000000, roundNearestEven, 0x7ff0000000000000, flagOverflow | flagInexact},
+		{"min subnormal * 0.5", mul, 0x0000000000000001, 0x3fe0000000000000, roundNearestEven, 0x0000000000000000, flagUnderflow | flagInexact},
+		{"sNaN * 1", mul, 0x7ff0000000000001, 0x3ff0000000000000, roundNearestEven, 0x7ff8000000000000, flagInvalid},
+		// (1 + 2^-52) * (1 - 2^-53) - 1 is exact only without an intermediate rounding
+		{"fused single rounding", fusedSub, 0x3ff0000000000001, 0x3fefffffffffffff, roundNearestEven, 0x3c9ffffffffffffe, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, flags := test.op(float64Format, test.a, test.b, test.rm)
+
+			if result != test.expected {
+				t.Errorf("expected 0x%016x, got 0x%016x", test.expected, result)
+			}
+			if flags != test.expectedFlags {
+				t.Errorf("expected flags 0b%05b, got 0b%05b", test.expectedFlags, flags)
+			}
+		})
+	}
+}
+
+func TestFloat64Conversions(t *testing.T) {
+	toSingle := func(a uint64, rm uint32) (uint64, uint32) { return floatConvert(float64Format, float32Format, a, rm) }
+	toDouble := func(a uint64, rm uint32) (uint64, uint32) { return floatConvert(float32Format, float64Format, a, rm) }
+	toWord := func(a uint64, rm uint32) (uint64, uint32) {
+		result, flags := floatToInt(float64Format, a, true, 32, rm)
+		return result & 0xFFFFFFFF, flags
+	}
+	fromWord := func(a uint64, rm uint32) (uint64, uint32) { return intToFloat(float64Format, a, true, 32, rm) }
+	fromUnsignedWord := func(a uint64, rm uint32) (uint64, uint32) { return intToFloat(float64Format, a, false, 32, rm) }
+
+	tests := []struct {
+		name          string
+		op            func(a uint64, rm uint32) (uint64, uint32)
+		value         uint64
+		rm            uint32
+		expected      uint64
+		expectedFlags uint32
+	}{
+		{"FCVT.S.D 0.1", toSingle, 0x3fb999999999999a, roundNearestEven, 0x3dcccccd, flagInexact},
+		{"FCVT.S.D 0.1 RTZ", toSingle, 0x3fb999999999999a, roundTowardZero, 0x3dcccccc, flagInexact},
+		{"FCVT.S.D 1e300", toSingle, 0x7e37e43c8800759c, roundNearestEven, 0x7f800000, flagOverflow | flagInexact},
+		{"FCVT.S.D 2^-150", toSingle, 0x3690000000000000, roundNearestEven, 0x00000000, flagUnderflow | flagInexact},
+		{"FCVT.S.D sNaN", toSingle, 0x7ff0000000000001, roundNearestEven, 0x7fc00000, flagInvalid},
+		{"FCVT.D.S 0.1", toDouble, 0x3dcccccd, roundNearestEven, 0x3fb99999a0000000, 0},
+		{"FCVT.D.S min subnormal", toDouble, 0x00000001, roundNearestEven, 0x36a0000000000000, 0},
+		{"FCVT.D.S sNaN", toDouble, 0x7f800001, roundNearestEven, 0x7ff8000000000000, flagInvalid},
+		{"FCVT.W.D -(2^31 + 0.5) RNE", toWord, 0xc1e0000000100000, roundNearestEven, 0x80000000, flagInexact},
+		{"FCVT.W.D -(2^31 + 0.5) RDN", toWord, 0xc1e0000000100000, roundDown, 0x80000000, flagInvalid},
+		{"FCVT.D.W -1", fromWord, 0xffffffff, roundNearestEven, 0xbff0000000000000, 0},
+		{"FCVT.D.WU 2^32 - 1", fromUnsignedWord, 0xffffffff, roundNearestEven, 0x41efffffffe00000, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, flags := test.op(test.value, test.rm)
+
+			if result != test.expected {
+				t.Errorf("expected 0x%016x, got 0x%016x", test.expected, result)
+			}
+			if flags != test.expectedFlags {
+				t.Errorf("expected flags 0b%05b, got 0b%05b", test.expectedFlags, flags)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+// The instruction cache keeps the instructions fetched at each physical address. Like on real hardware, stores
+// do not update it: code written to memory is only fetched once FENCE.I has flushed the cache.
+const icacheSize = 1024
+
+type icacheEntry struct {
+	valid       bool
+	address     uint32 // Physical address of the low halfword
+	highValid   bool
+	highAddress uint32 // Physical address of the high halfword of a 32-bit instruction, it can be on another page
+	instruction uint32
+	length      uint32
+}
+
+func flushICache(cpu *CPUState) {
+	cpu.icache = [icacheSize]icacheEntry{}
+}
+
+// fetchInstruction returns the instruction at pc and its length in bytes, ok is false when the fetch raised an
+// exception. Each half of the instruction is translated on its own, a 32-bit instruction can straddle two pages.
+func fetchInstruction(cpu *CPUState, memory *Memory, pc uint64) (uint32, uint32, bool) {
+	low, ok := checkAccess(cpu, memory, pc, 2, accessFetch)
+	if !ok {
+		return 0, 0, false
+	}
+	entry := &cpu.icache[(low/2)%icacheSize]
+	if !entry.valid || entry.address != low {
+		*entry = icacheEntry{valid: true, address: low, instruction: uint32(memory.Load16(low)), length: 2}
+		if !isCompressed(entry.instruction) {
+			entry.length = 4
+		}
+	}
+	if entry.length == 2 {
+		return entry.instruction, 2, true
+	}
+
+	high, ok := checkAccess(cpu, memory, pc+2, 2, accessFetch)
+	if !ok {
+		return 0, 0, false
+	}
+	if !entry.highValid || entry.highAddress != high {
+		entry.instruction = entry.instruction&0xFFFF | uint32(memory.Load16(high))<<16
+		entry.highValid, entry.highAddress = true, high
+	}
+	return entry.instruction, 4, true
+}
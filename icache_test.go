@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFenceI(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initMemory(&memory, 256, 0)
+	initCPUState(&cpu, 0, 0)
+	memory.Store32(0x00, 0x00100093)   // ADDI x1, x0, 1
+	memory.Store32(0x04, 0x00312023)   // SW x3, 0(x2)
+	memory.Store32(0x08, 0x0000100F)   // FENCE.I
+	writeRegister(&cpu, 3, 0x00200093) // ADDI x1, x0, 2
+
+	executeInstruction(&cpu, &memory)
+	executeInstruction(&cpu, &memory) // Overwrites the ADDI at 0x00
+
+	cpu.pc = 0
+	executeInstruction(&cpu, &memory)
+	if cpu.x[1] != 1 {
+		t.Errorf("expected the stale instruction to run before FENCE.I, got x1=%d", cpu.x[1])
+	}
+
+	cpu.pc = 8
+	executeInstruction(&cpu, &memory)
+	cpu.pc = 0
+	executeInstruction(&cpu, &memory)
+	if cpu.x[1] != 2 {
+		t.Errorf("expected the new instruction to run after FENCE.I, got x1=%d", cpu.x[1])
+	}
+}
+
+func TestFetchInstructionCache(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initMemory(&memory, 256, 0)
+	initCPUState(&cpu, 0, 0)
+	memory.Store32(0x10, 0x4505_0513) // ADDI x10, x10, 0x450
+	memory.Store32(0x20, 0x0001_4501) // C.LI x10, 0
+
+	tests := []struct {
+		name           string
+		pc             uint64
+		expected       uint32
+		expectedLength uint32
+	}{
+		{"32-bit instruction", 0x10, 0x45050513, 4},
+		{"Compressed instruction", 0x20, 0x4501, 2},
+		{"Cached 32-bit instruction", 0x10, 0x45050513, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			instruction, length, ok := fetchInstruction(&cpu, &memory, test.pc)
+			if !ok || instruction != test.expected || length != test.expectedLength {
+				t.Errorf("expected 0x%08x (%d bytes), got 0x%08x (%d bytes, ok=%v)", test.expected,
+					test.expectedLength, instruction, length, ok)
+			}
+		})
+	}
+
+	memory.Store32(0x10, 0)
+	if instruction, _, _ := fetchInstruction(&cpu, &memory, 0x10); instruction != 0x45050513 {
+		t.Errorf("expected the cached instruction, got 0x%08x", instruction)
+	}
+	flushICache(&cpu)
+	if instruction, length, _ := fetchInstruction(&cpu, &memory, 0x10); instruction != 0 || length != 2 {
+		t.Errorf("expected the new instruction after a flush, got 0x%08x (%d bytes)", instruction, length)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	mathbits "math/bits"
 )
 
 type Instruction struct {
@@ -16,8 +17,8 @@ var Instructions = map[[4]uint32]Instruction{
 		"BEQ",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rs1, rs2, imm := args[0], args[1], args[2]
-			if readRegister(cpu, rs1) == readRegister(cpu, rs2) {
-				cpu.pc += imm
+			if readRegister(cpu, rs1) == readRegister(cpu, rs2) && checkJumpTarget(cpu, cpu.pc+immediate(imm)) {
+				jumpTo(cpu, cpu.pc+immediate(imm))
 			}
 		},
 	},
@@ -26,8 +27,8 @@ var Instructions = map[[4]uint32]Instruction{
 		"BNE",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rs1, rs2, imm := args[0], args[1], args[2]
-			if readRegister(cpu, rs1) != readRegister(cpu, rs2) {
-				cpu.pc += imm
+			if readRegister(cpu, rs1) != readRegister(cpu, rs2) && checkJumpTarget(cpu, cpu.pc+immediate(imm)) {
+				jumpTo(cpu, cpu.pc+immediate(imm))
 			}
 		},
 	},
@@ -36,8 +37,8 @@ var Instructions = map[[4]uint32]Instruction{
 		"BLT",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rs1, rs2, imm := args[0], args[1], args[2]
-			if int32(readRegister(cpu, rs1)) < int32(readRegister(cpu, rs2)) {
-				cpu.pc += imm
+			if int64(readRegister(cpu, rs1)) < int64(readRegister(cpu, rs2)) && checkJumpTarget(cpu, cpu.pc+immediate(imm)) {
+				jumpTo(cpu, cpu.pc+immediate(imm))
 			}
 		},
 	},
@@ -46,8 +47,8 @@ var Instructions = map[[4]uint32]Instruction{
 		"BGE",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rs1, rs2, imm := args[0], args[1], args[2]
-			if int32(readRegister(cpu, rs1)) >= int32(readRegister(cpu, rs2)) {
-				cpu.pc += imm
+			if int64(readRegister(cpu, rs1)) >= int64(readRegister(cpu, rs2)) && checkJumpTarget(cpu, cpu.pc+immediate(imm)) {
+				jumpTo(cpu, cpu.pc+immediate(imm))
 			}
 		},
 	},
@@ -56,8 +57,8 @@ var Instructions = map[[4]uint32]Instruction{
 		"BLTU",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rs1, rs2, imm := args[0], args[1], args[2]
-			if readRegister(cpu, rs1) < readRegister(cpu, rs2) {
-				cpu.pc += imm
+			if readRegister(cpu, rs1) < readRegister(cpu, rs2) && checkJumpTarget(cpu, cpu.pc+immediate(imm)) {
+				jumpTo(cpu, cpu.pc+immediate(imm))
 			}
 		},
 	},
@@ -66,8 +67,8 @@ var Instructions = map[[4]uint32]Instruction{
 		"BGEU",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rs1, rs2, imm := args[0], args[1], args[2]
-			if readRegister(cpu, rs1) >= readRegister(cpu, rs2) {
-				cpu.pc += imm
+			if readRegister(cpu, rs1) >= readRegister(cpu, rs2) && checkJumpTarget(cpu, cpu.pc+immediate(imm)) {
+				jumpTo(cpu, cpu.pc+immediate(imm))
 			}
 		},
 	},
@@ -77,8 +78,12 @@ var Instructions = map[[4]uint32]Instruction{
 		"LB",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, imm := args[0], args[1], args[2]
-			address := readRegister(cpu, rs1) + imm
-			writeRegister(cpu, rd, readMemory(memory, address))
+			address := effectiveAddress(cpu, rs1, imm)
+			physical, ok := checkAccess(cpu, memory, address, 1, accessLoad)
+			if !ok {
+				return
+			}
+			writeRegister(cpu, rd, uint64(int64(int8(memory.Load8(physical)))))
 		},
 	},
 	// LH : Load Halfword
@@ -86,8 +91,12 @@ var Instructions = map[[4]uint32]Instruction{
 		"LH",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, imm := args[0], args[1], args[2]
-			address := readRegister(cpu, rs1) + imm
-			writeRegister(cpu, rd, readMemory(memory, address))
+			address := effectiveAddress(cpu, rs1, imm)
+			physical, ok := checkAccess(cpu, memory, address, 2, accessLoad)
+			if !ok {
+				return
+			}
+			writeRegister(cpu, rd, uint64(int64(int16(memory.Load16(physical)))))
 		},
 	},
 	// LW : Load Word
@@ -95,8 +104,12 @@ var Instructions = map[[4]uint32]Instruction{
 		"LW",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, imm := args[0], args[1], args[2]
-			address := readRegister(cpu, rs1) + imm
-			writeRegister(cpu, rd, readMemory(memory, address))
+			address := effectiveAddress(cpu, rs1, imm)
+			physical, ok := checkAccess(cpu, memory, address, 4, accessLoad)
+			if !ok {
+				return
+			}
+			writeRegister(cpu, rd, signExtendWord(uint64(memory.Load32(physical))))
 		},
 	},
 	// LBU : Load Byte Unsigned
@@ -104,8 +117,12 @@ var Instructions = map[[4]uint32]Instruction{
 		"LBU",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, imm := args[0], args[1], args[2]
-			address := readRegister(cpu, rs1) + imm
-			writeRegister(cpu, rd, readMemory(memory, address))
+			address := effectiveAddress(cpu, rs1, imm)
+			physical, ok := checkAccess(cpu, memory, address, 1, accessLoad)
+			if !ok {
+				return
+			}
+			writeRegister(cpu, rd, uint64(memory.Load8(physical)))
 		},
 	},
 	// LHU : Load Halfword Unsigned
@@ -113,8 +130,12 @@ var Instructions = map[[4]uint32]Instruction{
 		"LHU",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, imm := args[0], args[1], args[2]
-			address := readRegister(cpu, rs1) + imm
-			writeRegister(cpu, rd, readMemory(memory, address))
+			address := effectiveAddress(cpu, rs1, imm)
+			physical, ok := checkAccess(cpu, memory, address, 2, accessLoad)
+			if !ok {
+				return
+			}
+			writeRegister(cpu, rd, uint64(memory.Load16(physical)))
 		},
 	},
 	// MISC-MEM
@@ -125,13 +146,21 @@ var Instructions = map[[4]uint32]Instruction{
 			// Do nothing
 		},
 	},
+	// FENCE.I : Instruction Fence (Zifencei)
+	// The following fetches see the stores made before it
+	{0b0001111, 0b001, 0, 0}: {
+		"FENCE.I",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			flushICache(cpu)
+		},
+	},
 	// OP-IMM
 	// ADDI : Add Immediate
 	{0b0010011, 0b000, 0, 0}: {
 		"ADDI",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, imm := args[0], args[1], args[2]
-			writeRegister(cpu, rd, readRegister(cpu, rs1)+imm)
+			writeRegister(cpu, rd, readRegister(cpu, rs1)+immediate(imm))
 		},
 	},
 	// SLTI : Set Less Than Immediate
@@ -139,7 +168,7 @@ var Instructions = map[[4]uint32]Instruction{
 		"SLTI",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, imm := args[0], args[1], args[2]
-			if int32(readRegister(cpu, rs1)) < int32(imm) {
+			if int64(readRegister(cpu, rs1)) < int64(immediate(imm)) {
 				writeRegister(cpu, rd, 1)
 			} else {
 				writeRegister(cpu, rd, 0)
@@ -151,8 +180,7 @@ var Instructions = map[[4]uint32]Instruction{
 		"SLTIU",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, imm := args[0], args[1], args[2]
-			signExtendedImm := uint32(int32(imm<<20) >> 20)
-			if readRegister(cpu, rs1) < signExtendedImm {
+			if readRegister(cpu, rs1) < immediate(imm) { // The immediate is sign-extended, then compared as unsigned
 				writeRegister(cpu, rd, 1)
 			} else {
 				writeRegister(cpu, rd, 0)
@@ -164,7 +192,7 @@ var Instructions = map[[4]uint32]Instruction{
 		"XORI",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, imm := args[0], args[1], args[2]
-			writeRegister(cpu, rd, readRegister(cpu, rs1)^imm)
+			writeRegister(cpu, rd, readRegister(cpu, rs1)^immediate(imm))
 		},
 	},
 	// ORI : OR Immediate
@@ -172,7 +200,7 @@ var Instructions = map[[4]uint32]Instruction{
 		"ORI",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, imm := args[0], args[1], args[2]
-			writeRegister(cpu, rd, readRegister(cpu, rs1)|imm)
+			writeRegister(cpu, rd, readRegister(cpu, rs1)|immediate(imm))
 		},
 	},
 	// ANDI : AND Immediate
@@ -180,10 +208,10 @@ var Instructions = map[[4]uint32]Instruction{
 		"ANDI",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, imm := args[0], args[1], args[2]
-			writeRegister(cpu, rd, readRegister(cpu, rs1)&imm)
+			writeRegister(cpu, rd, readRegister(cpu, rs1)&immediate(imm))
 		},
 	},
-	// OP-IMM-32 : 32-bit Immediate
+	// SLLI : Shift Left Logical Immediate
 	{0b0010011, 0b001, 0, 0}: {
 		"SLLI",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
@@ -196,7 +224,7 @@ var Instructions = map[[4]uint32]Instruction{
 		"SRLI",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, imm := args[0], args[1], args[2]
-			writeRegister(cpu, rd, readRegister(cpu, rs1)>>imm)
+			writeRegister(cpu, rd, readUnsignedRegister(cpu, rs1)>>imm)
 		},
 	},
 	// SRAI : Shift Right Arithmetic Immediate
@@ -204,7 +232,7 @@ var Instructions = map[[4]uint32]Instruction{
 		"SRAI",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, imm := args[0], args[1], args[2]
-			writeRegister(cpu, rd, uint32(int32(readRegister(cpu, rs1))>>imm))
+			writeRegister(cpu, rd, uint64(int64(readRegister(cpu, rs1))>>imm))
 		},
 	},
 	// JALR
@@ -213,9 +241,12 @@ var Instructions = map[[4]uint32]Instruction{
 		"JALR",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, imm := args[0], args[1], args[2]
-			writeRegister(cpu, rd, cpu.pc+4)
-			var targetAddress = readRegister(cpu, rs1) + imm
-			cpu.pc = targetAddress
+			var targetAddress = effectiveAddress(cpu, rs1, imm) &^ 1
+			if !checkJumpTarget(cpu, targetAddress) {
+				return
+			}
+			writeRegister(cpu, rd, cpu.pc+uint64(cpu.instructionLength))
+			jumpTo(cpu, targetAddress)
 		},
 	},
 	// SYSTEM
@@ -223,15 +254,129 @@ var Instructions = map[[4]uint32]Instruction{
 	{0b1110011, 0, 0, 0}: {
 		"ECALL",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
-			// Do nothing
+			raiseException(cpu, causeEnvironmentCallFromUMode+cpu.privilege, 0) // The cause encodes the calling mode
 		},
 	},
 	// EBREAK : Environment Break
 	{0b1110011, 0, 0, 1}: {
 		"EBREAK",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
-			stepMode = true
-			fmt.Println("Step by step mode enabled")
+			tvec := cpu.csr[csrMtvec]
+			if isTrapDelegated(cpu, causeBreakpoint) {
+				tvec = cpu.csr[csrStvec]
+			}
+			if trapVector(tvec, causeBreakpoint) == 0 {
+				// No trap handler installed: the breakpoint is still reported as an unhandled trap, then drops into
+				// the step by step debugger instead of stopping the program
+				stepMode = true
+				fmt.Println("Step by step mode enabled")
+			}
+			raiseException(cpu, causeBreakpoint, cpu.pc)
+		},
+	},
+	// MRET : Machine-mode Return
+	{0b1110011, 0, 0, 0b001100000010}: {
+		"MRET",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			if cpu.privilege != privilegeMachine {
+				raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+				return
+			}
+			returnFromTrap(cpu)
+		},
+	},
+	// SRET : Supervisor-mode Return (illegal in S-mode when mstatus.TSR is set)
+	{0b1110011, 0, 0, 0b000100000010}: {
+		"SRET",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			if cpu.privilege < privilegeSupervisor ||
+				(cpu.privilege == privilegeSupervisor && cpu.csr[csrMstatus]&mstatusTSR != 0) {
+				raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+				return
+			}
+			returnFromSupervisorTrap(cpu)
+		},
+	},
+	// SFENCE.VMA : Supervisor Memory-Management Fence
+	// rs1 selects the virtual address to flush (all of them when x0), the address space in rs2 is ignored since
+	// the TLB does not keep ASIDs. Illegal in U-mode, and in S-mode when mstatus.TVM is set.
+	{0b1110011, 0, 0, 0b000100100000}: {
+		"SFENCE.VMA",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rs1 := args[1]
+			if cpu.privilege == privilegeUser ||
+				(cpu.privilege == privilegeSupervisor && cpu.csr[csrMstatus]&mstatusTVM != 0) {
+				raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+				return
+			}
+			if rs1 == 0 {
+				flushTLB(cpu)
+			} else {
+				flushTLBPage(cpu, readUnsignedRegister(cpu, rs1))
+			}
+		},
+	},
+	// WFI : Wait For Interrupt
+	// The hart is allowed to resume at any time, so WFI simply continues with the next instruction. It is illegal
+	// in U-mode, and in S-mode when mstatus.TW is set.
+	{0b1110011, 0, 0, 0b000100000101}: {
+		"WFI",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			if cpu.privilege == privilegeUser ||
+				(cpu.privilege == privilegeSupervisor && cpu.csr[csrMstatus]&mstatusTW != 0) {
+				raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+			}
+		},
+	},
+	// CSRRW : Atomic Read/Write CSR
+	{0b1110011, 0b001, 0, 0}: {
+		"CSRRW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, csr := args[0], args[1], args[2]
+			value := readRegister(cpu, rs1)
+			accessCSR(cpu, rd, csr, rd != 0, true, func(old uint64) uint64 { return value })
+		},
+	},
+	// CSRRS : Atomic Read and Set Bits in CSR
+	{0b1110011, 0b010, 0, 0}: {
+		"CSRRS",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, csr := args[0], args[1], args[2]
+			mask := readRegister(cpu, rs1)
+			accessCSR(cpu, rd, csr, true, rs1 != 0, func(old uint64) uint64 { return old | mask })
+		},
+	},
+	// CSRRC : Atomic Read and Clear Bits in CSR
+	{0b1110011, 0b011, 0, 0}: {
+		"CSRRC",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, csr := args[0], args[1], args[2]
+			mask := readRegister(cpu, rs1)
+			accessCSR(cpu, rd, csr, true, rs1 != 0, func(old uint64) uint64 { return old &^ mask })
+		},
+	},
+	// CSRRWI : Atomic Read/Write CSR Immediate (the rs1 field holds a 5-bit zero-extended immediate)
+	{0b1110011, 0b101, 0, 0}: {
+		"CSRRWI",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, uimm, csr := args[0], args[1], args[2]
+			accessCSR(cpu, rd, csr, rd != 0, true, func(old uint64) uint64 { return uint64(uimm) })
+		},
+	},
+	// CSRRSI : Atomic Read and Set Bits in CSR Immediate
+	{0b1110011, 0b110, 0, 0}: {
+		"CSRRSI",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, uimm, csr := args[0], args[1], args[2]
+			accessCSR(cpu, rd, csr, true, uimm != 0, func(old uint64) uint64 { return old | uint64(uimm) })
+		},
+	},
+	// CSRRCI : Atomic Read and Clear Bits in CSR Immediate
+	{0b1110011, 0b111, 0, 0}: {
+		"CSRRCI",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, uimm, csr := args[0], args[1], args[2]
+			accessCSR(cpu, rd, csr, true, uimm != 0, func(old uint64) uint64 { return old &^ uint64(uimm) })
 		},
 	},
 	// JAL
@@ -240,8 +385,11 @@ var Instructions = map[[4]uint32]Instruction{
 		"JAL",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, imm := args[0], args[1]
-			writeRegister(cpu, rd, cpu.pc+4)
-			cpu.pc = cpu.pc + imm
+			if !checkJumpTarget(cpu, cpu.pc+immediate(imm)) {
+				return
+			}
+			writeRegister(cpu, rd, cpu.pc+uint64(cpu.instructionLength))
+			jumpTo(cpu, cpu.pc+immediate(imm))
 		},
 	},
 	// OP
@@ -266,7 +414,7 @@ var Instructions = map[[4]uint32]Instruction{
 		"SLL",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, rs2 := args[0], args[1], args[2]
-			writeRegister(cpu, rd, readRegister(cpu, rs1)<<readRegister(cpu, rs2))
+			writeRegister(cpu, rd, readRegister(cpu, rs1)<<shiftAmount(cpu, readRegister(cpu, rs2)))
 		},
 	},
 	// SLT : Set Less Than
@@ -274,7 +422,7 @@ var Instructions = map[[4]uint32]Instruction{
 		"SLT",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, rs2 := args[0], args[1], args[2]
-			if readRegister(cpu, rs1) < readRegister(cpu, rs2) {
+			if int64(readRegister(cpu, rs1)) < int64(readRegister(cpu, rs2)) {
 				writeRegister(cpu, rd, 1)
 			} else {
 				writeRegister(cpu, rd, 0)
@@ -306,7 +454,7 @@ var Instructions = map[[4]uint32]Instruction{
 		"SRL",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, rs2 := args[0], args[1], args[2]
-			writeRegister(cpu, rd, readRegister(cpu, rs1)>>readRegister(cpu, rs2))
+			writeRegister(cpu, rd, readUnsignedRegister(cpu, rs1)>>shiftAmount(cpu, readRegister(cpu, rs2)))
 		},
 	},
 	// SRA : Shift Right Arithmetic
@@ -314,7 +462,7 @@ var Instructions = map[[4]uint32]Instruction{
 		"SRA",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, rs1, rs2 := args[0], args[1], args[2]
-			writeRegister(cpu, rd, uint32(int32(readRegister(cpu, rs1))>>readRegister(cpu, rs2)))
+			writeRegister(cpu, rd, uint64(int64(readRegister(cpu, rs1))>>shiftAmount(cpu, readRegister(cpu, rs2))))
 		},
 	},
 	// OR : OR
@@ -333,15 +481,106 @@ var Instructions = map[[4]uint32]Instruction{
 			writeRegister(cpu, rd, readRegister(cpu, rs1)&readRegister(cpu, rs2))
 		},
 	},
+	// OP (RV32M)
+	// MUL : Multiply
+	{0b0110011, 0b000, 0b0000001, 0}: {
+		"MUL",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, readRegister(cpu, rs1)*readRegister(cpu, rs2))
+		},
+	},
+	// MULH : Multiply High (signed x signed)
+	{0b0110011, 0b001, 0b0000001, 0}: {
+		"MULH",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, multiplyHigh(cpu, readRegister(cpu, rs1), readRegister(cpu, rs2), true, true))
+		},
+	},
+	// MULHSU : Multiply High (signed x unsigned)
+	{0b0110011, 0b010, 0b0000001, 0}: {
+		"MULHSU",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, multiplyHigh(cpu, readRegister(cpu, rs1), readUnsignedRegister(cpu, rs2), true, false))
+		},
+	},
+	// MULHU : Multiply High (unsigned x unsigned)
+	{0b0110011, 0b011, 0b0000001, 0}: {
+		"MULHU",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, multiplyHigh(cpu, readUnsignedRegister(cpu, rs1), readUnsignedRegister(cpu, rs2), false, false))
+		},
+	},
+	// DIV : Divide
+	{0b0110011, 0b100, 0b0000001, 0}: {
+		"DIV",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			dividend, divisor := int64(readRegister(cpu, rs1)), int64(readRegister(cpu, rs2))
+			if divisor == 0 {
+				writeRegister(cpu, rd, ^uint64(0)) // Division by zero gives -1
+			} else {
+				// Overflow gives the dividend: Go defines MinInt64 / -1 so, and the RV32 quotient 2^31 is
+				// truncated back to -2^31 by writeRegister
+				writeRegister(cpu, rd, uint64(dividend/divisor))
+			}
+		},
+	},
+	// DIVU : Divide Unsigned
+	{0b0110011, 0b101, 0b0000001, 0}: {
+		"DIVU",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			dividend, divisor := readUnsignedRegister(cpu, rs1), readUnsignedRegister(cpu, rs2)
+			if divisor == 0 {
+				writeRegister(cpu, rd, ^uint64(0)) // Division by zero gives 2^XLEN-1
+			} else {
+				writeRegister(cpu, rd, dividend/divisor)
+			}
+		},
+	},
+	// REM : Remainder
+	{0b0110011, 0b110, 0b0000001, 0}: {
+		"REM",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			dividend, divisor := int64(readRegister(cpu, rs1)), int64(readRegister(cpu, rs2))
+			if divisor == 0 {
+				writeRegister(cpu, rd, uint64(dividend)) // Remainder of a division by zero is the dividend
+			} else {
+				writeRegister(cpu, rd, uint64(dividend%divisor)) // Overflow gives a remainder of 0
+			}
+		},
+	},
+	// REMU : Remainder Unsigned
+	{0b0110011, 0b111, 0b0000001, 0}: {
+		"REMU",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			dividend, divisor := readUnsignedRegister(cpu, rs1), readUnsignedRegister(cpu, rs2)
+			if divisor == 0 {
+				writeRegister(cpu, rd, dividend) // Remainder of a division by zero is the dividend
+			} else {
+				writeRegister(cpu, rd, dividend%divisor)
+			}
+		},
+	},
 	// STORE
 	// SB : Store Byte
 	{0b0100011, 0b000, 0, 0}: {
 		"SB",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rs1, rs2, imm := args[0], args[1], args[2]
-			address := readRegister(cpu, rs1) + imm
-			value := readRegister(cpu, rs2) & 0xFF // Mask to keep only the lower 8 bits
-			writeByte(memory, address, value)      // Write only a byte to memory
+			address := effectiveAddress(cpu, rs1, imm)
+			physical, ok := checkAccess(cpu, memory, address, 1, accessStore)
+			if !ok {
+				return
+			}
+			memory.Store8(physical, uint8(readRegister(cpu, rs2)))
+			invalidateReservation(cpu, physical)
 		},
 	},
 	// SH : Store Halfword
@@ -349,11 +588,13 @@ var Instructions = map[[4]uint32]Instruction{
 		"SH",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rs1, rs2, imm := args[0], args[1], args[2]
-			address := readRegister(cpu, rs1) + imm
-			value := readRegister(cpu, rs2) & 0xFFFF // Mask lower 16 bits
-			//writeMemory(memory, address, value)      // Write the entire 32-bit value
-			writeHalfword(memory, address, value) // Write only a halfword to memory
-			fmt.Printf("SH: address: %d, value: %d\n", address, value)
+			address := effectiveAddress(cpu, rs1, imm)
+			physical, ok := checkAccess(cpu, memory, address, 2, accessStore)
+			if !ok {
+				return
+			}
+			memory.Store16(physical, uint16(readRegister(cpu, rs2)))
+			invalidateReservation(cpu, physical)
 		},
 	},
 	// SW : Store Word
@@ -361,9 +602,134 @@ var Instructions = map[[4]uint32]Instruction{
 		"SW",
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rs1, rs2, imm := args[0], args[1], args[2]
-			address := readRegister(cpu, rs1) + imm
-			value := readRegister(cpu, rs2) // Use the entire 32-bit value
-			writeWord(memory, address, value)
+			address := effectiveAddress(cpu, rs1, imm)
+			physical, ok := checkAccess(cpu, memory, address, 4, accessStore)
+			if !ok {
+				return
+			}
+			memory.Store32(physical, uint32(readRegister(cpu, rs2)))
+			invalidateReservation(cpu, physical)
+		},
+	},
+	// AMO
+	// LR.W : Load Reserved Word
+	{0b0101111, 0b010, 0b00010, 0}: {
+		"LR.W",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			if rs2 != 0 {
+				raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction)) // Reserved encoding
+				return
+			}
+			address := effectiveAddress(cpu, rs1, 0)
+			physical, ok := checkAccess(cpu, memory, address, 4, accessLoad)
+			if !ok {
+				return
+			}
+			writeRegister(cpu, rd, signExtendWord(uint64(memory.Load32(physical))))
+			reserveAddress(cpu, physical)
+		},
+	},
+	// SC.W : Store Conditional Word
+	{0b0101111, 0b010, 0b00011, 0}: {
+		"SC.W",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			address := effectiveAddress(cpu, rs1, 0)
+			physical, ok := checkAccess(cpu, memory, address, 4, accessStore)
+			if !ok {
+				return
+			}
+			if cpu.reservationValid && cpu.reservation == physical&^3 {
+				memory.Store32(physical, uint32(readRegister(cpu, rs2)))
+				writeRegister(cpu, rd, 0) // Success
+			} else {
+				writeRegister(cpu, rd, 1) // Failure
+			}
+			cpu.reservationValid = false
+		},
+	},
+	// AMOSWAP.W : Atomic Swap
+	{0b0101111, 0b010, 0b00001, 0}: {
+		"AMOSWAP.W",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperation(cpu, memory, args[0], args[1], args[2], func(a, b uint32) uint32 { return b })
+		},
+	},
+	// AMOADD.W : Atomic Add
+	{0b0101111, 0b010, 0b00000, 0}: {
+		"AMOADD.W",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperation(cpu, memory, args[0], args[1], args[2], func(a, b uint32) uint32 { return a + b })
+		},
+	},
+	// AMOXOR.W : Atomic XOR
+	{0b0101111, 0b010, 0b00100, 0}: {
+		"AMOXOR.W",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperation(cpu, memory, args[0], args[1], args[2], func(a, b uint32) uint32 { return a ^ b })
+		},
+	},
+	// AMOAND.W : Atomic AND
+	{0b0101111, 0b010, 0b01100, 0}: {
+		"AMOAND.W",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperation(cpu, memory, args[0], args[1], args[2], func(a, b uint32) uint32 { return a & b })
+		},
+	},
+	// AMOOR.W : Atomic OR
+	{0b0101111, 0b010, 0b01000, 0}: {
+		"AMOOR.W",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperation(cpu, memory, args[0], args[1], args[2], func(a, b uint32) uint32 { return a | b })
+		},
+	},
+	// AMOMIN.W : Atomic Minimum
+	{0b0101111, 0b010, 0b10000, 0}: {
+		"AMOMIN.W",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperation(cpu, memory, args[0], args[1], args[2], func(a, b uint32) uint32 {
+				if int32(a) < int32(b) {
+					return a
+				}
+				return b
+			})
+		},
+	},
+	// AMOMAX.W : Atomic Maximum
+	{0b0101111, 0b010, 0b10100, 0}: {
+		"AMOMAX.W",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperation(cpu, memory, args[0], args[1], args[2], func(a, b uint32) uint32 {
+				if int32(a) > int32(b) {
+					return a
+				}
+				return b
+			})
+		},
+	},
+	// AMOMINU.W : Atomic Minimum Unsigned
+	{0b0101111, 0b010, 0b11000, 0}: {
+		"AMOMINU.W",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperation(cpu, memory, args[0], args[1], args[2], func(a, b uint32) uint32 {
+				if a < b {
+					return a
+				}
+				return b
+			})
+		},
+	},
+	// AMOMAXU.W : Atomic Maximum Unsigned
+	{0b0101111, 0b010, 0b11100, 0}: {
+		"AMOMAXU.W",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperation(cpu, memory, args[0], args[1], args[2], func(a, b uint32) uint32 {
+				if a > b {
+					return a
+				}
+				return b
+			})
 		},
 	},
 	// AU-IPC
@@ -373,7 +739,7 @@ var Instructions = map[[4]uint32]Instruction{
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, imm := args[0], args[1]
 			imm = imm << 12
-			writeRegister(cpu, rd, cpu.pc+imm)
+			writeRegister(cpu, rd, cpu.pc+immediate(imm))
 		},
 	},
 	// LUI
@@ -383,14 +749,71 @@ var Instructions = map[[4]uint32]Instruction{
 		func(cpu *CPUState, memory *Memory, args ...uint32) {
 			rd, imm := args[0], args[1]
 			imm = imm << 12
-			writeRegister(cpu, rd, imm)
+			writeRegister(cpu, rd, immediate(imm)) // Sign-extended from bit 31 in RV64
 		},
 	},
 }
 
-func FindInstruction(instruction uint32, funct3 uint32, funct7 uint32, funct12 uint32) (Instruction, error) {
+// atomicMemoryOperation loads the word at rs1 into rd (sign-extended) and stores op(loaded value, rs2) back to memory.
+func atomicMemoryOperation(cpu *CPUState, memory *Memory, rd uint32, rs1 uint32, rs2 uint32, op func(a, b uint32) uint32) {
+	address := effectiveAddress(cpu, rs1, 0)
+	physical, ok := checkAccess(cpu, memory, address, 4, accessStore)
+	if !ok {
+		return
+	}
+	value := memory.Load32(physical)
+	result := op(value, uint32(readRegister(cpu, rs2)))
+	memory.Store32(physical, result)
+	invalidateReservation(cpu, physical)
+	writeRegister(cpu, rd, signExtendWord(uint64(value)))
+}
+
+// multiplyHigh returns the upper XLEN bits of the product of a and b, each read as signed or unsigned. In RV32 the
+// operands are sign- or zero-extended registers, so the full product fits in the lower 64 bits.
+func multiplyHigh(cpu *CPUState, a uint64, b uint64, signedA bool, signedB bool) uint64 {
+	high, low := mathbits.Mul64(a, b)
+	if cpu.xlen == 32 {
+		return low >> 32
+	}
+	// Unsigned 128-bit product corrected for the negative two's complement operands
+	if signedA && int64(a) < 0 {
+		high -= b
+	}
+	if signedB && int64(b) < 0 {
+		high -= a
+	}
+	return high
+}
+
+// Operations {opcode, funct3, funct7} whose rs2 field (instruction[24:20]) is an extension of the opcode rather than a
+// register or a shift amount: it becomes the funct12 part of their key.
+var operationsSelectedByRs2 = map[[3]uint32]bool{
+	{0b0010011, 0b001, 0b0110000}: true, // CLZ, CTZ, CPOP, SEXT.B, SEXT.H
+	{0b0011011, 0b001, 0b0110000}: true, // CLZW, CTZW, CPOPW
+	{0b0010011, 0b101, 0b0010100}: true, // ORC.B
+	{0b0010011, 0b101, 0b0110100}: true, // REV8
+	{0b0010011, 0b101, 0b0110101}: true, // REV8 (RV64)
+	{0b0010011, 0b001, 0b0000100}: true, // ZIP
+	{0b0010011, 0b101, 0b0000100}: true, // UNZIP
+	{0b0010011, 0b001, 0b0001000}: true, // SHA256SUM0, SHA256SUM1, SHA256SIG0, SHA256SIG1
+}
+
+func isSelectedByRs2(opcode uint32, funct3 uint32, funct7 uint32) bool {
+	return operationsSelectedByRs2[[3]uint32{opcode, funct3, funct7}]
+}
+
+// FindInstruction returns the instruction of an encoding, instructions of the extensions disabled by the ISA are
+// not found.
+func FindInstruction(cpu *CPUState, instruction uint32, funct3 uint32, funct7 uint32, funct12 uint32) (Instruction, error) {
 	opcode := instruction & 0x7F
-	if instr, ok := Instructions[[4]uint32{opcode, funct3, funct7, funct12}]; ok {
+	if isSelectedByRs2(opcode, funct3, funct7) {
+		funct12 = (instruction >> 20) & 0x1F
+	}
+	key := [4]uint32{opcode, funct3, funct7, funct12}
+	if instr, ok := Instructions[key]; ok {
+		if !isInstructionEnabled(cpu, key, instr.Name, instruction) {
+			return Instruction{}, fmt.Errorf("instruction %s is not part of the selected ISA", instr.Name)
+		}
 		return instr, nil
 	}
 	return Instruction{}, fmt.Errorf("instruction {opcode: %b, funct3: %b, funct7: %b, funct12: %b} not found", opcode, funct3, funct7, funct12)
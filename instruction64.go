@@ -0,0 +1,359 @@
+package main
+
+import mathbits "math/bits" // bits is the field extractor of compressed.go
+
+// rv64Instruction wraps an instruction that only exists in RV64: it is illegal when the hart runs with XLEN = 32.
+func rv64Instruction(instruction Instruction) Instruction {
+	return Instruction{
+		instruction.Name,
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			if cpu.xlen != 64 {
+				raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+				return
+			}
+			instruction.Exec(cpu, memory, args...)
+		},
+	}
+}
+
+// RV64Instructions holds the RV64I, RV64M and RV64A instructions, they are merged into Instructions.
+var RV64Instructions = map[[4]uint32]Instruction{
+	// LOAD
+	// LWU : Load Word Unsigned
+	{0b0000011, 0b110, 0, 0}: rv64Instruction(Instruction{
+		"LWU",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, imm := args[0], args[1], args[2]
+			address := effectiveAddress(cpu, rs1, imm)
+			physical, ok := checkAccess(cpu, memory, address, 4, accessLoad)
+			if !ok {
+				return
+			}
+			writeRegister(cpu, rd, uint64(memory.Load32(physical)))
+		},
+	}),
+	// LD : Load Doubleword
+	{0b0000011, 0b011, 0, 0}: rv64Instruction(Instruction{
+		"LD",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, imm := args[0], args[1], args[2]
+			address := effectiveAddress(cpu, rs1, imm)
+			physical, ok := checkAccess(cpu, memory, address, 8, accessLoad)
+			if !ok {
+				return
+			}
+			writeRegister(cpu, rd, readDoubleword(memory, physical))
+		},
+	}),
+	// STORE
+	// SD : Store Doubleword
+	{0b0100011, 0b011, 0, 0}: rv64Instruction(Instruction{
+		"SD",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rs1, rs2, imm := args[0], args[1], args[2]
+			address := effectiveAddress(cpu, rs1, imm)
+			physical, ok := checkAccess(cpu, memory, address, 8, accessStore)
+			if !ok {
+				return
+			}
+			writeDoubleword(cpu, memory, physical, readRegister(cpu, rs2))
+		},
+	}),
+	// OP-IMM
+	// REV8 : Byte-Reverse Register (RV64 encoding)
+	{0b0010011, 0b101, 0b0110101, 0b11000}: rv64Instruction(Instruction{
+		"REV8",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1 := args[0], args[1]
+			writeRegister(cpu, rd, mathbits.ReverseBytes64(readRegister(cpu, rs1)))
+		},
+	}),
+	// OP-IMM-32
+	// ADDIW : Add Word Immediate
+	{0b0011011, 0b000, 0, 0}: rv64Instruction(Instruction{
+		"ADDIW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, imm := args[0], args[1], args[2]
+			writeRegister(cpu, rd, signExtendWord(readRegister(cpu, rs1)+immediate(imm)))
+		},
+	}),
+	// SLLIW : Shift Left Logical Word Immediate
+	{0b0011011, 0b001, 0, 0}: rv64Instruction(Instruction{
+		"SLLIW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, imm := args[0], args[1], args[2]
+			writeRegister(cpu, rd, signExtendWord(readRegister(cpu, rs1)<<imm))
+		},
+	}),
+	// SRLIW : Shift Right Logical Word Immediate
+	{0b0011011, 0b101, 0b0000000, 0}: rv64Instruction(Instruction{
+		"SRLIW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, imm := args[0], args[1], args[2]
+			writeRegister(cpu, rd, signExtendWord(uint64(uint32(readRegister(cpu, rs1))>>imm)))
+		},
+	}),
+	// SRAIW : Shift Right Arithmetic Word Immediate
+	{0b0011011, 0b101, 0b0100000, 0}: rv64Instruction(Instruction{
+		"SRAIW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, imm := args[0], args[1], args[2]
+			writeRegister(cpu, rd, uint64(int64(int32(readRegister(cpu, rs1))>>imm)))
+		},
+	}),
+	// OP-32
+	// ADDW : Add Word
+	{0b0111011, 0b000, 0b0000000, 0}: rv64Instruction(Instruction{
+		"ADDW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, signExtendWord(readRegister(cpu, rs1)+readRegister(cpu, rs2)))
+		},
+	}),
+	// SUBW : Subtract Word
+	{0b0111011, 0b000, 0b0100000, 0}: rv64Instruction(Instruction{
+		"SUBW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, signExtendWord(readRegister(cpu, rs1)-readRegister(cpu, rs2)))
+		},
+	}),
+	// SLLW : Shift Left Logical Word
+	{0b0111011, 0b001, 0b0000000, 0}: rv64Instruction(Instruction{
+		"SLLW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, signExtendWord(readRegister(cpu, rs1)<<(readRegister(cpu, rs2)&0x1F)))
+		},
+	}),
+	// SRLW : Shift Right Logical Word
+	{0b0111011, 0b101, 0b0000000, 0}: rv64Instruction(Instruction{
+		"SRLW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, signExtendWord(uint64(uint32(readRegister(cpu, rs1))>>(readRegister(cpu, rs2)&0x1F))))
+		},
+	}),
+	// SRAW : Shift Right Arithmetic Word
+	{0b0111011, 0b101, 0b0100000, 0}: rv64Instruction(Instruction{
+		"SRAW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, uint64(int64(int32(readRegister(cpu, rs1))>>(readRegister(cpu, rs2)&0x1F))))
+		},
+	}),
+	// OP-32 (RV64M)
+	// MULW : Multiply Word
+	{0b0111011, 0b000, 0b0000001, 0}: rv64Instruction(Instruction{
+		"MULW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			writeRegister(cpu, rd, signExtendWord(readRegister(cpu, rs1)*readRegister(cpu, rs2)))
+		},
+	}),
+	// DIVW : Divide Word
+	{0b0111011, 0b100, 0b0000001, 0}: rv64Instruction(Instruction{
+		"DIVW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			dividend, divisor := int32(readRegister(cpu, rs1)), int32(readRegister(cpu, rs2))
+			if divisor == 0 {
+				writeRegister(cpu, rd, ^uint64(0)) // Division by zero gives -1
+			} else {
+				writeRegister(cpu, rd, uint64(int64(dividend/divisor))) // Overflow gives the dividend
+			}
+		},
+	}),
+	// DIVUW : Divide Unsigned Word
+	{0b0111011, 0b101, 0b0000001, 0}: rv64Instruction(Instruction{
+		"DIVUW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			dividend, divisor := uint32(readRegister(cpu, rs1)), uint32(readRegister(cpu, rs2))
+			if divisor == 0 {
+				writeRegister(cpu, rd, ^uint64(0)) // Division by zero gives 2^64-1
+			} else {
+				writeRegister(cpu, rd, signExtendWord(uint64(dividend/divisor)))
+			}
+		},
+	}),
+	// REMW : Remainder Word
+	{0b0111011, 0b110, 0b0000001, 0}: rv64Instruction(Instruction{
+		"REMW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			dividend, divisor := int32(readRegister(cpu, rs1)), int32(readRegister(cpu, rs2))
+			if divisor == 0 {
+				writeRegister(cpu, rd, uint64(int64(dividend))) // Remainder of a division by zero is the dividend
+			} else {
+				writeRegister(cpu, rd, uint64(int64(dividend%divisor))) // Overflow gives a remainder of 0
+			}
+		},
+	}),
+	// REMUW : Remainder Unsigned Word
+	{0b0111011, 0b111, 0b0000001, 0}: rv64Instruction(Instruction{
+		"REMUW",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			dividend, divisor := uint32(readRegister(cpu, rs1)), uint32(readRegister(cpu, rs2))
+			if divisor == 0 {
+				writeRegister(cpu, rd, signExtendWord(uint64(dividend))) // Remainder of a division by zero is the dividend
+			} else {
+				writeRegister(cpu, rd, signExtendWord(uint64(dividend%divisor)))
+			}
+		},
+	}),
+	// AMO (RV64A)
+	// LR.D : Load Reserved Doubleword
+	{0b0101111, 0b011, 0b00010, 0}: rv64Instruction(Instruction{
+		"LR.D",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			if rs2 != 0 {
+				raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction)) // Reserved encoding
+				return
+			}
+			address := effectiveAddress(cpu, rs1, 0)
+			physical, ok := checkAccess(cpu, memory, address, 8, accessLoad)
+			if !ok {
+				return
+			}
+			writeRegister(cpu, rd, readDoubleword(memory, physical))
+			reserveAddress(cpu, physical)
+		},
+	}),
+	// SC.D : Store Conditional Doubleword
+	{0b0101111, 0b011, 0b00011, 0}: rv64Instruction(Instruction{
+		"SC.D",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			rd, rs1, rs2 := args[0], args[1], args[2]
+			address := effectiveAddress(cpu, rs1, 0)
+			physical, ok := checkAccess(cpu, memory, address, 8, accessStore)
+			if !ok {
+				return
+			}
+			if cpu.reservationValid && cpu.reservation == physical {
+				writeDoubleword(cpu, memory, physical, readRegister(cpu, rs2))
+				writeRegister(cpu, rd, 0) // Success
+			} else {
+				writeRegister(cpu, rd, 1) // Failure
+			}
+			cpu.reservationValid = false
+		},
+	}),
+	// AMOSWAP.D : Atomic Swap Doubleword
+	{0b0101111, 0b011, 0b00001, 0}: rv64Instruction(Instruction{
+		"AMOSWAP.D",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperationDoubleword(cpu, memory, args[0], args[1], args[2], func(a, b uint64) uint64 { return b })
+		},
+	}),
+	// AMOADD.D : Atomic Add Doubleword
+	{0b0101111, 0b011, 0b00000, 0}: rv64Instruction(Instruction{
+		"AMOADD.D",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperationDoubleword(cpu, memory, args[0], args[1], args[2], func(a, b uint64) uint64 { return a + b })
+		},
+	}),
+	// AMOXOR.D : Atomic XOR Doubleword
+	{0b0101111, 0b011, 0b00100, 0}: rv64Instruction(Instruction{
+		"AMOXOR.D",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperationDoubleword(cpu, memory, args[0], args[1], args[2], func(a, b uint64) uint64 { return a ^ b })
+		},
+	}),
+	// AMOAND.D : Atomic AND Doubleword
+	{0b0101111, 0b011, 0b01100, 0}: rv64Instruction(Instruction{
+		"AMOAND.D",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperationDoubleword(cpu, memory, args[0], args[1], args[2], func(a, b uint64) uint64 { return a & b })
+		},
+	}),
+	// AMOOR.D : Atomic OR Doubleword
+	{0b0101111, 0b011, 0b01000, 0}: rv64Instruction(Instruction{
+		"AMOOR.D",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperationDoubleword(cpu, memory, args[0], args[1], args[2], func(a, b uint64) uint64 { return a | b })
+		},
+	}),
+	// AMOMIN.D : Atomic Minimum Doubleword
+	{0b0101111, 0b011, 0b10000, 0}: rv64Instruction(Instruction{
+		"AMOMIN.D",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperationDoubleword(cpu, memory, args[0], args[1], args[2], func(a, b uint64) uint64 {
+				if int64(a) < int64(b) {
+					return a
+				}
+				return b
+			})
+		},
+	}),
+	// AMOMAX.D : Atomic Maximum Doubleword
+	{0b0101111, 0b011, 0b10100, 0}: rv64Instruction(Instruction{
+		"AMOMAX.D",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperationDoubleword(cpu, memory, args[0], args[1], args[2], func(a, b uint64) uint64 {
+				if int64(a) > int64(b) {
+					return a
+				}
+				return b
+			})
+		},
+	}),
+	// AMOMINU.D : Atomic Minimum Unsigned Doubleword
+	{0b0101111, 0b011, 0b11000, 0}: rv64Instruction(Instruction{
+		"AMOMINU.D",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperationDoubleword(cpu, memory, args[0], args[1], args[2], func(a, b uint64) uint64 {
+				if a < b {
+					return a
+				}
+				return b
+			})
+		},
+	}),
+	// AMOMAXU.D : Atomic Maximum Unsigned Doubleword
+	{0b0101111, 0b011, 0b11100, 0}: rv64Instruction(Instruction{
+		"AMOMAXU.D",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			atomicMemoryOperationDoubleword(cpu, memory, args[0], args[1], args[2], func(a, b uint64) uint64 {
+				if a > b {
+					return a
+				}
+				return b
+			})
+		},
+	}),
+}
+
+// readDoubleword reads the little-endian doubleword at a byte address (8-byte aligned by the callers).
+func readDoubleword(memory *Memory, address uint32) uint64 {
+	low, high := memory.Load32(address), memory.Load32(address+4)
+	return uint64(high)<<32 | uint64(low)
+}
+
+// writeDoubleword writes the doubleword at a byte address as two words and drops the reservations they hold.
+func writeDoubleword(cpu *CPUState, memory *Memory, address uint32, value uint64) {
+	memory.Store32(address, uint32(value))
+	memory.Store32(address+4, uint32(value>>32))
+	invalidateReservation(cpu, address)
+	invalidateReservation(cpu, address+4)
+}
+
+// atomicMemoryOperationDoubleword is the doubleword version of atomicMemoryOperation.
+func atomicMemoryOperationDoubleword(cpu *CPUState, memory *Memory, rd uint32, rs1 uint32, rs2 uint32, op func(a, b uint64) uint64) {
+	address := effectiveAddress(cpu, rs1, 0)
+	physical, ok := checkAccess(cpu, memory, address, 8, accessStore)
+	if !ok {
+		return
+	}
+	value := readDoubleword(memory, physical)
+	writeDoubleword(cpu, memory, physical, op(value, readRegister(cpu, rs2)))
+	writeRegister(cpu, rd, value)
+}
+
+func init() {
+	for key, instruction := range RV64Instructions {
+		Instructions[key] = instruction
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRV64Instructions(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+	var trapVector uint64 = 0x80
+
+	opImm := func(funct3, rd, rs1, imm uint32) uint32 { return assembleI(0b0010011, rd, funct3, rs1, imm) }
+	opImm32 := func(funct3, rd, rs1, imm uint32) uint32 { return assembleI(0b0011011, rd, funct3, rs1, imm) }
+	op := func(funct7, funct3, rd, rs1, rs2 uint32) uint32 {
+		return assembleR(0b0110011, rd, funct3, rs1, rs2, funct7)
+	}
+	op32 := func(funct7, funct3, rd, rs1, rs2 uint32) uint32 {
+		return assembleR(0b0111011, rd, funct3, rs1, rs2, funct7)
+	}
+
+	tests := []struct {
+		name         string
+		xlen         uint32
+		instruction  uint32
+		defaultRegs  map[uint32]uint64
+		defaultMem   map[uint32]uint32 // byte address -> word
+		expectedRegs map[uint32]uint64
+		expectedMem  map[uint32]uint32
+		expectedTrap bool
+	}{
+		// RV64I
+		{
+			name:         "ADDI carries into the upper word",
+			xlen:         64,
+			instruction:  opImm(0b000, 3, 1, 1), // ADDI x3, x1, 1
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFF},
+			expectedRegs: map[uint32]uint64{3: 0x100000000},
+		},
+		{
+			name:         "ADDIW sign-extends the 32-bit sum",
+			xlen:         64,
+			instruction:  opImm32(0b000, 3, 1, 1), // ADDIW x3, x1, 1
+			defaultRegs:  map[uint32]uint64{1: 0x7FFFFFFF},
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFF80000000},
+		},
+		{
+			name:         "SLLI with a 6-bit shift amount",
+			xlen:         64,
+			instruction:  opImm(0b001, 3, 1, 40), // SLLI x3, x1, 40
+			defaultRegs:  map[uint32]uint64{1: 0x3},
+			expectedRegs: map[uint32]uint64{3: 0x30000000000},
+		},
+		{
+			name:         "SRAI by 63",
+			xlen:         64,
+			instruction:  opImm(0b101, 3, 1, 0x400|63), // SRAI x3, x1, 63
+			defaultRegs:  map[uint32]uint64{1: 0x8000000000000000},
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFFFFFFFFFF},
+		},
+		{
+			name:         "SRLI by 32",
+			xlen:         64,
+			instruction:  opImm(0b101, 3, 1, 32), // SRLI x3, x1, 32
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFF00000000},
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFF},
+		},
+		{
+			name:         "SLLIW with shamt[5] set is illegal",
+			xlen:         64,
+			instruction:  opImm32(0b001, 3, 1, 32), // SLLIW x3, x1, 32
+			expectedTrap: true,
+		},
+		{
+			name:         "SLL uses 6 bits of rs2",
+			xlen:         64,
+			instruction:  op(0, 0b001, 3, 1, 2), // SLL x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 1, 2: 0x7F},
+			expectedRegs: map[uint32]uint64{3: 0x8000000000000000},
+		},
+		{
+			name:         "SLT compares 64-bit signed values",
+			xlen:         64,
+			instruction:  op(0, 0b010, 3, 1, 2), // SLT x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFFFFFFFFFF, 2: 0x100000000},
+			expectedRegs: map[uint32]uint64{3: 1},
+		},
+		{
+			name:         "ADDW wraps to 32 bits",
+			xlen:         64,
+			instruction:  op32(0, 0b000, 3, 1, 2), // ADDW x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0x17FFFFFFF, 2: 1},
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFF80000000},
+		},
+		{
+			name:         "SUBW",
+			xlen:         64,
+			instruction:  op32(0b0100000, 0b000, 3, 1, 2), // SUBW x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0, 2: 1},
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFFFFFFFFFF},
+		},
+		{
+			name:         "SRLW shifts the low word",
+			xlen:         64,
+			instruction:  op32(0, 0b101, 3, 1, 2), // SRLW x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFF80000000, 2: 31},
+			expectedRegs: map[uint32]uint64{3: 1},
+		},
+		{
+			name:         "SRAW",
+			xlen:         64,
+			instruction:  op32(0b0100000, 0b101, 3, 1, 2), // SRAW x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0x80000000, 2: 4},
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFFF8000000},
+		},
+		{
+			name:         "LUI sign-extends",
+			xlen:         64,
+			instruction:  assembleU(0b0110111, 3, 0x80000), // LUI x3, 0x80000
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFF80000000},
+		},
+		{
+			name:         "LD",
+			xlen:         64,
+			instruction:  assembleI(0b0000011, 3, 0b011, 1, 8), // LD x3, 8(x1)
+			defaultRegs:  map[uint32]uint64{1: 0x20},
+			defaultMem:   map[uint32]uint32{0x28: 0x89ABCDEF, 0x2C: 0x01234567},
+			expectedRegs: map[uint32]uint64{3: 0x0123456789ABCDEF},
+		},
+		{
+			name:         "LWU zero-extends",
+			xlen:         64,
+			instruction:  assembleI(0b0000011, 3, 0b110, 1, 0), // LWU x3, 0(x1)
+			defaultRegs:  map[uint32]uint64{1: 0x20},
+			defaultMem:   map[uint32]uint32{0x20: 0x80000000},
+			expectedRegs: map[uint32]uint64{3: 0x80000000},
+		},
+		{
+			name:        "SD",
+			xlen:        64,
+			instruction: assembleS(0b0100011, 0b011, 1, 2, 0), // SD x2, 0(x1)
+			defaultRegs: map[uint32]uint64{1: 0x20, 2: 0x0123456789ABCDEF},
+			expectedMem: map[uint32]uint32{0x20: 0x89ABCDEF, 0x24: 0x01234567},
+		},
+		{
+			name:         "LD misaligned",
+			xlen:         64,
+			instruction:  assembleI(0b0000011, 3, 0b011, 1, 4), // LD x3, 4(x1)
+			defaultRegs:  map[uint32]uint64{1: 0x20},
+			expectedTrap: true,
+		},
+		// RV64M
+		{
+			name:         "MULW",
+			xlen:         64,
+			instruction:  op32(0b0000001, 0b000, 3, 1, 2), // MULW x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0x10000, 2: 0x8000},
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFF80000000},
+		},
+		{
+			name:         "MULH",
+			xlen:         64,
+			instruction:  op(0b0000001, 0b001, 3, 1, 2), // MULH x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFFFFFFFFFF, 2: 2},
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFFFFFFFFFF},
+		},
+		{
+			name:         "MULHU",
+			xlen:         64,
+			instruction:  op(0b0000001, 0b011, 3, 1, 2), // MULHU x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFFFFFFFFFF, 2: 2},
+			expectedRegs: map[uint32]uint64{3: 1},
+		},
+		{
+			name:         "MULHSU",
+			xlen:         64,
+			instruction:  op(0b0000001, 0b010, 3, 1, 2), // MULHSU x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFFFFFFFFFF, 2: 0xFFFFFFFFFFFFFFFF},
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFFFFFFFFFF},
+		},
+		{
+			name:         "DIV overflow",
+			xlen:         64,
+			instruction:  op(0b0000001, 0b100, 3, 1, 2), // DIV x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0x8000000000000000, 2: 0xFFFFFFFFFFFFFFFF},
+			expectedRegs: map[uint32]uint64{3: 0x8000000000000000},
+		},
+		{
+			name:         "DIVW overflow",
+			xlen:         64,
+			instruction:  op32(0b0000001, 0b100, 3, 1, 2), // DIVW x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0x80000000, 2: 0xFFFFFFFF},
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFF80000000},
+		},
+		{
+			name:         "DIVUW by zero",
+			xlen:         64,
+			instruction:  op32(0b0000001, 0b101, 3, 1, 2), // DIVUW x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 5, 2: 0x100000000},
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFFFFFFFFFF},
+		},
+		{
+			name:         "REMUW",
+			xlen:         64,
+			instruction:  op32(0b0000001, 0b111, 3, 1, 2), // REMUW x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFF, 2: 0x10},
+			expectedRegs: map[uint32]uint64{3: 0xF},
+		},
+		// RV64A
+		{
+			name:         "AMOADD.D",
+			xlen:         64,
+			instruction:  assembleR(0b0101111, 3, 0b011, 1, 2, 0b00000<<2), // AMOADD.D x3, x2, (x1)
+			defaultRegs:  map[uint32]uint64{1: 0x20, 2: 1},
+			defaultMem:   map[uint32]uint32{0x20: 0xFFFFFFFF, 0x24: 0},
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFF},
+			expectedMem:  map[uint32]uint32{0x20: 0, 0x24: 1},
+		},
+		// Zbb over 64 bits
+		{
+			name:         "CLZ",
+			xlen:         64,
+			instruction:  opImm(0b001, 3, 1, 0x600), // CLZ x3, x1
+			defaultRegs:  map[uint32]uint64{1: 0x100000000},
+			expectedRegs: map[uint32]uint64{3: 31},
+		},
+		{
+			name:         "REV8",
+			xlen:         64,
+			instruction:  opImm(0b101, 3, 1, 0x6B8), // REV8 x3, x1
+			defaultRegs:  map[uint32]uint64{1: 0x0123456789ABCDEF},
+			expectedRegs: map[uint32]uint64{3: 0xEFCDAB8967452301},
+		},
+		{
+			name:         "REV8 with the RV32 encoding is illegal",
+			xlen:         64,
+			instruction:  opImm(0b101, 3, 1, 0x698),
+			expectedTrap: true,
+		},
+		{
+			name:         "CLZW",
+			xlen:         64,
+			instruction:  opImm32(0b001, 3, 1, 0x600), // CLZW x3, x1
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFF00010000},
+			expectedRegs: map[uint32]uint64{3: 15},
+		},
+		{
+			name:         "CTZW of 0",
+			xlen:         64,
+			instruction:  opImm32(0b001, 3, 1, 0x601), // CTZW x3, x1
+			defaultRegs:  map[uint32]uint64{1: 0x100000000},
+			expectedRegs: map[uint32]uint64{3: 32},
+		},
+		{
+			name:         "CPOPW",
+			xlen:         64,
+			instruction:  opImm32(0b001, 3, 1, 0x602), // CPOPW x3, x1
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFF0000F0F0},
+			expectedRegs: map[uint32]uint64{3: 8},
+		},
+		{
+			name:         "ROLW sign-extends the rotated word",
+			xlen:         64,
+			instruction:  op32(0b0110000, 0b001, 3, 1, 2), // ROLW x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFF40000001, 2: 33},
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFF80000002},
+		},
+		{
+			name:         "RORW",
+			xlen:         64,
+			instruction:  op32(0b0110000, 0b101, 3, 1, 2), // RORW x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0x3, 2: 1},
+			expectedRegs: map[uint32]uint64{3: 0xFFFFFFFF80000001},
+		},
+		{
+			name:         "RORIW",
+			xlen:         64,
+			instruction:  opImm32(0b101, 3, 1, 0x600|8), // RORIW x3, x1, 8
+			defaultRegs:  map[uint32]uint64{1: 0x12345678},
+			expectedRegs: map[uint32]uint64{3: 0x78123456},
+		},
+		{
+			name:         "RORIW with shamt[5] set is illegal",
+			xlen:         64,
+			instruction:  opImm32(0b101, 3, 1, 0x600|32),
+			expectedTrap: true,
+		},
+		// Zba over 64 bits
+		{
+			name:         "ZEXT.W is ADD.UW with rs2 = x0",
+			xlen:         64,
+			instruction:  op32(0b0000100, 0b000, 3, 1, 0), // ADD.UW x3, x1, x0
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFF80000000},
+			expectedRegs: map[uint32]uint64{3: 0x80000000},
+		},
+		{
+			name:         "ADD.UW",
+			xlen:         64,
+			instruction:  op32(0b0000100, 0b000, 3, 1, 2), // ADD.UW x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFFFFFFFFFF, 2: 0x100000000},
+			expectedRegs: map[uint32]uint64{3: 0x1FFFFFFFF},
+		},
+		{
+			name:         "SH1ADD.UW",
+			xlen:         64,
+			instruction:  op32(0b0010000, 0b010, 3, 1, 2), // SH1ADD.UW x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFF80000000, 2: 1},
+			expectedRegs: map[uint32]uint64{3: 0x100000001},
+		},
+		{
+			name:         "SH2ADD.UW",
+			xlen:         64,
+			instruction:  op32(0b0010000, 0b100, 3, 1, 2), // SH2ADD.UW x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFF80000000, 2: 1},
+			expectedRegs: map[uint32]uint64{3: 0x200000001},
+		},
+		{
+			name:         "SH3ADD.UW",
+			xlen:         64,
+			instruction:  op32(0b0010000, 0b110, 3, 1, 2), // SH3ADD.UW x3, x1, x2
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFF80000000, 2: 1},
+			expectedRegs: map[uint32]uint64{3: 0x400000001},
+		},
+		{
+			name:         "SLLI.UW with a 6-bit shift amount",
+			xlen:         64,
+			instruction:  opImm32(0b001, 3, 1, 0x080|40), // SLLI.UW x3, x1, 40
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFF00000003},
+			expectedRegs: map[uint32]uint64{3: 0x30000000000},
+		},
+		// RV64 instructions do not exist in RV32
+		{
+			name:         "ADDIW in RV32",
+			xlen:         32,
+			instruction:  opImm32(0b000, 3, 1, 1),
+			expectedTrap: true,
+		},
+		{
+			name:         "ADD.UW in RV32",
+			xlen:         32,
+			instruction:  op32(0b0000100, 0b000, 3, 1, 2),
+			expectedTrap: true,
+		},
+		{
+			name:         "LD in RV32",
+			xlen:         32,
+			instruction:  assembleI(0b0000011, 3, 0b011, 1, 0),
+			defaultRegs:  map[uint32]uint64{1: 0x20},
+			expectedTrap: true,
+		},
+		{
+			name:         "SLLI with shamt[5] set in RV32",
+			xlen:         32,
+			instruction:  opImm(0b001, 3, 1, 32),
+			expectedTrap: true,
+		},
+		{
+			name:         "ADDI wraps in RV32",
+			xlen:         32,
+			instruction:  opImm(0b000, 3, 1, 1),
+			defaultRegs:  map[uint32]uint64{1: 0xFFFFFFFF},
+			expectedRegs: map[uint32]uint64{3: 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initMemory(&memory, 256, 0)
+			initCPUState(&cpu, 0, 0)
+			cpu.xlen = test.xlen
+			cpu.csr[csrMtvec] = trapVector
+
+			memory.Store32(0, test.instruction)
+			for address, value := range test.defaultMem {
+				memory.Store32(address, value)
+			}
+			for reg, value := range test.defaultRegs {
+				writeRegister(&cpu, reg, value)
+			}
+
+			executeInstruction(&cpu, &memory)
+
+			if test.expectedTrap {
+				if cpu.pc != trapVector {
+					t.Errorf("expected a trap, got pc=0x%x", cpu.pc)
+				}
+				return
+			}
+			if cpu.pc != 4 {
+				t.Errorf("expected pc=0x4, got pc=0x%x mcause=%d", cpu.pc, cpu.csr[csrMcause])
+			}
+			for reg, expected := range test.expectedRegs {
+				if value := readUnsignedRegister(&cpu, reg); value != expected {
+					t.Errorf("expected x%d=0x%x, got x%d=0x%x", reg, expected, reg, value)
+				}
+			}
+			for address, expected := range test.expectedMem {
+				if value := memory.Load32(address); value != expected {
+					t.Errorf("expected memory[0x%x]=0x%x, got 0x%x", address, expected, value)
+				}
+			}
+		})
+	}
+}
+
+func TestRV64ProgramCounterWraps(t *testing.T) {
+	var cpu CPUState
+
+	initCPUState(&cpu, 0, 0)
+	jumpTo(&cpu, 0x100000004)
+	if cpu.pc != 0x4 {
+		t.Errorf("expected pc to wrap to 0x4 in RV32, got pc=0x%x", cpu.pc)
+	}
+
+	cpu.xlen = 64
+	jumpTo(&cpu, 0x100000004)
+	if cpu.pc != 0x100000004 {
+		t.Errorf("expected pc=0x100000004 in RV64, got pc=0x%x", cpu.pc)
+	}
+}
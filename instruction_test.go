@@ -17,7 +17,7 @@ func TestInstructions(t *testing.T) {
 		args         []uint32
 		defaultRegs  map[uint32]uint32
 		defaultMem   map[uint32]uint32
-		expectedPC   uint32
+		expectedPC   uint64
 		expectedRegs map[uint32]uint32
 		expectedMem  map[uint32]uint32
 	}{
@@ -122,6 +122,147 @@ func TestInstructions(t *testing.T) {
 			expectedRegs: map[uint32]uint32{2: 0},
 			expectedMem:  map[uint32]uint32{},
 		},
+		// OP RV32M (MUL, DIV, ...)
+		{
+			name:         "MUL",
+			instruction:  Instructions[[4]uint32{0b0110011, 0b000, 0b0000001, 0}],
+			args:         []uint32{2, 1, 3}, // MUL x2, x1, x3 => x2 = x1 * x3
+			defaultRegs:  map[uint32]uint32{1: 6, 3: 7},
+			defaultMem:   map[uint32]uint32{},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 42},
+			expectedMem:  map[uint32]uint32{},
+		},
+		{
+			name:         "MULH",
+			instruction:  Instructions[[4]uint32{0b0110011, 0b001, 0b0000001, 0}],
+			args:         []uint32{2, 1, 3}, // MULH x2, x1, x3 => x2 = (-1 * -1) >> 32
+			defaultRegs:  map[uint32]uint32{1: 0xFFFFFFFF, 3: 0xFFFFFFFF},
+			defaultMem:   map[uint32]uint32{},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 0},
+			expectedMem:  map[uint32]uint32{},
+		},
+		{
+			name:         "MULHSU",
+			instruction:  Instructions[[4]uint32{0b0110011, 0b010, 0b0000001, 0}],
+			args:         []uint32{2, 1, 3}, // MULHSU x2, x1, x3 => x2 = (-1 * (2^32-1)) >> 32
+			defaultRegs:  map[uint32]uint32{1: 0xFFFFFFFF, 3: 0xFFFFFFFF},
+			defaultMem:   map[uint32]uint32{},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 0xFFFFFFFF},
+			expectedMem:  map[uint32]uint32{},
+		},
+		{
+			name:         "MULHU",
+			instruction:  Instructions[[4]uint32{0b0110011, 0b011, 0b0000001, 0}],
+			args:         []uint32{2, 1, 3}, // MULHU x2, x1, x3 => x2 = ((2^32-1) * (2^32-1)) >> 32
+			defaultRegs:  map[uint32]uint32{1: 0xFFFFFFFF, 3: 0xFFFFFFFF},
+			defaultMem:   map[uint32]uint32{},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 0xFFFFFFFE},
+			expectedMem:  map[uint32]uint32{},
+		},
+		{
+			name:         "DIV",
+			instruction:  Instructions[[4]uint32{0b0110011, 0b100, 0b0000001, 0}],
+			args:         []uint32{2, 1, 3}, // DIV x2, x1, x3 => x2 = -7 / 2 (rounded towards zero)
+			defaultRegs:  map[uint32]uint32{1: 0xFFFFFFF9, 3: 2},
+			defaultMem:   map[uint32]uint32{},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 0xFFFFFFFD},
+			expectedMem:  map[uint32]uint32{},
+		},
+		{
+			name:         "DIV by zero",
+			instruction:  Instructions[[4]uint32{0b0110011, 0b100, 0b0000001, 0}],
+			args:         []uint32{2, 1, 3}, // DIV x2, x1, x3 => x2 = -1 when x3 = 0
+			defaultRegs:  map[uint32]uint32{1: 7, 3: 0},
+			defaultMem:   map[uint32]uint32{},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 0xFFFFFFFF},
+			expectedMem:  map[uint32]uint32{},
+		},
+		{
+			name:         "DIV overflow",
+			instruction:  Instructions[[4]uint32{0b0110011, 0b100, 0b0000001, 0}],
+			args:         []uint32{2, 1, 3}, // DIV x2, x1, x3 => x2 = -2^31 when -2^31 / -1
+			defaultRegs:  map[uint32]uint32{1: 0x80000000, 3: 0xFFFFFFFF},
+			defaultMem:   map[uint32]uint32{},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 0x80000000},
+			expectedMem:  map[uint32]uint32{},
+		},
+		{
+			name:         "DIVU",
+			instruction:  Instructions[[4]uint32{0b0110011, 0b101, 0b0000001, 0}],
+			args:         []uint32{2, 1, 3}, // DIVU x2, x1, x3 => x2 = x1 / x3
+			defaultRegs:  map[uint32]uint32{1: 0xFFFFFFFE, 3: 2},
+			defaultMem:   map[uint32]uint32{},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 0x7FFFFFFF},
+			expectedMem:  map[uint32]uint32{},
+		},
+		{
+			name:         "DIVU by zero",
+			instruction:  Instructions[[4]uint32{0b0110011, 0b101, 0b0000001, 0}],
+			args:         []uint32{2, 1, 3}, // DIVU x2, x1, x3 => x2 = 2^32-1 when x3 = 0
+			defaultRegs:  map[uint32]uint32{1: 7, 3: 0},
+			defaultMem:   map[uint32]uint32{},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 0xFFFFFFFF},
+			expectedMem:  map[uint32]uint32{},
+		},
+		{
+			name:         "REM",
+			instruction:  Instructions[[4]uint32{0b0110011, 0b110, 0b0000001, 0}],
+			args:         []uint32{2, 1, 3}, // REM x2, x1, x3 => x2 = -7 % 2 (sign of the dividend)
+			defaultRegs:  map[uint32]uint32{1: 0xFFFFFFF9, 3: 2},
+			defaultMem:   map[uint32]uint32{},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 0xFFFFFFFF},
+			expectedMem:  map[uint32]uint32{},
+		},
+		{
+			name:         "REM by zero",
+			instruction:  Instructions[[4]uint32{0b0110011, 0b110, 0b0000001, 0}],
+			args:         []uint32{2, 1, 3}, // REM x2, x1, x3 => x2 = x1 when x3 = 0
+			defaultRegs:  map[uint32]uint32{1: 7, 3: 0},
+			defaultMem:   map[uint32]uint32{},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 7},
+			expectedMem:  map[uint32]uint32{},
+		},
+		{
+			name:         "REM overflow",
+			instruction:  Instructions[[4]uint32{0b0110011, 0b110, 0b0000001, 0}],
+			args:         []uint32{2, 1, 3}, // REM x2, x1, x3 => x2 = 0 when -2^31 % -1
+			defaultRegs:  map[uint32]uint32{1: 0x80000000, 3: 0xFFFFFFFF},
+			defaultMem:   map[uint32]uint32{},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 0},
+			expectedMem:  map[uint32]uint32{},
+		},
+		{
+			name:         "REMU",
+			instruction:  Instructions[[4]uint32{0b0110011, 0b111, 0b0000001, 0}],
+			args:         []uint32{2, 1, 3}, // REMU x2, x1, x3 => x2 = x1 % x3
+			defaultRegs:  map[uint32]uint32{1: 7, 3: 2},
+			defaultMem:   map[uint32]uint32{},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 1},
+			expectedMem:  map[uint32]uint32{},
+		},
+		{
+			name:         "REMU by zero",
+			instruction:  Instructions[[4]uint32{0b0110011, 0b111, 0b0000001, 0}],
+			args:         []uint32{2, 1, 3}, // REMU x2, x1, x3 => x2 = x1 when x3 = 0
+			defaultRegs:  map[uint32]uint32{1: 7, 3: 0},
+			defaultMem:   map[uint32]uint32{},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 7},
+			expectedMem:  map[uint32]uint32{},
+		},
 		// OP-IMM (ADDI, SLTI, ...)
 		{
 			name:         "ADDI",
@@ -219,81 +360,111 @@ func TestInstructions(t *testing.T) {
 			instruction:  Instructions[[4]uint32{0b0100011, 0b000, 0, 0}],
 			args:         []uint32{1, 2, 0}, // SB x2, 0(x1)
 			defaultRegs:  map[uint32]uint32{1: 4, 2: 0x12345678},
-			defaultMem:   map[uint32]uint32{1: 0xFFFFFFFF}, // Memory initialized with all bits set
+			defaultMem:   map[uint32]uint32{4: 0xFFFFFFFF}, // Memory initialized with all bits set
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{},
+			expectedMem:  map[uint32]uint32{4: 0xFFFFFF78}, // Only the low byte is stored
+		},
+		{
+			name:         "SB at an odd address",
+			instruction:  Instructions[[4]uint32{0b0100011, 0b000, 0, 0}],
+			args:         []uint32{1, 2, 3}, // SB x2, 3(x1)
+			defaultRegs:  map[uint32]uint32{1: 4, 2: 0x12345678},
+			defaultMem:   map[uint32]uint32{4: 0xFFFFFFFF},
 			expectedPC:   0,
 			expectedRegs: map[uint32]uint32{},
-			expectedMem:  map[uint32]uint32{1: 0xFFFFFF78}, // Only the last byte is stored
+			expectedMem:  map[uint32]uint32{4: 0x78FFFFFF}, // The byte goes to the most significant byte of the word
 		},
 		{
-			name:         "SH", // Store halfword, it
+			name:         "SH", // Store halfword, it will store 2 bytes in memory starting from the address x1 + 2
 			instruction:  Instructions[[4]uint32{0b0100011, 0b001, 0, 0}],
 			args:         []uint32{1, 2, 2},                      // SH x2, 2(x1)
 			defaultRegs:  map[uint32]uint32{1: 0, 2: 0x12345678}, // x1 = base address, x2 = value to store
-			defaultMem:   map[uint32]uint32{1: 0xFFFFFFFF},       // Memory initialized with all bits set
+			defaultMem:   map[uint32]uint32{0: 0xFFFFFFFF},       // Memory initialized with all bits set
 			expectedPC:   0,
 			expectedRegs: map[uint32]uint32{},
-			expectedMem:  map[uint32]uint32{0: 0x12345678}, // Only the last two bytes are stored
+			expectedMem:  map[uint32]uint32{0: 0x5678FFFF}, // Only the low halfword is stored, in the upper half of the word
 		},
 		{
 			name:         "SW", // Store Word, it will store 4 bytes in memory starting from the address x1 + 4
 			instruction:  Instructions[[4]uint32{0b0100011, 0b010, 0, 0}],
 			args:         []uint32{1, 2, 4},                      // SW x2, 4(x1)
 			defaultRegs:  map[uint32]uint32{1: 0, 2: 0x12345678}, // x1 = base address, x2 = value to store
-			defaultMem:   map[uint32]uint32{1: 0xFFFFFFFF},       // Memory initialized with all bits set
+			defaultMem:   map[uint32]uint32{4: 0xFFFFFFFF},       // Memory initialized with all bits set
 			expectedPC:   0,
 			expectedRegs: map[uint32]uint32{},
-			expectedMem:  map[uint32]uint32{1: 0x12345678}, // Value is stored at the base address
+			expectedMem:  map[uint32]uint32{4: 0x12345678}, // Value is stored at the base address + 4
 		},
 		// Load
 		{
-			name:         "LB",
+			name:         "LB", // Sign-extended
 			instruction:  Instructions[[4]uint32{0b0000011, 0b000, 0, 0}],
 			args:         []uint32{1, 2, 4}, // LB x1, 4(x2) => x1 = memory[x2+4]
 			defaultRegs:  map[uint32]uint32{2: 0},
-			defaultMem:   map[uint32]uint32{},
+			defaultMem:   map[uint32]uint32{4: 0x8081F2F3},
 			expectedPC:   0,
-			expectedRegs: map[uint32]uint32{1: 0},
-			expectedMem:  map[uint32]uint32{4: 0},
+			expectedRegs: map[uint32]uint32{1: 0xFFFFFFF3},
+			expectedMem:  map[uint32]uint32{4: 0x8081F2F3},
 		},
 		{
-			name:         "LH",
+			name:         "LB positive",
+			instruction:  Instructions[[4]uint32{0b0000011, 0b000, 0, 0}],
+			args:         []uint32{1, 2, 7}, // LB x1, 7(x2)
+			defaultRegs:  map[uint32]uint32{2: 0},
+			defaultMem:   map[uint32]uint32{4: 0x7081F2F3},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{1: 0x70},
+			expectedMem:  map[uint32]uint32{},
+		},
+		{
+			name:         "LH", // Sign-extended
 			instruction:  Instructions[[4]uint32{0b0000011, 0b001, 0, 0}],
 			args:         []uint32{1, 2, 4}, // LH x1, 4(x2) => x1 = memory[x2+4]
 			defaultRegs:  map[uint32]uint32{2: 0},
-			defaultMem:   map[uint32]uint32{},
+			defaultMem:   map[uint32]uint32{4: 0x8081F2F3},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{1: 0xFFFFF2F3},
+			expectedMem:  map[uint32]uint32{4: 0x8081F2F3},
+		},
+		{
+			name:         "LH upper half",
+			instruction:  Instructions[[4]uint32{0b0000011, 0b001, 0, 0}],
+			args:         []uint32{1, 2, 6}, // LH x1, 6(x2)
+			defaultRegs:  map[uint32]uint32{2: 0},
+			defaultMem:   map[uint32]uint32{4: 0x8081F2F3},
 			expectedPC:   0,
-			expectedRegs: map[uint32]uint32{1: 0},
-			expectedMem:  map[uint32]uint32{4: 0},
+			expectedRegs: map[uint32]uint32{1: 0xFFFF8081},
+			expectedMem:  map[uint32]uint32{},
 		},
 		{
 			name:         "LW",
 			instruction:  Instructions[[4]uint32{0b0000011, 0b010, 0, 0}],
 			args:         []uint32{1, 2, 4}, // LW x1, 4(x2) => x1 = memory[x2+4]
 			defaultRegs:  map[uint32]uint32{2: 0},
-			defaultMem:   map[uint32]uint32{},
+			defaultMem:   map[uint32]uint32{4: 0x8081F2F3},
 			expectedPC:   0,
-			expectedRegs: map[uint32]uint32{1: 0},
-			expectedMem:  map[uint32]uint32{4: 0},
+			expectedRegs: map[uint32]uint32{1: 0x8081F2F3},
+			expectedMem:  map[uint32]uint32{4: 0x8081F2F3},
 		},
 		{
-			name:         "LBU",
+			name:         "LBU", // Zero-extended
 			instruction:  Instructions[[4]uint32{0b0000011, 0b100, 0, 0}],
 			args:         []uint32{1, 2, 4}, // LBU x1, 4(x2) => x1 = memory[x2+4]
 			defaultRegs:  map[uint32]uint32{2: 0},
-			defaultMem:   map[uint32]uint32{},
+			defaultMem:   map[uint32]uint32{4: 0x8081F2F3},
 			expectedPC:   0,
-			expectedRegs: map[uint32]uint32{1: 0},
-			expectedMem:  map[uint32]uint32{4: 0},
+			expectedRegs: map[uint32]uint32{1: 0xF3},
+			expectedMem:  map[uint32]uint32{4: 0x8081F2F3},
 		},
 		{
-			name:         "LHU",
+			name:         "LHU", // Zero-extended
 			instruction:  Instructions[[4]uint32{0b0000011, 0b101, 0, 0}],
-			args:         []uint32{1, 2, 4}, // LHU x1, 4(x2) => x1 = memory[x2+4]
+			args:         []uint32{1, 2, 6}, // LHU x1, 6(x2) => x1 = memory[x2+6]
 			defaultRegs:  map[uint32]uint32{2: 0},
-			defaultMem:   map[uint32]uint32{},
+			defaultMem:   map[uint32]uint32{4: 0x8081F2F3},
 			expectedPC:   0,
-			expectedRegs: map[uint32]uint32{1: 0},
-			expectedMem:  map[uint32]uint32{4: 0},
+			expectedRegs: map[uint32]uint32{1: 0x8081},
+			expectedMem:  map[uint32]uint32{4: 0x8081F2F3},
 		},
 		// Branch
 		{
@@ -356,6 +527,117 @@ func TestInstructions(t *testing.T) {
 			expectedRegs: map[uint32]uint32{},
 			expectedMem:  map[uint32]uint32{},
 		},
+		// AMO (LR.W, SC.W, AMOADD.W, ...)
+		{
+			name:         "LR.W",
+			instruction:  Instructions[[4]uint32{0b0101111, 0b010, 0b00010, 0}],
+			args:         []uint32{2, 1, 0}, // LR.W x2, (x1) => x2 = memory[x1]
+			defaultRegs:  map[uint32]uint32{1: 0},
+			defaultMem:   map[uint32]uint32{0: 42},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 42},
+			expectedMem:  map[uint32]uint32{0: 42},
+		},
+		{
+			name:         "SC.W without reservation",
+			instruction:  Instructions[[4]uint32{0b0101111, 0b010, 0b00011, 0}],
+			args:         []uint32{2, 1, 3}, // SC.W x2, x3, (x1) => fails, x2 = 1
+			defaultRegs:  map[uint32]uint32{1: 0, 3: 7},
+			defaultMem:   map[uint32]uint32{0: 42},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 1},
+			expectedMem:  map[uint32]uint32{0: 42},
+		},
+		{
+			name:         "AMOSWAP.W",
+			instruction:  Instructions[[4]uint32{0b0101111, 0b010, 0b00001, 0}],
+			args:         []uint32{2, 1, 3}, // AMOSWAP.W x2, x3, (x1) => x2 = memory[x1]; memory[x1] = x3
+			defaultRegs:  map[uint32]uint32{1: 0, 3: 7},
+			defaultMem:   map[uint32]uint32{0: 42},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 42},
+			expectedMem:  map[uint32]uint32{0: 7},
+		},
+		{
+			name:         "AMOADD.W",
+			instruction:  Instructions[[4]uint32{0b0101111, 0b010, 0b00000, 0}],
+			args:         []uint32{2, 1, 3}, // AMOADD.W x2, x3, (x1) => memory[x1] += x3
+			defaultRegs:  map[uint32]uint32{1: 0, 3: 3},
+			defaultMem:   map[uint32]uint32{0: 5},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 5},
+			expectedMem:  map[uint32]uint32{0: 8},
+		},
+		{
+			name:         "AMOXOR.W",
+			instruction:  Instructions[[4]uint32{0b0101111, 0b010, 0b00100, 0}],
+			args:         []uint32{2, 1, 3}, // AMOXOR.W x2, x3, (x1) => memory[x1] ^= x3
+			defaultRegs:  map[uint32]uint32{1: 0, 3: 3},
+			defaultMem:   map[uint32]uint32{0: 5},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 5},
+			expectedMem:  map[uint32]uint32{0: 6},
+		},
+		{
+			name:         "AMOAND.W",
+			instruction:  Instructions[[4]uint32{0b0101111, 0b010, 0b01100, 0}],
+			args:         []uint32{2, 1, 3}, // AMOAND.W x2, x3, (x1) => memory[x1] &= x3
+			defaultRegs:  map[uint32]uint32{1: 0, 3: 3},
+			defaultMem:   map[uint32]uint32{0: 5},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 5},
+			expectedMem:  map[uint32]uint32{0: 1},
+		},
+		{
+			name:         "AMOOR.W",
+			instruction:  Instructions[[4]uint32{0b0101111, 0b010, 0b01000, 0}],
+			args:         []uint32{2, 1, 3}, // AMOOR.W x2, x3, (x1) => memory[x1] |= x3
+			defaultRegs:  map[uint32]uint32{1: 0, 3: 3},
+			defaultMem:   map[uint32]uint32{0: 5},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 5},
+			expectedMem:  map[uint32]uint32{0: 7},
+		},
+		{
+			name:         "AMOMIN.W",
+			instruction:  Instructions[[4]uint32{0b0101111, 0b010, 0b10000, 0}],
+			args:         []uint32{2, 1, 3}, // AMOMIN.W x2, x3, (x1) => memory[x1] = min(5, -1)
+			defaultRegs:  map[uint32]uint32{1: 0, 3: 0xFFFFFFFF},
+			defaultMem:   map[uint32]uint32{0: 5},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 5},
+			expectedMem:  map[uint32]uint32{0: 0xFFFFFFFF},
+		},
+		{
+			name:         "AMOMAX.W",
+			instruction:  Instructions[[4]uint32{0b0101111, 0b010, 0b10100, 0}],
+			args:         []uint32{2, 1, 3}, // AMOMAX.W x2, x3, (x1) => memory[x1] = max(5, -1)
+			defaultRegs:  map[uint32]uint32{1: 0, 3: 0xFFFFFFFF},
+			defaultMem:   map[uint32]uint32{0: 5},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 5},
+			expectedMem:  map[uint32]uint32{0: 5},
+		},
+		{
+			name:         "AMOMINU.W",
+			instruction:  Instructions[[4]uint32{0b0101111, 0b010, 0b11000, 0}],
+			args:         []uint32{2, 1, 3}, // AMOMINU.W x2, x3, (x1) => memory[x1] = minu(5, 2^32-1)
+			defaultRegs:  map[uint32]uint32{1: 0, 3: 0xFFFFFFFF},
+			defaultMem:   map[uint32]uint32{0: 5},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 5},
+			expectedMem:  map[uint32]uint32{0: 5},
+		},
+		{
+			name:         "AMOMAXU.W",
+			instruction:  Instructions[[4]uint32{0b0101111, 0b010, 0b11100, 0}],
+			args:         []uint32{2, 1, 3}, // AMOMAXU.W x2, x3, (x1) => memory[x1] = maxu(5, 2^32-1)
+			defaultRegs:  map[uint32]uint32{1: 0, 3: 0xFFFFFFFF},
+			defaultMem:   map[uint32]uint32{0: 5},
+			expectedPC:   0,
+			expectedRegs: map[uint32]uint32{2: 5},
+			expectedMem:  map[uint32]uint32{0: 0xFFFFFFFF},
+		},
 		// LUI
 		{
 			name:         "LUI",
@@ -429,7 +711,7 @@ func TestInstructions(t *testing.T) {
 			initCPUState(&cpu, startAddress, registerDefault)
 
 			for reg, value := range test.defaultRegs {
-				writeRegister(&cpu, reg, value)
+				writeRegister(&cpu, reg, uint64(value))
 			}
 
 			for addr, value := range test.defaultMem {
@@ -437,7 +719,7 @@ func TestInstructions(t *testing.T) {
 					t.Errorf("memory address %d out of bounds", addr)
 					continue
 				}
-				writeMemory(&memory, addr, value)
+				memory.Store32(addr, value)
 			}
 
 			test.instruction.Exec(&cpu, &memory, test.args...)
@@ -447,7 +729,7 @@ func TestInstructions(t *testing.T) {
 			}
 
 			for reg, expected := range test.expectedRegs {
-				if cpu.x[reg] != expected {
+				if uint32(cpu.x[reg]) != expected {
 					t.Errorf("expected x%d=%d, got x%d=%d", reg, expected, reg, cpu.x[reg])
 				}
 			}
@@ -457,10 +739,70 @@ func TestInstructions(t *testing.T) {
 					t.Errorf("memory address %d out of bounds", addr)
 					continue
 				}
-				if readMemory(&memory, addr) != expected {
-					t.Errorf("expected memory[%d]=%d, got memory[%d]=%d", addr, expected, addr, readMemory(&memory, addr))
+				if memory.Load32(addr) != expected {
+					t.Errorf("expected memory[%d]=0x%x, got memory[%d]=0x%x", addr, expected, addr, memory.Load32(addr))
 				}
 			}
 		})
 	}
 }
+
+func TestLoadReservedStoreConditional(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+	lr := Instructions[[4]uint32{0b0101111, 0b010, 0b00010, 0}]
+	sc := Instructions[[4]uint32{0b0101111, 0b010, 0b00011, 0}]
+	sw := Instructions[[4]uint32{0b0100011, 0b010, 0, 0}]
+
+	tests := []struct {
+		name          string
+		storeBetween  bool
+		storeAddress  uint32
+		expectedRd    uint32
+		expectedValue uint32
+	}{
+		{"SC succeeds after LR", false, 0, 0, 7},
+		{"SC fails after a store to the reserved word", true, 8, 1, 3},
+		{"SC succeeds after a store to another word", true, 12, 0, 7},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initMemory(&memory, 256, 0)
+			initCPUState(&cpu, 0, 0)
+			writeRegister(&cpu, 1, 8) // x1 = reserved address
+			writeRegister(&cpu, 3, 7) // x3 = value stored by SC
+			writeRegister(&cpu, 4, 3) // x4 = value stored by SW
+
+			lr.Exec(&cpu, &memory, 2, 1, 0) // LR.W x2, (x1)
+			if test.storeBetween {
+				writeRegister(&cpu, 5, uint64(test.storeAddress))
+				sw.Exec(&cpu, &memory, 5, 4, 0) // SW x4, 0(x5)
+			}
+			sc.Exec(&cpu, &memory, 2, 1, 3) // SC.W x2, x3, (x1)
+
+			if uint32(cpu.x[2]) != test.expectedRd {
+				t.Errorf("expected x2=%d, got x2=%d", test.expectedRd, cpu.x[2])
+			}
+			if value := memory.Load32(8); value != test.expectedValue {
+				t.Errorf("expected memory[8]=%d, got memory[8]=%d", test.expectedValue, value)
+			}
+			if cpu.reservationValid {
+				t.Errorf("expected the reservation to be cleared by SC")
+			}
+		})
+	}
+
+	// LR with rs2 != 0 is a reserved encoding
+	initMemory(&memory, 256, 0)
+	initCPUState(&cpu, 0, 0)
+	writeRegister(&cpu, 1, 8)
+	memory.Store32(8, 5)
+	lr.Exec(&cpu, &memory, 2, 1, 3) // LR.W x2, (x1) with rs2 = x3
+	if !cpu.trapped || cpu.csr[csrMcause] != causeIllegalInstruction {
+		t.Errorf("expected an illegal instruction for LR.W with rs2 = x3, got trapped=%v mcause=%d", cpu.trapped, cpu.csr[csrMcause])
+	}
+	if cpu.x[2] != 0 || cpu.reservationValid {
+		t.Errorf("expected LR.W with rs2 = x3 to neither load nor reserve, got x2=%d reservation=%v", cpu.x[2], cpu.reservationValid)
+	}
+}
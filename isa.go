@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Base ISA of the emulated hart, selected at launch with --isa.
+var (
+	xlen       uint32 = 32                    // Width of the integer registers
+	embedded          = false                 // RV32E: only x0-x15 exist
+	extensions        = supportedExtensions() // Enabled extensions, all of them unless --isa selects a subset
+)
+
+// Extensions that an ISA string can enable besides the base, in canonical order. S and U, the privilege modes,
+// are always present.
+var extensionNames = []string{"m", "a", "f", "d", "c", "v", "zicsr", "zifencei", "zicntr", "zba", "zbb", "zbs", "zbkb",
+	"zbkx", "zknh", "zkne", "zknd"}
+
+// Single-letter extensions that stand for several extensions
+var extensionShorthands = map[string][]string{
+	"g": {"m", "a", "f", "d", "zicsr", "zifencei"},
+	"b": {"zba", "zbb", "zbs"},
+}
+
+// ISA is the base integer ISA and the extensions described by an ISA string.
+type ISA struct {
+	xlen       uint32
+	embedded   bool
+	extensions map[string]bool
+}
+
+// supportedExtensions returns the set of all the extensions the emulator implements.
+func supportedExtensions() map[string]bool {
+	all := map[string]bool{}
+	for _, name := range extensionNames {
+		all[name] = true
+	}
+	return all
+}
+
+// parseISA reads an ISA string such as "rv32imac_zicsr_zifencei", "rv32ec" or "rv64gc_zba_zbb": the base, then
+// single-letter extensions, then multi-letter extensions separated by underscores.
+func parseISA(isa string) (ISA, error) {
+	isa = strings.ToLower(isa)
+	base := ISA{extensions: map[string]bool{}}
+	switch {
+	case strings.HasPrefix(isa, "rv32"):
+		base.xlen = 32
+	case strings.HasPrefix(isa, "rv64"):
+		base.xlen = 64
+	default:
+		return ISA{}, fmt.Errorf("unsupported ISA string '%s', expected rv32... or rv64...", isa)
+	}
+
+	switch {
+	case strings.HasPrefix(isa[4:], "i"):
+	case strings.HasPrefix(isa[4:], "g"):
+		for _, name := range extensionShorthands["g"] {
+			base.extensions[name] = true
+		}
+	case strings.HasPrefix(isa[4:], "e") && base.xlen == 32:
+		base.embedded = true
+	default:
+		return ISA{}, fmt.Errorf("unsupported ISA string '%s', the base must be i, g or e (rv32 only)", isa)
+	}
+
+	// The first multi-letter extension can directly follow the single letters
+	letters, multiLetter, separated := strings.Cut(isa[5:], "_")
+	if index := strings.IndexAny(letters, "zsx"); index >= 0 {
+		if separated {
+			multiLetter = letters[index:] + "_" + multiLetter
+		} else {
+			multiLetter = letters[index:]
+		}
+		letters, separated = letters[:index], true
+	}
+	names := strings.Split(letters, "")
+	if separated {
+		names = append(names, strings.Split(multiLetter, "_")...) // An empty name is rejected below
+	}
+	for _, name := range names {
+		if shorthand, found := extensionShorthands[name]; found && name != "g" {
+			for _, extension := range shorthand {
+				base.extensions[extension] = true
+			}
+		} else if slices.Contains(extensionNames, name) && (len(name) == 1 || name[0] == 'z') {
+			base.extensions[name] = true
+		} else {
+			return ISA{}, fmt.Errorf("unsupported extension '%s' in ISA string '%s'", name, isa)
+		}
+	}
+	if base.extensions["d"] && !base.extensions["f"] {
+		return ISA{}, fmt.Errorf("unsupported ISA string '%s', d requires f", isa)
+	}
+	if base.extensions["zicntr"] && !base.extensions["zicsr"] {
+		return ISA{}, fmt.Errorf("unsupported ISA string '%s', zicntr requires zicsr", isa)
+	}
+	return base, nil
+}
+
+// Extensions of the instructions that are not identified by their opcode and funct fields alone. An instruction
+// is enabled when one of its extensions is.
+var instructionExtensionsByName = map[string][]string{
+	"SH1ADD": {"zba"}, "SH2ADD": {"zba"}, "SH3ADD": {"zba"},
+	"ADD.UW": {"zba"}, "SH1ADD.UW": {"zba"}, "SH2ADD.UW": {"zba"}, "SH3ADD.UW": {"zba"}, "SLLI.UW": {"zba"},
+	"CLZ": {"zbb"}, "CTZ": {"zbb"}, "CPOP": {"zbb"}, "SEXT.B": {"zbb"}, "SEXT.H": {"zbb"},
+	"CLZW": {"zbb"}, "CTZW": {"zbb"}, "CPOPW": {"zbb"},
+	"MAX": {"zbb"}, "MAXU": {"zbb"}, "MIN": {"zbb"}, "MINU": {"zbb"}, "ORC.B": {"zbb"},
+	"ANDN": {"zbb", "zbkb"}, "ORN": {"zbb", "zbkb"}, "XNOR": {"zbb", "zbkb"}, "REV8": {"zbb", "zbkb"},
+	"ROL": {"zbb", "zbkb"}, "ROR": {"zbb", "zbkb"}, "RORI": {"zbb", "zbkb"},
+	"ROLW": {"zbb", "zbkb"}, "RORW": {"zbb", "zbkb"}, "RORIW": {"zbb", "zbkb"},
+	"BCLR": {"zbs"}, "BCLRI": {"zbs"}, "BEXT": {"zbs"}, "BEXTI": {"zbs"},
+	"BINV": {"zbs"}, "BINVI": {"zbs"}, "BSET": {"zbs"}, "BSETI": {"zbs"},
+	"PACK": {"zbkb"}, "PACKH": {"zbkb"}, "PACKW": {"zbkb"}, "BREV8": {"zbkb"}, "ZIP": {"zbkb"}, "UNZIP": {"zbkb"},
+	"XPERM4": {"zbkx"}, "XPERM8": {"zbkx"},
+	"SHA256SUM0": {"zknh"}, "SHA256SUM1": {"zknh"}, "SHA256SIG0": {"zknh"}, "SHA256SIG1": {"zknh"},
+	"AES32ESI": {"zkne"}, "AES32ESMI": {"zkne"}, "AES32DSI": {"zknd"}, "AES32DSMI": {"zknd"},
+}
+
+// instructionExtensions returns the extensions providing the instruction found under key, nil for the base ISA.
+// ZEXT.H is PACK with rs2 = x0 on RV32 and PACKW with rs2 = x0 on RV64.
+func instructionExtensions(key [4]uint32, name string, instruction uint32, xlen uint32) []string {
+	funct3, funct7 := key[1], key[2]
+	if names, found := instructionExtensionsByName[name]; found {
+		zextH := xlen == 32 && name == "PACK" || xlen == 64 && name == "PACKW"
+		if zextH && (instruction>>20)&0x1F == 0 {
+			return []string{"zbb", "zbkb"}
+		}
+		return names
+	}
+
+	switch key[0] {
+	case 0b0101111: // AMO
+		return []string{"a"}
+	case 0b0110011, 0b0111011: // OP, OP-32
+		if funct7 == 0b0000001 {
+			return []string{"m"}
+		}
+	case 0b0001111: // MISC-MEM
+		if funct3 == 0b001 {
+			return []string{"zifencei"}
+		}
+	case 0b1110011: // SYSTEM
+		if funct3 != 0 {
+			return []string{"zicsr"}
+		}
+	case 0b1010111: // OP-V
+		return []string{"v"}
+	case 0b0000111, 0b0100111: // LOAD-FP, STORE-FP
+		if isVectorWidth(funct3) {
+			return []string{"v"}
+		} else if funct3 == 0b011 {
+			return []string{"d"}
+		}
+		return []string{"f"}
+	case 0b1010011: // OP-FP
+		if funct7&0b11 == 1 || funct7>>2 == 0b01000 { // Double operands, or a conversion between S and D
+			return []string{"d"}
+		}
+		return []string{"f"}
+	case 0b1000011, 0b1000111, 0b1001011, 0b1001111: // MADD, MSUB, NMSUB, NMADD
+		if funct7 == 1 {
+			return []string{"d"}
+		}
+		return []string{"f"}
+	}
+	return nil
+}
+
+// isInstructionEnabled reports whether the extension of an instruction is enabled by the ISA.
+func isInstructionEnabled(cpu *CPUState, key [4]uint32, name string, instruction uint32) bool {
+	names := instructionExtensions(key, name, instruction, cpu.xlen)
+	if names == nil {
+		return true
+	}
+	for _, name := range names {
+		if cpu.extensions[name] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseISA(t *testing.T) {
+	set := func(names ...string) map[string]bool {
+		extensions := map[string]bool{}
+		for _, name := range names {
+			extensions[name] = true
+		}
+		return extensions
+	}
+
+	tests := []struct {
+		isa        string
+		expected   ISA
+		shouldFail bool
+	}{
+		{"rv32imac", ISA{32, false, set("m", "a", "c")}, false},
+		{"RV64GC", ISA{64, false, set("m", "a", "f", "d", "c", "zicsr", "zifencei")}, false},
+		{"rv64i", ISA{64, false, set()}, false},
+		{"rv32e", ISA{32, true, set()}, false},
+		{"rv32emc", ISA{32, true, set("m", "c")}, false},
+		{"rv32imac_zicsr_zifencei", ISA{32, false, set("m", "a", "c", "zicsr", "zifencei")}, false},
+		{"rv32imzicsr_zifencei", ISA{32, false, set("m", "zicsr", "zifencei")}, false},
+		{"rv32imac_zicsr_zicntr", ISA{32, false, set("m", "a", "c", "zicsr", "zicntr")}, false},
+		{"rv32i_zicntr", ISA{}, true},
+		{"rv32ib", ISA{32, false, set("zba", "zbb", "zbs")}, false},
+		{"rv64gcv_zbkb_zbkx_zknh_zkne_zknd", ISA{64, false, set("m", "a", "f", "d", "c", "v", "zicsr", "zifencei",
+			"zbkb", "zbkx", "zknh", "zkne", "zknd")}, false},
+		{"rv32id", ISA{}, true},
+		{"rv32iq", ISA{}, true},
+		{"rv32i_zfoo", ISA{}, true},
+		{"rv32i_", ISA{}, true},
+		{"rv64e", ISA{}, true},
+		{"rv32x", ISA{}, true},
+		{"rv128i", ISA{}, true},
+		{"x86", ISA{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.isa, func(t *testing.T) {
+			isa, err := parseISA(test.isa)
+
+			if test.shouldFail {
+				if err == nil {
+					t.Errorf("expected failure for '%s', but got %+v", test.isa, isa)
+				}
+			} else if err != nil {
+				t.Errorf("expected success for '%s', but got error: %v", test.isa, err)
+			} else if isa.xlen != test.expected.xlen || isa.embedded != test.expected.embedded ||
+				!maps.Equal(isa.extensions, test.expected.extensions) {
+				t.Errorf("expected %+v, got %+v", test.expected, isa)
+			}
+		})
+	}
+}
+
+func TestEmbeddedRegisters(t *testing.T) {
+	tests := []struct {
+		name         string
+		instruction  uint32
+		expectedTrap bool
+	}{
+		{"add x15, x14, x13", 0x00D707B3, false},
+		{"add x16, x14, x13", 0x00D70833, true},
+		{"add x15, x16, x13", 0x00D807B3, true},
+		{"sw x16, 0(x2)", 0x01012023, true},
+		{"beq x1, x17, 0", 0x01108063, true},
+		{"lui x31, 1", 0x00001FB7, true},
+		{"c.mv x15, x14", 0x87BA, false},
+		{"c.mv x16, x14", 0x883A, true},
+		{"csrrwi x1, mscratch, 31", 0x340FD0F3, false},
+		{"csrrw x1, mscratch, x31", 0x340F90F3, true},
+		{"fadd.s f16, f17, f18", 0x01288853, false},
+		{"fmv.x.w x16, f1", 0xE0008853, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cpu CPUState
+			var memory Memory
+
+			embedded = true
+			defer func() { embedded = false }()
+			initMemory(&memory, 256, 0)
+			initCPUState(&cpu, 0, 0)
+			cpu.csr[csrMtvec] = 0x20
+			cpu.csr[csrMstatus] |= 1 << 13 // FS = Initial
+			memory.Store32(0, test.instruction)
+
+			executeInstruction(&cpu, &memory)
+
+			if cpu.trapped != test.expectedTrap {
+				t.Errorf("expected trap %v, got %v", test.expectedTrap, cpu.trapped)
+			}
+			if test.expectedTrap && cpu.csr[csrMcause] != causeIllegalInstruction {
+				t.Errorf("expected illegal instruction cause, got %d", cpu.csr[csrMcause])
+			}
+		})
+	}
+}
+
+func TestMisaEmbedded(t *testing.T) {
+	var cpu CPUState
+
+	embedded = true
+	defer func() { embedded = false }()
+	initCPUState(&cpu, 0, 0)
+
+	misa := misaValue(&cpu)
+	if misa&(1<<('E'-'A')) == 0 || misa&(1<<('I'-'A')) != 0 {
+		t.Errorf("expected misa to report E instead of I, got %08x", misa)
+	}
+}
+
+func TestISAExtensions(t *testing.T) {
+	tests := []struct {
+		isa          string
+		name         string
+		instruction  uint32
+		expectedTrap bool
+	}{
+		{"rv32i", "add x3, x1, x2", 0x002081B3, false},
+		{"rv32i", "mul x3, x1, x2", 0x022081B3, true},
+		{"rv32im", "mul x3, x1, x2", 0x022081B3, false},
+		{"rv32i", "amoadd.w x3, x2, (x0)", 0x002021AF, true},
+		{"rv32ia", "amoadd.w x3, x2, (x0)", 0x002021AF, false},
+		{"rv32i", "csrrs x3, mscratch, x0", 0x340021F3, true},
+		{"rv32i_zicsr", "csrrs x3, mscratch, x0", 0x340021F3, false},
+		{"rv32i_zicsr", "rdcycle x3", 0xC00021F3, true},
+		{"rv32i_zicsr", "rdtimeh x3", 0xC81021F3, true},
+		{"rv32i_zicsr_zicntr", "rdcycle x3", 0xC00021F3, false},
+		{"rv32i_zicsr", "csrrs x3, mcycle, x0", 0xB00021F3, false},
+		{"rv32i", "fence.i", 0x0000100F, true},
+		{"rv32i_zifencei", "fence.i", 0x0000100F, false},
+		{"rv32i", "c.li x10, 0", 0x4501, true},
+		{"rv32ic", "c.li x10, 0", 0x4501, false},
+		{"rv32if_zicsr", "fadd.s f1, f2, f3", 0x003100D3, false},
+		{"rv32if_zicsr", "fadd.d f1, f2, f3", 0x023100D3, true},
+		{"rv32ifd_zicsr", "fcvt.s.d f1, f2", 0x401100D3, false},
+		{"rv32if_zicsr", "fcvt.s.d f1, f2", 0x401100D3, true},
+		{"rv32i", "vsetvli x3, x1, e32", 0x0100F1D7, true},
+		{"rv32iv", "vsetvli x3, x1, e32", 0x0100F1D7, false},
+		{"rv32i_zbb", "zext.h x3, x1", 0x0800C1B3, false},
+		{"rv32i_zbb", "pack x3, x1, x2", 0x0820C1B3, true},
+		{"rv32i_zbkb", "pack x3, x1, x2", 0x0820C1B3, false},
+		{"rv64i_zbb", "zext.h x3, x1", 0x0800C1BB, false},
+		{"rv64i_zbb", "pack x3, x1, x0", 0x0800C1B3, true},
+		{"rv64i_zbkb", "pack x3, x1, x0", 0x0800C1B3, false},
+		{"rv64i_zbb", "packw x3, x1, x2", 0x0820C1BB, true},
+		{"rv64i_zba", "zext.w x3, x1", 0x080081BB, false},
+		{"rv64i_zbb", "zext.w x3, x1", 0x080081BB, true},
+		{"rv64i_zbb", "clzw x3, x1", 0x6000919B, false},
+		{"rv32i_zbkb", "rol x3, x1, x2", 0x602091B3, false},
+		{"rv32i_zba", "rol x3, x1, x2", 0x602091B3, true},
+		{"rv32i_zknh", "sha256sig0 x3, x1", 0x10209193, false},
+		{"rv32i_zkne", "aes32dsi x3, x1, x2", 0x2A2081B3, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.isa+" "+test.name, func(t *testing.T) {
+			var cpu CPUState
+			var memory Memory
+
+			isa, err := parseISA(test.isa)
+			if err != nil {
+				t.Fatal(err)
+			}
+			xlen, extensions = isa.xlen, isa.extensions
+			defer func() { xlen, extensions = 32, supportedExtensions() }()
+			initMemory(&memory, 256, 0)
+			initCPUState(&cpu, 0, 0)
+			cpu.csr[csrMtvec] = 0x20
+			memory.Store32(0, test.instruction)
+
+			executeInstruction(&cpu, &memory)
+
+			if cpu.trapped != test.expectedTrap {
+				t.Errorf("expected trap %v, got %v (mcause=%d)", test.expectedTrap, cpu.trapped, cpu.csr[csrMcause])
+			}
+			if test.expectedTrap && cpu.csr[csrMcause] != causeIllegalInstruction {
+				t.Errorf("expected illegal instruction cause, got %d", cpu.csr[csrMcause])
+			}
+		})
+	}
+}
+
+func TestMisaExtensions(t *testing.T) {
+	tests := []struct {
+		isa      string
+		expected string
+	}{
+		{"rv32i", "ISU"},
+		{"rv32imac_zicsr", "ACIMSU"},
+		{"rv64gcv", "ACDFIMSUV"},
+		{"rv32i_zba_zbb", "ISU"},
+		{"rv32ib", "BISU"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.isa, func(t *testing.T) {
+			var cpu CPUState
+
+			isa, err := parseISA(test.isa)
+			if err != nil {
+				t.Fatal(err)
+			}
+			xlen, extensions = isa.xlen, isa.extensions
+			defer func() { xlen, extensions = 32, supportedExtensions() }()
+			initCPUState(&cpu, 0, 0)
+
+			letters := ""
+			misa := misaValue(&cpu)
+			for letter := 'A'; letter <= 'Z'; letter++ {
+				if misa&(1<<(letter-'A')) != 0 {
+					letters += string(letter)
+				}
+			}
+			if letters != test.expected {
+				t.Errorf("expected misa extensions %s, got %s", test.expected, letters)
+			}
+		})
+	}
+}
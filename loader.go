@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Initial value of sp (x2) and gp (x3) after a reset, set by the --sp and --gp options
+var initialRegisters = map[uint32]uint32{}
+
+// Image is a raw binary file loaded at a physical address before the hart starts, or an ELF program.
+type Image struct {
+	filename string
+	address  uint32
+	explicit bool // Set when the address was given as file@address, which an ELF program does not accept
+}
+
+// parseAddress parses a 32-bit address, in hexadecimal with the 0x prefix or in decimal.
+func parseAddress(text string) (uint32, error) {
+	address, err := strconv.ParseUint(text, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", text)
+	}
+	return uint32(address), nil
+}
+
+// parseImage parses an image given as file@address, a file without an address is loaded at defaultAddress.
+func parseImage(text string, defaultAddress uint32) (Image, error) {
+	separator := strings.LastIndex(text, "@")
+	if separator < 0 {
+		return Image{text, defaultAddress, false}, nil
+	}
+	address, err := parseAddress(text[separator+1:])
+	if err != nil {
+		return Image{}, err
+	}
+	if separator == 0 {
+		return Image{}, fmt.Errorf("missing file name in %q", text)
+	}
+	return Image{text[:separator], address, true}, nil
+}
+
+// loadImage copies the content of an image file into memory and returns the address where it starts. A raw binary
+// is copied at the address of the image, all of its bytes must be writable RAM. An ELF program is loaded by
+// loadELF, its segments give the addresses and it starts at its entry point: it cannot be given an address.
+func loadImage(memory *Memory, image Image) (uint32, error) {
+	if isELF(image.filename) {
+		if image.explicit {
+			return 0, fmt.Errorf("%s is an ELF program, its segments give the load addresses: remove @0x%08x", image.filename, image.address)
+		}
+		return loadELF(memory, image.filename)
+	}
+	data, err := os.ReadFile(image.filename)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) > 0 && !isPhysicalAccessValid(memory, uint64(image.address), uint32(len(data)), accessStore) {
+		return 0, fmt.Errorf("%s (%d bytes) does not fit in memory at 0x%08x", image.filename, len(data), image.address)
+	}
+	for i, value := range data {
+		memory.Store8(image.address+uint32(i), value)
+	}
+	return image.address, nil
+}
+
+// resetCPU resets the hart to start at entry, then applies the initial values of sp and gp.
+func resetCPU(cpu *CPUState, entry uint32, registerDefault uint32) {
+	initCPUState(cpu, entry, registerDefault)
+	for register, value := range initialRegisters {
+		writeRegister(cpu, register, uint64(value))
+	}
+}
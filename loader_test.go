@@ -0,0 +1,95 @@
+package main
+
+import (
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseImage(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		expected      Image
+		expectedError bool
+	}{
+		{"Default address", "program.bin", Image{"program.bin", 0x1000, false}, false},
+		{"Hexadecimal address", "program.bin@0x80000000", Image{"program.bin", 0x80000000, true}, false},
+		{"Decimal address", "data.bin@4096", Image{"data.bin", 4096, true}, false},
+		{"Explicit default address", "program.elf@0x1000", Image{"program.elf", 0x1000, true}, false},
+		{"Last @ separates the address", "dir@home/data.bin@0x20", Image{"dir@home/data.bin", 0x20, true}, false},
+		{"Invalid address", "program.bin@0xZZ", Image{}, true},
+		{"Address too large", "program.bin@0x100000000", Image{}, true},
+		{"Missing file name", "@0x80000000", Image{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			image, err := parseImage(test.text, 0x1000)
+			if (err != nil) != test.expectedError {
+				t.Fatalf("expected error=%v, got %v", test.expectedError, err)
+			}
+			if image != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, image)
+			}
+		})
+	}
+}
+
+func TestLoadImages(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+	directory := t.TempDir()
+
+	// LW a0, 0(gp) ; ADDI a1, sp, -4 at 0x80000000, and the data read by LW at 0x80100000
+	program := filepath.Join(directory, "program.bin")
+	data := filepath.Join(directory, "data.bin")
+	os.WriteFile(program, []byte{0x03, 0xA5, 0x01, 0x00, 0x93, 0x05, 0xC1, 0xFF}, 0o644)
+	os.WriteFile(data, []byte{0x78, 0x56, 0x34, 0x12}, 0o644)
+
+	initPagedMemory(&memory, 1024*1024, 0)
+	for _, image := range []Image{{data, 0x80100000, true}, {program, 0x80000000, true}} {
+		if _, err := loadImage(&memory, image); err != nil {
+			t.Fatalf("unexpected error loading %s: %v", image.filename, err)
+		}
+	}
+	if _, err := loadImage(&memory, Image{filepath.Join(directory, "missing.bin"), 0, false}); err == nil {
+		t.Errorf("expected an error loading a missing file")
+	}
+
+	initialRegisters = map[uint32]uint32{2: 0x80200000, 3: 0x80100000}
+	defer func() { initialRegisters = map[uint32]uint32{} }()
+	resetCPU(&cpu, 0x80000000, 0)
+	executeInstruction(&cpu, &memory)
+	executeInstruction(&cpu, &memory)
+
+	if cpu.pc != 0x80000008 {
+		t.Errorf("expected pc=0x80000008, got pc=0x%x mcause=%d", cpu.pc, cpu.csr[csrMcause])
+	}
+	if cpu.x[10] != 0x12345678 || uint32(cpu.x[11]) != 0x801FFFFC {
+		t.Errorf("expected a0=0x12345678 and a1=0x801ffffc, got a0=0x%x a1=0x%x", cpu.x[10], cpu.x[11])
+	}
+
+	// An image larger than the RAM limit is refused
+	initPagedMemory(&memory, pageSize, 0)
+	if _, err := loadImage(&memory, Image{program, 0x80000FFC, true}); err == nil {
+		t.Errorf("expected an error loading an image over the RAM limit")
+	}
+
+	// An ELF program takes its addresses from its segments, file@address is refused
+	elfProgram := filepath.Join(directory, "program.elf")
+	writeTestELF(t, elfProgram, elf.EM_RISCV, 0x80000000, []testSegment{{0x80000000, 0x80000000, []byte{0x13, 0, 0, 0}, 4}}, nil, "\x00")
+	initPagedMemory(&memory, pageSize, 0)
+	for _, text := range []string{elfProgram + "@0x80000000", elfProgram + "@0x0"} {
+		image, _ := parseImage(text, 0)
+		if _, err := loadImage(&memory, image); err == nil {
+			t.Errorf("expected an error loading %s", text)
+		}
+	}
+	defer func() { symbols = nil }()
+	image, _ := parseImage(elfProgram, 0x1000)
+	if entry, err := loadImage(&memory, image); err != nil || entry != 0x80000000 {
+		t.Errorf("expected the ELF program to start at 0x80000000, got 0x%x (%v)", entry, err)
+	}
+}
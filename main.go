@@ -1,21 +1,38 @@
 package main
 
 import (
-	"encoding/binary"
 	"fmt"
 	"os"
 )
 
 func printHelp() {
-	fmt.Println("Utilisation: sae-emulateur [OPTIONS] FICHIER_BIN")
+	fmt.Println("Utilisation: sae-emulateur [OPTIONS] FICHIER_BIN[@ADRESSE]")
 	fmt.Println("")
 	fmt.Println("Arguments:")
-	fmt.Println("  FICHIER_BIN Un fichier au format binaire contenant les instructions à décoder")
+	fmt.Println("  FICHIER_BIN Un fichier au format binaire contenant les instructions à décoder, chargé à ADRESSE")
+	fmt.Println("              si elle est donnée, sinon à l'adresse de chargement")
+	fmt.Println("              Un programme ELF32 est chargé aux adresses physiques de ses segments et démarre à son")
+	fmt.Println("              point d'entrée, ses symboles sont affichés sous la forme fonction+décalage. @ADRESSE et")
+	fmt.Println("              --base ne s'appliquent pas à un programme ELF")
 	fmt.Println("")
 	fmt.Println("Options:")
 	fmt.Println("  -h \t\t\t Affiche ce message d'aide")
-	fmt.Println("  -m <uint32> \t Définir la taille de la mémoire en octets (par défaut 512 Ko)")
+	fmt.Println("  -m <uint32> \t Définir la taille maximale de la RAM allouée en octets (par défaut 512 Ko)")
+	fmt.Println("              \t La RAM couvre tout l'espace d'adressage, ses pages sont allouées à la première écriture")
+	fmt.Println("              \t Exécuter une page jamais écrite lève une faute d'accès, sans gestionnaire de trap (mtvec = 0)")
+	fmt.Println("              \t le programme s'arrête alors, ECALL sans gestionnaire termine le programme avec le code a0")
 	fmt.Println("  -d <uint32> \t Définir la valeur par défaut de la mémoire (par défaut 0)")
+	fmt.Println("  --isa <isa> \t Choisir l'ISA émulée et ses extensions, par exemple rv32imac_zicsr_zifencei, rv32ec ou rv64gc")
+	fmt.Println("              \t cycle, time et instret demandent zicntr, qui n'est pas compris dans g")
+	fmt.Println("              \t (par défaut rv32i avec toutes les extensions supportées)")
+	fmt.Println("  -t <uint64> \t Définir la fréquence de l'horloge virtuelle du compteur time en Hz (par défaut 10 MHz)")
+	fmt.Println("  --base <adresse> \t Définir l'adresse de chargement de FICHIER_BIN (par défaut 0), par exemple 0x80000000")
+	fmt.Println("  --entry <adresse> \t Définir le PC de départ (par défaut l'adresse de chargement ou le point d'entrée de FICHIER_BIN)")
+	fmt.Println("  --sp <adresse> \t Définir la valeur initiale du pointeur de pile (x2)")
+	fmt.Println("  --gp <adresse> \t Définir la valeur initiale du pointeur global (x3)")
+	fmt.Println("  --load <fichier@adresse> Charger un fichier binaire supplémentaire à une adresse, peut être répété")
+	fmt.Println("              \t Un programme ELF est donné sans @adresse, ses segments donnent les adresses")
+	fmt.Println("  --vlen <bits> \t Définir la taille des registres vectoriels, une puissance de 2 entre 64 et 4096 (par défaut 128)")
 }
 
 func main() {
@@ -45,6 +62,9 @@ func main() {
 	var cpu CPUState
 	var memory Memory
 	var startAddress uint32 = 0
+	var loadAddress uint32 = 0
+	var entrySet = false
+	var imageOptions []string
 
 	// extract options
 	for i, arg := range os.Args {
@@ -62,6 +82,63 @@ func main() {
 			}
 		}
 
+		if arg == "--isa" {
+			if i+1 < len(os.Args) {
+				base, err := parseISA(os.Args[i+1])
+				if err != nil {
+					fmt.Println(err)
+					printHelp()
+					os.Exit(1)
+				}
+				xlen, embedded, extensions = base.xlen, base.embedded, base.extensions
+			}
+		}
+
+		if arg == "-t" {
+			if i+1 < len(os.Args) {
+				if _, err := fmt.Sscanf(os.Args[i+1], "%d", &timeFrequency); err != nil || timeFrequency == 0 {
+					printHelp()
+					os.Exit(1)
+				}
+			}
+		}
+
+		if arg == "--vlen" {
+			if i+1 < len(os.Args) {
+				if _, err := fmt.Sscanf(os.Args[i+1], "%d", &vlen); err != nil || vlen < 64 || vlen > 4096 || vlen&(vlen-1) != 0 {
+					printHelp()
+					os.Exit(1)
+				}
+			}
+		}
+
+		if arg == "--base" || arg == "--entry" || arg == "--sp" || arg == "--gp" {
+			if i+1 < len(os.Args) {
+				address, err := parseAddress(os.Args[i+1])
+				if err != nil {
+					fmt.Println(err)
+					printHelp()
+					os.Exit(1)
+				}
+				switch arg {
+				case "--base":
+					loadAddress = address
+				case "--entry":
+					startAddress, entrySet = address, true
+				case "--sp":
+					initialRegisters[2] = address
+				case "--gp":
+					initialRegisters[3] = address
+				}
+			}
+		}
+
+		if arg == "--load" {
+			if i+1 < len(os.Args) {
+				imageOptions = append(imageOptions, os.Args[i+1])
+			}
+		}
+
 		if arg == "-d" {
 			if i+1 < len(os.Args) {
 				if _, err := fmt.Sscanf(os.Args[i+1], "%d", &registerDefault); err != nil {
@@ -72,64 +149,73 @@ func main() {
 		}
 	}
 
-	// extract filename from last argument and open file
-	filename := os.Args[len(os.Args)-1]
-	file, err := os.Open(filename)
-	if err != nil {
-		fmt.Printf("Error opening file: %v\n", err)
-		os.Exit(1)
+	// extract the images to load, the last argument is the program, it starts at its load address by default
+	var images []Image
+	for _, option := range append(imageOptions, os.Args[len(os.Args)-1]) {
+		image, err := parseImage(option, loadAddress)
+		if err != nil {
+			fmt.Println(err)
+			printHelp()
+			os.Exit(1)
+		}
+		images = append(images, image)
 	}
 
-	// init memory and cpu state
-	initMemory(&memory, memorySize, 0)
-	initCPUState(&cpu, startAddress, registerDefault)
+	// init memory and devices
+	initPagedMemory(&memory, uint64(memorySize), 0)
+	if err := attachCLINT(&memory, newCLINT(&cpu)); err != nil {
+		fmt.Printf("Error mapping devices: %v\n", err)
+		os.Exit(1)
+	}
+	if err := attachPLIC(&memory, newPLIC()); err != nil {
+		fmt.Printf("Error mapping devices: %v\n", err)
+		os.Exit(1)
+	}
 
-	// read binary file and load instructions into memory
-	offset := startAddress / 4
-	for {
-		var instruction uint32
-		err = binary.Read(file, binary.LittleEndian, &instruction)
+	// read the binary and ELF files and load them into memory, then reset the cpu at the start of the program
+	for _, image := range images {
+		start, err := loadImage(&memory, image)
 		if err != nil {
-			if err.Error() == "EOF" {
-				break
-			}
-			fmt.Printf("Error reading file: %v\n", err)
+			fmt.Printf("Error loading file: %v\n", err)
 			os.Exit(1)
 		}
-
-		if offset < uint32(len(memory.data)) {
-			writeMemory(&memory, offset, instruction)
-			offset++
-		} else {
-			fmt.Printf("Binary file too large for memory, actual size: %d, requested size: %d\n", len(memory.data), offset)
-			os.Exit(1)
+		if !entrySet {
+			startAddress = start
 		}
 	}
+	resetCPU(&cpu, startAddress, registerDefault)
 
 	// loop through memory and decode instructions
 	for {
-		// check if pc is out of memory bounds
-		if cpu.pc/4 >= lenMemory(&memory) {
-			fmt.Println("PC out of memory bounds.")
-			os.Exit(1)
-		}
-
 		// handle step mode
 		if stepMode {
 			handleStepMode(&cpu, &memory, startAddress, registerDefault)
 		}
 
-		// decode instruction
-		instruction := readMemory(&memory, cpu.pc/4)
-		opcode, err := GetOpcodeFromInstruction(instruction)
+		// take pending interrupts, then decode and execute instruction and move to the next one
+		handleInterrupts(&cpu, &memory)
+		pc := cpu.pc
+		rtnString, err := executeInstruction(&cpu, &memory)
+
+		// without a trap handler the program would restart from address 0, stop it instead, unless a breakpoint
+		// just dropped into the step by step debugger
+		if message, status, ok := unhandledTrap(&cpu); ok {
+			fmt.Println(message)
+			if !stepMode {
+				os.Exit(status)
+			}
+		}
 
 		if err == nil {
-			rtnString := opcode.Encoding.Decode(opcode, instruction, &cpu, &memory)
-			logDebug("DISAS", "%s", rtnString)
+			logDebug("DISAS", "%s: %s", formatAddress(pc), rtnString)
 		} else {
 			//logDebug("DISAS", "%08x: %s\n", cpu.pc, err.Error())
-		}
 
-		cpu.pc += 4
+			// the trap handler cannot itself be fetched or decoded, the guest will never make progress
+			if cpu.pc == pc {
+				fmt.Printf("Trap handler at %s cannot be executed: %v\n", formatAddress(pc), err)
+				os.Exit(1)
+			}
+		}
 	}
 }
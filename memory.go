@@ -1,50 +1,245 @@
 package main
 
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Device is the common interface of everything mapped on the bus. offset is relative to the base of the region,
+// size is 1, 2 or 4 bytes and the access never crosses the end of the region. Multi-byte values are little-endian.
+type Device interface {
+	Read(offset uint32, size uint32) uint32
+	Write(offset uint32, size uint32, value uint32)
+}
+
+// pagedDevice is implemented by the devices that allocate their storage on demand. Accepts reports, without
+// allocating anything, whether the device can perform an access of size bytes at offset.
+type pagedDevice interface {
+	Accepts(offset uint32, size uint64, access int) bool
+}
+
+// Region maps a device in the physical address space, readOnly regions (ROM) refuse the stores of the hart. A
+// fallback region only answers the addresses that no other region maps, so devices can be mapped over it.
+type Region struct {
+	name     string
+	base     uint32
+	size     uint64
+	device   Device
+	readOnly bool
+	fallback bool
+}
+
+// Memory is the system bus of the hart: the physical address map made of RAM, ROM and device regions. Accesses
+// outside of every region are access faults (see isPhysicalAccessValid).
 type Memory struct {
-	data []uint32
+	regions []Region
+	clint   *CLINT // Sampled by handleInterrupts when attached
+	plic    *PLIC  // Sampled by handleInterrupts when attached
 }
 
-func initMemory(memory *Memory, size uint32, defaultValue uint32) {
-	memory.data = make([]uint32, size)
-	for i := 0; i < len(memory.data); i++ {
-		memory.data[i] = defaultValue
+// RAM is a byte-addressable memory device.
+type RAM struct {
+	data []byte
+}
+
+// newRAM returns size bytes of RAM, every aligned word holding defaultValue.
+func newRAM(size uint32, defaultValue uint32) *RAM {
+	ram := &RAM{data: make([]byte, size)}
+	for i := uint32(0); i+4 <= size; i += 4 {
+		binary.LittleEndian.PutUint32(ram.data[i:], defaultValue)
+	}
+	return ram
+}
+
+func (ram *RAM) Read(offset uint32, size uint32) uint32 {
+	value := uint32(0)
+	for i := uint32(0); i < size; i++ {
+		value |= uint32(ram.data[offset+i]) << (8 * i)
+	}
+	return value
+}
+
+func (ram *RAM) Write(offset uint32, size uint32, value uint32) {
+	for i := uint32(0); i < size; i++ {
+		ram.data[offset+i] = byte(value >> (8 * i))
+	}
+}
+
+// PagedRAM is a RAM allocated one page at a time when it is first written, so that it can cover the whole address
+// space. Pages never written read as defaultValue but cannot be fetched: a program running past its code into
+// them raises an instruction access fault. Once limit bytes of pages are allocated, stores to new pages are refused.
+type PagedRAM struct {
+	pages        map[uint32]*[pageSize]byte // By page number
+	limit        uint64
+	defaultValue uint32
+}
+
+func newPagedRAM(limit uint64, defaultValue uint32) *PagedRAM {
+	return &PagedRAM{pages: map[uint32]*[pageSize]byte{}, limit: limit, defaultValue: defaultValue}
+}
+
+// page returns the page holding offset, allocated and filled with defaultValue on the first write.
+func (ram *PagedRAM) page(offset uint32) *[pageSize]byte {
+	page, ok := ram.pages[offset>>pageShift]
+	if !ok {
+		page = new([pageSize]byte)
+		for i := 0; i < pageSize; i += 4 {
+			binary.LittleEndian.PutUint32(page[i:], ram.defaultValue)
+		}
+		ram.pages[offset>>pageShift] = page
+	}
+	return page
+}
+
+// Accepts reports whether the size bytes at offset can be accessed: instructions are only fetched from pages
+// already written, and the new pages of a store must fit in the limit. Loads are always accepted.
+func (ram *PagedRAM) Accepts(offset uint32, size uint64, access int) bool {
+	if size == 0 {
+		return true
 	}
+	missing := 0
+	for number := uint64(offset) >> pageShift; number <= (uint64(offset)+size-1)>>pageShift; number++ {
+		if _, ok := ram.pages[uint32(number)]; !ok {
+			missing++
+		}
+	}
+	switch access {
+	case accessFetch:
+		return missing == 0
+	case accessStore:
+		return uint64(len(ram.pages)+missing)*pageSize <= ram.limit
+	}
+	return true
+}
+
+func (ram *PagedRAM) Read(offset uint32, size uint32) uint32 {
+	value := uint32(0)
+	for i := uint32(0); i < size; i++ {
+		address := offset + i
+		if page, ok := ram.pages[address>>pageShift]; ok {
+			value |= uint32(page[address%pageSize]) << (8 * i)
+		} else {
+			value |= (ram.defaultValue >> (8 * (address % 4)) & 0xFF) << (8 * i)
+		}
+	}
+	return value
+}
+
+func (ram *PagedRAM) Write(offset uint32, size uint32, value uint32) {
+	for i := uint32(0); i < size; i++ {
+		address := offset + i
+		ram.page(address)[address%pageSize] = byte(value >> (8 * i))
+	}
+}
+
+// initMemory empties the address map and maps size bytes of RAM at address 0, every aligned word holding
+// defaultValue.
+func initMemory(memory *Memory, size uint32, defaultValue uint32) {
+	*memory = Memory{}
+	memory.Map(Region{name: "ram", base: 0, size: uint64(size), device: newRAM(size, defaultValue)})
 	logDebug("INIT", "Memory initialized with default value %d\n", defaultValue)
 }
 
-func readMemory(memory *Memory, address uint32) uint32 {
-	if address < uint32(len(memory.data)) {
-		return memory.data[address]
+// initPagedMemory empties the address map and maps a PagedRAM over the whole 32-bit address space, the devices
+// attached afterwards take precedence over it. At most limit bytes of RAM are allocated, and only the written pages
+// can be executed, so a program escaping its code stops on an instruction access fault.
+func initPagedMemory(memory *Memory, limit uint64, defaultValue uint32) {
+	*memory = Memory{}
+	memory.Map(Region{name: "ram", base: 0, size: 1 << 32, device: newPagedRAM(limit, defaultValue), fallback: true})
+	logDebug("INIT", "Memory initialized with default value %d, up to %d bytes of RAM\n", defaultValue, limit)
+}
+
+// mapROM maps a read-only copy of image at base.
+func mapROM(memory *Memory, base uint32, image []byte) error {
+	rom := &RAM{data: append([]byte(nil), image...)}
+	return memory.Map(Region{name: "rom", base: base, size: uint64(len(image)), device: rom, readOnly: true})
+}
+
+// Map adds a region to the address map, it must not overlap the regions already mapped.
+func (memory *Memory) Map(region Region) error {
+	end := uint64(region.base) + region.size
+	if region.size == 0 || end > 1<<32 {
+		return fmt.Errorf("region %s at 0x%08x does not fit in the address space", region.name, region.base)
 	}
-	return 0
+	for _, other := range memory.regions {
+		if region.fallback || other.fallback {
+			continue
+		}
+		if uint64(region.base) < uint64(other.base)+other.size && uint64(other.base) < end {
+			return fmt.Errorf("region %s at 0x%08x overlaps region %s at 0x%08x", region.name, region.base, other.name, other.base)
+		}
+	}
+	memory.regions = append(memory.regions, region)
+	return nil
 }
 
-func writeMemory(memory *Memory, address uint32, value uint32) {
-	wordIndex := address / 4 // Convert byte address to word index
-	if wordIndex < uint32(len(memory.data)) {
-		memory.data[wordIndex] = value
+// region returns the region holding the size bytes at a physical address, or nil when they are not all mapped by
+// the same region. The fallback regions are only used when no byte of the access belongs to another region.
+func (memory *Memory) region(address uint64, size uint64) *Region {
+	var fallback *Region
+	for i := range memory.regions {
+		region := &memory.regions[i]
+		start, end := uint64(region.base), uint64(region.base)+region.size
+		switch {
+		case region.fallback:
+			if fallback == nil && address >= start && address+size <= end {
+				fallback = region
+			}
+		case address >= start && address+size <= end:
+			return region
+		case address < end && start < address+size:
+			return nil // The access straddles the boundary of a region
+		}
 	}
+	return fallback
+}
+
+// load reads size bytes at a physical address, unmapped bytes read as 0. The access is checked beforehand by
+// checkAccess, which raises the access fault.
+func (memory *Memory) load(address uint32, size uint32) uint32 {
+	region := memory.region(uint64(address), uint64(size))
+	if region == nil {
+		return 0
+	}
+	return region.device.Read(address-region.base, size)
+}
+
+// store writes the low size bytes of value at a physical address, unmapped stores are ignored. Read-only regions
+// are refused by checkAccess: the bus itself writes them, so that images can be loaded into ROM.
+func (memory *Memory) store(address uint32, size uint32, value uint32) {
+	region := memory.region(uint64(address), uint64(size))
+	if region == nil {
+		return
+	}
+	region.device.Write(address-region.base, size, value&uint32(1<<(8*size)-1))
+}
+
+// Load8 reads the byte at address.
+func (memory *Memory) Load8(address uint32) uint8 {
+	return uint8(memory.load(address, 1))
+}
+
+// Load16 reads the little-endian halfword at address.
+func (memory *Memory) Load16(address uint32) uint16 {
+	return uint16(memory.load(address, 2))
 }
 
-func writeByte(memory *Memory, address uint32, value uint32) {
-	wordIndex := address / 4                                                                   // Find the 32-bit word index
-	byteOffset := (address % 4) * 8                                                            // Calculate the byte's position (0, 8, 16, or 24 bits)
-	mask := uint32(0xFF << byteOffset)                                                         // Create a mask to isolate the byte
-	memory.data[wordIndex] = (memory.data[wordIndex] & ^mask) | ((value & 0xFF) << byteOffset) // Clear the byte and write the new value
+// Load32 reads the little-endian word at address.
+func (memory *Memory) Load32(address uint32) uint32 {
+	return memory.load(address, 4)
 }
 
-func writeHalfword(memory *Memory, address uint32, value uint32) {
-	wordIndex := address / 4                                                                         // Find the 32-bit word index
-	halfwordOffset := (address % 4) * 16                                                             // Calculate the halfword's position (0 or 16 bits)
-	mask := uint32(0xFFFF << halfwordOffset)                                                         // Create a mask to isolate the halfword
-	memory.data[wordIndex] = (memory.data[wordIndex] & ^mask) | ((value & 0xFFFF) << halfwordOffset) // Clear the halfword and write the new value
+// Store8 writes a byte at address.
+func (memory *Memory) Store8(address uint32, value uint8) {
+	memory.store(address, 1, uint32(value))
 }
 
-func writeWord(memory *Memory, address uint32, value uint32) {
-	wordIndex := address / 4       // Find the 32-bit word index
-	memory.data[wordIndex] = value // Write the value to memory
+// Store16 writes a little-endian halfword at address.
+func (memory *Memory) Store16(address uint32, value uint16) {
+	memory.store(address, 2, uint32(value))
 }
 
-func lenMemory(memory *Memory) uint32 {
-	return uint32(len(memory.data))
+// Store32 writes a little-endian word at address.
+func (memory *Memory) Store32(address uint32, value uint32) {
+	memory.store(address, 4, value)
 }
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMemoryLoadStore(t *testing.T) {
+	var memory Memory
+
+	initMemory(&memory, 16, 0xAABBCCDD)
+	if value := memory.Load8(1); value != 0xCC {
+		t.Errorf("expected the default word to be stored in little-endian order, got byte 1 = 0x%x", value)
+	}
+
+	memory.Store32(4, 0x12345678)
+	memory.Store16(8, 0xBEEF)
+	memory.Store8(11, 0x7F)
+
+	tests := []struct {
+		name     string
+		load     func(address uint32) uint32
+		address  uint32
+		expected uint32
+	}{
+		{"Load8 low byte", func(a uint32) uint32 { return uint32(memory.Load8(a)) }, 4, 0x78},
+		{"Load8 high byte", func(a uint32) uint32 { return uint32(memory.Load8(a)) }, 7, 0x12},
+		{"Load16 aligned", func(a uint32) uint32 { return uint32(memory.Load16(a)) }, 4, 0x5678},
+		{"Load16 upper half", func(a uint32) uint32 { return uint32(memory.Load16(a)) }, 6, 0x1234},
+		{"Load16 across words", func(a uint32) uint32 { return uint32(memory.Load16(a)) }, 7, 0xEF12},
+		{"Load32", memory.Load32, 4, 0x12345678},
+		{"Load32 after sized stores", memory.Load32, 8, 0x7FBBBEEF},
+		{"Load32 unaligned", memory.Load32, 6, 0xBEEF1234},
+		{"Load32 past the end", memory.Load32, 14, 0},
+		{"Load8 past the end", func(a uint32) uint32 { return uint32(memory.Load8(a)) }, 16, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if value := test.load(test.address); value != test.expected {
+				t.Errorf("expected 0x%x at 0x%x, got 0x%x", test.expected, test.address, value)
+			}
+		})
+	}
+
+	memory.Store32(14, 0xFFFFFFFF) // Ignored, it does not fit in memory
+	if value := memory.Load16(14); value != 0xAABB {
+		t.Errorf("expected a store past the end to be ignored, got 0x%x", value)
+	}
+}
+
+// recordingDevice remembers the last access it received
+type recordingDevice struct {
+	offset, size, value uint32
+}
+
+func (device *recordingDevice) Read(offset uint32, size uint32) uint32 {
+	device.offset, device.size = offset, size
+	return 0xCAFEBABE
+}
+
+func (device *recordingDevice) Write(offset uint32, size uint32, value uint32) {
+	device.offset, device.size, device.value = offset, size, value
+}
+
+func TestBusRegions(t *testing.T) {
+	var memory Memory
+
+	initMemory(&memory, 0x100, 0)
+	device := &recordingDevice{}
+	if err := memory.Map(Region{name: "device", base: 0x1000, size: 0x10, device: device}); err != nil {
+		t.Fatalf("unexpected error mapping the device: %v", err)
+	}
+	if err := mapROM(&memory, 0x2000, []byte{0x13, 0x05, 0xA0, 0x02}); err != nil {
+		t.Fatalf("unexpected error mapping the ROM: %v", err)
+	}
+	if err := memory.Map(Region{name: "overlap", base: 0x100C, size: 0x10, device: device}); err == nil {
+		t.Errorf("expected an error when mapping a region over another one")
+	}
+
+	memory.Store16(0x1006, 0x1234)
+	if device.offset != 6 || device.size != 2 || device.value != 0x1234 {
+		t.Errorf("expected a 2-byte write of 0x1234 at offset 6, got %+v", *device)
+	}
+	if value := memory.Load32(0x1008); value != 0xCAFEBABE || device.offset != 8 || device.size != 4 {
+		t.Errorf("expected a 4-byte read at offset 8, got 0x%x and %+v", value, *device)
+	}
+	if value := memory.Load32(0x2000); value != 0x02A00513 {
+		t.Errorf("expected the ROM image, got 0x%x", value)
+	}
+
+	tests := []struct {
+		name     string
+		address  uint64
+		size     uint32
+		access   int
+		expected bool
+	}{
+		{"RAM", 0xFC, 4, accessStore, true},
+		{"across the end of RAM", 0xFE, 4, accessLoad, false},
+		{"unmapped", 0x800, 4, accessLoad, false},
+		{"device", 0x100C, 4, accessStore, true},
+		{"ROM load", 0x2000, 4, accessLoad, true},
+		{"ROM fetch", 0x2002, 2, accessFetch, true},
+		{"ROM store", 0x2000, 4, accessStore, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid := isPhysicalAccessValid(&memory, test.address, test.size, test.access); valid != test.expected {
+				t.Errorf("expected valid=%v at 0x%x, got %v", test.expected, test.address, valid)
+			}
+		})
+	}
+}
+
+func TestBusAccessFaults(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	tests := []struct {
+		name          string
+		instruction   uint32
+		address       uint64
+		expectedCause uint64
+	}{
+		{"LW from an unmapped address", assembleI(0b0000011, 2, 0b010, 1, 0), 0x800, causeLoadAccessFault},
+		{"SW to an unmapped address", assembleS(0b0100011, 0b010, 1, 2, 0), 0x800, causeStoreAccessFault},
+		{"SB to ROM", assembleS(0b0100011, 0b000, 1, 2, 0), 0x2000, causeStoreAccessFault},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initMemory(&memory, 0x100, 0)
+			mapROM(&memory, 0x2000, []byte{1, 2, 3, 4})
+			initCPUState(&cpu, 0, 0)
+			cpu.csr[csrMtvec] = 0x40
+			memory.Store32(0, test.instruction)
+			writeRegister(&cpu, 1, test.address)
+
+			executeInstruction(&cpu, &memory)
+
+			if cpu.pc != 0x40 || cpu.csr[csrMcause] != test.expectedCause || cpu.csr[csrMtval] != test.address {
+				t.Errorf("expected cause %d with mtval=0x%x, got pc=0x%x mcause=%d mtval=0x%x",
+					test.expectedCause, test.address, cpu.pc, cpu.csr[csrMcause], cpu.csr[csrMtval])
+			}
+			if value := memory.Load32(0x2000); value != 0x04030201 {
+				t.Errorf("expected the ROM to be unchanged, got 0x%x", value)
+			}
+		})
+	}
+}
+
+func TestPagedMemory(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initPagedMemory(&memory, 2*pageSize, 0x01010101)
+	initCPUState(&cpu, 0x80000000, 0)
+	if err := attachCLINT(&memory, newCLINT(&cpu)); err != nil {
+		t.Fatalf("unexpected error mapping the CLINT over the paged RAM: %v", err)
+	}
+	ram := memory.regions[0].device.(*PagedRAM)
+
+	if value := memory.Load32(0x40000000); value != 0x01010101 {
+		t.Errorf("expected a page never written to read as the default value, got 0x%x", value)
+	}
+	if !isPhysicalAccessValid(&memory, 0x10000, 4, accessStore) || len(ram.pages) != 0 {
+		t.Errorf("expected checking a store to accept it without allocating, got %d pages", len(ram.pages))
+	}
+
+	memory.Store32(0xFFFFFFFC, 0xDEADBEEF)
+	memory.Store8(0x80000001, 0xAB)
+	if value := memory.Load32(0xFFFFFFFC); value != 0xDEADBEEF {
+		t.Errorf("expected 0xdeadbeef at the top of memory, got 0x%x", value)
+	}
+	if value := memory.Load32(0x80000000); value != 0x0101AB01 {
+		t.Errorf("expected 0x0101ab01 at 0x80000000, got 0x%x", value)
+	}
+
+	tests := []struct {
+		name     string
+		address  uint64
+		size     uint32
+		access   int
+		expected bool
+	}{
+		{"store to a written page", 0x80000FFC, 4, accessStore, true},
+		{"store near the top", 0xFFFFFFF0, 4, accessStore, true},
+		{"store to a third page over the limit", 0x10000, 4, accessStore, false},
+		{"load from a page never written", 0x10000, 4, accessLoad, true},
+		{"fetch from a written page", 0x80000004, 2, accessFetch, true},
+		{"fetch from a page never written", 0x40000000, 2, accessFetch, false},
+		{"CLINT over the RAM", clintBase + clintMtime, 4, accessStore, true},
+		{"across the start of the CLINT", clintBase - 2, 4, accessLoad, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid := isPhysicalAccessValid(&memory, test.address, test.size, test.access); valid != test.expected {
+				t.Errorf("expected valid=%v at 0x%x, got %v", test.expected, test.address, valid)
+			}
+		})
+	}
+	if len(ram.pages) != 2 {
+		t.Errorf("expected 2 pages to be allocated, got %d", len(ram.pages))
+	}
+
+	// A store to a third page raises a store access fault
+	cpu.csr[csrMtvec] = 0x80000100
+	memory.Store32(0x80000000, assembleS(0b0100011, 0b010, 1, 2, 0)) // SW x2, 0(x1)
+	writeRegister(&cpu, 1, 0x10000)
+	executeInstruction(&cpu, &memory)
+	if cpu.pc != 0x80000100 || cpu.csr[csrMcause] != causeStoreAccessFault {
+		t.Errorf("expected a store access fault, got pc=0x%x mcause=%d", cpu.pc, cpu.csr[csrMcause])
+	}
+
+	// Running into a page never written raises an instruction access fault
+	cpu.pc = 0x40000000
+	executeInstruction(&cpu, &memory)
+	if cpu.pc != 0x80000100 || cpu.csr[csrMcause] != causeInstructionAccessFault || cpu.csr[csrMepc] != 0x40000000 {
+		t.Errorf("expected an instruction access fault, got pc=0x%x mcause=%d mepc=0x%x", cpu.pc, cpu.csr[csrMcause], cpu.csr[csrMepc])
+	}
+}
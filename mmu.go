@@ -0,0 +1,191 @@
+package main
+
+// satp fields (RV32)
+const (
+	satpModeSv32 = 1 << 31
+	satpASID     = 0x1FF << 22
+	satpPPN      = 0x3FFFFF
+)
+
+// Sv32 page table entry fields
+const (
+	pteV = 1 << 0
+	pteR = 1 << 1
+	pteW = 1 << 2
+	pteX = 1 << 3
+	pteU = 1 << 4
+	pteG = 1 << 5
+	pteA = 1 << 6
+	pteD = 1 << 7
+
+	pageShift = 12
+	pageSize  = 1 << pageShift
+	pteSize   = 4
+	sv32Level = 2
+)
+
+// Page-fault exception of each access type
+var pageFaultCause = []uint64{causeInstructionPageFault, causeLoadPageFault, causeStorePageFault}
+
+const tlbSize = 16
+
+// tlbEntry caches the leaf PTE of a virtual page. Superpages are cached one 4 KiB page at a time.
+type tlbEntry struct {
+	valid      bool
+	vpn        uint64 // Virtual page number
+	pte        uint32 // Leaf PTE, its flags are checked again on every access
+	pteAddress uint64 // Physical address of the PTE, to set its D bit on the first store
+	physical   uint64 // Physical address of the page
+}
+
+func flushTLB(cpu *CPUState) {
+	cpu.tlb = [tlbSize]tlbEntry{}
+}
+
+// flushTLBPage drops the cached translation of the page holding a virtual address.
+func flushTLBPage(cpu *CPUState, address uint64) {
+	entry := &cpu.tlb[(address>>pageShift)%tlbSize]
+	if entry.vpn == address>>pageShift {
+		entry.valid = false
+	}
+}
+
+// effectivePrivilege returns the privilege mode an access is checked against: with mstatus.MPRV set, loads and
+// stores use the mode saved in MPP.
+func effectivePrivilege(cpu *CPUState, access int) uint64 {
+	if access != accessFetch && cpu.csr[csrMstatus]&mstatusMPRV != 0 {
+		return (cpu.csr[csrMstatus] & mstatusMPP) >> mstatusMPPShift
+	}
+	return cpu.privilege
+}
+
+// isTranslationEnabled reports whether an access goes through Sv32: satp must select it and M-mode is never
+// translated. Only Bare is supported in RV64.
+func isTranslationEnabled(cpu *CPUState, access int) bool {
+	return cpu.xlen == 32 && cpu.csr[csrSatp]&satpModeSv32 != 0 && effectivePrivilege(cpu, access) != privilegeMachine
+}
+
+// translateAddress returns the physical address of a virtual address, raising a page fault (or an access fault
+// when a page table lies outside memory) if the access is not allowed.
+func translateAddress(cpu *CPUState, memory *Memory, address uint64, access int) (uint64, bool) {
+	if !isTranslationEnabled(cpu, access) {
+		return address, true
+	}
+
+	vpn := address >> pageShift
+	entry := &cpu.tlb[vpn%tlbSize]
+	if !entry.valid || entry.vpn != vpn || (access == accessStore && entry.pte&pteD == 0) {
+		pte, pteAddress, physical, ok := walkPageTable(cpu, memory, address, access)
+		if !ok {
+			return 0, false
+		}
+		*entry = tlbEntry{true, vpn, pte, pteAddress, physical}
+	}
+
+	if !isPageAccessAllowed(cpu, entry.pte, access) {
+		raiseException(cpu, pageFaultCause[access], address)
+		return 0, false
+	}
+	return entry.physical | address&(pageSize-1), true
+}
+
+// peekTranslation returns the physical address of an instruction fetch from the TLB only, without walking the page
+// table or checking the permissions, ok is false when the translation is not cached.
+func peekTranslation(cpu *CPUState, address uint64) (uint64, bool) {
+	if !isTranslationEnabled(cpu, accessFetch) {
+		return address, true
+	}
+	entry := &cpu.tlb[(address>>pageShift)%tlbSize]
+	if !entry.valid || entry.vpn != address>>pageShift {
+		return 0, false
+	}
+	return entry.physical | address&(pageSize-1), true
+}
+
+// walkPageTable walks the two levels of the Sv32 page table for a virtual address and returns its leaf PTE, the
+// physical address of that PTE and the physical address of the page. The A bit, and the D bit of a store, are set
+// in the PTE as the hardware would. The permissions of the leaf are checked by isPageAccessAllowed.
+func walkPageTable(cpu *CPUState, memory *Memory, address uint64, access int) (uint32, uint64, uint64, bool) {
+	vpn := []uint64{(address >> 12) & 0x3FF, (address >> 22) & 0x3FF}
+	table := (cpu.csr[csrSatp] & satpPPN) << pageShift
+
+	for level := sv32Level - 1; level >= 0; level-- {
+		pteAddress := table + vpn[level]*pteSize
+		// The page table is read and written with the privilege of S-mode, whatever the mode of the access
+		if !isPhysicalAccessValid(memory, pteAddress, pteSize, accessLoad) ||
+			!isPmpAccessAllowed(cpu, pteAddress, pteSize, accessLoad, privilegeSupervisor) {
+			raiseException(cpu, accessFaultCause[access], address)
+			return 0, 0, 0, false
+		}
+		pte := memory.Load32(uint32(pteAddress))
+		ppn := uint64(pte >> 10)
+
+		if pte&pteV == 0 || (pte&pteR == 0 && pte&pteW != 0) {
+			break
+		}
+		if pte&(pteR|pteX) == 0 {
+			table = ppn << pageShift // Pointer to the next level
+			continue
+		}
+
+		// Leaf PTE: a megapage must be aligned on 4 MiB, its PPN[0] must be zero
+		if level == 1 && ppn&0x3FF != 0 {
+			break
+		}
+		if !isPageAccessAllowed(cpu, pte, access) {
+			break
+		}
+		updated := pte | pteA
+		if access == accessStore {
+			updated |= pteD
+		}
+		if updated != pte {
+			if !isPhysicalAccessValid(memory, pteAddress, pteSize, accessStore) ||
+				!isPmpAccessAllowed(cpu, pteAddress, pteSize, accessStore, privilegeSupervisor) {
+				raiseException(cpu, accessFaultCause[access], address)
+				return 0, 0, 0, false
+			}
+			memory.Store32(uint32(pteAddress), updated)
+			invalidateReservation(cpu, uint32(pteAddress))
+			pte = updated
+		}
+
+		physical := ppn << pageShift
+		if level == 1 {
+			physical |= vpn[0] << pageShift // The low bits of a megapage come from the virtual address
+		}
+		return pte, pteAddress, physical, true
+	}
+
+	raiseException(cpu, pageFaultCause[access], address)
+	return 0, 0, 0, false
+}
+
+// isPageAccessAllowed checks the R/W/X permissions of a leaf PTE and its U bit against the privilege of the
+// access. mstatus.MXR makes executable pages readable and mstatus.SUM lets S-mode load from and store to U-mode
+// pages; S-mode can never execute them.
+func isPageAccessAllowed(cpu *CPUState, pte uint32, access int) bool {
+	mstatus := cpu.csr[csrMstatus]
+	switch access {
+	case accessFetch:
+		if pte&pteX == 0 {
+			return false
+		}
+	case accessLoad:
+		if pte&pteR == 0 && (mstatus&mstatusMXR == 0 || pte&pteX == 0) {
+			return false
+		}
+	case accessStore:
+		if pte&pteW == 0 {
+			return false
+		}
+	}
+
+	switch effectivePrivilege(cpu, access) {
+	case privilegeUser:
+		return pte&pteU != 0
+	case privilegeSupervisor:
+		return pte&pteU == 0 || (access != accessFetch && mstatus&mstatusSUM != 0)
+	}
+	return true
+}
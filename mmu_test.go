@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+)
+
+// setupPageTable maps the virtual page 0x4000 to the physical page 0x8000 with the given flags, through a root
+// table at 0x1000 and a second level table at 0x2000. The virtual megapage 0x400000 maps the first 4 MiB with
+// the flags of megapage.
+func setupPageTable(cpu *CPUState, memory *Memory, flags uint32, megapage uint32) {
+	initMemory(memory, 0x10000, 0)
+	initCPUState(cpu, 0, 0)
+	cpu.csr[csrSatp] = satpModeSv32 | 0x1
+	memory.Store32(0x1000, 0x2<<10|pteV)      // VPN[1] = 0: pointer to the table at 0x2000
+	memory.Store32(0x1004, megapage)          // VPN[1] = 1: megapage
+	memory.Store32(0x2000+4*4, 0x8<<10|flags) // VPN[0] = 4: page at 0x8000
+}
+
+func TestTranslateAddress(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	tests := []struct {
+		name          string
+		flags         uint32
+		megapage      uint32
+		privilege     uint64
+		mstatus       uint64
+		address       uint64
+		access        int
+		expected      uint64
+		expectedCause uint64
+		expectedPTE   uint32
+	}{
+		{"U-mode load", pteV | pteR | pteU, 0, privilegeUser, 0, 0x4010, accessLoad, 0x8010, 0,
+			pteV | pteR | pteU | pteA},
+		{"U-mode store sets D", pteV | pteR | pteW | pteU, 0, privilegeUser, 0, 0x4010, accessStore, 0x8010, 0,
+			pteV | pteR | pteW | pteU | pteA | pteD},
+		{"U-mode load from S-mode page", pteV | pteR, 0, privilegeUser, 0, 0x4010, accessLoad, 0,
+			causeLoadPageFault, pteV | pteR},
+		{"S-mode load from U-mode page", pteV | pteR | pteU, 0, privilegeSupervisor, 0, 0x4010, accessLoad, 0,
+			causeLoadPageFault, pteV | pteR | pteU},
+		{"S-mode load from U-mode page with SUM", pteV | pteR | pteU, 0, privilegeSupervisor, mstatusSUM, 0x4010,
+			accessLoad, 0x8010, 0, pteV | pteR | pteU | pteA},
+		{"S-mode fetch from U-mode page with SUM", pteV | pteX | pteU, 0, privilegeSupervisor, mstatusSUM, 0x4010,
+			accessFetch, 0, causeInstructionPageFault, pteV | pteX | pteU},
+		{"Load from execute-only page", pteV | pteX, 0, privilegeSupervisor, 0, 0x4010, accessLoad, 0,
+			causeLoadPageFault, pteV | pteX},
+		{"Load from execute-only page with MXR", pteV | pteX, 0, privilegeSupervisor, mstatusMXR, 0x4010,
+			accessLoad, 0x8010, 0, pteV | pteX | pteA},
+		{"Store to read-only page", pteV | pteR, 0, privilegeSupervisor, 0, 0x4010, accessStore, 0,
+			causeStorePageFault, pteV | pteR},
+		{"Fetch from non-executable page", pteV | pteR, 0, privilegeSupervisor, 0, 0x4010, accessFetch, 0,
+			causeInstructionPageFault, pteV | pteR},
+		{"Invalid PTE", pteR, 0, privilegeSupervisor, 0, 0x4010, accessLoad, 0, causeLoadPageFault, pteR},
+		{"Reserved W without R", pteV | pteW, 0, privilegeSupervisor, 0, 0x4010, accessLoad, 0,
+			causeLoadPageFault, pteV | pteW},
+		{"Megapage", pteV | pteR, pteV | pteR, privilegeSupervisor, 0, 0x408010, accessLoad, 0x8010, 0, pteV | pteR},
+		{"Misaligned megapage", pteV | pteR, 0x1<<10 | pteV | pteR, privilegeSupervisor, 0, 0x408010, accessLoad, 0,
+			causeLoadPageFault, pteV | pteR},
+		{"M-mode is not translated", pteV | pteR, 0, privilegeMachine, 0, 0x4010, accessLoad, 0x4010, 0, pteV | pteR},
+		{"M-mode with MPRV", pteV | pteR | pteU, 0, privilegeMachine, mstatusMPRV, 0x4010, accessLoad, 0x8010, 0,
+			pteV | pteR | pteU | pteA},
+		{"M-mode fetch ignores MPRV", pteV | pteX | pteU, 0, privilegeMachine, mstatusMPRV, 0x4010, accessFetch,
+			0x4010, 0, pteV | pteX | pteU},
+		{"Page table outside memory", pteV | pteR, 0x3FFFF<<10 | pteV, privilegeSupervisor, 0, 0x408010, accessLoad,
+			0, causeLoadAccessFault, pteV | pteR},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupPageTable(&cpu, &memory, test.flags, test.megapage)
+			cpu.privilege = test.privilege
+			cpu.csr[csrMstatus] = test.mstatus // MPP = U for MPRV
+			cpu.csr[csrMtvec] = 0x100
+
+			physical, ok := translateAddress(&cpu, &memory, test.address, test.access)
+
+			if test.expectedCause != 0 {
+				if ok || cpu.csr[csrMcause] != test.expectedCause || cpu.csr[csrMtval] != test.address {
+					t.Errorf("expected exception %d with mtval=0x%x, got ok=%v mcause=%d mtval=0x%x",
+						test.expectedCause, test.address, ok, cpu.csr[csrMcause], cpu.csr[csrMtval])
+				}
+			} else if !ok || physical != test.expected {
+				t.Errorf("expected physical address 0x%x, got 0x%x (ok=%v, mcause=%d)", test.expected, physical, ok,
+					cpu.csr[csrMcause])
+			}
+			if pte := memory.Load32(0x2000+4*4) & 0x3FF; pte != test.expectedPTE {
+				t.Errorf("expected PTE flags 0x%x, got 0x%x", test.expectedPTE, pte)
+			}
+		})
+	}
+}
+
+func TestSFENCEVMA(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	setupPageTable(&cpu, &memory, pteV|pteR|pteW|pteX|pteA|pteD, 0)
+	cpu.privilege = privilegeSupervisor
+	cpu.csr[csrMtvec] = 0x100
+	memory.Store32(0x8000, 0x12000073) // SFENCE.VMA x0, x0
+	memory.Store32(0x8004, 0x1000A12F) // LR.W x2, (x1)
+	memory.Store32(0x9004, 0x1000A12F) // LR.W x2, (x1)
+	memory.Store32(0x8010, 0x11111111)
+	memory.Store32(0x9010, 0x22222222)
+	writeRegister(&cpu, 1, 0x4010)
+
+	// The first load fills the TLB, remapping the page is only seen after SFENCE.VMA
+	cpu.pc = 0x4004
+	executeInstruction(&cpu, &memory)
+	memory.Store32(0x2000+4*4, 0x9<<10|pteV|pteR|pteW|pteX|pteA|pteD)
+	cpu.pc = 0x4004
+	executeInstruction(&cpu, &memory)
+	if cpu.x[2] != 0x11111111 {
+		t.Errorf("expected the cached translation before SFENCE.VMA, got x2=0x%x", cpu.x[2])
+	}
+
+	cpu.pc = 0x4000
+	executeInstruction(&cpu, &memory) // SFENCE.VMA, still fetched from the old page
+	executeInstruction(&cpu, &memory) // LR.W, fetched from the new page
+	if cpu.x[2] != 0x22222222 || cpu.pc != 0x4008 {
+		t.Errorf("expected the new translation after SFENCE.VMA, got x2=0x%x pc=0x%x", cpu.x[2], cpu.pc)
+	}
+
+	cpu.privilege = privilegeUser
+	cpu.pc = 0x4000
+	memory.Store32(0x9000, 0x12000073) // SFENCE.VMA x0, x0
+	memory.Store32(0x2000+4*4, 0x9<<10|pteV|pteR|pteX|pteU|pteA)
+	flushTLB(&cpu)
+	executeInstruction(&cpu, &memory)
+	if cpu.pc != 0x100 || cpu.csr[csrMcause] != causeIllegalInstruction {
+		t.Errorf("expected SFENCE.VMA to be illegal in U-mode, got pc=0x%x mcause=%d", cpu.pc, cpu.csr[csrMcause])
+	}
+}
@@ -8,17 +8,28 @@ type Opcode struct {
 }
 
 var OpcodeMap = map[uint32]Opcode{
-	0b1100011: {"BRANCH", Encodings["SB"]},  // Conditional branches
-	0b1100111: {"JALR", Encodings["I"]},     // Jump and link register
-	0b0000011: {"LOAD", Encodings["I"]},     // Load instructions
-	0b0001111: {"MISC-MEM", Encodings["I"]}, // Misc memory instructions
-	0b0010011: {"OP-IMM", Encodings["I"]},   // Integer-Register-Immediate instructions
-	0b1110011: {"SYSTEM", Encodings["I"]},   // System instructions
-	0b1101111: {"JAL", Encodings["UJ"]},     // Jump and link
-	0b0110011: {"OP", Encodings["R"]},       // Register-register operations
-	0b0100011: {"STORE", Encodings["S"]},    // Store instructions
-	0b0010111: {"AUIPC", Encodings["U"]},    // Add upper immediate to PC
-	0b0110111: {"LUI", Encodings["U"]},      // Load upper immediate
+	0b1100011: {"BRANCH", Encodings["SB"]},   // Conditional branches
+	0b1100111: {"JALR", Encodings["I"]},      // Jump and link register
+	0b0000011: {"LOAD", Encodings["I"]},      // Load instructions
+	0b0001111: {"MISC-MEM", Encodings["I"]},  // Misc memory instructions
+	0b0010011: {"OP-IMM", Encodings["I"]},    // Integer-Register-Immediate instructions
+	0b0011011: {"OP-IMM-32", Encodings["I"]}, // RV64 word Integer-Register-Immediate instructions
+	0b1110011: {"SYSTEM", Encodings["I"]},    // System instructions
+	0b1101111: {"JAL", Encodings["UJ"]},      // Jump and link
+	0b0110011: {"OP", Encodings["R"]},        // Register-register operations
+	0b0111011: {"OP-32", Encodings["R"]},     // RV64 word Register-register operations
+	0b0100011: {"STORE", Encodings["S"]},     // Store instructions
+	0b0010111: {"AUIPC", Encodings["U"]},     // Add upper immediate to PC
+	0b0110111: {"LUI", Encodings["U"]},       // Load upper immediate
+	0b0101111: {"AMO", Encodings["R"]},       // Atomic memory operations
+	0b0000111: {"LOAD-FP", Encodings["I"]},   // Floating-point loads
+	0b0100111: {"STORE-FP", Encodings["S"]},  // Floating-point stores
+	0b1010011: {"OP-FP", Encodings["R"]},     // Floating-point operations
+	0b1000011: {"MADD", Encodings["R4"]},     // Fused multiply-add
+	0b1000111: {"MSUB", Encodings["R4"]},     // Fused multiply-subtract
+	0b1001011: {"NMSUB", Encodings["R4"]},    // Fused negated multiply-subtract
+	0b1001111: {"NMADD", Encodings["R4"]},    // Fused negated multiply-add
+	0b1010111: {"OP-V", Encodings["V"]},      // Vector operations
 }
 
 func GetOpcode(opcode uint32) (Opcode, error) {
@@ -21,6 +21,12 @@ func TestGetOpcode(t *testing.T) {
 		{0b0100011, "STORE", false},
 		{0b0010111, "AUIPC", false},
 		{0b0110111, "LUI", false},
+		{0b0101111, "AMO", false},
+		{0b0000111, "LOAD-FP", false},
+		{0b0100111, "STORE-FP", false},
+		{0b1010011, "OP-FP", false},
+		{0b1000011, "MADD", false},
+		{0b1001111, "NMADD", false},
 		{0b0000000, "", true}, // Invalid opcode for testing
 	}
 
@@ -60,6 +66,7 @@ func TestGetOpcodeFromInstruction(t *testing.T) {
 		{0x23, "STORE", false},    // STORE instruction with opcode 0b0100011
 		{0x17, "AUIPC", false},    // AUIPC instruction with opcode 0b0010111
 		{0x37, "LUI", false},      // LUI instruction with opcode 0b0110111
+		{0x2F, "AMO", false},      // AMO instruction with opcode 0b0101111
 		{0x00, "", true},          // Invalid instruction for testing
 	}
 
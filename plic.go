@@ -0,0 +1,170 @@
+package main
+
+// Memory map of the PLIC (platform-level interrupt controller), at the address used by most RISC-V platforms
+const (
+	plicBase          = 0x0C000000
+	plicSize          = 0x4000000
+	plicPriority      = 0x000000 // One word per source, source 0 does not exist
+	plicPending       = 0x001000 // One bit per source, read-only
+	plicEnable        = 0x002000 // One bit per source for each context
+	plicEnableStride  = 0x80
+	plicContext       = 0x200000 // Priority threshold, then claim/complete, for each context
+	plicContextStride = 0x1000
+
+	plicSources     = 32 // Interrupt sources 1-31
+	plicContexts    = 2  // Context 0 interrupts the hart in M-mode (MEIP), context 1 in S-mode (SEIP)
+	plicMaxPriority = 7
+)
+
+// PLIC routes the interrupt lines of the devices to the hart. A source becomes pending when its line is raised
+// and it is not being served, claiming it clears the pending bit until the handler completes it. Lines are level
+// triggered: a line still raised at completion makes the source pending again.
+type PLIC struct {
+	priority  [plicSources]uint32
+	pending   uint32 // Bit i is source i
+	claimed   uint32 // Sources claimed and not completed yet
+	lines     uint32 // Interrupt lines currently raised by the devices
+	enable    [plicContexts]uint32
+	threshold [plicContexts]uint32
+}
+
+func newPLIC() *PLIC {
+	return &PLIC{}
+}
+
+// attachPLIC maps the registers of a PLIC at plicBase and lets handleInterrupts sample it.
+func attachPLIC(memory *Memory, plic *PLIC) error {
+	memory.plic = plic
+	return memory.Map(Region{name: "plic", base: plicBase, size: plicSize, device: plic})
+}
+
+// Read returns the size bytes of the PLIC registers at a byte offset.
+func (plic *PLIC) Read(offset uint32, size uint32) uint32 {
+	return readPLIC(plic, offset) >> ((offset % 4) * 8)
+}
+
+// Write writes the size bytes of the PLIC registers at a byte offset, leaving the rest of the register untouched.
+func (plic *PLIC) Write(offset uint32, size uint32, value uint32) {
+	shift := (offset % 4) * 8
+	writePLIC(plic, offset, value<<shift, uint32(1<<(8*size)-1)<<shift)
+}
+
+// setInterruptLine raises or lowers the interrupt line of a source, devices call it when their state changes.
+func setInterruptLine(plic *PLIC, source uint32, raised bool) {
+	if source == 0 || source >= plicSources {
+		return
+	}
+	if raised {
+		plic.lines |= 1 << source
+		if plic.claimed&(1<<source) == 0 {
+			plic.pending |= 1 << source
+		}
+	} else {
+		plic.lines &^= 1 << source
+	}
+}
+
+// highestPendingInterrupt returns the enabled pending source of a context with the highest priority above its
+// threshold, the lowest source number wins a tie. It returns 0 when there is none.
+func highestPendingInterrupt(plic *PLIC, context int) uint32 {
+	best := uint32(0)
+	for source := uint32(1); source < plicSources; source++ {
+		if plic.pending&plic.enable[context]&(1<<source) == 0 || plic.priority[source] <= plic.threshold[context] {
+			continue
+		}
+		if best == 0 || plic.priority[source] > plic.priority[best] {
+			best = source
+		}
+	}
+	return best
+}
+
+// claimInterrupt implements a read of the claim register of a context.
+func claimInterrupt(plic *PLIC, context int) uint32 {
+	source := highestPendingInterrupt(plic, context)
+	if source != 0 {
+		plic.pending &^= 1 << source
+		plic.claimed |= 1 << source
+	}
+	return source
+}
+
+// completeInterrupt implements a write to the claim register of a context, sources it does not enable are ignored.
+func completeInterrupt(plic *PLIC, context int, source uint32) {
+	if source == 0 || source >= plicSources || plic.enable[context]&(1<<source) == 0 {
+		return
+	}
+	plic.claimed &^= 1 << source
+	if plic.lines&(1<<source) != 0 {
+		plic.pending |= 1 << source
+	}
+}
+
+// plicContextRegister decodes an offset in the enable or context areas, it returns the context and the offset
+// of the register inside the area of that context.
+func plicContextRegister(offset uint32, base uint32, stride uint32) (int, uint32, bool) {
+	context := (offset - base) / stride
+	return int(context), (offset - base) % stride, context < plicContexts
+}
+
+// readPLIC returns the word of the PLIC registers at a byte offset, unimplemented words read as zero. Reading a
+// claim register claims the interrupt it returns.
+func readPLIC(plic *PLIC, offset uint32) uint32 {
+	offset &^= 3
+	switch {
+	case offset < plicPending:
+		if source := offset / 4; source < plicSources {
+			return plic.priority[source]
+		}
+	case offset == plicPending:
+		return plic.pending
+	case offset >= plicEnable && offset < plicContext:
+		if context, register, ok := plicContextRegister(offset, plicEnable, plicEnableStride); ok && register == 0 {
+			return plic.enable[context]
+		}
+	case offset >= plicContext:
+		context, register, ok := plicContextRegister(offset, plicContext, plicContextStride)
+		if ok && register == 0 {
+			return plic.threshold[context]
+		} else if ok && register == 4 {
+			return claimInterrupt(plic, context)
+		}
+	}
+	return 0
+}
+
+// writePLIC writes the bits of mask in the word of the PLIC registers at a byte offset. Priorities and thresholds
+// keep their 3 implemented bits (up to plicMaxPriority), source 0 cannot be enabled.
+func writePLIC(plic *PLIC, offset uint32, value uint32, mask uint32) {
+	offset &^= 3
+	switch {
+	case offset < plicPending:
+		if source := offset / 4; source != 0 && source < plicSources {
+			plic.priority[source] = (plic.priority[source]&^mask | value&mask) & plicMaxPriority
+		}
+	case offset >= plicEnable && offset < plicContext:
+		if context, register, ok := plicContextRegister(offset, plicEnable, plicEnableStride); ok && register == 0 {
+			plic.enable[context] = (plic.enable[context]&^mask | value&mask) &^ 1
+		}
+	case offset >= plicContext:
+		context, register, ok := plicContextRegister(offset, plicContext, plicContextStride)
+		if ok && register == 0 {
+			plic.threshold[context] = (plic.threshold[context]&^mask | value&mask) & plicMaxPriority
+		} else if ok && register == 4 {
+			completeInterrupt(plic, context, value&mask)
+		}
+	}
+}
+
+// updatePLICInterrupts drives mip.MEIP and mip.SEIP from the two contexts of the PLIC. While a PLIC is attached,
+// it overrides the value written to mip.SEIP by M-mode software.
+func updatePLICInterrupts(cpu *CPUState, plic *PLIC) {
+	mip := cpu.csr[csrMip] &^ (mipMEIP | mipSEIP)
+	if highestPendingInterrupt(plic, 0) != 0 {
+		mip |= mipMEIP
+	}
+	if highestPendingInterrupt(plic, 1) != 0 {
+		mip |= mipSEIP
+	}
+	cpu.csr[csrMip] = mip
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPLIC(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initMemory(&memory, 256, 0)
+	initCPUState(&cpu, 0x10, 0)
+	attachPLIC(&memory, newPLIC())
+	plic := memory.plic
+	claim := uint32(plicBase + plicContext + 4) // Claim/complete of context 0
+
+	memory.Store32(plicBase+4*3, 2)                 // Priority of source 3
+	memory.Store32(plicBase+4*5, 0xF)               // Priority of source 5, only 3 bits are implemented
+	memory.Store32(plicBase+plicEnable, 0xFFFFFFFF) // Enable every source of context 0
+	if plic.priority[5] != 7 || plic.enable[0] != 0xFFFFFFFE {
+		t.Errorf("expected priority[5]=7 and enable[0]=0xfffffffe, got %d and 0x%x", plic.priority[5], plic.enable[0])
+	}
+
+	setInterruptLine(plic, 3, true)
+	setInterruptLine(plic, 5, true)
+	setInterruptLine(plic, 7, true) // Priority 0: never interrupts
+	if pending := memory.Load32(plicBase + plicPending); pending != 1<<3|1<<5|1<<7 {
+		t.Errorf("expected sources 3, 5 and 7 pending, got 0x%x", pending)
+	}
+
+	updatePLICInterrupts(&cpu, plic)
+	if cpu.csr[csrMip]&mipMEIP == 0 || cpu.csr[csrMip]&mipSEIP != 0 {
+		t.Errorf("expected only MEIP to be raised, got mip=0x%x", cpu.csr[csrMip])
+	}
+
+	if source := memory.Load32(claim); source != 5 {
+		t.Errorf("expected to claim source 5 first, got %d", source)
+	}
+	if source := memory.Load32(claim); source != 3 {
+		t.Errorf("expected to claim source 3 next, got %d", source)
+	}
+	if source := memory.Load32(claim); source != 0 {
+		t.Errorf("expected no interrupt left to claim, got %d", source)
+	}
+	updatePLICInterrupts(&cpu, plic)
+	if cpu.csr[csrMip]&mipMEIP != 0 {
+		t.Errorf("expected MEIP to be cleared once everything is claimed, got mip=0x%x", cpu.csr[csrMip])
+	}
+
+	// A raised line is pending again at completion, a lowered one is not
+	setInterruptLine(plic, 3, false)
+	memory.Store32(claim, 3)
+	memory.Store32(claim, 5)
+	if plic.pending != 1<<5|1<<7 || plic.claimed != 0 {
+		t.Errorf("expected only source 5 and 7 pending after completion, got pending=0x%x claimed=0x%x", plic.pending,
+			plic.claimed)
+	}
+
+	// The threshold masks the interrupts with a priority lower or equal to it
+	memory.Store32(plicBase+plicContext, 7)
+	updatePLICInterrupts(&cpu, plic)
+	if cpu.csr[csrMip]&mipMEIP != 0 || memory.Load32(claim) != 0 {
+		t.Errorf("expected the threshold to mask every source, got mip=0x%x", cpu.csr[csrMip])
+	}
+
+	// The S-mode context raises SEIP
+	memory.Store32(plicBase+plicEnable+plicEnableStride, 1<<5)
+	updatePLICInterrupts(&cpu, plic)
+	if cpu.csr[csrMip]&mipSEIP == 0 {
+		t.Errorf("expected SEIP to be raised by context 1, got mip=0x%x", cpu.csr[csrMip])
+	}
+	if source := memory.Load32(plicBase + plicContext + plicContextStride + 4); source != 5 {
+		t.Errorf("expected context 1 to claim source 5, got %d", source)
+	}
+}
+
+func TestExternalInterrupt(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initMemory(&memory, 256, 0)
+	initCPUState(&cpu, 0x10, 0)
+	attachPLIC(&memory, newPLIC())
+	memory.plic.priority[1] = 1
+	memory.plic.enable[0] = 1 << 1
+	cpu.csr[csrMtvec] = 0x81 // Vectored
+	cpu.csr[csrMie] = mipMEIP
+	cpu.csr[csrMstatus] = mstatusMIE
+
+	setInterruptLine(memory.plic, 1, true)
+	handleInterrupts(&cpu, &memory)
+
+	if cpu.pc != 0x80+4*11 || cpu.csr[csrMcause] != 1<<31|11 || cpu.csr[csrMepc] != 0x10 {
+		t.Errorf("expected a machine external interrupt, got pc=0x%x mcause=0x%x mepc=0x%x", cpu.pc,
+			cpu.csr[csrMcause], cpu.csr[csrMepc])
+	}
+}
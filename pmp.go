@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	mathbits "math/bits" // bits is the field extractor of compressed.go
+)
+
+// PMP configuration fields, one byte per entry
+const (
+	pmpR = 1 << 0
+	pmpW = 1 << 1
+	pmpX = 1 << 2
+	pmpA = 0b11 << 3 // Address matching mode
+	pmpL = 1 << 7    // Locked: the entry can no longer be written and also applies to M-mode
+
+	pmpOff   = 0 << 3
+	pmpTOR   = 1 << 3 // Top Of Range: pmpaddr[i-1] <= address < pmpaddr[i]
+	pmpNA4   = 2 << 3 // Naturally aligned four-byte region
+	pmpNAPOT = 3 << 3 // Naturally aligned power-of-two region, the size is encoded in the trailing ones of pmpaddr
+
+	pmpEntries = 16
+)
+
+// pmpConfig returns the configuration byte of a PMP entry. The bytes are kept in the RV32 layout, four per
+// pmpcfg register, whatever XLEN is.
+func pmpConfig(cpu *CPUState, entry int) uint64 {
+	return (cpu.csr[csrPmpcfg0+entry/4] >> (8 * (entry % 4))) & 0xFF
+}
+
+func setPmpConfig(cpu *CPUState, entry int, config uint64) {
+	shift := 8 * (entry % 4)
+	cpu.csr[csrPmpcfg0+entry/4] = cpu.csr[csrPmpcfg0+entry/4]&^(0xFF<<shift) | config<<shift
+}
+
+func isPmpLocked(cpu *CPUState, entry int) bool {
+	return pmpConfig(cpu, entry)&pmpL != 0
+}
+
+// isPmpAddressLocked reports whether pmpaddr of an entry is locked: by its own lock bit, or by the lock bit of
+// the next entry when that one uses it as the bottom of a TOR range.
+func isPmpAddressLocked(cpu *CPUState, entry int) bool {
+	if isPmpLocked(cpu, entry) {
+		return true
+	}
+	next := entry + 1
+	return next < pmpEntries && isPmpLocked(cpu, next) && pmpConfig(cpu, next)&pmpA == pmpTOR
+}
+
+// pmpRange returns the physical address range [start, end) matched by an entry, ok is false when it is off.
+func pmpRange(cpu *CPUState, entry int) (start uint64, end uint64, ok bool) {
+	address := cpu.csr[csrPmpaddr0+entry]
+	switch pmpConfig(cpu, entry) & pmpA {
+	case pmpTOR:
+		if entry > 0 {
+			start = cpu.csr[csrPmpaddr0+entry-1] << 2
+		}
+		return start, address << 2, true
+	case pmpNA4:
+		return address << 2, address<<2 + 4, true
+	case pmpNAPOT:
+		size := uint64(8) << mathbits.TrailingZeros64(^address)
+		start = (address << 2) &^ (size - 1)
+		return start, start + size, true
+	}
+	return 0, 0, false
+}
+
+// isPmpAccessAllowed checks an access of size bytes at a physical address made in a privilege mode. The entry
+// with the lowest number matching any of its bytes decides, and it must match all of them. M-mode accesses only
+// obey locked entries and succeed when no entry matches. S and U-mode accesses matching no entry fail, unless
+// every entry is off: PMP is then considered unused so that bare-metal programs run without setting it up.
+func isPmpAccessAllowed(cpu *CPUState, address uint64, size uint32, access int, privilege uint64) bool {
+	permission := []uint64{pmpX, pmpR, pmpW}[access]
+	last := address + uint64(size) - 1
+	active := false
+
+	for entry := 0; entry < pmpEntries; entry++ {
+		start, end, ok := pmpRange(cpu, entry)
+		if !ok {
+			continue
+		}
+		active = true
+		if last < start || address >= end {
+			continue
+		}
+		if address < start || last >= end {
+			return false // Partial match
+		}
+		config := pmpConfig(cpu, entry)
+		if privilege == privilegeMachine && config&pmpL == 0 {
+			return true
+		}
+		return config&permission != 0
+	}
+	return privilege == privilegeMachine || !active
+}
+
+// pmpcfgCSR returns pmpcfg<index>. In RV64 the even registers hold eight entries and the odd ones do not exist.
+// Writes skip the locked entries, the reserved combination W without R is turned into no permission.
+func pmpcfgCSR(index int) CSR {
+	return CSR{
+		fmt.Sprintf("pmpcfg%d", index),
+		func(cpu *CPUState) uint64 {
+			value := cpu.csr[csrPmpcfg0+index]
+			if cpu.xlen == 64 {
+				value |= cpu.csr[csrPmpcfg0+index+1] << 32
+			}
+			return value
+		},
+		func(cpu *CPUState, value uint64) {
+			for i := 0; i < int(cpu.xlen/8); i++ {
+				entry := 4*index + i
+				config := (value >> (8 * i)) & (pmpR | pmpW | pmpX | pmpA | pmpL)
+				if config&(pmpR|pmpW) == pmpW {
+					config &^= pmpW
+				}
+				if !isPmpLocked(cpu, entry) {
+					setPmpConfig(cpu, entry, config)
+				}
+			}
+		},
+	}
+}
+
+// pmpaddrCSR returns pmpaddr<index>, bits [XLEN+1:2] of a physical address (bits [55:2] in RV64).
+func pmpaddrCSR(index int) CSR {
+	return CSR{
+		fmt.Sprintf("pmpaddr%d", index),
+		func(cpu *CPUState) uint64 {
+			return cpu.csr[csrPmpaddr0+index]
+		},
+		func(cpu *CPUState, value uint64) {
+			if isPmpAddressLocked(cpu, index) {
+				return
+			}
+			if cpu.xlen == 64 {
+				value &= 1<<54 - 1
+			}
+			cpu.csr[csrPmpaddr0+index] = value
+		},
+	}
+}
+
+// isOddPmpcfgCSR reports whether the address is pmpcfg1 or pmpcfg3, which only exist in RV32.
+func isOddPmpcfgCSR(address uint32) bool {
+	return address >= csrPmpcfg0 && address <= csrPmpcfg3 && address%2 == 1
+}
+
+func init() {
+	for i := 0; i < pmpEntries/4; i++ {
+		CSRs[uint32(csrPmpcfg0+i)] = pmpcfgCSR(i)
+	}
+	for i := 0; i < pmpEntries; i++ {
+		CSRs[uint32(csrPmpaddr0+i)] = pmpaddrCSR(i)
+	}
+}
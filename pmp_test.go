@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPmpAccess(t *testing.T) {
+	var cpu CPUState
+
+	tests := []struct {
+		name      string
+		config    uint64 // pmpcfg0, entries 0-3
+		addresses []uint64
+		address   uint64
+		size      uint32
+		access    int
+		privilege uint64
+		expected  bool
+	}{
+		{"No entry active", 0, nil, 0x1000, 4, accessLoad, privilegeUser, true},
+		{"No entry matches U-mode", pmpNA4 | pmpR, []uint64{0x100 >> 2}, 0x1000, 4, accessLoad, privilegeUser, false},
+		{"No entry matches M-mode", pmpNA4 | pmpR, []uint64{0x100 >> 2}, 0x1000, 4, accessLoad, privilegeMachine, true},
+		{"NA4 read", pmpNA4 | pmpR, []uint64{0x100 >> 2}, 0x100, 4, accessLoad, privilegeUser, true},
+		{"NA4 write without W", pmpNA4 | pmpR, []uint64{0x100 >> 2}, 0x100, 4, accessStore, privilegeUser, false},
+		{"NA4 partial match", pmpNA4 | pmpR, []uint64{0x100 >> 2}, 0x100, 8, accessLoad, privilegeUser, false},
+		{"TOR from zero", pmpTOR | pmpX, []uint64{0x1000 >> 2}, 0xFFC, 4, accessFetch, privilegeSupervisor, true},
+		{"TOR end is excluded", pmpTOR | pmpX, []uint64{0x1000 >> 2}, 0x1000, 4, accessFetch, privilegeSupervisor, false},
+		{"TOR between two entries", pmpTOR<<8 | pmpR<<8, []uint64{0x1000 >> 2, 0x2000 >> 2}, 0x1800, 4, accessLoad,
+			privilegeUser, true},
+		{"NAPOT 4 KiB", pmpNAPOT | pmpR | pmpW, []uint64{(0x2000 | 0x7FF) >> 2}, 0x2FFC, 4, accessStore,
+			privilegeUser, true},
+		{"NAPOT 4 KiB outside", pmpNAPOT | pmpR | pmpW, []uint64{(0x2000 | 0x7FF) >> 2}, 0x3000, 4, accessStore,
+			privilegeUser, false},
+		{"Lowest entry wins", pmpNA4 | (pmpNAPOT|pmpR|pmpW)<<8, []uint64{0x2000 >> 2, (0x2000 | 0x7FF) >> 2},
+			0x2000, 4, accessLoad, privilegeUser, false},
+		{"Unlocked entry ignored by M-mode", pmpNA4, []uint64{0x100 >> 2}, 0x100, 4, accessStore, privilegeMachine,
+			true},
+		{"Locked entry enforced on M-mode", pmpNA4 | pmpL | pmpR, []uint64{0x100 >> 2}, 0x100, 4, accessStore,
+			privilegeMachine, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initCPUState(&cpu, 0, 0)
+			cpu.csr[csrPmpcfg0] = test.config
+			for i, address := range test.addresses {
+				cpu.csr[csrPmpaddr0+i] = address
+			}
+
+			if allowed := isPmpAccessAllowed(&cpu, test.address, test.size, test.access, test.privilege); allowed != test.expected {
+				t.Errorf("expected allowed=%v, got %v", test.expected, allowed)
+			}
+		})
+	}
+}
+
+func TestPmpCSRs(t *testing.T) {
+	var cpu CPUState
+
+	initCPUState(&cpu, 0, 0)
+	CSRs[csrPmpaddr0+1].Write(&cpu, 0x400)
+	CSRs[csrPmpcfg0].Write(&cpu, (pmpTOR|pmpL|pmpR)<<8|pmpW|0x60)
+
+	if value := CSRs[csrPmpcfg0].Read(&cpu); value != (pmpTOR|pmpL|pmpR)<<8 {
+		t.Errorf("expected W without R and the reserved bits to be cleared, got pmpcfg0=0x%x", value)
+	}
+	CSRs[csrPmpcfg0].Write(&cpu, 0)
+	CSRs[csrPmpaddr0+1].Write(&cpu, 0x800)
+	CSRs[csrPmpaddr0].Write(&cpu, 0x100)
+	if cpu.csr[csrPmpcfg0] != (pmpTOR|pmpL|pmpR)<<8 || cpu.csr[csrPmpaddr0+1] != 0x400 || cpu.csr[csrPmpaddr0] != 0 {
+		t.Errorf("expected the locked TOR entry and its bottom address to ignore writes, got pmpcfg0=0x%x "+
+			"pmpaddr0=0x%x pmpaddr1=0x%x", cpu.csr[csrPmpcfg0], cpu.csr[csrPmpaddr0], cpu.csr[csrPmpaddr0+1])
+	}
+
+	cpu.xlen = 64
+	if isCSRAccessible(&cpu, csrPmpcfg0+1) {
+		t.Errorf("expected pmpcfg1 to be illegal in RV64")
+	}
+	CSRs[csrPmpcfg0+2].Write(&cpu, uint64(pmpNA4|pmpX)<<32)
+	if pmpConfig(&cpu, 12) != pmpNA4|pmpX {
+		t.Errorf("expected pmpcfg2 to hold entries 8-15 in RV64, got entry 12=0x%x", pmpConfig(&cpu, 12))
+	}
+}
+
+func TestPmpFaults(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initMemory(&memory, 256, 0)
+	initCPUState(&cpu, 0x10, 0)
+	cpu.csr[csrMtvec] = 0x80
+	cpu.privilege = privilegeUser
+	cpu.csr[csrPmpaddr0] = 0x40 >> 2
+	cpu.csr[csrPmpaddr0+1] = (0x80 | 0x3F) >> 2
+	cpu.csr[csrPmpcfg0] = pmpTOR | pmpX | pmpR | (pmpNAPOT|pmpL)<<8 // Code below 0x40, locked data at 0x80-0xFF
+	memory.Store32(0x10, 0x0020A023)                                // SW x2, 0(x1)
+	writeRegister(&cpu, 1, 0x90)
+
+	executeInstruction(&cpu, &memory)
+
+	if cpu.pc != 0x80 || cpu.csr[csrMcause] != causeStoreAccessFault || cpu.csr[csrMtval] != 0x90 {
+		t.Errorf("expected a store access fault at 0x90, got pc=0x%x mcause=%d mtval=0x%x", cpu.pc, cpu.csr[csrMcause],
+			cpu.csr[csrMtval])
+	}
+
+	executeInstruction(&cpu, &memory) // The handler is fetched by M-mode from a locked entry without X
+	if cpu.pc != 0x80 || cpu.csr[csrMcause] != causeInstructionAccessFault {
+		t.Errorf("expected an instruction access fault, got pc=0x%x mcause=%d", cpu.pc, cpu.csr[csrMcause])
+	}
+}
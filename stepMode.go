@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"os"
 )
 
@@ -16,30 +17,24 @@ func executeCommand(cpu *CPUState, memory *Memory, commands []string, startAddre
 		fmt.Sscanf(commands[0], "x/%d", &count)
 		fmt.Sscanf(commands[1], "0x%x", &address)
 		for i := uint32(0); i < count; i++ {
-			fmt.Printf("0x%08x: 0x%08x\n", address+i, readMemory(memory, address+i))
+			fmt.Printf("0x%08x: 0x%08x\n", address+4*i, memory.Load32(address+4*i))
 		}
 	} else {
 		switch commands[0] {
 		case "step":
-			if cpu.pc/4 >= lenMemory(memory) {
-				fmt.Println("PC hors limites mémoire.")
-			} else {
-				instruction := readMemory(memory, cpu.pc/4)
-				opcode, err := GetOpcodeFromInstruction(instruction)
+			handleInterrupts(cpu, memory)
+			rtnString, err := executeInstruction(cpu, memory)
 
-				if err == nil {
-					rtnString := opcode.Encoding.Decode(opcode, instruction, cpu, memory)
-					logDebug("EXEC", rtnString)
-				} else {
-					fmt.Println("Erreur lors de l'exécution de l'instruction :", err)
-				}
-				cpu.pc += 4
+			if err == nil {
+				logDebug("EXEC", rtnString)
+			} else {
+				fmt.Println("Erreur lors de l'exécution de l'instruction :", err)
 			}
 		case "continue":
 			stepMode = false
 			fmt.Println("Sortie du mode pas à pas.")
 		case "reset":
-			initCPUState(cpu, startAddress, defaultRegisterValue)
+			resetCPU(cpu, startAddress, defaultRegisterValue)
 			fmt.Println("CPU reset avec PC =", startAddress, "et registre par défaut =", defaultRegisterValue)
 		case "exit":
 			os.Exit(0)
@@ -52,23 +47,28 @@ func executeCommand(cpu *CPUState, memory *Memory, commands []string, startAddre
 func handleStepMode(cpu *CPUState, memory *Memory, startAddress uint32, defaultRegisterValue uint32) {
 	for stepMode {
 		// Affiche l'état des registres
-		fmt.Printf("PC: 0x%08x\n", cpu.pc)
+		if name := symbolize(cpu.pc); name != "" {
+			fmt.Printf("PC: 0x%0*x <%s>\n", cpu.xlen/4, cpu.pc, name)
+		} else {
+			fmt.Printf("PC: 0x%0*x\n", cpu.xlen/4, cpu.pc)
+		}
+		fmt.Printf("Mode: %c\n", "US?M"[cpu.privilege])
+		for i := 0; i < registerCount(cpu); i++ {
+			fmt.Printf("x%d: 0x%0*x\n", i, cpu.xlen/4, readUnsignedRegister(cpu, uint32(i)))
+		}
 		for i := 0; i < 32; i++ {
-			fmt.Printf("x%d: 0x%08x\n", i, cpu.x[i])
+			if cpu.f[i]>>32 == 0xFFFFFFFF { // Valeur simple précision (NaN-boxée)
+				fmt.Printf("f%d: 0x%016x (%g)\n", i, cpu.f[i], math.Float32frombits(readFloatRegister32(cpu, uint32(i))))
+			} else {
+				fmt.Printf("f%d: 0x%016x (%g)\n", i, cpu.f[i], math.Float64frombits(readFloatRegister64(cpu, uint32(i))))
+			}
 		}
 
 		// Affiche l'instruction
-		if cpu.pc/4 < uint32(lenMemory(memory)) {
-			instruction := readMemory(memory, cpu.pc/4)
-			opcode, err := GetOpcodeFromInstruction(instruction)
-			if err == nil {
-				rtnString := opcode.Encoding.Decode(opcode, instruction, cpu, memory)
-				logDebug("DISAS", "%s", rtnString)
-			} else {
-				//logDebug("DISAS", "%08x: %s\n", cpu.pc, err.Error())
-			}
+		if rtnString, err := disassembleInstruction(cpu, memory); err == nil {
+			logDebug("DISAS", "%s: %s", formatAddress(cpu.pc), rtnString)
 		} else {
-			fmt.Println("Instruction hors mémoire.")
+			fmt.Println("Instruction non décodable :", err)
 		}
 
 		// Attend la commande suivante
@@ -0,0 +1,277 @@
+package main
+
+import "fmt"
+
+// Exception codes (mcause values with the interrupt bit clear)
+const (
+	causeInstructionAddressMisaligned = 0
+	causeInstructionAccessFault       = 1
+	causeIllegalInstruction           = 2
+	causeBreakpoint                   = 3
+	causeLoadAddressMisaligned        = 4
+	causeLoadAccessFault              = 5
+	causeStoreAddressMisaligned       = 6 // Also used by AMOs and SC
+	causeStoreAccessFault             = 7 // Also used by AMOs and SC
+	causeEnvironmentCallFromUMode     = 8
+	causeEnvironmentCallFromSMode     = 9
+	causeEnvironmentCallFromMMode     = 11
+	causeInstructionPageFault         = 12
+	causeLoadPageFault                = 13
+	causeStorePageFault               = 15 // Also used by AMOs and SC
+)
+
+// Privilege modes, encoded as in mstatus.MPP
+const (
+	privilegeUser       = 0
+	privilegeSupervisor = 1
+	privilegeMachine    = 3
+)
+
+// Interrupt flag of the causes given to takeTrap, set when the trap is an interrupt instead of an exception.
+// It is stored in the most significant bit of mcause, bit 31 or 63 depending on XLEN.
+const causeInterrupt = 1 << 63
+
+// Memory access types, they select the exception raised by checkAccess
+const (
+	accessFetch = iota
+	accessLoad
+	accessStore
+)
+
+// raiseException traps on the instruction being executed, tval holds the faulting address or instruction bits.
+func raiseException(cpu *CPUState, cause uint64, tval uint64) {
+	pc := cpu.pc
+	cpu.trapped = true
+	takeTrap(cpu, cause, tval)
+	logDebug("TRAP", "exception %d at %s (tval 0x%08x)\n", cause, formatAddress(pc), tval)
+}
+
+// isTrapDelegated reports whether a trap is handled in S-mode: the bit of its cause must be set in medeleg for
+// exceptions or in mideleg for interrupts, and traps are never delegated away from M-mode.
+func isTrapDelegated(cpu *CPUState, cause uint64) bool {
+	code := cause &^ causeInterrupt
+	if cpu.privilege == privilegeMachine || code >= 64 {
+		return false
+	}
+	if cause&causeInterrupt != 0 {
+		return cpu.csr[csrMideleg]>>code&1 != 0
+	}
+	return cpu.csr[csrMedeleg]>>code&1 != 0
+}
+
+// trapVector returns the handler address selected by an xtvec register. In vectored mode, interrupts jump to
+// BASE + 4 * cause while exceptions still use BASE.
+func trapVector(tvec uint64, cause uint64) uint64 {
+	target := tvec &^ 0b11
+	if tvec&0b11 == 1 && cause&causeInterrupt != 0 {
+		target += 4 * (cause &^ causeInterrupt)
+	}
+	return target
+}
+
+// takeTrap enters the trap handler of M-mode, or of S-mode when the trap is delegated: the pc, the cause and the
+// trap value are saved in xepc, xcause and xtval, interrupts of that mode are disabled, the previous privilege mode
+// is saved in xPP and execution continues at xtvec.
+func takeTrap(cpu *CPUState, cause uint64, tval uint64) {
+	xcause := cause
+	if cause&causeInterrupt != 0 {
+		xcause = cause&^causeInterrupt | 1<<(cpu.xlen-1)
+	}
+	tval &= xlenMask(cpu)
+
+	if isTrapDelegated(cpu, cause) {
+		cpu.csr[csrSepc] = cpu.pc
+		cpu.csr[csrScause] = xcause
+		cpu.csr[csrStval] = tval
+
+		// SPIE = SIE, SIE = 0, SPP = previous mode (U or S)
+		mstatus := cpu.csr[csrMstatus] &^ (mstatusSIE | mstatusSPIE | mstatusSPP)
+		if cpu.csr[csrMstatus]&mstatusSIE != 0 {
+			mstatus |= mstatusSPIE
+		}
+		if cpu.privilege == privilegeSupervisor {
+			mstatus |= mstatusSPP
+		}
+		cpu.csr[csrMstatus] = mstatus
+		cpu.privilege = privilegeSupervisor
+		jumpTo(cpu, trapVector(cpu.csr[csrStvec], cause))
+		return
+	}
+
+	cpu.csr[csrMepc] = cpu.pc
+	cpu.csr[csrMcause] = xcause
+	cpu.csr[csrMtval] = tval
+
+	// MPIE = MIE, MIE = 0, MPP = previous mode
+	mstatus := cpu.csr[csrMstatus] &^ (mstatusMIE | mstatusMPIE | mstatusMPP)
+	if cpu.csr[csrMstatus]&mstatusMIE != 0 {
+		mstatus |= mstatusMPIE
+	}
+	cpu.csr[csrMstatus] = mstatus | cpu.privilege<<mstatusMPPShift
+	cpu.privilege = privilegeMachine
+	jumpTo(cpu, trapVector(cpu.csr[csrMtvec], cause))
+}
+
+// returnFromTrap implements MRET: execution resumes at mepc in the mode saved in MPP, the interrupt enable saved
+// in MPIE is restored and MPP is set to U, the least privileged mode. Leaving M-mode clears MPRV.
+func returnFromTrap(cpu *CPUState) {
+	mstatus := cpu.csr[csrMstatus] &^ (mstatusMIE | mstatusMPP)
+	if mstatus&mstatusMPIE != 0 {
+		mstatus |= mstatusMIE
+	}
+	cpu.privilege = (cpu.csr[csrMstatus] & mstatusMPP) >> mstatusMPPShift
+	if cpu.privilege != privilegeMachine {
+		mstatus &^= mstatusMPRV
+	}
+	cpu.csr[csrMstatus] = mstatus | mstatusMPIE
+	jumpTo(cpu, exceptionPC(cpu, csrMepc))
+}
+
+// returnFromSupervisorTrap implements SRET: execution resumes at sepc in the mode saved in SPP, the interrupt
+// enable saved in SPIE is restored, SPP is set to U and MPRV is cleared.
+func returnFromSupervisorTrap(cpu *CPUState) {
+	mstatus := cpu.csr[csrMstatus] &^ (mstatusSIE | mstatusSPP | mstatusMPRV)
+	if mstatus&mstatusSPIE != 0 {
+		mstatus |= mstatusSIE
+	}
+	cpu.privilege = privilegeUser
+	if cpu.csr[csrMstatus]&mstatusSPP != 0 {
+		cpu.privilege = privilegeSupervisor
+	}
+	cpu.csr[csrMstatus] = mstatus | mstatusSPIE
+	jumpTo(cpu, exceptionPC(cpu, csrSepc))
+}
+
+// Interrupts by decreasing priority
+var interruptPriority = []uint64{11, 3, 7, 9, 1, 5} // MEI, MSI, MTI, SEI, SSI, STI
+
+// pendingInterrupt returns the interrupt to take before the next instruction: it must be pending in mip, enabled
+// in mie, and the mode that handles it must accept it. Interrupts handled by M-mode are always taken in the less
+// privileged modes and need mstatus.MIE in M-mode; interrupts delegated to S-mode by mideleg are never taken in
+// M-mode, always in U-mode and need mstatus.SIE in S-mode.
+func pendingInterrupt(cpu *CPUState) (uint64, bool) {
+	pending := cpu.csr[csrMip] & cpu.csr[csrMie]
+	mstatus := cpu.csr[csrMstatus]
+	machineEnabled := cpu.privilege < privilegeMachine || mstatus&mstatusMIE != 0
+	supervisorEnabled := cpu.privilege < privilegeSupervisor ||
+		(cpu.privilege == privilegeSupervisor && mstatus&mstatusSIE != 0)
+
+	for _, code := range interruptPriority {
+		if pending&(1<<code) == 0 {
+			continue
+		}
+		if cpu.csr[csrMideleg]&(1<<code) == 0 && machineEnabled {
+			return code, true
+		}
+		if cpu.csr[csrMideleg]&(1<<code) != 0 && supervisorEnabled {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// handleInterrupts is called between two instructions: it samples the interrupt sources and traps to the handler
+// of the highest priority interrupt that can be taken. mepc (or sepc) points to the next instruction to execute.
+func handleInterrupts(cpu *CPUState, memory *Memory) {
+	if memory.clint != nil {
+		updateCLINTInterrupts(cpu, memory.clint)
+	}
+	if memory.plic != nil {
+		updatePLICInterrupts(cpu, memory.plic)
+	}
+	if code, ok := pendingInterrupt(cpu); ok {
+		logDebug("TRAP", "interrupt %d at %s\n", code, formatAddress(cpu.pc))
+		takeTrap(cpu, causeInterrupt|code, 0)
+	}
+}
+
+// unhandledTrap reports whether the last instruction trapped while no handler is installed: the xtvec register of
+// the mode taking the trap still holds its reset value 0, so the hart would restart the program from address 0.
+// It returns the diagnostic to print and the exit status. An environment call is then a request to exit, as with
+// semihosting, and the exit status is the low byte of a0.
+func unhandledTrap(cpu *CPUState) (string, int, bool) {
+	if !cpu.trapped {
+		return "", 0, false
+	}
+	tvec, cause, epc, tval := cpu.csr[csrMtvec], cpu.csr[csrMcause], cpu.csr[csrMepc], cpu.csr[csrMtval]
+	if cpu.privilege == privilegeSupervisor {
+		tvec, cause, epc, tval = cpu.csr[csrStvec], cpu.csr[csrScause], cpu.csr[csrSepc], cpu.csr[csrStval]
+	}
+	if tvec&^0b11 != 0 {
+		return "", 0, false
+	}
+	if cause >= causeEnvironmentCallFromUMode && cause <= causeEnvironmentCallFromMMode {
+		status := readRegister(cpu, 10)
+		return fmt.Sprintf("Program exited with ECALL at %s, a0 = %d", formatAddress(epc), int64(status)), int(status & 0xFF), true
+	}
+	return fmt.Sprintf("Exception %d at %s (tval 0x%08x) with no trap handler installed", cause, formatAddress(epc), tval), 1, true
+}
+
+// checkAccess validates a memory access of size bytes before it is performed, translates its virtual address
+// through the MMU and returns the physical address to access once PMP allows it. It raises the matching misaligned,
+// page-fault or access-fault exception when the access cannot be performed: instructions must then stop without
+// side effects.
+// Aligned accesses never cross a page, so the whole access uses the translation of its first byte.
+func checkAccess(cpu *CPUState, memory *Memory, address uint64, size uint32, access int) (uint32, bool) {
+	misaligned := []uint64{causeInstructionAddressMisaligned, causeLoadAddressMisaligned, causeStoreAddressMisaligned}
+
+	alignment := uint64(size)
+	if access == accessFetch {
+		alignment = 2 // Instructions are fetched as 16-bit parcels, jumps enforce IALIGN (see checkJumpTarget)
+	}
+	if address%alignment != 0 {
+		raiseException(cpu, misaligned[access], address)
+		return 0, false
+	}
+	physical, ok := translateAddress(cpu, memory, address, access)
+	if !ok {
+		return 0, false
+	}
+	if !isPhysicalAccessValid(memory, physical, size, access) ||
+		!isPmpAccessAllowed(cpu, physical, size, access, effectivePrivilege(cpu, access)) {
+		raiseException(cpu, accessFaultCause[access], address)
+		return 0, false
+	}
+	return uint32(physical), true
+}
+
+// instructionAlignment returns IALIGN in bytes: 2 with the C extension, 4 without it.
+func instructionAlignment(cpu *CPUState) uint64 {
+	if cpu.extensions["c"] {
+		return 2
+	}
+	return 4
+}
+
+// checkJumpTarget reports whether a jump or a taken branch can go to address. A target that is not IALIGN-aligned
+// raises the instruction-address-misaligned exception on the jump itself, which then does not write rd.
+func checkJumpTarget(cpu *CPUState, address uint64) bool {
+	address &= xlenMask(cpu)
+	if address%instructionAlignment(cpu) != 0 {
+		raiseException(cpu, causeInstructionAddressMisaligned, address)
+		return false
+	}
+	return true
+}
+
+// exceptionPC returns mepc or sepc as read by software and by xRET: bit 1 reads as zero when IALIGN = 32.
+func exceptionPC(cpu *CPUState, address uint32) uint64 {
+	return cpu.csr[address] &^ (instructionAlignment(cpu) - 1)
+}
+
+// Access-fault exception of each access type
+var accessFaultCause = []uint64{causeInstructionAccessFault, causeLoadAccessFault, causeStoreAccessFault}
+
+// isPhysicalAccessValid reports whether the size bytes at a physical address are mapped by a single region of the
+// bus, stores are refused by read-only regions. It has no side effect: a paged RAM only allocates its pages when
+// the access is performed.
+func isPhysicalAccessValid(memory *Memory, address uint64, size uint32, access int) bool {
+	region := memory.region(address, uint64(size))
+	if region == nil || (access == accessStore && region.readOnly) {
+		return false
+	}
+	if paged, ok := region.device.(pagedDevice); ok {
+		return paged.Accepts(uint32(address-uint64(region.base)), uint64(size), access)
+	}
+	return true
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTraps(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+	var memorySize uint32 = 256 // bytes
+	var trapVector uint64 = 0x80
+
+	tests := []struct {
+		name          string
+		pc            uint32
+		instruction   uint32
+		defaultRegs   map[uint32]uint32
+		expectedCause uint64
+		expectedTval  uint64
+	}{
+		{
+			name:          "ECALL",
+			pc:            0x10,
+			instruction:   0x00000073, // ECALL
+			expectedCause: causeEnvironmentCallFromMMode,
+			expectedTval:  0,
+		},
+		{
+			name:          "EBREAK",
+			pc:            0x10,
+			instruction:   0x00100073, // EBREAK
+			expectedCause: causeBreakpoint,
+			expectedTval:  0x10,
+		},
+		{
+			name:          "Illegal opcode",
+			pc:            0x10,
+			instruction:   0xFFFFFFFF,
+			expectedCause: causeIllegalInstruction,
+			expectedTval:  0xFFFFFFFF,
+		},
+		{
+			name:          "Illegal compressed instruction",
+			pc:            0x10,
+			instruction:   0x00000000,
+			expectedCause: causeIllegalInstruction,
+			expectedTval:  0,
+		},
+		{
+			name:          "Unimplemented CSR",
+			pc:            0x10,
+			instruction:   0x7C0020F3, // CSRRS x1, 0x7c0, x0
+			expectedCause: causeIllegalInstruction,
+			expectedTval:  0x7C0020F3,
+		},
+		{
+			name:          "Instruction access fault",
+			pc:            0x1000,
+			expectedCause: causeInstructionAccessFault,
+			expectedTval:  0x1000,
+		},
+		{
+			name:          "Load access fault",
+			pc:            0x10,
+			instruction:   0x00012083, // LW x1, 0(x2)
+			defaultRegs:   map[uint32]uint32{1: 0xAA, 2: 0x2000},
+			expectedCause: causeLoadAccessFault,
+			expectedTval:  0x2000,
+		},
+		{
+			name:          "Load address misaligned",
+			pc:            0x10,
+			instruction:   0x00011083, // LH x1, 0(x2)
+			defaultRegs:   map[uint32]uint32{1: 0xAA, 2: 0x21},
+			expectedCause: causeLoadAddressMisaligned,
+			expectedTval:  0x21,
+		},
+		{
+			name:          "Store access fault",
+			pc:            0x10,
+			instruction:   0x00112023, // SW x1, 0(x2)
+			defaultRegs:   map[uint32]uint32{2: 0x2000},
+			expectedCause: causeStoreAccessFault,
+			expectedTval:  0x2000,
+		},
+		{
+			name:          "Store address misaligned",
+			pc:            0x10,
+			instruction:   0x00112023, // SW x1, 0(x2)
+			defaultRegs:   map[uint32]uint32{2: 0x22},
+			expectedCause: causeStoreAddressMisaligned,
+			expectedTval:  0x22,
+		},
+		{
+			name:          "AMO address misaligned",
+			pc:            0x10,
+			instruction:   0x003120AF, // AMOADD.W x1, x3, (x2)
+			defaultRegs:   map[uint32]uint32{1: 0xAA, 2: 0x22},
+			expectedCause: causeStoreAddressMisaligned,
+			expectedTval:  0x22,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initMemory(&memory, memorySize, 0)
+			initCPUState(&cpu, test.pc, 0)
+			cpu.csr[csrMtvec] = trapVector
+			cpu.csr[csrMstatus] = mstatusMIE
+
+			for reg, value := range test.defaultRegs {
+				writeRegister(&cpu, reg, uint64(value))
+			}
+			if test.pc+4 <= memorySize {
+				memory.Store32(test.pc, test.instruction)
+			}
+
+			executeInstruction(&cpu, &memory)
+
+			if cpu.pc != trapVector {
+				t.Errorf("expected pc=0x%x, got pc=0x%x", trapVector, cpu.pc)
+			}
+			if cpu.csr[csrMcause] != test.expectedCause {
+				t.Errorf("expected mcause=%d, got mcause=%d", test.expectedCause, cpu.csr[csrMcause])
+			}
+			if cpu.csr[csrMepc] != uint64(test.pc) {
+				t.Errorf("expected mepc=0x%x, got mepc=0x%x", test.pc, cpu.csr[csrMepc])
+			}
+			if cpu.csr[csrMtval] != test.expectedTval {
+				t.Errorf("expected mtval=0x%x, got mtval=0x%x", test.expectedTval, cpu.csr[csrMtval])
+			}
+			if cpu.csr[csrMstatus] != mstatusMPIE|mstatusMPP {
+				t.Errorf("expected mstatus.MPIE=1, mstatus.MIE=0 and mstatus.MPP=M, got mstatus=0x%x", cpu.csr[csrMstatus])
+			}
+			// The trapping instruction must not have written its destination register
+			if expected, found := test.defaultRegs[1]; found && uint32(cpu.x[1]) != expected {
+				t.Errorf("expected x1=0x%x to be preserved, got x1=0x%x", expected, cpu.x[1])
+			}
+		})
+	}
+}
+
+func TestMRET(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initMemory(&memory, 256, 0)
+	initCPUState(&cpu, 0x80, 0)
+	memory.Store32(0x80, 0x30200073) // MRET
+	cpu.csr[csrMepc] = 0x14
+	cpu.csr[csrMstatus] = mstatusMPIE
+
+	executeInstruction(&cpu, &memory)
+
+	if cpu.pc != 0x14 {
+		t.Errorf("expected pc=0x14, got pc=0x%x", cpu.pc)
+	}
+	if cpu.csr[csrMstatus] != mstatusMIE|mstatusMPIE {
+		t.Errorf("expected mstatus.MIE=1 and mstatus.MPIE=1, got mstatus=0x%x", cpu.csr[csrMstatus])
+	}
+}
+
+func TestTrapVectorModes(t *testing.T) {
+	var cpu CPUState
+
+	tests := []struct {
+		name     string
+		mtvec    uint64
+		cause    uint64
+		expected uint64
+	}{
+		{"Direct exception", 0x100, causeIllegalInstruction, 0x100},
+		{"Direct interrupt", 0x100, causeInterrupt | 7, 0x100},
+		{"Vectored exception", 0x101, causeIllegalInstruction, 0x100},
+		{"Vectored interrupt", 0x101, causeInterrupt | 7, 0x11C},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initCPUState(&cpu, 0x40, 0)
+			cpu.csr[csrMtvec] = test.mtvec
+
+			takeTrap(&cpu, test.cause, 0)
+
+			if cpu.pc != test.expected {
+				t.Errorf("expected pc=0x%x, got pc=0x%x", test.expected, cpu.pc)
+			}
+		})
+	}
+}
+
+func TestPrivilegeModes(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	tests := []struct {
+		name              string
+		privilege         uint64
+		instruction       uint32
+		mstatus           uint64
+		medeleg           uint64
+		expectedPrivilege uint64
+		expectedPc        uint64
+		expectedMcause    uint64
+		expectedScause    uint64
+	}{
+		{"ECALL from U-mode", privilegeUser, 0x00000073, 0, 0, privilegeMachine, 0x80, causeEnvironmentCallFromUMode, 0},
+		{"ECALL from U-mode delegated", privilegeUser, 0x00000073, 0, 1 << causeEnvironmentCallFromUMode,
+			privilegeSupervisor, 0xC0, 0, causeEnvironmentCallFromUMode},
+		{"ECALL from S-mode", privilegeSupervisor, 0x00000073, 0, 1 << causeEnvironmentCallFromUMode,
+			privilegeMachine, 0x80, causeEnvironmentCallFromSMode, 0},
+		{"ECALL from M-mode is never delegated", privilegeMachine, 0x00000073, 0, 0xFFFF, privilegeMachine, 0x80,
+			causeEnvironmentCallFromMMode, 0},
+		{"MRET from S-mode", privilegeSupervisor, 0x30200073, 0, 0, privilegeMachine, 0x80, causeIllegalInstruction, 0},
+		{"MRET to S-mode", privilegeMachine, 0x30200073, 1 << mstatusMPPShift, 0, privilegeSupervisor, 0x40, 0, 0},
+		{"SRET to U-mode", privilegeSupervisor, 0x10200073, 0, 0, privilegeUser, 0x60, 0, 0},
+		{"SRET to S-mode", privilegeMachine, 0x10200073, mstatusSPP, 0, privilegeSupervisor, 0x60, 0, 0},
+		{"SRET from U-mode", privilegeUser, 0x10200073, 0, 0, privilegeMachine, 0x80, causeIllegalInstruction, 0},
+		{"SRET with TSR", privilegeSupervisor, 0x10200073, mstatusTSR, 0, privilegeMachine, 0x80,
+			causeIllegalInstruction, 0},
+		{"WFI in S-mode", privilegeSupervisor, 0x10500073, 0, 0, privilegeSupervisor, 0x14, 0, 0},
+		{"WFI in S-mode with TW", privilegeSupervisor, 0x10500073, mstatusTW, 0, privilegeMachine, 0x80,
+			causeIllegalInstruction, 0},
+		{"WFI in U-mode", privilegeUser, 0x10500073, 0, 0, privilegeMachine, 0x80, causeIllegalInstruction, 0},
+		{"ECALL with rd = x1", privilegeMachine, 0x000000F3, 0, 0, privilegeMachine, 0x80, causeIllegalInstruction, 0},
+		{"EBREAK with rs1 = x1", privilegeMachine, 0x00108073, 0, 0, privilegeMachine, 0x80, causeIllegalInstruction, 0},
+		{"MRET with rs1 = x1", privilegeMachine, 0x30208073, 0, 0, privilegeMachine, 0x80, causeIllegalInstruction, 0},
+		{"SRET with rd = x1", privilegeMachine, 0x102000F3, 0, 0, privilegeMachine, 0x80, causeIllegalInstruction, 0},
+		{"WFI with rd = x1", privilegeMachine, 0x105000F3, 0, 0, privilegeMachine, 0x80, causeIllegalInstruction, 0},
+		{"SFENCE.VMA with rd = x1", privilegeMachine, 0x120000F3, 0, 0, privilegeMachine, 0x80,
+			causeIllegalInstruction, 0},
+		{"SFENCE.VMA x1, x2", privilegeMachine, 0x12208073, 0, 0, privilegeMachine, 0x14, 0, 0},
+		{"CSRRS mstatus from S-mode", privilegeSupervisor, 0x300020F3, 0, 0, privilegeMachine, 0x80,
+			causeIllegalInstruction, 0},
+		{"CSRRS sstatus from S-mode", privilegeSupervisor, 0x100020F3, 0, 0, privilegeSupervisor, 0x14, 0, 0},
+		{"CSRRS sstatus from U-mode delegated", privilegeUser, 0x100020F3, 0, 1 << causeIllegalInstruction,
+			privilegeSupervisor, 0xC0, 0, causeIllegalInstruction},
+		{"rdcycle from U-mode without mcounteren", privilegeUser, 0xC00020F3, 0, 0, privilegeMachine, 0x80,
+			causeIllegalInstruction, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initMemory(&memory, 256, 0)
+			initCPUState(&cpu, 0x10, 0)
+			memory.Store32(0x10, test.instruction)
+			cpu.privilege = test.privilege
+			cpu.csr[csrMstatus] = test.mstatus
+			cpu.csr[csrMedeleg] = test.medeleg
+			cpu.csr[csrMtvec] = 0x80
+			cpu.csr[csrStvec] = 0xC0
+			cpu.csr[csrMepc] = 0x40
+			cpu.csr[csrSepc] = 0x60
+
+			executeInstruction(&cpu, &memory)
+
+			if cpu.privilege != test.expectedPrivilege {
+				t.Errorf("expected privilege %d, got %d", test.expectedPrivilege, cpu.privilege)
+			}
+			if cpu.pc != test.expectedPc {
+				t.Errorf("expected pc=0x%x, got pc=0x%x", test.expectedPc, cpu.pc)
+			}
+			if test.expectedMcause != 0 && cpu.csr[csrMcause] != test.expectedMcause {
+				t.Errorf("expected mcause=%d, got mcause=%d", test.expectedMcause, cpu.csr[csrMcause])
+			}
+			if test.expectedScause != 0 && cpu.csr[csrScause] != test.expectedScause {
+				t.Errorf("expected scause=%d, got scause=%d", test.expectedScause, cpu.csr[csrScause])
+			}
+		})
+	}
+}
+
+func TestInstructionAlignment(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	tests := []struct {
+		name         string
+		compressed   bool
+		instruction  uint32
+		x2           uint64
+		mepc         uint64
+		expectedPc   uint64
+		expectedTrap bool
+		rd           uint32
+		expectedRd   uint64
+	}{
+		{"JAL to a halfword with C", true, assembleJ(1, 6), 0, 0, 0x16, false, 1, 0x14},
+		{"JAL to a halfword without C", false, assembleJ(1, 6), 0, 0, 0x80, true, 1, 0},
+		{"JALR to a halfword without C", false, assembleI(0b1100111, 1, 0, 2, 2), 0x100, 0, 0x80, true, 1, 0},
+		{"JALR clears bit 0 without C", false, assembleI(0b1100111, 1, 0, 2, 1), 0x100, 0, 0x100, false, 1, 0x14},
+		{"Taken branch to a halfword without C", false, assembleB(0b000, 0, 0, 6), 0, 0, 0x80, true, 0, 0},
+		{"Branch not taken to a halfword without C", false, assembleB(0b001, 0, 0, 6), 0, 0, 0x14, false, 0, 0},
+		{"MRET to a halfword with C", true, 0x30200073, 0, 0x102, 0x102, false, 0, 0},
+		{"MRET ignores mepc[1] without C", false, 0x30200073, 0, 0x102, 0x100, false, 0, 0},
+		{"mepc[1] reads as zero without C", false, 0x341021F3, 0, 0x102, 0x14, false, 3, 0x100}, // CSRRS x3, mepc, x0
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initMemory(&memory, 256, 0)
+			initCPUState(&cpu, 0x10, 0)
+			cpu.extensions = supportedExtensions()
+			cpu.extensions["c"] = test.compressed
+			cpu.csr[csrMtvec] = 0x80
+			cpu.csr[csrMepc] = test.mepc
+			cpu.csr[csrMstatus] = privilegeMachine << mstatusMPPShift
+			writeRegister(&cpu, 2, test.x2)
+			memory.Store32(0x10, test.instruction)
+
+			executeInstruction(&cpu, &memory)
+
+			if cpu.pc != test.expectedPc {
+				t.Errorf("expected pc=0x%x, got pc=0x%x", test.expectedPc, cpu.pc)
+			}
+			if test.expectedTrap && (cpu.csr[csrMcause] != causeInstructionAddressMisaligned || cpu.csr[csrMepc] != 0x10) {
+				t.Errorf("expected a misaligned jump at 0x10, got mcause=%d mepc=0x%x", cpu.csr[csrMcause], cpu.csr[csrMepc])
+			}
+			if test.rd != 0 && cpu.x[test.rd] != test.expectedRd {
+				t.Errorf("expected x%d=0x%x, got 0x%x", test.rd, test.expectedRd, cpu.x[test.rd])
+			}
+		})
+	}
+}
+
+func TestSupervisorTrap(t *testing.T) {
+	var cpu CPUState
+
+	initCPUState(&cpu, 0x40, 0)
+	cpu.privilege = privilegeSupervisor
+	cpu.csr[csrMstatus] = mstatusSIE
+	cpu.csr[csrMideleg] = mipSTIP
+	cpu.csr[csrStvec] = 0x101
+
+	takeTrap(&cpu, causeInterrupt|5, 0)
+
+	if cpu.pc != 0x114 || cpu.privilege != privilegeSupervisor {
+		t.Errorf("expected the vectored S-mode handler at 0x114, got pc=0x%x in mode %d", cpu.pc, cpu.privilege)
+	}
+	if cpu.csr[csrSepc] != 0x40 || cpu.csr[csrScause] != 1<<31|5 {
+		t.Errorf("expected sepc=0x40 and scause=0x80000005, got sepc=0x%x scause=0x%x", cpu.csr[csrSepc], cpu.csr[csrScause])
+	}
+	if cpu.csr[csrMstatus] != mstatusSPIE|mstatusSPP {
+		t.Errorf("expected mstatus.SPIE=1, mstatus.SIE=0 and mstatus.SPP=S, got mstatus=0x%x", cpu.csr[csrMstatus])
+	}
+}
+
+func TestUnhandledTrap(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	tests := []struct {
+		name           string
+		instruction    uint32
+		mtvec          uint64
+		a0             uint64
+		expectedStop   bool
+		expectedStatus int
+	}{
+		{"ECALL without a handler exits with a0", 0x00000073, 0, 3, true, 3},
+		{"ECALL exit status is the low byte of a0", 0x00000073, 0, 0x102, true, 2},
+		{"Zero word without a handler", 0x00000000, 0, 0, true, 1},
+		{"Vectored mtvec at address 0", 0x00000000, 1, 0, true, 1},
+		{"ECALL with a handler", 0x00000073, 0x40, 3, false, 0},
+		{"Illegal instruction with a handler", 0x00000000, 0x40, 0, false, 0},
+		{"EBREAK without a handler", 0x00100073, 0, 0, true, 1},
+		{"No trap", 0x00100093, 0, 0, false, 0}, // ADDI x1, x0, 1
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initMemory(&memory, 256, 0)
+			initCPUState(&cpu, 0x10, 0)
+			cpu.csr[csrMtvec] = test.mtvec
+			memory.Store32(0x10, test.instruction)
+			writeRegister(&cpu, 10, test.a0)
+
+			executeInstruction(&cpu, &memory)
+
+			message, status, stop := unhandledTrap(&cpu)
+			if stop != test.expectedStop || status != test.expectedStatus {
+				t.Errorf("expected stop=%v with status %d, got stop=%v with status %d (%s)", test.expectedStop, test.expectedStatus, stop, status, message)
+			}
+		})
+	}
+
+	// A trap delegated to S-mode uses stvec
+	initMemory(&memory, 256, 0)
+	initCPUState(&cpu, 0x10, 0)
+	cpu.privilege = privilegeUser
+	cpu.csr[csrMtvec] = 0x40
+	cpu.csr[csrMedeleg] = 1 << causeIllegalInstruction
+	executeInstruction(&cpu, &memory)
+	if _, _, stop := unhandledTrap(&cpu); !stop {
+		t.Errorf("expected a trap delegated to S-mode with stvec=0 to stop the program")
+	}
+
+	// A breakpoint delegated to S-mode reaches stvec even when mtvec is 0, without dropping into the debugger
+	defer func() { stepMode = false }()
+	stepMode = false
+	initMemory(&memory, 256, 0)
+	initCPUState(&cpu, 0x10, 0)
+	memory.Store32(0x10, 0x00100073) // EBREAK
+	cpu.privilege = privilegeUser
+	cpu.csr[csrStvec] = 0x40
+	cpu.csr[csrMedeleg] = 1 << causeBreakpoint
+	executeInstruction(&cpu, &memory)
+	if cpu.pc != 0x40 || cpu.csr[csrScause] != causeBreakpoint || stepMode {
+		t.Errorf("expected the breakpoint at stvec, got pc=0x%x scause=%d step mode=%v", cpu.pc, cpu.csr[csrScause], stepMode)
+	}
+
+	// Without a handler, the breakpoint is reported and drops into the debugger
+	initMemory(&memory, 256, 0)
+	initCPUState(&cpu, 0x10, 0)
+	memory.Store32(0x10, 0x00100073) // EBREAK
+	cpu.csr[csrStvec] = 0x40
+	executeInstruction(&cpu, &memory)
+	if _, _, stop := unhandledTrap(&cpu); !stop || !stepMode || cpu.csr[csrMcause] != causeBreakpoint {
+		t.Errorf("expected an unhandled breakpoint in step mode, got stop=%v step mode=%v mcause=%d", stop, stepMode, cpu.csr[csrMcause])
+	}
+}
@@ -0,0 +1,1177 @@
+package main
+
+import (
+	"fmt"
+	mathbits "math/bits" // bits is the field extractor of compressed.go
+)
+
+// Width of the vector registers in bits, selected at launch with --vlen. ELEN, the widest element, is 64 bits.
+var vlen uint32 = 128
+
+// vtype fields, vill is the most significant bit
+const (
+	vtypeVlmul = 0b111
+	vtypeVsew  = 0b111 << 3
+	vtypeVta   = 1 << 6 // Tail agnostic, the tail is left undisturbed in both cases
+	vtypeVma   = 1 << 7 // Mask agnostic, the inactive elements are left undisturbed in both cases
+)
+
+// funct3 of the OP-V instructions: the operand categories
+const (
+	vectorOPIVV = 0b000
+	vectorOPMVV = 0b010
+	vectorOPIVI = 0b011
+	vectorOPIVX = 0b100
+	vectorOPMVX = 0b110
+	vectorOPCFG = 0b111
+)
+
+// Operand forms of an operation: vs1, x[rs1] or a 5-bit immediate
+const (
+	vectorVV = 1 << iota
+	vectorVX
+	vectorVI
+)
+
+// Addressing modes of the vector loads and stores (mop), and the unit-stride variants selected by lumop/sumop
+const (
+	vectorUnitStride = 0b00
+	vectorStrided    = 0b10
+	vectorMaskAccess = 0b01011
+)
+
+// vectorInstruction wraps the implementation of a V instruction: they are illegal while mstatus.VS is Off, and
+// they mark the vector state dirty.
+func vectorInstruction(name string, exec func(cpu *CPUState, memory *Memory, args ...uint32)) Instruction {
+	return Instruction{
+		name,
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			if cpu.csr[csrMstatus]&mstatusVS == 0 {
+				raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+				return
+			}
+			exec(cpu, memory, args...)
+			cpu.csr[csrMstatus] |= mstatusVSDirty
+		},
+	}
+}
+
+// isVectorWidth reports whether the width field (funct3) of a LOAD-FP or STORE-FP instruction selects a vector
+// access: 8, 16, 32 or 64-bit elements. The other values are the scalar floating-point loads and stores.
+func isVectorWidth(funct3 uint32) bool {
+	return funct3 == 0b000 || funct3 >= 0b101
+}
+
+// vectorWidth returns the element width in bits encoded in the width field of a vector load or store.
+func vectorWidth(funct3 uint32) uint32 {
+	if funct3 == 0b000 {
+		return 8
+	}
+	return 8 << (funct3 - 0b100)
+}
+
+// vectorSEW returns the selected element width in bits.
+func vectorSEW(cpu *CPUState) uint32 {
+	return 8 << ((cpu.csr[csrVtype] & vtypeVsew) >> 3)
+}
+
+// vectorLMUL returns LMUL in eighths of a register, so that the fractional values 1/8, 1/4 and 1/2 are integers.
+func vectorLMUL(vtype uint64) uint32 {
+	vlmul := uint32(vtype & vtypeVlmul)
+	if vlmul >= 0b100 {
+		return 1 << (vlmul - 0b101) // 0b101 = 1/8, 0b110 = 1/4, 0b111 = 1/2
+	}
+	return 8 << vlmul
+}
+
+// vectorMaxLength returns VLMAX, the number of elements of a register group with the current vtype.
+func vectorMaxLength(cpu *CPUState) uint64 {
+	return uint64(cpu.vlen * vectorLMUL(cpu.csr[csrVtype]) / 8 / vectorSEW(cpu))
+}
+
+// isVtypeValid reports whether a vtype value is supported: SEW up to ELEN, the reserved LMUL and bits clear, and
+// a fractional LMUL that still holds an element of ELEN bits.
+func isVtypeValid(cpu *CPUState, vtype uint64) bool {
+	vsew := (vtype & vtypeVsew) >> 3
+	if vtype>>8 != 0 || vtype&vtypeVlmul == 0b100 || vsew > 0b011 {
+		return false
+	}
+	lmul := vectorLMUL(vtype)
+	return (8<<vsew)*8 <= lmul*64 && cpu.vlen*lmul/8/(8<<vsew) > 0
+}
+
+// setVectorConfiguration implements vset{i}vl{i}: vtype is set, or vill when it is not supported, and vl is
+// computed from the application vector length. keepLength keeps vl (rd = rs1 = x0), clipped to the new VLMAX.
+func setVectorConfiguration(cpu *CPUState, rd uint32, avl uint64, keepLength bool, vtype uint64) {
+	if !isVtypeValid(cpu, vtype) {
+		cpu.csr[csrVtype] = 1 << (cpu.xlen - 1)
+		cpu.csr[csrVl] = 0
+	} else {
+		cpu.csr[csrVtype] = vtype
+		if keepLength {
+			avl = cpu.csr[csrVl]
+		}
+		cpu.csr[csrVl] = min(avl, vectorMaxLength(cpu))
+	}
+	cpu.csr[csrVstart] = 0
+	writeRegister(cpu, rd, cpu.csr[csrVl])
+}
+
+// vectorApplicationLength returns the AVL of vsetvli and vsetvl: x[rs1], or the largest value when rs1 = x0 and
+// rd != x0 so that vl is set to VLMAX.
+func vectorApplicationLength(cpu *CPUState, rd uint32, rs1 uint32) uint64 {
+	if rs1 == 0 && rd != 0 {
+		return ^uint64(0)
+	}
+	return readUnsignedRegister(cpu, rs1)
+}
+
+// vectorRegisterGroup returns the number of registers of a group of elements of eew bits with the current vtype:
+// EMUL = EEW / SEW * LMUL, at least one register. ok is false when EMUL is outside 1/8-8.
+func vectorRegisterGroup(cpu *CPUState, eew uint32) (uint32, bool) {
+	emul := eew * vectorLMUL(cpu.csr[csrVtype]) / vectorSEW(cpu) // In eighths
+	if eew*vectorLMUL(cpu.csr[csrVtype])%vectorSEW(cpu) != 0 || emul == 0 || emul > 64 {
+		return 0, false
+	}
+	return max(emul/8, 1), true
+}
+
+// checkVectorState raises an illegal instruction exception when vtype is invalid or when one of the register
+// groups is not aligned on its size. Instructions must stop when it returns false.
+func checkVectorState(cpu *CPUState, group uint32, registers ...uint32) bool {
+	legal := cpu.csr[csrVtype]>>(cpu.xlen-1) == 0
+	for _, register := range registers {
+		legal = legal && register%group == 0
+	}
+	if !legal {
+		raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+	}
+	return legal
+}
+
+// readElement returns element index of the register group starting at reg, zero-extended from eew bits.
+func readElement(cpu *CPUState, reg uint32, index uint64, eew uint32) uint64 {
+	offset := uint64(reg*cpu.vlen/8) + index*uint64(eew/8)
+	value := uint64(0)
+	for i := uint64(eew / 8); i > 0; i-- {
+		value = value<<8 | uint64(cpu.v[offset+i-1])
+	}
+	return value
+}
+
+// writeElement writes the low eew bits of value in element index of the register group starting at reg.
+func writeElement(cpu *CPUState, reg uint32, index uint64, eew uint32, value uint64) {
+	offset := uint64(reg*cpu.vlen/8) + index*uint64(eew/8)
+	for i := uint64(0); i < uint64(eew/8); i++ {
+		cpu.v[offset+i] = byte(value >> (8 * i))
+	}
+}
+
+// readMaskBit returns bit index of the mask register reg.
+func readMaskBit(cpu *CPUState, reg uint32, index uint64) bool {
+	return cpu.v[uint64(reg*cpu.vlen/8)+index/8]>>(index%8)&1 != 0
+}
+
+func writeMaskBit(cpu *CPUState, reg uint32, index uint64, bit bool) {
+	offset := uint64(reg*cpu.vlen/8) + index/8
+	cpu.v[offset] &^= 1 << (index % 8)
+	if bit {
+		cpu.v[offset] |= 1 << (index % 8)
+	}
+}
+
+// isElementActive reports whether an element is executed: always when vm is set, else when its bit of v0 is set.
+func isElementActive(cpu *CPUState, vm uint32, index uint64) bool {
+	return vm == 1 || readMaskBit(cpu, 0, index)
+}
+
+// signedElement sign-extends an element of sew bits.
+func signedElement(value uint64, sew uint32) int64 {
+	return int64(value<<(64-sew)) >> (64 - sew)
+}
+
+// vectorOperand returns the second operand of element index: vs1[index], x[rs1] or the immediate, truncated to
+// sew bits. The immediate is sign-extended unless unsignedImmediate is set.
+func vectorOperand(cpu *CPUState, form uint32, src uint32, index uint64, sew uint32, unsignedImmediate bool) uint64 {
+	mask := ^uint64(0) >> (64 - sew)
+	switch form {
+	case vectorVV:
+		return readElement(cpu, src, index, sew)
+	case vectorVX:
+		return readRegister(cpu, src) & mask
+	}
+	if unsignedImmediate {
+		return uint64(src)
+	}
+	return immediate(signExtend(src, 5)) & mask
+}
+
+// vectorMultiplyHigh returns the upper sew bits of the product of a and b, each read as signed or unsigned.
+func vectorMultiplyHigh(a uint64, b uint64, sew uint32, signedA bool, signedB bool) uint64 {
+	if signedA {
+		a = uint64(signedElement(a, sew))
+	}
+	if signedB {
+		b = uint64(signedElement(b, sew))
+	}
+	high, low := mathbits.Mul64(a, b)
+	if signedA && int64(a) < 0 {
+		high -= b
+	}
+	if signedB && int64(b) < 0 {
+		high -= a
+	}
+	if sew == 64 {
+		return high
+	}
+	return low >> sew
+}
+
+// vectorOperation is an element-wise operation. a is the element of vs2, b the element of vs1, x[rs1] or the
+// immediate, and d the previous element of vd for the multiply-add operations.
+type vectorOperation struct {
+	name              string
+	forms             uint32
+	unsignedImmediate bool // The shifts take a 5-bit unsigned immediate
+	op                func(a, b, d uint64, sew uint32) uint64
+}
+
+// vectorIntegerOperations are the OPIVV/OPIVX/OPIVI operations, by funct6
+var vectorIntegerOperations = map[uint32]vectorOperation{
+	0b000000: {"VADD", vectorVV | vectorVX | vectorVI, false, func(a, b, d uint64, sew uint32) uint64 {
+		return a + b
+	}},
+	0b000010: {"VSUB", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		return a - b
+	}},
+	0b000011: {"VRSUB", vectorVX | vectorVI, false, func(a, b, d uint64, sew uint32) uint64 {
+		return b - a
+	}},
+	0b000100: {"VMINU", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		return min(a, b)
+	}},
+	0b000101: {"VMIN", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		if signedElement(a, sew) < signedElement(b, sew) {
+			return a
+		}
+		return b
+	}},
+	0b000110: {"VMAXU", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		return max(a, b)
+	}},
+	0b000111: {"VMAX", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		if signedElement(a, sew) > signedElement(b, sew) {
+			return a
+		}
+		return b
+	}},
+	0b001001: {"VAND", vectorVV | vectorVX | vectorVI, false, func(a, b, d uint64, sew uint32) uint64 {
+		return a & b
+	}},
+	0b001010: {"VOR", vectorVV | vectorVX | vectorVI, false, func(a, b, d uint64, sew uint32) uint64 {
+		return a | b
+	}},
+	0b001011: {"VXOR", vectorVV | vectorVX | vectorVI, false, func(a, b, d uint64, sew uint32) uint64 {
+		return a ^ b
+	}},
+	0b100101: {"VSLL", vectorVV | vectorVX | vectorVI, true, func(a, b, d uint64, sew uint32) uint64 {
+		return a << (b & uint64(sew-1))
+	}},
+	0b101000: {"VSRL", vectorVV | vectorVX | vectorVI, true, func(a, b, d uint64, sew uint32) uint64 {
+		return a >> (b & uint64(sew-1))
+	}},
+	0b101001: {"VSRA", vectorVV | vectorVX | vectorVI, true, func(a, b, d uint64, sew uint32) uint64 {
+		return uint64(signedElement(a, sew) >> (b & uint64(sew-1)))
+	}},
+}
+
+// vectorMultiplyOperations are the OPMVV/OPMVX operations, by funct6
+var vectorMultiplyOperations = map[uint32]vectorOperation{
+	0b100000: {"VDIVU", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		if b == 0 {
+			return ^uint64(0)
+		}
+		return a / b
+	}},
+	0b100001: {"VDIV", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		dividend, divisor := signedElement(a, sew), signedElement(b, sew)
+		if divisor == 0 {
+			return ^uint64(0)
+		} else if divisor == -1 {
+			return uint64(-dividend) // Overflow of the most negative value wraps back to itself
+		}
+		return uint64(dividend / divisor)
+	}},
+	0b100010: {"VREMU", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		if b == 0 {
+			return a
+		}
+		return a % b
+	}},
+	0b100011: {"VREM", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		dividend, divisor := signedElement(a, sew), signedElement(b, sew)
+		if divisor == 0 {
+			return a
+		} else if divisor == -1 {
+			return 0
+		}
+		return uint64(dividend % divisor)
+	}},
+	0b100100: {"VMULHU", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		return vectorMultiplyHigh(a, b, sew, false, false)
+	}},
+	0b100101: {"VMUL", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		return a * b
+	}},
+	0b100110: {"VMULHSU", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		return vectorMultiplyHigh(a, b, sew, true, false)
+	}},
+	0b100111: {"VMULH", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		return vectorMultiplyHigh(a, b, sew, true, true)
+	}},
+	0b101001: {"VMADD", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		return d*b + a
+	}},
+	0b101011: {"VNMSUB", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		return a - d*b
+	}},
+	0b101101: {"VMACC", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		return b*a + d
+	}},
+	0b101111: {"VNMSAC", vectorVV | vectorVX, false, func(a, b, d uint64, sew uint32) uint64 {
+		return d - b*a
+	}},
+}
+
+// vectorWideningOperation is an operation whose result has 2*SEW bits. The SEW-bit operands are first extended to
+// 64 bits, signed or unsigned, and d is the previous element of vd for the multiply-add operations.
+type vectorWideningOperation struct {
+	name    string
+	forms   uint32
+	wide    bool // .WV and .WX forms: vs2 already holds elements of 2*SEW bits
+	signedA bool // Extension of the element of vs2
+	signedB bool // Extension of the element of vs1 or of x[rs1]
+	op      func(a, b, d uint64) uint64
+}
+
+// vectorWideningOperations are the OPMVV/OPMVX widening add, subtract, multiply and multiply-add, by funct6
+var vectorWideningOperations = map[uint32]vectorWideningOperation{
+	0b110000: {"VWADDU", vectorVV | vectorVX, false, false, false, func(a, b, d uint64) uint64 { return a + b }},
+	0b110001: {"VWADD", vectorVV | vectorVX, false, true, true, func(a, b, d uint64) uint64 { return a + b }},
+	0b110010: {"VWSUBU", vectorVV | vectorVX, false, false, false, func(a, b, d uint64) uint64 { return a - b }},
+	0b110011: {"VWSUB", vectorVV | vectorVX, false, true, true, func(a, b, d uint64) uint64 { return a - b }},
+	0b110100: {"VWADDU", vectorVV | vectorVX, true, false, false, func(a, b, d uint64) uint64 { return a + b }},
+	0b110101: {"VWADD", vectorVV | vectorVX, true, true, true, func(a, b, d uint64) uint64 { return a + b }},
+	0b110110: {"VWSUBU", vectorVV | vectorVX, true, false, false, func(a, b, d uint64) uint64 { return a - b }},
+	0b110111: {"VWSUB", vectorVV | vectorVX, true, true, true, func(a, b, d uint64) uint64 { return a - b }},
+	0b111000: {"VWMULU", vectorVV | vectorVX, false, false, false, func(a, b, d uint64) uint64 { return a * b }},
+	0b111010: {"VWMULSU", vectorVV | vectorVX, false, true, false, func(a, b, d uint64) uint64 { return a * b }},
+	0b111011: {"VWMUL", vectorVV | vectorVX, false, true, true, func(a, b, d uint64) uint64 { return a * b }},
+	0b111100: {"VWMACCU", vectorVV | vectorVX, false, false, false, func(a, b, d uint64) uint64 { return b*a + d }},
+	0b111101: {"VWMACC", vectorVV | vectorVX, false, true, true, func(a, b, d uint64) uint64 { return b*a + d }},
+	0b111110: {"VWMACCUS", vectorVX, false, true, false, func(a, b, d uint64) uint64 { return b*a + d }},
+	0b111111: {"VWMACCSU", vectorVV | vectorVX, false, false, true, func(a, b, d uint64) uint64 { return b*a + d }},
+}
+
+// vectorNarrowingShifts are the OPIVV/OPIVX/OPIVI shifts of 2*SEW-bit elements to SEW bits, by funct6
+var vectorNarrowingShifts = map[uint32]struct {
+	name       string
+	arithmetic bool
+}{
+	0b101100: {"VNSRL", false},
+	0b101101: {"VNSRA", true},
+}
+
+// vectorCarryOperations are the add-with-carry and subtract-with-borrow operations, by funct6. v0 holds the carry
+// in (vm = 0). VMADC and VMSBC write the carry out in the mask register vd, and take no carry in when vm = 1.
+var vectorCarryOperations = map[uint32]struct {
+	name     string
+	forms    uint32
+	subtract bool
+	carryOut bool
+}{
+	0b010000: {"VADC", vectorVV | vectorVX | vectorVI, false, false},
+	0b010001: {"VMADC", vectorVV | vectorVX | vectorVI, false, true},
+	0b010010: {"VSBC", vectorVV | vectorVX, true, false},
+	0b010011: {"VMSBC", vectorVV | vectorVX, true, true},
+}
+
+// vectorCompareOperations are the integer comparisons, by funct6: they write a mask register
+var vectorCompareOperations = map[uint32]struct {
+	name  string
+	forms uint32
+	op    func(a, b uint64, sew uint32) bool
+}{
+	0b011000: {"VMSEQ", vectorVV | vectorVX | vectorVI, func(a, b uint64, sew uint32) bool { return a == b }},
+	0b011001: {"VMSNE", vectorVV | vectorVX | vectorVI, func(a, b uint64, sew uint32) bool { return a != b }},
+	0b011010: {"VMSLTU", vectorVV | vectorVX, func(a, b uint64, sew uint32) bool { return a < b }},
+	0b011011: {"VMSLT", vectorVV | vectorVX, func(a, b uint64, sew uint32) bool {
+		return signedElement(a, sew) < signedElement(b, sew)
+	}},
+	0b011100: {"VMSLEU", vectorVV | vectorVX | vectorVI, func(a, b uint64, sew uint32) bool { return a <= b }},
+	0b011101: {"VMSLE", vectorVV | vectorVX | vectorVI, func(a, b uint64, sew uint32) bool {
+		return signedElement(a, sew) <= signedElement(b, sew)
+	}},
+	0b011110: {"VMSGTU", vectorVX | vectorVI, func(a, b uint64, sew uint32) bool { return a > b }},
+	0b011111: {"VMSGT", vectorVX | vectorVI, func(a, b uint64, sew uint32) bool {
+		return signedElement(a, sew) > signedElement(b, sew)
+	}},
+}
+
+// vectorReductions are the OPMVV single-width integer reductions, by funct6: they combine the elements with an
+// operation of vectorIntegerOperations (given by its funct6).
+var vectorReductions = map[uint32]struct {
+	name      string
+	operation uint32
+}{
+	0b000000: {"VREDSUM.VS", 0b000000},
+	0b000001: {"VREDAND.VS", 0b001001},
+	0b000010: {"VREDOR.VS", 0b001010},
+	0b000011: {"VREDXOR.VS", 0b001011},
+	0b000100: {"VREDMINU.VS", 0b000100},
+	0b000101: {"VREDMIN.VS", 0b000101},
+	0b000110: {"VREDMAXU.VS", 0b000110},
+	0b000111: {"VREDMAX.VS", 0b000111},
+}
+
+// vectorMaskLogicalOperations are the OPMVV mask-register logical instructions, by funct6
+var vectorMaskLogicalOperations = map[uint32]struct {
+	name string
+	op   func(a, b bool) bool
+}{
+	0b011000: {"VMANDN.MM", func(a, b bool) bool { return a && !b }},
+	0b011001: {"VMAND.MM", func(a, b bool) bool { return a && b }},
+	0b011010: {"VMOR.MM", func(a, b bool) bool { return a || b }},
+	0b011011: {"VMXOR.MM", func(a, b bool) bool { return a != b }},
+	0b011100: {"VMORN.MM", func(a, b bool) bool { return a || !b }},
+	0b011101: {"VMNAND.MM", func(a, b bool) bool { return !(a && b) }},
+	0b011110: {"VMNOR.MM", func(a, b bool) bool { return !(a || b) }},
+	0b011111: {"VMXNOR.MM", func(a, b bool) bool { return a == b }},
+}
+
+// vectorOperationsSelectedByVs1 are the OPMVV unary operations whose vs1 field selects the operation, it is
+// then used as funct12 in the instruction table.
+var vectorOperationsSelectedByVs1 = map[[2]uint32]bool{
+	{vectorOPMVV, 0b010000}: true, // VWXUNARY0: VMV.X.S, VCPOP.M, VFIRST.M
+	{vectorOPMVV, 0b010100}: true, // VMUNARY0: VMSBF.M, VMSOF.M, VMSIF.M, VIOTA.M, VID.V
+	{vectorOPMVV, 0b010010}: true, // VXUNARY0: VZEXT.VF2-8, VSEXT.VF2-8
+}
+
+// vectorSuffixes gives the funct3 and the name suffix of each operand form, for the integer and multiply groups
+var vectorSuffixes = []struct {
+	form           uint32
+	integerFunct3  uint32
+	multiplyFunct3 uint32
+	suffix         string
+}{
+	{vectorVV, vectorOPIVV, vectorOPMVV, ".VV"},
+	{vectorVX, vectorOPIVX, vectorOPMVX, ".VX"},
+	{vectorVI, vectorOPIVI, 0, ".VI"},
+}
+
+// vectorArithmetic returns the instruction applying an element-wise operation to the active elements.
+func vectorArithmetic(name string, form uint32, operation vectorOperation) Instruction {
+	return vectorInstruction(name, func(cpu *CPUState, memory *Memory, args ...uint32) {
+		vd, src, vs2, vm := args[0], args[1], args[2], args[3]
+		group, _ := vectorRegisterGroup(cpu, vectorSEW(cpu))
+		registers := []uint32{vd, vs2}
+		if form == vectorVV {
+			registers = append(registers, src)
+		}
+		if vm == 0 && vd == 0 {
+			raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction)) // v0 holds the mask
+			return
+		}
+		if !checkVectorState(cpu, group, registers...) {
+			return
+		}
+
+		sew := vectorSEW(cpu)
+		for i := cpu.csr[csrVstart]; i < cpu.csr[csrVl]; i++ {
+			if isElementActive(cpu, vm, i) {
+				b := vectorOperand(cpu, form, src, i, sew, operation.unsignedImmediate)
+				writeElement(cpu, vd, i, sew, operation.op(readElement(cpu, vs2, i, sew), b, readElement(cpu, vd, i, sew), sew))
+			}
+		}
+		cpu.csr[csrVstart] = 0
+	})
+}
+
+// extendElement extends an element of sew bits to 64 bits, with its sign when signed is set.
+func extendElement(value uint64, sew uint32, signed bool) uint64 {
+	if signed {
+		return uint64(signedElement(value, sew))
+	}
+	return value
+}
+
+// vectorWidening returns the instruction applying a widening operation to the active elements: vd, and vs2 for
+// the .W forms, are groups of 2*SEW-bit elements, so SEW must be below ELEN and LMUL at most 4. The results are
+// computed before being written, as vd may overlap the upper part of a source group.
+func vectorWidening(name string, form uint32, operation vectorWideningOperation) Instruction {
+	return vectorInstruction(name, func(cpu *CPUState, memory *Memory, args ...uint32) {
+		vd, src, vs2, vm := args[0], args[1], args[2], args[3]
+		sew := vectorSEW(cpu)
+		group, _ := vectorRegisterGroup(cpu, sew)
+		wideGroup, ok := vectorRegisterGroup(cpu, 2*sew)
+		if sew == 64 || !ok || (vm == 0 && vd == 0) {
+			raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+			return
+		}
+		wide, narrow := []uint32{vd}, []uint32{}
+		if operation.wide {
+			wide = append(wide, vs2)
+		} else {
+			narrow = append(narrow, vs2)
+		}
+		if form == vectorVV {
+			narrow = append(narrow, src)
+		}
+		if !checkVectorState(cpu, wideGroup, wide...) || !checkVectorState(cpu, group, narrow...) {
+			return
+		}
+
+		results := map[uint64]uint64{}
+		for i := cpu.csr[csrVstart]; i < cpu.csr[csrVl]; i++ {
+			if !isElementActive(cpu, vm, i) {
+				continue
+			}
+			a := extendElement(readElement(cpu, vs2, i, sew), sew, operation.signedA)
+			if operation.wide {
+				a = readElement(cpu, vs2, i, 2*sew)
+			}
+			b := extendElement(vectorOperand(cpu, form, src, i, sew, false), sew, operation.signedB)
+			results[i] = operation.op(a, b, readElement(cpu, vd, i, 2*sew))
+		}
+		for i, result := range results {
+			writeElement(cpu, vd, i, 2*sew, result)
+		}
+		cpu.csr[csrVstart] = 0
+	})
+}
+
+// vectorNarrowingShift returns VNSRL or VNSRA: vd[i] = vs2[i] >> operand truncated to SEW bits, where vs2 holds
+// 2*SEW-bit elements and the shift amount uses log2(2*SEW) bits.
+func vectorNarrowingShift(name string, form uint32, arithmetic bool) Instruction {
+	return vectorInstruction(name, func(cpu *CPUState, memory *Memory, args ...uint32) {
+		vd, src, vs2, vm := args[0], args[1], args[2], args[3]
+		sew := vectorSEW(cpu)
+		group, _ := vectorRegisterGroup(cpu, sew)
+		wideGroup, ok := vectorRegisterGroup(cpu, 2*sew)
+		if sew == 64 || !ok || (vm == 0 && vd == 0) {
+			raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+			return
+		}
+		narrow := []uint32{vd}
+		if form == vectorVV {
+			narrow = append(narrow, src)
+		}
+		if !checkVectorState(cpu, wideGroup, vs2) || !checkVectorState(cpu, group, narrow...) {
+			return
+		}
+
+		results := map[uint64]uint64{}
+		for i := cpu.csr[csrVstart]; i < cpu.csr[csrVl]; i++ {
+			if !isElementActive(cpu, vm, i) {
+				continue
+			}
+			shift := vectorOperand(cpu, form, src, i, sew, true) & uint64(2*sew-1)
+			value := readElement(cpu, vs2, i, 2*sew)
+			if arithmetic {
+				value = uint64(signedElement(value, 2*sew) >> shift)
+			} else {
+				value >>= shift
+			}
+			results[i] = value
+		}
+		for i, result := range results {
+			writeElement(cpu, vd, i, sew, result)
+		}
+		cpu.csr[csrVstart] = 0
+	})
+}
+
+// vectorCarryOut returns the carry out of a + b + carry, or the borrow out of a - b - carry, on sew bits.
+func vectorCarryOut(a uint64, b uint64, carry uint64, sew uint32, subtract bool) uint64 {
+	if sew == 64 {
+		if subtract {
+			_, borrow := mathbits.Sub64(a, b, carry)
+			return borrow
+		}
+		_, carryOut := mathbits.Add64(a, b, carry)
+		return carryOut
+	}
+	if subtract {
+		return (a - b - carry) >> sew & 1
+	}
+	return (a + b + carry) >> sew & 1
+}
+
+// vectorCarry returns VADC, VSBC (vd[i] = vs2[i] +/- operand +/- v0[i], vm = 1 is reserved), VMADC or VMSBC (the
+// carry out of the same operation in the mask register vd). All the body elements are computed, v0 is not a mask.
+func vectorCarry(name string, form uint32, subtract bool, carryOut bool) Instruction {
+	return vectorInstruction(name, func(cpu *CPUState, memory *Memory, args ...uint32) {
+		vd, src, vs2, vm := args[0], args[1], args[2], args[3]
+		group, _ := vectorRegisterGroup(cpu, vectorSEW(cpu))
+		registers := []uint32{vs2}
+		if form == vectorVV {
+			registers = append(registers, src)
+		}
+		if !carryOut {
+			if vm == 1 || vd == 0 {
+				raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction)) // v0 holds the carry
+				return
+			}
+			registers = append(registers, vd)
+		}
+		if !checkVectorState(cpu, group, registers...) {
+			return
+		}
+
+		sew := vectorSEW(cpu)
+		results := map[uint64]uint64{}
+		for i := cpu.csr[csrVstart]; i < cpu.csr[csrVl]; i++ {
+			a, b, carry := readElement(cpu, vs2, i, sew), vectorOperand(cpu, form, src, i, sew, false), uint64(0)
+			if vm == 0 && readMaskBit(cpu, 0, i) {
+				carry = 1
+			}
+			switch {
+			case carryOut:
+				results[i] = vectorCarryOut(a, b, carry, sew, subtract)
+			case subtract:
+				results[i] = a - b - carry
+			default:
+				results[i] = a + b + carry
+			}
+		}
+		for i, result := range results {
+			if carryOut {
+				writeMaskBit(cpu, vd, i, result == 1)
+			} else {
+				writeElement(cpu, vd, i, sew, result)
+			}
+		}
+		cpu.csr[csrVstart] = 0
+	})
+}
+
+// vectorExtension returns VZEXT or VSEXT: vd[i] = vs2[i] extended from SEW / factor bits to SEW bits.
+func vectorExtension(name string, factor uint32, signed bool) Instruction {
+	return vectorInstruction(name, func(cpu *CPUState, memory *Memory, args ...uint32) {
+		vd, vs2, vm := args[0], args[2], args[3]
+		sew := vectorSEW(cpu)
+		group, _ := vectorRegisterGroup(cpu, sew)
+		sourceGroup, ok := vectorRegisterGroup(cpu, sew/factor)
+		if sew/factor < 8 || !ok || (vm == 0 && vd == 0) {
+			raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+			return
+		}
+		if !checkVectorState(cpu, group, vd) || !checkVectorState(cpu, sourceGroup, vs2) {
+			return
+		}
+
+		results := map[uint64]uint64{}
+		for i := cpu.csr[csrVstart]; i < cpu.csr[csrVl]; i++ {
+			if isElementActive(cpu, vm, i) {
+				results[i] = extendElement(readElement(cpu, vs2, i, sew/factor), sew/factor, signed)
+			}
+		}
+		for i, result := range results {
+			writeElement(cpu, vd, i, sew, result)
+		}
+		cpu.csr[csrVstart] = 0
+	})
+}
+
+// vectorCompare returns the instruction writing the result of a comparison of the active elements in the mask
+// register vd. The results are computed before being written, vd can overlap the sources.
+func vectorCompare(name string, form uint32, compare func(a, b uint64, sew uint32) bool) Instruction {
+	return vectorInstruction(name, func(cpu *CPUState, memory *Memory, args ...uint32) {
+		vd, src, vs2, vm := args[0], args[1], args[2], args[3]
+		group, _ := vectorRegisterGroup(cpu, vectorSEW(cpu))
+		registers := []uint32{vs2}
+		if form == vectorVV {
+			registers = append(registers, src)
+		}
+		if !checkVectorState(cpu, group, registers...) {
+			return
+		}
+
+		sew := vectorSEW(cpu)
+		results := map[uint64]bool{}
+		for i := cpu.csr[csrVstart]; i < cpu.csr[csrVl]; i++ {
+			if isElementActive(cpu, vm, i) {
+				results[i] = compare(readElement(cpu, vs2, i, sew), vectorOperand(cpu, form, src, i, sew, false), sew)
+			}
+		}
+		for i, result := range results {
+			writeMaskBit(cpu, vd, i, result)
+		}
+		cpu.csr[csrVstart] = 0
+	})
+}
+
+// vectorReduction returns the instruction computing vd[0] = vs1[0] op vs2[active elements].
+func vectorReduction(name string, operation vectorOperation) Instruction {
+	return vectorInstruction(name, func(cpu *CPUState, memory *Memory, args ...uint32) {
+		vd, vs1, vs2, vm := args[0], args[1], args[2], args[3]
+		group, _ := vectorRegisterGroup(cpu, vectorSEW(cpu))
+		if !checkVectorState(cpu, group, vs2) {
+			return
+		}
+
+		sew := vectorSEW(cpu)
+		if cpu.csr[csrVl] > 0 {
+			result := readElement(cpu, vs1, 0, sew)
+			for i := uint64(0); i < cpu.csr[csrVl]; i++ {
+				if isElementActive(cpu, vm, i) {
+					result = operation.op(result, readElement(cpu, vs2, i, sew), 0, sew) & (^uint64(0) >> (64 - sew))
+				}
+			}
+			writeElement(cpu, vd, 0, sew, result)
+		}
+		cpu.csr[csrVstart] = 0
+	})
+}
+
+// vectorWideningReduction returns VWREDSUMU or VWREDSUM: vd[0] = vs1[0] + the active elements of vs2 extended to
+// 2*SEW bits, vd and vs1 hold a single element of 2*SEW bits.
+func vectorWideningReduction(name string, signed bool) Instruction {
+	return vectorInstruction(name, func(cpu *CPUState, memory *Memory, args ...uint32) {
+		vd, vs1, vs2, vm := args[0], args[1], args[2], args[3]
+		sew := vectorSEW(cpu)
+		group, _ := vectorRegisterGroup(cpu, sew)
+		if sew == 64 {
+			raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+			return
+		}
+		if !checkVectorState(cpu, group, vs2) {
+			return
+		}
+
+		if cpu.csr[csrVl] > 0 {
+			result := readElement(cpu, vs1, 0, 2*sew)
+			for i := uint64(0); i < cpu.csr[csrVl]; i++ {
+				if isElementActive(cpu, vm, i) {
+					result += extendElement(readElement(cpu, vs2, i, sew), sew, signed)
+				}
+			}
+			writeElement(cpu, vd, 0, 2*sew, result)
+		}
+		cpu.csr[csrVstart] = 0
+	})
+}
+
+// vectorMaskLogical returns the instruction combining the vl first bits of the mask registers vs2 and vs1.
+func vectorMaskLogical(name string, op func(a, b bool) bool) Instruction {
+	return vectorInstruction(name, func(cpu *CPUState, memory *Memory, args ...uint32) {
+		vd, vs1, vs2, vm := args[0], args[1], args[2], args[3]
+		if vm == 0 {
+			raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction)) // The mask operations are unmasked
+			return
+		}
+		if !checkVectorState(cpu, 1) {
+			return
+		}
+		for i := cpu.csr[csrVstart]; i < cpu.csr[csrVl]; i++ {
+			writeMaskBit(cpu, vd, i, op(readMaskBit(cpu, vs2, i), readMaskBit(cpu, vs1, i)))
+		}
+		cpu.csr[csrVstart] = 0
+	})
+}
+
+// vectorMerge returns VMERGE (vm = 0: vd[i] = v0[i] ? operand : vs2[i]) and VMV.V (vm = 1 and vs2 = 0:
+// vd[i] = operand), which share their encoding. decodeV names the unmasked form VMV.V.
+func vectorMerge(form uint32, suffix string) Instruction {
+	return vectorInstruction("VMERGE"+suffix, func(cpu *CPUState, memory *Memory, args ...uint32) {
+		vd, src, vs2, vm := args[0], args[1], args[2], args[3]
+		group, _ := vectorRegisterGroup(cpu, vectorSEW(cpu))
+		registers := []uint32{vd, vs2}
+		if form == vectorVV {
+			registers = append(registers, src)
+		}
+		if (vm == 1 && vs2 != 0) || (vm == 0 && vd == 0) {
+			raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+			return
+		}
+		if !checkVectorState(cpu, group, registers...) {
+			return
+		}
+
+		sew := vectorSEW(cpu)
+		for i := cpu.csr[csrVstart]; i < cpu.csr[csrVl]; i++ {
+			value := vectorOperand(cpu, form, src, i, sew, false)
+			if vm == 0 && !readMaskBit(cpu, 0, i) {
+				value = readElement(cpu, vs2, i, sew)
+			}
+			writeElement(cpu, vd, i, sew, value)
+		}
+		cpu.csr[csrVstart] = 0
+	})
+}
+
+// vectorAccess loads or stores the active elements of eew bits of the register group vd, at rs1 + i * stride.
+// A fault stops the instruction with vstart holding the index of the faulting element, so that it can resume.
+func vectorAccess(cpu *CPUState, memory *Memory, vd uint32, rs1 uint32, stride uint64, eew uint32, vm uint32, mask bool, store bool) {
+	length := cpu.csr[csrVl]
+	group, ok := vectorRegisterGroup(cpu, eew)
+	if mask {
+		group, ok = 1, true
+		length = (length + 7) / 8 // The mask loads and stores transfer ceil(vl / 8) bytes
+	}
+	if !ok || (vm == 0 && vd == 0 && !store) {
+		raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+		return
+	}
+	if !checkVectorState(cpu, group, vd) {
+		return
+	}
+
+	access := accessLoad
+	if store {
+		access = accessStore
+	}
+	base := readRegister(cpu, rs1)
+	for i := cpu.csr[csrVstart]; i < length; i++ {
+		if !isElementActive(cpu, vm, i) {
+			continue
+		}
+		physical, ok := checkAccess(cpu, memory, (base+i*stride)&xlenMask(cpu), eew/8, access)
+		if !ok {
+			cpu.csr[csrVstart] = i
+			return
+		}
+		if store {
+			writeMemoryElement(cpu, memory, physical, eew, readElement(cpu, vd, i, eew))
+		} else {
+			writeElement(cpu, vd, i, eew, readMemoryElement(memory, physical, eew))
+		}
+	}
+	cpu.csr[csrVstart] = 0
+}
+
+// readMemoryElement reads an element of eew bits at a physical address aligned on its size.
+func readMemoryElement(memory *Memory, address uint32, eew uint32) uint64 {
+	switch eew {
+	case 8:
+		return uint64(memory.Load8(address))
+	case 16:
+		return uint64(memory.Load16(address))
+	case 32:
+		return uint64(memory.Load32(address))
+	}
+	return readDoubleword(memory, address)
+}
+
+// writeMemoryElement writes an element of eew bits at a physical address aligned on its size.
+func writeMemoryElement(cpu *CPUState, memory *Memory, address uint32, eew uint32, value uint64) {
+	switch eew {
+	case 8:
+		memory.Store8(address, uint8(value))
+	case 16:
+		memory.Store16(address, uint16(value))
+	case 32:
+		memory.Store32(address, uint32(value))
+	default:
+		writeDoubleword(cpu, memory, address, value)
+		return
+	}
+	invalidateReservation(cpu, address)
+}
+
+// vectorLoadStoreInstructions returns the unit-stride, strided and mask loads and stores of each element width.
+// In the table, funct7 holds the mop field ([31:26] with nf = 0 and mew = 0) and funct12 the lumop/sumop field.
+func vectorLoadStoreInstructions() map[[4]uint32]Instruction {
+	table := map[[4]uint32]Instruction{}
+	for _, funct3 := range []uint32{0b000, 0b101, 0b110, 0b111} {
+		eew := vectorWidth(funct3)
+
+		// Loads: rd = vd, rs1, imm holds [24:20] lumop or rs2 and [25] vm
+		table[[4]uint32{0b0000111, funct3, vectorUnitStride, 0}] = vectorInstruction(fmt.Sprintf("VLE%d.V", eew),
+			func(cpu *CPUState, memory *Memory, args ...uint32) {
+				vectorAccess(cpu, memory, args[0], args[1], uint64(eew/8), eew, (args[2]>>5)&1, false, false)
+			})
+		table[[4]uint32{0b0000111, funct3, vectorStrided, 0}] = vectorInstruction(fmt.Sprintf("VLSE%d.V", eew),
+			func(cpu *CPUState, memory *Memory, args ...uint32) {
+				stride := readRegister(cpu, args[2]&0x1F)
+				vectorAccess(cpu, memory, args[0], args[1], stride, eew, (args[2]>>5)&1, false, false)
+			})
+
+		// Stores: rs1, rs2, imm holds [4:0] vs3 and [5] vm
+		table[[4]uint32{0b0100111, funct3, vectorUnitStride, 0}] = vectorInstruction(fmt.Sprintf("VSE%d.V", eew),
+			func(cpu *CPUState, memory *Memory, args ...uint32) {
+				vectorAccess(cpu, memory, args[2]&0x1F, args[0], uint64(eew/8), eew, (args[2]>>5)&1, false, true)
+			})
+		table[[4]uint32{0b0100111, funct3, vectorStrided, 0}] = vectorInstruction(fmt.Sprintf("VSSE%d.V", eew),
+			func(cpu *CPUState, memory *Memory, args ...uint32) {
+				stride := readRegister(cpu, args[1])
+				vectorAccess(cpu, memory, args[2]&0x1F, args[0], stride, eew, (args[2]>>5)&1, false, true)
+			})
+	}
+
+	// VLM.V / VSM.V : mask load and store, unmasked with 8-bit elements
+	table[[4]uint32{0b0000111, 0b000, vectorUnitStride, vectorMaskAccess}] = vectorInstruction("VLM.V",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			vectorAccess(cpu, memory, args[0], args[1], 1, 8, 1, true, false)
+		})
+	table[[4]uint32{0b0100111, 0b000, vectorUnitStride, vectorMaskAccess}] = vectorInstruction("VSM.V",
+		func(cpu *CPUState, memory *Memory, args ...uint32) {
+			vectorAccess(cpu, memory, args[2]&0x1F, args[0], 1, 8, 1, true, true)
+		})
+	return table
+}
+
+// VectorInstructions holds the configuration and the unary OP-V instructions, the element-wise operations
+// are generated from the tables above (see vectorOperations). OP-V instructions get the arguments vd, vs1 (or
+// rs1 or the immediate), vs2 and vm, except vset{i}vl{i} which get rd, rs1 and instruction[31:20].
+var VectorInstructions = map[[4]uint32]Instruction{
+	// OPCFG
+	// VSETVLI : Set Vector Length, vtype from an immediate ([31] = 0)
+	{0b1010111, vectorOPCFG, 0, 0}: vectorInstruction("VSETVLI", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rd, rs1, zimm := args[0], args[1], args[2]&0x7FF
+		setVectorConfiguration(cpu, rd, vectorApplicationLength(cpu, rd, rs1), rs1 == 0 && rd == 0, uint64(zimm))
+	}),
+	// VSETIVLI : Set Vector Length from a 5-bit immediate ([31:30] = 11)
+	{0b1010111, vectorOPCFG, 0b11, 0}: vectorInstruction("VSETIVLI", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rd, uimm, zimm := args[0], args[1], args[2]&0x3FF
+		setVectorConfiguration(cpu, rd, uint64(uimm), false, uint64(zimm))
+	}),
+	// VSETVL : Set Vector Length, vtype from rs2 ([31:25] = 1000000)
+	{0b1010111, vectorOPCFG, 0b1000000, 0}: vectorInstruction("VSETVL", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rd, rs1, rs2 := args[0], args[1], args[2]&0x1F
+		setVectorConfiguration(cpu, rd, vectorApplicationLength(cpu, rd, rs1), rs1 == 0 && rd == 0, readUnsignedRegister(cpu, rs2))
+	}),
+	// VWXUNARY0
+	// VMV.X.S : x[rd] = vs2[0], sign-extended or truncated to XLEN
+	{0b1010111, vectorOPMVV, 0b010000, 0b00000}: vectorInstruction("VMV.X.S", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rd, vs2 := args[0], args[2]
+		if checkVectorState(cpu, 1) {
+			sew := vectorSEW(cpu)
+			writeRegister(cpu, rd, uint64(signedElement(readElement(cpu, vs2, 0, sew), sew)))
+			cpu.csr[csrVstart] = 0
+		}
+	}),
+	// VCPOP.M : x[rd] = number of active set bits of the mask vs2
+	{0b1010111, vectorOPMVV, 0b010000, 0b10000}: vectorInstruction("VCPOP.M", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rd, vs2, vm := args[0], args[2], args[3]
+		if checkVectorState(cpu, 1) {
+			count := uint64(0)
+			for i := uint64(0); i < cpu.csr[csrVl]; i++ {
+				if isElementActive(cpu, vm, i) && readMaskBit(cpu, vs2, i) {
+					count++
+				}
+			}
+			writeRegister(cpu, rd, count)
+			cpu.csr[csrVstart] = 0
+		}
+	}),
+	// VFIRST.M : x[rd] = index of the first active set bit of the mask vs2, or -1
+	{0b1010111, vectorOPMVV, 0b010000, 0b10001}: vectorInstruction("VFIRST.M", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		rd, vs2, vm := args[0], args[2], args[3]
+		if checkVectorState(cpu, 1) {
+			first := ^uint64(0)
+			for i := uint64(0); i < cpu.csr[csrVl]; i++ {
+				if isElementActive(cpu, vm, i) && readMaskBit(cpu, vs2, i) {
+					first = i
+					break
+				}
+			}
+			writeRegister(cpu, rd, first)
+			cpu.csr[csrVstart] = 0
+		}
+	}),
+	// VRXUNARY0
+	// VMV.S.X : vd[0] = x[rs1] (vs2 = 0), nothing is written when vl = 0
+	{0b1010111, vectorOPMVX, 0b010000, 0}: vectorInstruction("VMV.S.X", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		vd, rs1, vs2 := args[0], args[1], args[2]
+		if vs2 != 0 {
+			raiseException(cpu, causeIllegalInstruction, uint64(cpu.instruction))
+			return
+		}
+		if checkVectorState(cpu, 1) {
+			if cpu.csr[csrVstart] < cpu.csr[csrVl] {
+				writeElement(cpu, vd, 0, vectorSEW(cpu), readRegister(cpu, rs1))
+			}
+			cpu.csr[csrVstart] = 0
+		}
+	}),
+	// VXUNARY0
+	// VZEXT.VF8, VSEXT.VF8, VZEXT.VF4, VSEXT.VF4, VZEXT.VF2, VSEXT.VF2 : vd[i] = vs2[i] extended to SEW bits
+	{0b1010111, vectorOPMVV, 0b010010, 0b00010}: vectorExtension("VZEXT.VF8", 8, false),
+	{0b1010111, vectorOPMVV, 0b010010, 0b00011}: vectorExtension("VSEXT.VF8", 8, true),
+	{0b1010111, vectorOPMVV, 0b010010, 0b00100}: vectorExtension("VZEXT.VF4", 4, false),
+	{0b1010111, vectorOPMVV, 0b010010, 0b00101}: vectorExtension("VSEXT.VF4", 4, true),
+	{0b1010111, vectorOPMVV, 0b010010, 0b00110}: vectorExtension("VZEXT.VF2", 2, false),
+	{0b1010111, vectorOPMVV, 0b010010, 0b00111}: vectorExtension("VSEXT.VF2", 2, true),
+	// VMUNARY0
+	// VMSBF.M : Set-Before-First mask bit
+	{0b1010111, vectorOPMVV, 0b010100, 0b00001}: vectorSetFirst("VMSBF.M", true, false),
+	// VMSOF.M : Set-Only-First mask bit
+	{0b1010111, vectorOPMVV, 0b010100, 0b00010}: vectorSetFirst("VMSOF.M", false, true),
+	// VMSIF.M : Set-Including-First mask bit
+	{0b1010111, vectorOPMVV, 0b010100, 0b00011}: vectorSetFirst("VMSIF.M", true, true),
+	// VIOTA.M : vd[i] = number of set bits of the mask vs2 among the active elements before i
+	{0b1010111, vectorOPMVV, 0b010100, 0b10000}: vectorInstruction("VIOTA.M", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		vd, vs2, vm := args[0], args[2], args[3]
+		group, _ := vectorRegisterGroup(cpu, vectorSEW(cpu))
+		if !checkVectorState(cpu, group, vd) {
+			return
+		}
+		count := uint64(0)
+		for i := uint64(0); i < cpu.csr[csrVl]; i++ {
+			if isElementActive(cpu, vm, i) {
+				writeElement(cpu, vd, i, vectorSEW(cpu), count)
+				if readMaskBit(cpu, vs2, i) {
+					count++
+				}
+			}
+		}
+		cpu.csr[csrVstart] = 0
+	}),
+	// VID.V : vd[i] = i
+	{0b1010111, vectorOPMVV, 0b010100, 0b10001}: vectorInstruction("VID.V", func(cpu *CPUState, memory *Memory, args ...uint32) {
+		vd, vm := args[0], args[3]
+		group, _ := vectorRegisterGroup(cpu, vectorSEW(cpu))
+		if !checkVectorState(cpu, group, vd) {
+			return
+		}
+		for i := cpu.csr[csrVstart]; i < cpu.csr[csrVl]; i++ {
+			if isElementActive(cpu, vm, i) {
+				writeElement(cpu, vd, i, vectorSEW(cpu), i)
+			}
+		}
+		cpu.csr[csrVstart] = 0
+	}),
+}
+
+// vectorSetFirst returns VMSBF.M, VMSOF.M or VMSIF.M: the active bits of vd are set before the first active set
+// bit of vs2 when before is set, and at that bit when at is set.
+func vectorSetFirst(name string, before bool, at bool) Instruction {
+	return vectorInstruction(name, func(cpu *CPUState, memory *Memory, args ...uint32) {
+		vd, vs2, vm := args[0], args[2], args[3]
+		if !checkVectorState(cpu, 1) {
+			return
+		}
+		found := false
+		results := map[uint64]bool{}
+		for i := uint64(0); i < cpu.csr[csrVl]; i++ {
+			if !isElementActive(cpu, vm, i) {
+				continue
+			}
+			first := !found && readMaskBit(cpu, vs2, i)
+			results[i] = (before && !found && !first) || (at && first)
+			found = found || first
+		}
+		for i, result := range results {
+			writeMaskBit(cpu, vd, i, result)
+		}
+		cpu.csr[csrVstart] = 0
+	})
+}
+
+// vectorOperations generates the OP-V instructions of the element-wise operations, reductions and mask logic.
+func vectorOperations() map[[4]uint32]Instruction {
+	table := map[[4]uint32]Instruction{}
+	for _, suffix := range vectorSuffixes {
+		for funct6, operation := range vectorIntegerOperations {
+			if operation.forms&suffix.form != 0 {
+				table[[4]uint32{0b1010111, suffix.integerFunct3, funct6, 0}] = vectorArithmetic(operation.name+suffix.suffix, suffix.form, operation)
+			}
+		}
+		for funct6, operation := range vectorMultiplyOperations {
+			if operation.forms&suffix.form != 0 {
+				table[[4]uint32{0b1010111, suffix.multiplyFunct3, funct6, 0}] = vectorArithmetic(operation.name+suffix.suffix, suffix.form, operation)
+			}
+		}
+		for funct6, operation := range vectorCompareOperations {
+			if operation.forms&suffix.form != 0 {
+				table[[4]uint32{0b1010111, suffix.integerFunct3, funct6, 0}] = vectorCompare(operation.name+suffix.suffix, suffix.form, operation.op)
+			}
+		}
+		for funct6, operation := range vectorWideningOperations {
+			name := operation.name + suffix.suffix
+			if operation.wide {
+				name = operation.name + ".W" + suffix.suffix[2:]
+			}
+			if operation.forms&suffix.form != 0 {
+				table[[4]uint32{0b1010111, suffix.multiplyFunct3, funct6, 0}] = vectorWidening(name, suffix.form, operation)
+			}
+		}
+		for funct6, shift := range vectorNarrowingShifts {
+			name := shift.name + ".W" + suffix.suffix[2:]
+			table[[4]uint32{0b1010111, suffix.integerFunct3, funct6, 0}] = vectorNarrowingShift(name, suffix.form, shift.arithmetic)
+		}
+		for funct6, operation := range vectorCarryOperations {
+			name := operation.name + suffix.suffix // VMADC and VMSBC get the M suffix from decodeV when vm = 0
+			if !operation.carryOut {
+				name += "M"
+			}
+			if operation.forms&suffix.form != 0 {
+				table[[4]uint32{0b1010111, suffix.integerFunct3, funct6, 0}] = vectorCarry(name, suffix.form, operation.subtract, operation.carryOut)
+			}
+		}
+		// VMERGE / VMV.V : funct6 010111
+		table[[4]uint32{0b1010111, suffix.integerFunct3, 0b010111, 0}] = vectorMerge(suffix.form, suffix.suffix+"M")
+	}
+	// VWREDSUMU.VS / VWREDSUM.VS : OPIVV widening reductions
+	table[[4]uint32{0b1010111, vectorOPIVV, 0b110000, 0}] = vectorWideningReduction("VWREDSUMU.VS", false)
+	table[[4]uint32{0b1010111, vectorOPIVV, 0b110001, 0}] = vectorWideningReduction("VWREDSUM.VS", true)
+	for funct6, reduction := range vectorReductions {
+		table[[4]uint32{0b1010111, vectorOPMVV, funct6, 0}] = vectorReduction(reduction.name, vectorIntegerOperations[reduction.operation])
+	}
+	for funct6, operation := range vectorMaskLogicalOperations {
+		table[[4]uint32{0b1010111, vectorOPMVV, funct6, 0}] = vectorMaskLogical(operation.name, operation.op)
+	}
+	return table
+}
+
+// vcsrField returns a view on the bits [offset+width-1:offset] of vcsr, like floatCSR for fcsr.
+func vcsrField(name string, offset uint32, width uint32) CSR {
+	mask := uint64(1<<width-1) << offset
+	return CSR{
+		name,
+		func(cpu *CPUState) uint64 {
+			return (cpu.csr[csrVcsr] & mask) >> offset
+		},
+		func(cpu *CPUState, value uint64) {
+			cpu.csr[csrVcsr] = (cpu.csr[csrVcsr] &^ mask) | ((value << offset) & mask)
+			cpu.csr[csrMstatus] |= mstatusVSDirty
+		},
+	}
+}
+
+func init() {
+	tables := []map[[4]uint32]Instruction{
+		VectorInstructions,
+		vectorOperations(),
+		vectorLoadStoreInstructions(),
+	}
+	for _, table := range tables {
+		for key, instruction := range table {
+			Instructions[key] = instruction
+		}
+	}
+
+	CSRs[csrVstart] = CSR{
+		"vstart",
+		func(cpu *CPUState) uint64 {
+			return cpu.csr[csrVstart]
+		},
+		func(cpu *CPUState, value uint64) {
+			cpu.csr[csrVstart] = value & uint64(cpu.vlen-1) // Enough bits for the largest element index
+			cpu.csr[csrMstatus] |= mstatusVSDirty
+		},
+	}
+	CSRs[csrVxsat] = vcsrField("vxsat", 0, 1)
+	CSRs[csrVxrm] = vcsrField("vxrm", 1, 2)
+	CSRs[csrVcsr] = vcsrField("vcsr", 0, 3)
+	CSRs[csrVl] = storedCSR("vl", csrVl, 0)
+	CSRs[csrVtype] = storedCSR("vtype", csrVtype, 0)
+	CSRs[csrVlenb] = CSR{
+		"vlenb",
+		func(cpu *CPUState) uint64 {
+			return uint64(cpu.vlen / 8)
+		},
+		func(cpu *CPUState, value uint64) {},
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"testing"
+)
+
+func encodeVType(funct6, vm, vs2, vs1, funct3, vd uint32) uint32 {
+	// [31:26] funct6 [25] vm [24:20] vs2 [19:15] vs1 [14:12] funct3 [11:7] vd [6:0] opcode
+	return funct6<<26 | vm<<25 | vs2<<20 | vs1<<15 | funct3<<12 | vd<<7 | 0b1010111
+}
+
+// executeVector runs a single instruction written at address 0.
+func executeVector(cpu *CPUState, memory *Memory, instruction uint32) {
+	memory.Store32(0, instruction)
+	flushICache(cpu)
+	cpu.pc = 0
+	executeInstruction(cpu, memory)
+}
+
+func TestVectorConfiguration(t *testing.T) {
+	tests := []struct {
+		name        string
+		instruction uint32
+		x1          uint64
+		x2          uint64
+		expectedVl  uint64
+		expectedX3  uint64
+		expectedIll bool
+	}{
+		{"VSETVLI e32 m1, AVL 10", 0b0_00000_010_000<<20 | 1<<15 | 0b111<<12 | 3<<7 | 0b1010111, 10, 0, 4, 4, false},
+		{"VSETVLI e32 m1, AVL 3", 0b0_00000_010_000<<20 | 1<<15 | 0b111<<12 | 3<<7 | 0b1010111, 3, 0, 3, 3, false},
+		{"VSETVLI e8 m2, VLMAX", 0b0_00000_000_001<<20 | 0<<15 | 0b111<<12 | 3<<7 | 0b1010111, 0, 0, 32, 32, false},
+		{"VSETVLI e16 mf2", 0b0_00000_001_111<<20 | 1<<15 | 0b111<<12 | 3<<7 | 0b1010111, 100, 0, 4, 4, false},
+		{"VSETVLI e64 mf8 is unsupported", 0b0_00000_011_101<<20 | 1<<15 | 0b111<<12 | 3<<7 | 0b1010111, 10, 0, 0, 0, true},
+		{"VSETVLI reserved LMUL", 0b0_00000_000_100<<20 | 1<<15 | 0b111<<12 | 3<<7 | 0b1010111, 10, 0, 0, 0, true},
+		{"VSETIVLI 3, e16 m1", 0b11_0000_001_000<<20 | 3<<15 | 0b111<<12 | 3<<7 | 0b1010111, 0, 0, 3, 3, false},
+		{"VSETVL e64 m8", 0b1000000<<25 | 2<<20 | 1<<15 | 0b111<<12 | 3<<7 | 0b1010111, 100, 0b011_011, 16, 16, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cpu CPUState
+			var memory Memory
+
+			initMemory(&memory, 64, 0)
+			initCPUState(&cpu, 0, 0)
+			writeRegister(&cpu, 1, test.x1)
+			writeRegister(&cpu, 2, test.x2)
+			executeVector(&cpu, &memory, test.instruction)
+
+			if cpu.trapped {
+				t.Fatalf("unexpected trap, mcause=%d", cpu.csr[csrMcause])
+			}
+			if CSRs[csrVl].Read(&cpu) != test.expectedVl || cpu.x[3] != test.expectedX3 {
+				t.Errorf("expected vl=%d x3=%d, got vl=%d x3=%d", test.expectedVl, test.expectedX3,
+					CSRs[csrVl].Read(&cpu), cpu.x[3])
+			}
+			if ill := CSRs[csrVtype].Read(&cpu)>>31 == 1; ill != test.expectedIll {
+				t.Errorf("expected vill=%v, got vtype=0x%x", test.expectedIll, CSRs[csrVtype].Read(&cpu))
+			}
+		})
+	}
+}
+
+func TestVectorArithmetic(t *testing.T) {
+	tests := []struct {
+		name        string
+		instruction uint32
+		vsew        uint64
+		vs1         []uint64
+		vs2         []uint64
+		vd          []uint64
+		mask        byte
+		x1          uint64
+		expected    []uint64
+	}{
+		{"VADD.VV", encodeVType(0b000000, 1, 2, 1, vectorOPIVV, 3), 2, []uint64{1, 2, 3, 4}, []uint64{10, 20, 30, 0xFFFFFFFF}, nil, 0, 0, []uint64{11, 22, 33, 3}},
+		{"VSUB.VX", encodeVType(0b000010, 1, 2, 1, vectorOPIVX, 3), 2, nil, []uint64{10, 20, 30, 0}, nil, 0, 5, []uint64{5, 15, 25, 0xFFFFFFFB}},
+		{"VRSUB.VI", encodeVType(0b000011, 1, 2, 0b11111, vectorOPIVI, 3), 0, nil, []uint64{1, 2, 3, 4}, nil, 0, 0, []uint64{0xFE, 0xFD, 0xFC, 0xFB}},
+		{"VADD.VI e64 sign-extends", encodeVType(0b000000, 1, 2, 0b11111, vectorOPIVI, 3), 3, nil, []uint64{1, 0}, nil, 0, 0, []uint64{0, 0xFFFFFFFFFFFFFFFF}},
+		{"VSRA.VI", encodeVType(0b101001, 1, 2, 4, vectorOPIVI, 3), 1, nil, []uint64{0x8000, 0x0100, 0xFFF0, 0x7FFF}, nil, 0, 0, []uint64{0xF800, 0x0010, 0xFFFF, 0x07FF}},
+		{"VMIN.VV", encodeVType(0b000101, 1, 2, 1, vectorOPIVV, 3), 2, []uint64{1, 0xFFFFFFFF, 3, 4}, []uint64{2, 1, 0x80000000, 4}, nil, 0, 0, []uint64{1, 0xFFFFFFFF, 0x80000000, 4}},
+		{"VMAXU.VX", encodeVType(0b000110, 1, 2, 1, vectorOPIVX, 3), 2, nil, []uint64{1, 7, 100, 0xFFFFFFFF}, nil, 0, 7, []uint64{7, 7, 100, 0xFFFFFFFF}},
+		{"VMUL.VV", encodeVType(0b100101, 1, 2, 1, vectorOPMVV, 3), 1, []uint64{3, 0x100, 0xFFFF, 2}, []uint64{5, 0x100, 0xFFFF, 0x8000}, nil, 0, 0, []uint64{15, 0, 1, 0}},
+		{"VMULH.VV", encodeVType(0b100111, 1, 2, 1, vectorOPMVV, 3), 2, []uint64{0xFFFFFFFF, 0x10000, 2, 0x80000000}, []uint64{0xFFFFFFFF, 0x10000, 3, 0x80000000}, nil, 0, 0, []uint64{0, 1, 0, 0x40000000}},
+		{"VMULHU.VX e64", encodeVType(0b100100, 1, 2, 1, vectorOPMVX, 3), 3, nil, []uint64{0xFFFFFFFFFFFFFFFF, 1 << 32}, nil, 0, 2, []uint64{1, 0}},
+		{"VMULHSU.VV", encodeVType(0b100110, 1, 2, 1, vectorOPMVV, 3), 0, []uint64{0xFF, 0xFF, 2, 0}, []uint64{0xFF, 0x01, 0x80, 5}, nil, 0, 0, []uint64{0xFF, 0, 0xFF, 0}},
+		{"VDIV.VV by zero and overflow", encodeVType(0b100001, 1, 2, 1, vectorOPMVV, 3), 0, []uint64{0, 0xFF, 2, 0xFE}, []uint64{5, 0x80, 0xF9, 7}, nil, 0, 0, []uint64{0xFF, 0x80, 0xFD, 0xFD}},
+		{"VREMU.VV by zero", encodeVType(0b100010, 1, 2, 1, vectorOPMVV, 3), 0, []uint64{0, 3, 7, 1}, []uint64{5, 10, 20, 9}, nil, 0, 0, []uint64{5, 1, 6, 0}},
+		{"VREM.VV overflow", encodeVType(0b100011, 1, 2, 1, vectorOPMVV, 3), 0, []uint64{0xFF, 3, 3, 0}, []uint64{0x80, 0xF9, 7, 0xF9}, nil, 0, 0, []uint64{0, 0xFF, 1, 0xF9}},
+		{"VMACC.VX", encodeVType(0b101101, 1, 2, 1, vectorOPMVX, 3), 2, nil, []uint64{1, 2, 3, 4}, []uint64{100, 100, 100, 100}, 0, 3, []uint64{103, 106, 109, 112}},
+		{"VNMSUB.VV", encodeVType(0b101011, 1, 2, 1, vectorOPMVV, 3), 2, []uint64{2, 2, 2, 2}, []uint64{100, 100, 100, 100}, []uint64{1, 2, 3, 4}, 0, 0, []uint64{98, 96, 94, 92}},
+		{"Masked VADD.VV", encodeVType(0b000000, 0, 2, 1, vectorOPIVV, 3), 2, []uint64{1, 1, 1, 1}, []uint64{10, 20, 30, 40}, []uint64{7, 7, 7, 7}, 0b0101, 0, []uint64{11, 7, 31, 7}},
+		{"VMERGE.VXM", encodeVType(0b010111, 0, 2, 1, vectorOPIVX, 3), 2, nil, []uint64{10, 20, 30, 40}, nil, 0b1001, 9, []uint64{9, 20, 30, 9}},
+		{"VMV.V.I", encodeVType(0b010111, 1, 0, 0b10000, vectorOPIVI, 3), 1, nil, nil, nil, 0, 0, []uint64{0xFFF0, 0xFFF0, 0xFFF0, 0xFFF0}},
+		{"VADC.VVM", encodeVType(0b010000, 0, 2, 1, vectorOPIVV, 3), 0, []uint64{1, 1, 1, 1}, []uint64{10, 20, 30, 0xFF}, nil, 0b0101, 0, []uint64{12, 21, 32, 0}},
+		{"VADC.VIM", encodeVType(0b010000, 0, 2, 0b11111, vectorOPIVI, 3), 2, nil, []uint64{10, 0, 1, 5}, nil, 0b0011, 0, []uint64{10, 0, 0, 4}},
+		{"VSBC.VXM", encodeVType(0b010010, 0, 2, 1, vectorOPIVX, 3), 0, nil, []uint64{10, 0, 5, 7}, nil, 0b0011, 5, []uint64{4, 0xFA, 0, 2}},
+		{"VREDSUM.VS", encodeVType(0b000000, 1, 2, 1, vectorOPMVV, 3), 2, []uint64{100}, []uint64{1, 2, 3, 4}, nil, 0, 0, []uint64{110}},
+		{"VREDMAX.VS", encodeVType(0b000111, 1, 2, 1, vectorOPMVV, 3), 2, []uint64{0xFFFFFFFF}, []uint64{0xFFFFFFF0, 0xFFFFFFFE, 0x80000000, 0xFFFFFFFA}, nil, 0, 0, []uint64{0xFFFFFFFF}},
+		{"Masked VREDMINU.VS", encodeVType(0b000100, 0, 2, 1, vectorOPMVV, 3), 2, []uint64{50}, []uint64{1, 20, 3, 40}, nil, 0b1010, 0, []uint64{20}},
+		{"VID.V", encodeVType(0b010100, 1, 0, 0b10001, vectorOPMVV, 3), 1, nil, nil, nil, 0, 0, []uint64{0, 1, 2, 3}},
+		{"VIOTA.M", encodeVType(0b010100, 1, 2, 0b10000, vectorOPMVV, 3), 2, nil, []uint64{0b1011}, nil, 0, 0, []uint64{0, 1, 2, 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cpu CPUState
+			var memory Memory
+
+			initMemory(&memory, 64, 0)
+			initCPUState(&cpu, 0, 0)
+			sew := uint32(8 << test.vsew)
+			setVectorConfiguration(&cpu, 0, 4, false, test.vsew<<3)
+			for i, value := range test.vs1 {
+				writeElement(&cpu, 1, uint64(i), sew, value)
+			}
+			for i, value := range test.vs2 {
+				writeElement(&cpu, 2, uint64(i), sew, value)
+			}
+			for i, value := range test.vd {
+				writeElement(&cpu, 3, uint64(i), sew, value)
+			}
+			cpu.v[0] = test.mask
+			writeRegister(&cpu, 1, test.x1)
+			executeVector(&cpu, &memory, test.instruction)
+
+			if cpu.trapped {
+				t.Fatalf("unexpected trap, mcause=%d", cpu.csr[csrMcause])
+			}
+			for i, expected := range test.expected {
+				if got := readElement(&cpu, 3, uint64(i), sew); got != expected {
+					t.Errorf("element %d: expected 0x%x, got 0x%x", i, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestVectorMask(t *testing.T) {
+	tests := []struct {
+		name        string
+		instruction uint32
+		vs1         []uint64
+		vs2         []uint64
+		x1          uint64
+		expectedV3  byte
+		expectedX3  uint64
+	}{
+		{"VMSEQ.VV", encodeVType(0b011000, 1, 2, 1, vectorOPIVV, 3), []uint64{1, 2, 3, 4}, []uint64{1, 0, 3, 0}, 0, 0b0101, 0},
+		{"VMSLT.VX", encodeVType(0b011011, 1, 2, 1, vectorOPIVX, 3), nil, []uint64{0xFF, 1, 2, 0x80}, 1, 0b1001, 0},
+		{"VMSGTU.VI", encodeVType(0b011110, 1, 2, 1, vectorOPIVI, 3), nil, []uint64{0xFF, 1, 2, 0}, 0, 0b0101, 0},
+		{"VMAND.MM", encodeVType(0b011001, 1, 2, 1, vectorOPMVV, 3), []uint64{0b0110}, []uint64{0b1100}, 0, 0b0100, 0},
+		{"VMXNOR.MM", encodeVType(0b011111, 1, 2, 1, vectorOPMVV, 3), []uint64{0b0110}, []uint64{0b1100}, 0, 0b0101, 0},
+		{"VMSBF.M", encodeVType(0b010100, 1, 2, 0b00001, vectorOPMVV, 3), nil, []uint64{0b0100}, 0, 0b0011, 0},
+		{"VMSIF.M", encodeVType(0b010100, 1, 2, 0b00011, vectorOPMVV, 3), nil, []uint64{0b0100}, 0, 0b0111, 0},
+		{"VMSOF.M", encodeVType(0b010100, 1, 2, 0b00010, vectorOPMVV, 3), nil, []uint64{0b1100}, 0, 0b0100, 0},
+		{"VCPOP.M", encodeVType(0b010000, 1, 2, 0b10000, vectorOPMVV, 3), nil, []uint64{0b11111011}, 0, 0, 3},
+		{"VFIRST.M", encodeVType(0b010000, 1, 2, 0b10001, vectorOPMVV, 3), nil, []uint64{0b1000}, 0, 0, 3},
+		{"VFIRST.M without set bit", encodeVType(0b010000, 1, 2, 0b10001, vectorOPMVV, 3), nil, []uint64{0b11110000}, 0, 0, 0xFFFFFFFFFFFFFFFF},
+		{"VMV.X.S", encodeVType(0b010000, 1, 2, 0b00000, vectorOPMVV, 3), nil, []uint64{0x80}, 0, 0, 0xFFFFFFFFFFFFFF80},
+		{"VMADC.VV", encodeVType(0b010001, 1, 2, 1, vectorOPIVV, 3), []uint64{1, 0xFF, 0x80, 0}, []uint64{0xFF, 0xFF, 0x80, 0}, 0, 0b0111, 0},
+		{"VMSBC.VX", encodeVType(0b010011, 1, 2, 1, vectorOPIVX, 3), nil, []uint64{4, 5, 6, 0}, 5, 0b1001, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cpu CPUState
+			var memory Memory
+
+			initMemory(&memory, 64, 0)
+			initCPUState(&cpu, 0, 0)
+			setVectorConfiguration(&cpu, 0, 4, false, 0) // e8 m1, vl = 4
+			for i, value := range test.vs1 {
+				writeElement(&cpu, 1, uint64(i), 8, value)
+			}
+			for i, value := range test.vs2 {
+				writeElement(&cpu, 2, uint64(i), 8, value)
+			}
+			cpu.v[3*cpu.vlen/8] = 0xF0 // The bits past vl are left undisturbed
+			writeRegister(&cpu, 1, test.x1)
+			executeVector(&cpu, &memory, test.instruction)
+
+			if cpu.trapped {
+				t.Fatalf("unexpected trap, mcause=%d", cpu.csr[csrMcause])
+			}
+			if test.expectedX3 != 0 {
+				if cpu.x[3] != test.expectedX3 {
+					t.Errorf("expected x3=0x%x, got x3=0x%x", test.expectedX3, cpu.x[3])
+				}
+			} else if got := cpu.v[3*cpu.vlen/8]; got != 0xF0|test.expectedV3 {
+				t.Errorf("expected v3=0b%08b, got v3=0b%08b", 0xF0|test.expectedV3, got)
+			}
+		})
+	}
+}
+
+func TestVectorWidthConversions(t *testing.T) {
+	tests := []struct {
+		name        string
+		instruction uint32 // vd = v4, vs2 = v2, vs1 = v1
+		vsew        uint64
+		vs1Width    uint32 // Element widths in bits
+		vs1         []uint64
+		vs2Width    uint32
+		vs2         []uint64
+		vdWidth     uint32
+		vd          []uint64
+		mask        byte
+		x1          uint64
+		expected    []uint64
+	}{
+		// Widening add and subtract
+		{"VWADDU.VV", encodeVType(0b110000, 1, 2, 1, vectorOPMVV, 4), 0, 8, []uint64{0xFF, 1, 2, 3}, 8, []uint64{0xFF, 0xFF, 0, 0}, 16, nil, 0, 0, []uint64{0x1FE, 0x100, 2, 3}},
+		{"VWADD.VX", encodeVType(0b110001, 1, 2, 1, vectorOPMVX, 4), 0, 8, nil, 8, []uint64{0x80, 1, 0x7F, 0}, 16, nil, 0, 0xFF, []uint64{0xFF7F, 0, 0x7E, 0xFFFF}},
+		{"VWSUBU.WV", encodeVType(0b110110, 1, 2, 1, vectorOPMVV, 4), 0, 8, []uint64{1, 1, 5, 0xFF}, 16, []uint64{0x100, 0, 5, 0xFFFF}, 16, nil, 0, 0, []uint64{0xFF, 0xFFFF, 0, 0xFF00}},
+		{"VWSUB.WX", encodeVType(0b110111, 1, 2, 1, vectorOPMVX, 4), 1, 16, nil, 32, []uint64{0, 10, 0x10000, 5}, 32, nil, 0, 0xFFFF, []uint64{1, 11, 0x10001, 6}},
+		{"Masked VWADDU.WX", encodeVType(0b110100, 0, 2, 1, vectorOPMVX, 4), 0, 8, nil, 16, []uint64{0xFFFF, 1, 2, 3}, 16, []uint64{7, 7, 7, 7}, 0b1001, 1, []uint64{0, 7, 7, 4}},
+		// Widening multiply and multiply-add
+		{"VWMUL.VV", encodeVType(0b111011, 1, 2, 1, vectorOPMVV, 4), 1, 16, []uint64{0xFFFF, 2, 0x8000, 3}, 16, []uint64{0xFFFF, 0x7FFF, 0x8000, 0xFFFE}, 32, nil, 0, 0, []uint64{1, 0xFFFE, 0x40000000, 0xFFFFFFFA}},
+		{"VWMULU.VX", encodeVType(0b111000, 1, 2, 1, vectorOPMVX, 4), 2, 32, nil, 32, []uint64{0xFFFFFFFF, 2, 0, 1}, 64, nil, 0, 0xFFFFFFFF, []uint64{0xFFFFFFFE00000001, 0x1FFFFFFFE, 0, 0xFFFFFFFF}},
+		{"VWMULSU.VV", encodeVType(0b111010, 1, 2, 1, vectorOPMVV, 4), 0, 8, []uint64{0xFF, 0x80}, 8, []uint64{0xFF, 2}, 16, nil, 0, 0, []uint64{0xFF01, 0x100}},
+		{"VWMACC.VX", encodeVType(0b111101, 1, 2, 1, vectorOPMVX, 4), 0, 8, nil, 8, []uint64{3, 0xFF, 0, 0}, 16, []uint64{100, 100, 0, 1}, 0, 0xFE, []uint64{94, 102, 0, 1}},
+		{"VWMACCU.VV", encodeVType(0b111100, 1, 2, 1, vectorOPMVV, 4), 0, 8, []uint64{0xFF, 2}, 8, []uint64{0xFF, 3}, 16, []uint64{1, 0xFFFF}, 0, 0, []uint64{0xFE02, 5}},
+		{"VWMACCUS.VX", encodeVType(0b111110, 1, 2, 1, vectorOPMVX, 4), 0, 8, nil, 8, []uint64{0xFF, 1}, 16, nil, 0, 0xFF, []uint64{0xFF01, 0xFF}},
+		{"VWMACCSU.VV", encodeVType(0b111111, 1, 2, 1, vectorOPMVV, 4), 0, 8, []uint64{0xFF, 1}, 8, []uint64{0xFF, 0xFF}, 16, nil, 0, 0, []uint64{0xFF01, 0xFF}},
+		// Narrowing shifts
+		{"VNSRL.WI", encodeVType(0b101100, 1, 2, 4, vectorOPIVI, 4), 0, 8, nil, 16, []uint64{0x1234, 0xFF00, 0x8000, 0x00FF}, 8, nil, 0, 0, []uint64{0x23, 0xF0, 0x00, 0x0F}},
+		{"VNSRA.WX", encodeVType(0b101101, 1, 2, 1, vectorOPIVX, 4), 0, 8, nil, 16, []uint64{0x8000, 0x7F00, 0xFF00, 0x1234}, 8, nil, 0, 8, []uint64{0x80, 0x7F, 0xFF, 0x12}},
+		{"VNSRA.WV uses log2(2*SEW) bits", encodeVType(0b101101, 1, 2, 1, vectorOPIVV, 4), 0, 8, []uint64{15, 16, 0, 1}, 16, []uint64{0x8000, 0x1234, 0x00FF, 0x0102}, 8, nil, 0, 0, []uint64{0xFF, 0x34, 0xFF, 0x81}},
+		// Integer extensions
+		{"VZEXT.VF2", encodeVType(0b010010, 1, 2, 0b00110, vectorOPMVV, 4), 1, 8, nil, 8, []uint64{0x80, 0xFF, 1, 0}, 16, nil, 0, 0, []uint64{0x80, 0xFF, 1, 0}},
+		{"VSEXT.VF4", encodeVType(0b010010, 1, 2, 0b00101, vectorOPMVV, 4), 2, 8, nil, 8, []uint64{0x80, 0x7F, 0xFF, 0}, 32, nil, 0, 0, []uint64{0xFFFFFF80, 0x7F, 0xFFFFFFFF, 0}},
+		{"VSEXT.VF8", encodeVType(0b010010, 1, 2, 0b00011, vectorOPMVV, 4), 3, 8, nil, 8, []uint64{0xFE, 1}, 64, nil, 0, 0, []uint64{0xFFFFFFFFFFFFFFFE, 1}},
+		// Widening reductions
+		{"VWREDSUMU.VS", encodeVType(0b110000, 1, 2, 1, vectorOPIVV, 4), 0, 16, []uint64{1000}, 8, []uint64{0xFF, 0xFF, 1, 2}, 16, nil, 0, 0, []uint64{1513}},
+		{"Masked VWREDSUM.VS", encodeVType(0b110001, 0, 2, 1, vectorOPIVV, 4), 0, 16, []uint64{0}, 8, []uint64{0xFF, 0x80, 5, 5}, 16, nil, 0b0011, 0, []uint64{0xFF7F}},
+		// Carry out at SEW = 64
+		{"VMADC.VXM", encodeVType(0b010001, 0, 2, 1, vectorOPIVX, 4), 3, 64, nil, 64, []uint64{0xFFFFFFFFFFFFFFFF, 5}, 8, nil, 0b01, 0, []uint64{0b01}},
+		{"VMSBC.VVM", encodeVType(0b010011, 0, 2, 1, vectorOPIVV, 4), 3, 64, []uint64{0, 5}, 64, []uint64{0, 5}, 8, nil, 0b10, 0, []uint64{0b10}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cpu CPUState
+			var memory Memory
+
+			initMemory(&memory, 64, 0)
+			initCPUState(&cpu, 0, 0)
+			setVectorConfiguration(&cpu, 0, 4, false, test.vsew<<3) // m1, vl = min(4, VLMAX)
+			for i, value := range test.vs1 {
+				writeElement(&cpu, 1, uint64(i), test.vs1Width, value)
+			}
+			for i, value := range test.vs2 {
+				writeElement(&cpu, 2, uint64(i), test.vs2Width, value)
+			}
+			for i, value := range test.vd {
+				writeElement(&cpu, 4, uint64(i), test.vdWidth, value)
+			}
+			cpu.v[0] = test.mask
+			writeRegister(&cpu, 1, test.x1)
+			executeVector(&cpu, &memory, test.instruction)
+
+			if cpu.trapped {
+				t.Fatalf("unexpected trap, mcause=%d", cpu.csr[csrMcause])
+			}
+			for i, expected := range test.expected {
+				if got := readElement(&cpu, 4, uint64(i), test.vdWidth); got != expected {
+					t.Errorf("element %d: expected 0x%x, got 0x%x", i, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestVectorLoadStore(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initMemory(&memory, 1024, 0)
+	initCPUState(&cpu, 0, 0)
+	for address := uint32(0x40); address < 0x60; address += 4 {
+		memory.Store32(address, 0x03020100+0x04040404*((address-0x40)/4))
+	}
+	writeRegister(&cpu, 1, 0x40)
+	writeRegister(&cpu, 2, 3)
+	writeRegister(&cpu, 4, 0x80)
+
+	// VSETIVLI x0, 4, e32 m1
+	executeVector(&cpu, &memory, 0b11_0000_010_000<<20|4<<15|0b111<<12|0b1010111)
+
+	executeVector(&cpu, &memory, 0b0000111|3<<7|0b110<<12|1<<15|1<<25) // VLE32.V v3, (x1)
+	for i, expected := range []uint64{0x03020100, 0x07060504, 0x0B0A0908, 0x0F0E0D0C} {
+		if got := readElement(&cpu, 3, uint64(i), 32); got != expected {
+			t.Errorf("VLE32.V element %d: expected 0x%x, got 0x%x", i, expected, got)
+		}
+	}
+
+	executeVector(&cpu, &memory, 0b0100111|3<<7|0b110<<12|4<<15|1<<25) // VSE32.V v3, (x4)
+	if got := memory.Load32(0x8C); got != 0x0F0E0D0C {
+		t.Errorf("VSE32.V: expected 0x0F0E0D0C at 0x8C, got 0x%x", got)
+	}
+
+	executeVector(&cpu, &memory, 0b0000111|5<<7|0b000<<12|1<<15|2<<20|1<<25|vectorStrided<<26) // VLSE8.V v5, (x1), x2
+	for i, expected := range []uint64{0, 3, 6, 9} {
+		if got := readElement(&cpu, 5, uint64(i), 8); got != expected {
+			t.Errorf("VLSE8.V element %d: expected %d, got %d", i, expected, got)
+		}
+	}
+
+	writeRegister(&cpu, 4, 0xA0)
+	executeVector(&cpu, &memory, 0b0100111|5<<7|0b000<<12|4<<15|2<<20|1<<25|vectorStrided<<26) // VSSE8.V v5, (x4), x2
+	if got := memory.Load32(0xA4); got != 0x00060000 {
+		t.Errorf("VSSE8.V: expected 0x00060000 at 0xA4, got 0x%x", got)
+	}
+
+	writeRegister(&cpu, 1, 0x45)
+	executeVector(&cpu, &memory, 0b0000111|0<<7|0b000<<12|1<<15|vectorMaskAccess<<20|1<<25) // VLM.V v0, (x1)
+	if cpu.v[0] != 0x05 || cpu.v[1] != 0x00 {
+		// vl = 4 loads a single byte, the bytes past it are left undisturbed
+		t.Errorf("VLM.V: expected v0=0x0005, got 0x%02x%02x", cpu.v[1], cpu.v[0])
+	}
+
+	if cpu.csr[csrMstatus]&mstatusVS != mstatusVSDirty {
+		t.Errorf("expected VS=Dirty after the vector instructions, got mstatus=0x%x", cpu.csr[csrMstatus])
+	}
+}
+
+func TestVectorFaults(t *testing.T) {
+	var cpu CPUState
+	var memory Memory
+
+	initMemory(&memory, 256, 0)
+	initCPUState(&cpu, 0, 0)
+	cpu.csr[csrMtvec] = 0x20
+	setVectorConfiguration(&cpu, 0, 4, false, 0b010_000) // e32 m1
+
+	// The last element is past the end of memory (256 bytes): vstart holds its index
+	writeRegister(&cpu, 1, 0xF4)
+	executeVector(&cpu, &memory, 0b0000111|3<<7|0b110<<12|1<<15|1<<25) // VLE32.V v3, (x1)
+	if !cpu.trapped || cpu.csr[csrMcause] != causeLoadAccessFault || cpu.csr[csrVstart] != 3 {
+		t.Errorf("expected a load access fault with vstart=3, got mcause=%d vstart=%d", cpu.csr[csrMcause], cpu.csr[csrVstart])
+	}
+
+	tests := []struct {
+		name        string
+		instruction uint32
+		setup       func(cpu *CPUState)
+	}{
+		{"VS Off", encodeVType(0b000000, 1, 2, 1, vectorOPIVV, 3), func(cpu *CPUState) { cpu.csr[csrMstatus] &^= mstatusVS }},
+		{"vill set", encodeVType(0b000000, 1, 2, 1, vectorOPIVV, 3), func(cpu *CPUState) { setVectorConfiguration(cpu, 0, 4, false, 0b100) }},
+		{"Masked write of v0", encodeVType(0b000000, 0, 2, 1, vectorOPIVV, 0), func(cpu *CPUState) {}},
+		{"Misaligned register group", encodeVType(0b000000, 1, 2, 1, vectorOPIVV, 3), func(cpu *CPUState) { setVectorConfiguration(cpu, 0, 4, false, 0b010_001) }},
+		{"Unknown encoding", encodeVType(0b001100, 1, 2, 1, vectorOPIVV, 3), func(cpu *CPUState) {}},
+		{"Widening at SEW = ELEN", encodeVType(0b110001, 1, 2, 1, vectorOPMVV, 4), func(cpu *CPUState) { setVectorConfiguration(cpu, 0, 4, false, 0b011_000) }},
+		{"Widening with LMUL = 8", encodeVType(0b110001, 1, 8, 1, vectorOPMVV, 16), func(cpu *CPUState) { setVectorConfiguration(cpu, 0, 4, false, 0b000_011) }},
+		{"Misaligned widening destination", encodeVType(0b110001, 1, 2, 1, vectorOPMVV, 3), func(cpu *CPUState) {}},
+		{"Unmasked VADC", encodeVType(0b010000, 1, 2, 1, vectorOPIVV, 3), func(cpu *CPUState) {}},
+		{"VADC writing v0", encodeVType(0b010000, 0, 2, 1, vectorOPIVV, 0), func(cpu *CPUState) {}},
+		{"VZEXT.VF8 at SEW = 32", encodeVType(0b010010, 1, 2, 0b00010, vectorOPMVV, 3), func(cpu *CPUState) {}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initCPUState(&cpu, 0, 0)
+			cpu.csr[csrMtvec] = 0x20
+			setVectorConfiguration(&cpu, 0, 4, false, 0b010_000)
+			test.setup(&cpu)
+			executeVector(&cpu, &memory, test.instruction)
+			if !cpu.trapped || cpu.csr[csrMcause] != causeIllegalInstruction {
+				t.Errorf("expected an illegal instruction exception, got trapped=%v mcause=%d", cpu.trapped, cpu.csr[csrMcause])
+			}
+		})
+	}
+}